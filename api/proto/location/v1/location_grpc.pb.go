@@ -0,0 +1,412 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: location/v1/location.proto
+
+package locationv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LocationService_CreateLocation_FullMethodName   = "/location.v1.LocationService/CreateLocation"
+	LocationService_GetLocation_FullMethodName      = "/location.v1.LocationService/GetLocation"
+	LocationService_ListLocations_FullMethodName    = "/location.v1.LocationService/ListLocations"
+	LocationService_StreamLocations_FullMethodName  = "/location.v1.LocationService/StreamLocations"
+	LocationService_DeleteLocation_FullMethodName   = "/location.v1.LocationService/DeleteLocation"
+	LocationService_FindNearest_FullMethodName      = "/location.v1.LocationService/FindNearest"
+	LocationService_FindKNearest_FullMethodName     = "/location.v1.LocationService/FindKNearest"
+	LocationService_FindWithinRadius_FullMethodName = "/location.v1.LocationService/FindWithinRadius"
+)
+
+// LocationServiceClient is the client API for LocationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// LocationService mirrors the REST /locations endpoints for internal callers.
+type LocationServiceClient interface {
+	// CreateLocation registers a new station. Fails with ALREADY_EXISTS if the name is taken.
+	CreateLocation(ctx context.Context, in *CreateLocationRequest, opts ...grpc.CallOption) (*Location, error)
+	// GetLocation returns a station by name.
+	GetLocation(ctx context.Context, in *GetLocationRequest, opts ...grpc.CallOption) (*Location, error)
+	// ListLocations returns stations in ID order, one page at a time.
+	ListLocations(ctx context.Context, in *ListLocationsRequest, opts ...grpc.CallOption) (*ListLocationsResponse, error)
+	// StreamLocations streams every station in ID order.
+	StreamLocations(ctx context.Context, in *StreamLocationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Location], error)
+	// DeleteLocation removes a station by name.
+	DeleteLocation(ctx context.Context, in *DeleteLocationRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// FindNearest returns the station closest to a point.
+	FindNearest(ctx context.Context, in *FindNearestRequest, opts ...grpc.CallOption) (*NearestMatch, error)
+	// FindKNearest returns the k stations closest to a point, nearest first.
+	FindKNearest(ctx context.Context, in *FindKNearestRequest, opts ...grpc.CallOption) (*FindKNearestResponse, error)
+	// FindWithinRadius returns every station within a radius of a point, nearest first.
+	FindWithinRadius(ctx context.Context, in *FindWithinRadiusRequest, opts ...grpc.CallOption) (*FindWithinRadiusResponse, error)
+}
+
+type locationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLocationServiceClient(cc grpc.ClientConnInterface) LocationServiceClient {
+	return &locationServiceClient{cc}
+}
+
+func (c *locationServiceClient) CreateLocation(ctx context.Context, in *CreateLocationRequest, opts ...grpc.CallOption) (*Location, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Location)
+	err := c.cc.Invoke(ctx, LocationService_CreateLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationServiceClient) GetLocation(ctx context.Context, in *GetLocationRequest, opts ...grpc.CallOption) (*Location, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Location)
+	err := c.cc.Invoke(ctx, LocationService_GetLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationServiceClient) ListLocations(ctx context.Context, in *ListLocationsRequest, opts ...grpc.CallOption) (*ListLocationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLocationsResponse)
+	err := c.cc.Invoke(ctx, LocationService_ListLocations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationServiceClient) StreamLocations(ctx context.Context, in *StreamLocationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Location], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &LocationService_ServiceDesc.Streams[0], LocationService_StreamLocations_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamLocationsRequest, Location]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LocationService_StreamLocationsClient = grpc.ServerStreamingClient[Location]
+
+func (c *locationServiceClient) DeleteLocation(ctx context.Context, in *DeleteLocationRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, LocationService_DeleteLocation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationServiceClient) FindNearest(ctx context.Context, in *FindNearestRequest, opts ...grpc.CallOption) (*NearestMatch, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NearestMatch)
+	err := c.cc.Invoke(ctx, LocationService_FindNearest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationServiceClient) FindKNearest(ctx context.Context, in *FindKNearestRequest, opts ...grpc.CallOption) (*FindKNearestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FindKNearestResponse)
+	err := c.cc.Invoke(ctx, LocationService_FindKNearest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *locationServiceClient) FindWithinRadius(ctx context.Context, in *FindWithinRadiusRequest, opts ...grpc.CallOption) (*FindWithinRadiusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FindWithinRadiusResponse)
+	err := c.cc.Invoke(ctx, LocationService_FindWithinRadius_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LocationServiceServer is the server API for LocationService service.
+// All implementations must embed UnimplementedLocationServiceServer
+// for forward compatibility.
+//
+// LocationService mirrors the REST /locations endpoints for internal callers.
+type LocationServiceServer interface {
+	// CreateLocation registers a new station. Fails with ALREADY_EXISTS if the name is taken.
+	CreateLocation(context.Context, *CreateLocationRequest) (*Location, error)
+	// GetLocation returns a station by name.
+	GetLocation(context.Context, *GetLocationRequest) (*Location, error)
+	// ListLocations returns stations in ID order, one page at a time.
+	ListLocations(context.Context, *ListLocationsRequest) (*ListLocationsResponse, error)
+	// StreamLocations streams every station in ID order.
+	StreamLocations(*StreamLocationsRequest, grpc.ServerStreamingServer[Location]) error
+	// DeleteLocation removes a station by name.
+	DeleteLocation(context.Context, *DeleteLocationRequest) (*emptypb.Empty, error)
+	// FindNearest returns the station closest to a point.
+	FindNearest(context.Context, *FindNearestRequest) (*NearestMatch, error)
+	// FindKNearest returns the k stations closest to a point, nearest first.
+	FindKNearest(context.Context, *FindKNearestRequest) (*FindKNearestResponse, error)
+	// FindWithinRadius returns every station within a radius of a point, nearest first.
+	FindWithinRadius(context.Context, *FindWithinRadiusRequest) (*FindWithinRadiusResponse, error)
+	mustEmbedUnimplementedLocationServiceServer()
+}
+
+// UnimplementedLocationServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLocationServiceServer struct{}
+
+func (UnimplementedLocationServiceServer) CreateLocation(context.Context, *CreateLocationRequest) (*Location, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateLocation not implemented")
+}
+func (UnimplementedLocationServiceServer) GetLocation(context.Context, *GetLocationRequest) (*Location, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLocation not implemented")
+}
+func (UnimplementedLocationServiceServer) ListLocations(context.Context, *ListLocationsRequest) (*ListLocationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLocations not implemented")
+}
+func (UnimplementedLocationServiceServer) StreamLocations(*StreamLocationsRequest, grpc.ServerStreamingServer[Location]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLocations not implemented")
+}
+func (UnimplementedLocationServiceServer) DeleteLocation(context.Context, *DeleteLocationRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLocation not implemented")
+}
+func (UnimplementedLocationServiceServer) FindNearest(context.Context, *FindNearestRequest) (*NearestMatch, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindNearest not implemented")
+}
+func (UnimplementedLocationServiceServer) FindKNearest(context.Context, *FindKNearestRequest) (*FindKNearestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindKNearest not implemented")
+}
+func (UnimplementedLocationServiceServer) FindWithinRadius(context.Context, *FindWithinRadiusRequest) (*FindWithinRadiusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindWithinRadius not implemented")
+}
+func (UnimplementedLocationServiceServer) mustEmbedUnimplementedLocationServiceServer() {}
+func (UnimplementedLocationServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafeLocationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LocationServiceServer will
+// result in compilation errors.
+type UnsafeLocationServiceServer interface {
+	mustEmbedUnimplementedLocationServiceServer()
+}
+
+func RegisterLocationServiceServer(s grpc.ServiceRegistrar, srv LocationServiceServer) {
+	// If the following call pancis, it indicates UnimplementedLocationServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LocationService_ServiceDesc, srv)
+}
+
+func _LocationService_CreateLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateLocationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).CreateLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_CreateLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).CreateLocation(ctx, req.(*CreateLocationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationService_GetLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLocationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).GetLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_GetLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).GetLocation(ctx, req.(*GetLocationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationService_ListLocations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLocationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).ListLocations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_ListLocations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).ListLocations(ctx, req.(*ListLocationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationService_StreamLocations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLocationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LocationServiceServer).StreamLocations(m, &grpc.GenericServerStream[StreamLocationsRequest, Location]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type LocationService_StreamLocationsServer = grpc.ServerStreamingServer[Location]
+
+func _LocationService_DeleteLocation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLocationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).DeleteLocation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_DeleteLocation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).DeleteLocation(ctx, req.(*DeleteLocationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationService_FindNearest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindNearestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).FindNearest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_FindNearest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).FindNearest(ctx, req.(*FindNearestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationService_FindKNearest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindKNearestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).FindKNearest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_FindKNearest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).FindKNearest(ctx, req.(*FindKNearestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LocationService_FindWithinRadius_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindWithinRadiusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LocationServiceServer).FindWithinRadius(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LocationService_FindWithinRadius_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LocationServiceServer).FindWithinRadius(ctx, req.(*FindWithinRadiusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LocationService_ServiceDesc is the grpc.ServiceDesc for LocationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LocationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "location.v1.LocationService",
+	HandlerType: (*LocationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateLocation",
+			Handler:    _LocationService_CreateLocation_Handler,
+		},
+		{
+			MethodName: "GetLocation",
+			Handler:    _LocationService_GetLocation_Handler,
+		},
+		{
+			MethodName: "ListLocations",
+			Handler:    _LocationService_ListLocations_Handler,
+		},
+		{
+			MethodName: "DeleteLocation",
+			Handler:    _LocationService_DeleteLocation_Handler,
+		},
+		{
+			MethodName: "FindNearest",
+			Handler:    _LocationService_FindNearest_Handler,
+		},
+		{
+			MethodName: "FindKNearest",
+			Handler:    _LocationService_FindKNearest_Handler,
+		},
+		{
+			MethodName: "FindWithinRadius",
+			Handler:    _LocationService_FindWithinRadius_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLocations",
+			Handler:       _LocationService_StreamLocations_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "location/v1/location.proto",
+}
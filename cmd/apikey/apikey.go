@@ -0,0 +1,170 @@
+package apikey
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/youngprinnce/geolocation-service/config"
+	"github.com/youngprinnce/geolocation-service/internal/app/manualwire"
+	"github.com/youngprinnce/geolocation-service/internal/postgres"
+	keys "github.com/youngprinnce/geolocation-service/internal/service/apikey"
+	"gorm.io/gorm"
+)
+
+// connectFunc opens the key service of the database named by the command's configuration
+type connectFunc func(cmd *cobra.Command) (keys.APIKeyBC, error)
+
+// APIKeyCmd manages the API keys in the database of the server
+func APIKeyCmd() *cobra.Command {
+	return newAPIKeyCmd(connect)
+}
+
+func newAPIKeyCmd(connect connectFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys",
+		Long: `Create, list and revoke the API keys accepted by the server.
+
+The commands connect to the database of the configuration file. Keys grant the
+read, write or admin scope; each includes the ones before it.`,
+	}
+
+	cmd.AddCommand(createCmd(connect), listCmd(connect), revokeCmd(connect))
+	return cmd
+}
+
+func createCmd(connect connectFunc) *cobra.Command {
+	var (
+		name    string
+		scopes  []string
+		expires time.Duration
+		tenant  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key and print it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := connect(cmd)
+			if err != nil {
+				return err
+			}
+
+			created, err := service.CreateKey(keys.CreateKeyRequest{Name: name, Scopes: scopes, TTL: expires, Tenant: tenant})
+			if err != nil {
+				return err
+			}
+
+			cmd.PrintErrf("Created key %d (%s). Store it now, it cannot be shown again.\n", created.ID, created.Prefix)
+			fmt.Fprintln(cmd.OutOrStdout(), created.Key)
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&name, "name", "", "name describing the holder of the key")
+	flags.StringSliceVar(&scopes, "scopes", []string{"read"}, "scopes to grant: read, write and/or admin")
+	flags.DurationVar(&expires, "expires", 0, "time until the key expires, e.g. 720h; 0 never expires")
+	flags.StringVar(&tenant, "tenant", "", "tenant the key is bound to; unbound keys act for the default tenant")
+	_ = cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+func listCmd(connect connectFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			service, err := connect(cmd)
+			if err != nil {
+				return err
+			}
+
+			list, err := service.ListKeys()
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(writer, "ID\tNAME\tPREFIX\tSCOPES\tTENANT\tSTATUS\tCREATED\tEXPIRES\tLAST USED")
+			for _, key := range list {
+				fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					key.ID, key.Name, key.Prefix, strings.Join(key.Scopes, ","), orDash(key.Tenant), status(key, now),
+					formatTime(&key.CreatedAt), formatTime(key.ExpiresAt), formatTime(key.LastUsedAt))
+			}
+			return writer.Flush()
+		},
+	}
+}
+
+func revokeCmd(connect connectFunc) *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke ID",
+		Short: "Revoke an API key so it is no longer accepted",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid key ID %q", args[0])
+			}
+
+			service, err := connect(cmd)
+			if err != nil {
+				return err
+			}
+
+			revoked, err := service.RevokeKey(uint(id))
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("key %d does not exist", id)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked key %d (%s)\n", revoked.ID, revoked.Name)
+			return nil
+		},
+	}
+}
+
+// connect opens the database of the configuration file, running its migrations
+func connect(cmd *cobra.Command) (keys.APIKeyBC, error) {
+	configFile, _ := cmd.Flags().GetString("config")
+	conf := config.LoadConfig(configFile)
+	if err := postgres.Load(conf); err != nil {
+		return nil, err
+	}
+	return manualwire.GetAPIKeyService(), nil
+}
+
+func status(key keys.APIKey, now time.Time) string {
+	switch {
+	case key.RevokedAt != nil:
+		return "revoked"
+	case !key.Active(now):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,93 @@
+package apikey
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	keys "github.com/youngprinnce/geolocation-service/internal/service/apikey"
+	"gorm.io/gorm"
+)
+
+// fakeService records the requests of the commands
+type fakeService struct {
+	created keys.CreateKeyRequest
+	list    []keys.APIKey
+	revoked uint
+}
+
+func (f *fakeService) CreateKey(req keys.CreateKeyRequest) (*keys.CreatedKey, error) {
+	f.created = req
+	return &keys.CreatedKey{APIKey: keys.APIKey{ID: 7, Prefix: "abc123"}, Key: "gsk_abc123_secret"}, nil
+}
+
+func (f *fakeService) ListKeys() ([]keys.APIKey, error) { return f.list, nil }
+
+func (f *fakeService) RevokeKey(id uint) (*keys.APIKey, error) {
+	if id != 7 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	f.revoked = id
+	return &keys.APIKey{ID: id, Name: "ci"}, nil
+}
+
+func (f *fakeService) Authenticate(string) (*auth.Principal, error) { return nil, keys.ErrInvalidKey }
+
+func execute(t *testing.T, service *fakeService, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := newAPIKeyCmd(func(*cobra.Command) (keys.APIKeyBC, error) { return service, nil })
+	var stdout, stderr bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestCreate(t *testing.T) {
+	service := &fakeService{}
+
+	out, errOut, err := execute(t, service, "create", "--name", "ci", "--scopes", "read,write", "--expires", "720h", "--tenant", "acme")
+	require.NoError(t, err)
+	assert.Equal(t, "gsk_abc123_secret\n", out, "only the key goes to stdout so it can be captured")
+	assert.Contains(t, errOut, "cannot be shown again")
+	assert.Equal(t, keys.CreateKeyRequest{Name: "ci", Scopes: []string{"read", "write"}, TTL: 720 * time.Hour, Tenant: "acme"}, service.created)
+
+	_, _, err = execute(t, service, "create")
+	assert.ErrorContains(t, err, "required flag")
+}
+
+func TestListAndRevoke(t *testing.T) {
+	created := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	expired := created.Add(time.Hour)
+	service := &fakeService{list: []keys.APIKey{
+		{ID: 1, Name: "ci", Prefix: "aaa", Scopes: []string{"read", "write"}, CreatedAt: created},
+		{ID: 2, Name: "old", Prefix: "bbb", Scopes: []string{"admin"}, CreatedAt: created, ExpiresAt: &expired},
+		{ID: 3, Name: "gone", Prefix: "ccc", Scopes: []string{"read"}, CreatedAt: created, RevokedAt: &expired},
+	}}
+
+	out, _, err := execute(t, service, "list")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "LAST USED")
+	assert.Contains(t, lines[1], "read,write")
+	assert.Contains(t, lines[1], "active")
+	assert.Contains(t, lines[2], "expired")
+	assert.Contains(t, lines[3], "revoked")
+
+	out, _, err = execute(t, service, "revoke", "7")
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), service.revoked)
+	assert.Equal(t, "Revoked key 7 (ci)\n", out)
+
+	_, _, err = execute(t, service, "revoke", "8")
+	assert.ErrorContains(t, err, "key 8 does not exist")
+	_, _, err = execute(t, service, "revoke", "abc")
+	assert.ErrorContains(t, err, "invalid key ID")
+}
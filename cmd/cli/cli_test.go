@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/pkg/client"
+)
+
+// request is what the stub server saw of the last request
+type request struct {
+	method, path, query, apiKey, auth string
+	body                              map[string]interface{}
+}
+
+func newStubServer(t *testing.T) (*httptest.Server, *request) {
+	t.Helper()
+	seen := &request{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*seen = request{
+			method: r.Method,
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			apiKey: r.Header.Get(client.APIKeyHeader),
+			auth:   r.Header.Get("Authorization"),
+		}
+		_ = json.NewDecoder(r.Body).Decode(&seen.body)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/locations":
+			if r.URL.Query().Get("cursor") == "" {
+				w.Header().Set("Link", `</locations?cursor=next>; rel="next"`)
+				_, _ = w.Write([]byte(`[{"uuid":"u1","name":"Depot, North","latitude":1.5,"longitude":2,"category":"depot"}]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[{"uuid":"u2","name":"Yard","latitude":3,"longitude":4}]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/locations":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"uuid":"u3","name":"New","latitude":5,"longitude":6}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/locations/nearest":
+			_, _ = w.Write([]byte(`{"location":{"uuid":"u1","name":"Depot","latitude":1.5,"longitude":2},"distance_km":1.23456}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/locations/Missing":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"status":404,"title":"Not Found","code":"not_found","detail":"The requested resource was not found","request_id":"r1"}`))
+		case r.Method == http.MethodDelete:
+			_, _ = w.Write([]byte(`{"message":"Location deleted successfully"}`))
+		default:
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts, seen
+}
+
+// isolate keeps the tests from reading the environment or profiles of the machine
+func isolate(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{EnvServer, EnvAPIKey, EnvToken, EnvProfile, EnvProfiles} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+}
+
+func execute(t *testing.T, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := LocationsCmd()
+	var stdout, stderr bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return stdout.String(), stderr.String(), err
+}
+
+func TestListFormats(t *testing.T) {
+	isolate(t)
+	ts, seen := newStubServer(t)
+
+	out, errOut, err := execute(t, "list", "--server", ts.URL, "--limit", "1", "--sort", "-name")
+	require.NoError(t, err)
+	assert.Equal(t, "limit=1&sort=-name", seen.query)
+	assert.Equal(t, "UUID  NAME          LATITUDE  LONGITUDE  CATEGORY\nu1    Depot, North  1.5       2          depot\n", out)
+	assert.Contains(t, errOut, "--cursor next")
+
+	out, _, err = execute(t, "list", "--server", ts.URL, "-o", "csv", "--all")
+	require.NoError(t, err)
+	assert.Equal(t, "UUID,NAME,LATITUDE,LONGITUDE,CATEGORY\nu1,\"Depot, North\",1.5,2,depot\nu2,Yard,3,4,\n", out)
+
+	out, _, err = execute(t, "list", "--server", ts.URL, "-o", "json", "--cursor", "next")
+	require.NoError(t, err)
+	var locations []client.Location
+	require.NoError(t, json.Unmarshal([]byte(out), &locations))
+	require.Len(t, locations, 1)
+	assert.Equal(t, "Yard", locations[0].Name)
+
+	_, _, err = execute(t, "list", "--server", ts.URL, "-o", "xml")
+	assert.ErrorContains(t, err, "unknown output format")
+}
+
+func TestCreateDeleteNearest(t *testing.T) {
+	isolate(t)
+	ts, seen := newStubServer(t)
+
+	out, _, err := execute(t, "create", "--server", ts.URL, "--name", "New", "--lat", "5", "--lng", "6", "--category", "fuel", "-o", "json")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "New", "latitude": 5.0, "longitude": 6.0, "category": "fuel"}, seen.body)
+	assert.Contains(t, out, `"uuid": "u3"`)
+
+	_, _, err = execute(t, "create", "--server", ts.URL, "--name", "New")
+	assert.ErrorContains(t, err, "required flag")
+
+	out, _, err = execute(t, "nearest", "--server", ts.URL, "--lat", "1.5", "--lng", "2.25")
+	require.NoError(t, err)
+	assert.Equal(t, "lat=1.5&lng=2.25", seen.query)
+	assert.Contains(t, out, "DISTANCE_KM")
+	assert.Contains(t, out, "1.235")
+
+	out, _, err = execute(t, "delete", "--server", ts.URL, "--uuid", "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "/locations/id/u1", seen.path)
+	assert.Equal(t, "DELETED\nu1\n", out)
+
+	_, _, err = execute(t, "delete", "--server", ts.URL, "Missing")
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, client.CodeNotFound, apiErr.Code)
+	assert.Contains(t, err.Error(), "request r1")
+}
+
+func TestConnectionPrecedence(t *testing.T) {
+	isolate(t)
+	ts, seen := newStubServer(t)
+
+	profiles := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(profiles, []byte(strings.Join([]string{
+		"default: staging",
+		"profiles:",
+		"  staging:",
+		"    server: " + ts.URL,
+		"    api_key: profile-key",
+		"  broken:",
+		"    server: http://127.0.0.1:1",
+	}, "\n")), 0o600))
+	t.Setenv(EnvProfiles, profiles)
+
+	// The default profile supplies the server and key
+	_, _, err := execute(t, "list")
+	require.NoError(t, err)
+	assert.Equal(t, "profile-key", seen.apiKey)
+
+	// Environment variables override the profile, flags override both
+	t.Setenv(EnvAPIKey, "env-key")
+	t.Setenv(EnvToken, "env-token")
+	_, _, err = execute(t, "list")
+	require.NoError(t, err)
+	assert.Equal(t, "env-key", seen.apiKey)
+	assert.Equal(t, "Bearer env-token", seen.auth)
+
+	_, _, err = execute(t, "list", "--api-key", "flag-key")
+	require.NoError(t, err)
+	assert.Equal(t, "flag-key", seen.apiKey)
+
+	t.Setenv(EnvProfile, "broken")
+	_, _, err = execute(t, "list", "--server", ts.URL)
+	require.NoError(t, err, "the flag overrides the profile's server")
+
+	_, _, err = execute(t, "list", "--profile", "unknown")
+	assert.ErrorContains(t, err, `profile "unknown" is not defined`)
+}
+
+func TestResolveDefaults(t *testing.T) {
+	isolate(t)
+	cmd := LocationsCmd()
+
+	profile, err := resolveProfile(cmd)
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Server: DefaultServer}, profile)
+
+	require.NoError(t, cmd.ParseFlags([]string{"--" + flagProfiles, filepath.Join(t.TempDir(), "absent.yaml")}))
+	_, err = resolveProfile(cmd)
+	assert.Error(t, err, "an explicitly named profiles file must exist")
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/youngprinnce/geolocation-service/pkg/client"
+)
+
+// LocationsCmd manages the locations of a running server over HTTP
+func LocationsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "locations",
+		Short: "Query and manage the locations of a running server",
+		Long: `Query and manage the locations of a running server over its HTTP API.
+
+The server and credentials come from the --server, --api-key and --token flags,
+then the ` + EnvServer + `, ` + EnvAPIKey + ` and ` + EnvToken + ` environment variables,
+then the selected profile of the profiles file.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			switch format, _ := cmd.Flags().GetString(flagOutput); format {
+			case formatTable, formatJSON, formatCSV:
+				return nil
+			default:
+				return fmt.Errorf("unknown output format %q, expected table, json or csv", format)
+			}
+		},
+	}
+	addConnectionFlags(cmd)
+
+	cmd.AddCommand(listLocationsCmd(), createLocationCmd(), deleteLocationCmd(), nearestLocationCmd())
+	return cmd
+}
+
+func listLocationsCmd() *cobra.Command {
+	var (
+		limit  int
+		cursor string
+		sort   string
+		all    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List locations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, func(ctx context.Context, c *client.Client) (table, error) {
+				options := client.ListOptions{Limit: limit, Cursor: cursor, Sort: sort}
+				if all {
+					locations, err := c.AllLocations(ctx, options)
+					return locationTable(locations, nil), err
+				}
+
+				page, err := c.ListLocations(ctx, options)
+				if err != nil {
+					return table{}, err
+				}
+				if page.NextCursor != "" {
+					cmd.PrintErrf("More locations follow; continue with --cursor %s\n", page.NextCursor)
+				}
+				return locationTable(page.Locations, nil), nil
+			})
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.IntVar(&limit, "limit", 0, "page size (server default 100, at most 1000)")
+	flags.StringVar(&cursor, "cursor", "", "continue from a previous page")
+	flags.StringVar(&sort, "sort", "", "sort by id, name, created_at or updated_at; prefix with - to reverse")
+	flags.BoolVar(&all, "all", false, "follow the cursor through every page")
+	return cmd
+}
+
+func createLocationCmd() *cobra.Command {
+	var req client.LocationRequest
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Register a location",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, func(ctx context.Context, c *client.Client) (table, error) {
+				created, err := c.CreateLocation(ctx, req)
+				if err != nil {
+					return table{}, err
+				}
+				t := locationTable([]client.Location{*created}, nil)
+				t.value = created
+				return t, nil
+			})
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.Name, "name", "", "unique name")
+	flags.Float64Var(&req.Latitude, "lat", 0, "latitude")
+	flags.Float64Var(&req.Longitude, "lng", 0, "longitude")
+	flags.StringVar(&req.Category, "category", "", "category, such as fuel or depot")
+	flags.Float64Var(&req.RadiusMeters, "radius", 0, "radius in meters that counts as being at the location")
+	for _, name := range []string{"name", "lat", "lng"} {
+		_ = cmd.MarkFlagRequired(name)
+	}
+	return cmd
+}
+
+func deleteLocationCmd() *cobra.Command {
+	var byUUID bool
+
+	cmd := &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Delete a location by name, or by UUID with --uuid",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, func(ctx context.Context, c *client.Client) (table, error) {
+				var err error
+				if byUUID {
+					err = c.DeleteLocation(ctx, args[0])
+				} else {
+					err = c.DeleteLocationByName(ctx, args[0])
+				}
+				if err != nil {
+					return table{}, err
+				}
+				return table{
+					header: []string{"DELETED"},
+					rows:   [][]string{{args[0]}},
+					value:  map[string]string{"deleted": args[0]},
+				}, nil
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&byUUID, "uuid", false, "treat the argument as the location's UUID")
+	return cmd
+}
+
+func nearestLocationCmd() *cobra.Command {
+	var lat, lng float64
+
+	cmd := &cobra.Command{
+		Use:   "nearest",
+		Short: "Find the location nearest to a point",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, func(ctx context.Context, c *client.Client) (table, error) {
+				nearest, err := c.NearestLocation(ctx, lat, lng)
+				if err != nil {
+					return table{}, err
+				}
+				t := locationTable([]client.Location{nearest.Location}, []float64{nearest.DistanceKm})
+				t.value = nearest
+				return t, nil
+			})
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.Float64Var(&lat, "lat", 0, "latitude")
+	flags.Float64Var(&lng, "lng", 0, "longitude")
+	_ = cmd.MarkFlagRequired("lat")
+	_ = cmd.MarkFlagRequired("lng")
+	return cmd
+}
+
+// run calls the API within the command's time limit and writes the result
+func run(cmd *cobra.Command, call func(ctx context.Context, c *client.Client) (table, error)) error {
+	c, err := newClient(cmd)
+	if err != nil {
+		return err
+	}
+
+	timeout, _ := cmd.Flags().GetDuration(flagTimeout)
+	ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+	defer cancel()
+
+	result, err := call(ctx, c)
+	if err != nil {
+		// The request was well formed, so usage would not help
+		cmd.SilenceUsage = true
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			return fmt.Errorf("server rejected the request: %w", err)
+		}
+		return err
+	}
+
+	format, _ := cmd.Flags().GetString(flagOutput)
+	return result.write(cmd.OutOrStdout(), format)
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/youngprinnce/geolocation-service/pkg/client"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// table is command output that can be rendered in every format
+type table struct {
+	header []string
+	rows   [][]string
+	// value is rendered instead of the rows as JSON
+	value interface{}
+}
+
+// locationTable lists locations, with their distance when distances is not nil
+func locationTable(locations []client.Location, distances []float64) table {
+	t := table{
+		header: []string{"UUID", "NAME", "LATITUDE", "LONGITUDE", "CATEGORY"},
+		value:  locations,
+	}
+	if distances != nil {
+		t.header = append(t.header, "DISTANCE_KM")
+	}
+
+	for i, l := range locations {
+		row := []string{l.UUID, l.Name, formatFloat(l.Latitude), formatFloat(l.Longitude), l.Category}
+		if distances != nil {
+			row = append(row, strconv.FormatFloat(distances[i], 'f', 3, 64))
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+// write renders t to w in format
+func (t table) write(w io.Writer, format string) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t.value)
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(t.header); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(t.rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	case formatTable:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, expected table, json or csv", format)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/youngprinnce/geolocation-service/pkg/client"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultServer is used when no flag, environment variable or profile names a server
+const DefaultServer = "http://localhost:8080"
+
+// Environment variables read by the client commands
+const (
+	EnvServer   = "GEOLOCATION_SERVER"
+	EnvAPIKey   = "GEOLOCATION_API_KEY"
+	EnvToken    = "GEOLOCATION_TOKEN"
+	EnvProfile  = "GEOLOCATION_PROFILE"
+	EnvProfiles = "GEOLOCATION_PROFILES"
+)
+
+// Flags shared by the client commands
+const (
+	flagServer   = "server"
+	flagAPIKey   = "api-key"
+	flagToken    = "token"
+	flagProfile  = "profile"
+	flagProfiles = "profiles"
+	flagOutput   = "output"
+	flagTimeout  = "timeout"
+)
+
+// Profile holds the connection settings of one server
+type Profile struct {
+	Server string `yaml:"server"`
+	APIKey string `yaml:"api_key"`
+	Token  string `yaml:"token"`
+}
+
+// profileFile is the YAML file holding named profiles, for example
+//
+//	default: staging
+//	profiles:
+//	  staging:
+//	    server: https://geo.staging.example.com
+//	    api_key: ...
+type profileFile struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// addConnectionFlags registers the flags selecting the server and credentials
+func addConnectionFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.String(flagServer, "", "server URL (env "+EnvServer+", default "+DefaultServer+")")
+	flags.String(flagAPIKey, "", "API key (env "+EnvAPIKey+")")
+	flags.String(flagToken, "", "bearer token (env "+EnvToken+")")
+	flags.String(flagProfile, "", "profile to use from the profiles file (env "+EnvProfile+")")
+	flags.String(flagProfiles, "", "profiles file (env "+EnvProfiles+", default "+defaultProfilesPath()+")")
+	flags.StringP(flagOutput, "o", formatTable, "output format: table, json or csv")
+	flags.Duration(flagTimeout, 30*time.Second, "time limit of each command")
+}
+
+// resolveProfile combines the connection settings; flags take precedence over
+// environment variables, which take precedence over the profile
+func resolveProfile(cmd *cobra.Command) (Profile, error) {
+	name := setting(cmd, flagProfile, EnvProfile)
+	path := setting(cmd, flagProfiles, EnvProfiles)
+	explicitPath := path != ""
+	if path == "" {
+		path = defaultProfilesPath()
+	}
+
+	var profile Profile
+	file, err := loadProfiles(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicitPath && name == "":
+		// Profiles are optional
+	case err != nil:
+		return profile, err
+	default:
+		if name == "" {
+			name = file.Default
+		}
+		if name != "" {
+			found, ok := file.Profiles[name]
+			if !ok {
+				return profile, fmt.Errorf("profile %q is not defined in %s", name, path)
+			}
+			profile = found
+		}
+	}
+
+	if server := setting(cmd, flagServer, EnvServer); server != "" {
+		profile.Server = server
+	}
+	if apiKey := setting(cmd, flagAPIKey, EnvAPIKey); apiKey != "" {
+		profile.APIKey = apiKey
+	}
+	if token := setting(cmd, flagToken, EnvToken); token != "" {
+		profile.Token = token
+	}
+	if profile.Server == "" {
+		profile.Server = DefaultServer
+	}
+	return profile, nil
+}
+
+// newClient creates an API client from the resolved connection settings
+func newClient(cmd *cobra.Command) (*client.Client, error) {
+	profile, err := resolveProfile(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []client.Option{client.WithUserAgent("geolocation-service-cli")}
+	if profile.APIKey != "" {
+		options = append(options, client.WithAPIKey(profile.APIKey))
+	}
+	if profile.Token != "" {
+		options = append(options, client.WithBearerToken(profile.Token))
+	}
+	return client.New(profile.Server, options...)
+}
+
+func loadProfiles(path string) (*profileFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file profileFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid profiles file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+// setting returns the value of a flag, or of an environment variable when the flag is not set
+func setting(cmd *cobra.Command, flag, env string) string {
+	if value, _ := cmd.Flags().GetString(flag); value != "" {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+func defaultProfilesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "profiles.yaml"
+	}
+	return filepath.Join(dir, "geolocation-service", "profiles.yaml")
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"github.com/spf13/cobra"
+	"github.com/youngprinnce/geolocation-service/cmd/apikey"
+	"github.com/youngprinnce/geolocation-service/cmd/cli"
 	"github.com/youngprinnce/geolocation-service/cmd/server"
 )
 
@@ -9,10 +11,14 @@ var rootCmd = &cobra.Command{
 	Use:   "geolocation-service",
 	Short: "Geolocation Service API",
 	Long:  `A RESTful API for managing geolocated stations and finding nearest locations`,
+	// Execute reports the error once through cobra.CheckErr
+	SilenceErrors: true,
 }
 
 func Execute() {
 	rootCmd.PersistentFlags().StringP("config", "c", "config.yaml", "config filename")
 	rootCmd.AddCommand(server.StartServerCmd())
+	rootCmd.AddCommand(cli.LocationsCmd())
+	rootCmd.AddCommand(apikey.APIKeyCmd())
 	cobra.CheckErr(rootCmd.Execute())
 }
@@ -1,13 +1,19 @@
 package server
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	log "github.com/sirupsen/logrus"
 	"github.com/youngprinnce/geolocation-service/config"
 	"github.com/youngprinnce/geolocation-service/internal/app"
 	"github.com/youngprinnce/geolocation-service/internal/app/manualwire"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/http"
 	"github.com/youngprinnce/geolocation-service/internal/logger"
+	"github.com/youngprinnce/geolocation-service/internal/openapi"
 )
 
 func init() {
@@ -15,31 +21,191 @@ func init() {
 	log.SetFormatter(&log.JSONFormatter{})
 }
 
+// Controllers holds the handlers mounted by NewRouter
+type Controllers struct {
+	Location      *http.LocationController
+	Stream        *http.StreamController
+	NearestSocket *http.NearestSocketController
+	Search        *http.SearchController
+	Geofence      *http.GeofenceController
+	GraphQL       *http.GraphQLController
+	Tracking      *http.TrackingController
+	Webhook       *http.WebhookController
+	Change        *http.ChangeController
+	Route         *http.RouteController
+	Audit         *http.AuditController
+	// Auth guards the routes by scope; nil leaves every route open
+	Auth *http.Authenticator
+	// RateLimit limits the requests of each client; nil lets every request through
+	RateLimit *http.RateLimiter
+}
+
+// Shutdown ends the streams, sockets and long polls held open by the controllers
+func (c Controllers) Shutdown() {
+	if c.Stream != nil {
+		c.Stream.Shutdown()
+	}
+	if c.NearestSocket != nil {
+		c.NearestSocket.Shutdown()
+	}
+	if c.GraphQL != nil {
+		c.GraphQL.Shutdown()
+	}
+	if c.Change != nil {
+		c.Change.Shutdown()
+	}
+}
+
+// RegisterRoutes builds the router of the API server with the controllers wired to the database
 func RegisterRoutes(conf *config.Config) *gin.Engine {
+	return NewRouter(conf, wiredControllers(conf))
+}
+
+// wiredControllers returns the controllers backed by the database
+func wiredControllers(conf *config.Config) Controllers {
+	controllers := Controllers{
+		Location:      manualwire.GetLocationController(),
+		Stream:        manualwire.GetStreamController(),
+		NearestSocket: manualwire.GetNearestSocketController(),
+		Search:        manualwire.GetSearchController(),
+		Geofence:      manualwire.GetGeofenceController(),
+		GraphQL:       manualwire.GetGraphQLController(),
+		Tracking:      manualwire.GetTrackingController(),
+		Webhook:       manualwire.GetWebhookController(),
+		Change:        manualwire.GetChangeController(),
+		Route:         manualwire.GetRouteController(),
+		Audit:         manualwire.GetAuditController(),
+	}
+	if !conf.Auth.Disabled {
+		controllers.Auth = manualwire.GetAuthenticator()
+	} else {
+		logger.Warn("Authentication is disabled, every route is open")
+	}
+	controllers.RateLimit = manualwire.GetRateLimiter()
+	return controllers
+}
+
+// NewRouter mounts every route of the API on a new router. Tests use it to
+// serve the real routes and middleware from in-memory services.
+func NewRouter(conf *config.Config, controllers Controllers) *gin.Engine {
 	binding.Validator = new(app.DefaultValidator)
 
 	router := gin.Default()
 	router.MaxMultipartMemory = 2 << 20 // 2 MiB
+	// Client IPs are only taken from X-Forwarded-For and X-Real-IP when sent by a trusted proxy
+	if err := router.SetTrustedProxies(conf.Server.TrustedProxies); err != nil {
+		logger.Fatal(fmt.Sprintf("Invalid trusted proxies: %v", err))
+	}
 
-	// CORS middleware
-	router.Use(corsMiddleware())
-	router.Use(gin.Recovery())
-	router.Use(errorReporterMiddleware())
+	// Browsers may only call the API from the configured origins
+	cors, err := http.NewCORS(corsOptions(conf.CORS))
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("Invalid CORS configuration: %v", err))
+	}
+	router.Use(cors.Handle())
+	// Errors recorded by handlers, panics included, are answered as application/problem+json
+	router.Use(http.RequestID())
+	router.Use(http.Problems())
+	router.Use(gin.CustomRecovery(http.RecoverProblem))
+	// Changes are audited with the client IP and request ID
+	router.Use(http.AuditOrigin())
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(http.NoRoute)
+	router.NoMethod(http.NoMethod)
+
+	// Credentials are checked on every request; routes then require a scope, except the public ones
+	read, write, admin := scopes(controllers.Auth)
+	if controllers.Auth != nil {
+		router.Use(controllers.Auth.Authenticate(controllers.RateLimit))
+	}
+	// Clients are limited by their credentials once they are known, or else by IP
+	if controllers.RateLimit != nil {
+		router.Use(controllers.RateLimit.Limit())
+	}
+	// Each request acts for the tenant of its credentials
+	router.Use(http.ResolveTenant())
 
 	// Health and info endpoints
 	router.GET("/", func(c *gin.Context) {
 		c.String(200, "Hello!")
 	})
 
-	locationController := manualwire.GetLocationController()
+	// API documentation
+	openapiHandler, err := openapi.NewHandler(conf.App.Version)
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("Failed to build the OpenAPI document: %v", err))
+	}
+	router.GET("/openapi.json", openapiHandler.Spec)
+	router.GET("/docs", openapiHandler.Docs)
 
 	// Location routes
 	locationRoutes := router.Group("/locations")
 	{
-		locationRoutes.POST("", locationController.CreateLocation)
-		locationRoutes.GET("", locationController.GetLocations)
-		locationRoutes.GET("/nearest", locationController.GetNearest)
-		locationRoutes.DELETE("/:name", locationController.DeleteLocation)
+		locationRoutes.POST("", write, controllers.Location.CreateLocation)
+		locationRoutes.GET("", read, controllers.Location.GetLocations)
+		locationRoutes.GET("/search", read, controllers.Search.SearchLocations)
+		locationRoutes.GET("/nearest", read, controllers.Location.GetNearest)
+		locationRoutes.GET("/nearest/ws", read, controllers.NearestSocket.StreamNearest)
+		locationRoutes.GET("/stream", read, controllers.Stream.StreamLocations)
+		locationRoutes.POST("/along-route", read, controllers.Location.FindAlongRoute)
+		locationRoutes.GET("/id/:uuid", read, controllers.Location.GetLocationByUUID)
+		locationRoutes.PUT("/id/:uuid", write, controllers.Location.UpdateLocationByUUID)
+		locationRoutes.DELETE("/id/:uuid", write, controllers.Location.DeleteLocationByUUID)
+		locationRoutes.PUT("/:name", write, controllers.Location.UpdateLocation)
+		locationRoutes.DELETE("/:name", write, controllers.Location.DeleteLocation)
+	}
+
+	// Geofence routes
+	geofenceRoutes := router.Group("/geofences")
+	{
+		geofenceRoutes.POST("", write, controllers.Geofence.CreateGeofence)
+		geofenceRoutes.GET("", read, controllers.Geofence.GetGeofences)
+		geofenceRoutes.GET("/contains", read, controllers.Geofence.GetContaining)
+		geofenceRoutes.GET("/:id", read, controllers.Geofence.GetGeofence)
+		geofenceRoutes.PUT("/:id", write, controllers.Geofence.UpdateGeofence)
+		geofenceRoutes.DELETE("/:id", write, controllers.Geofence.DeleteGeofence)
+	}
+
+	// GraphQL; subscriptions use a WebSocket on GET
+	router.POST("/graphql", read, controllers.GraphQL.Execute)
+	router.GET("/graphql", read, controllers.GraphQL.Subscribe)
+
+	// Device tracking routes
+	router.POST("/devices/:id/positions", write, controllers.Tracking.IngestPositions)
+	router.GET("/events", read, controllers.Tracking.GetEvents)
+
+	// Webhook routes
+	webhookRoutes := router.Group("/webhooks")
+	{
+		webhookRoutes.POST("", admin, controllers.Webhook.CreateSubscription)
+		webhookRoutes.GET("", admin, controllers.Webhook.GetSubscriptions)
+		webhookRoutes.GET("/:id", admin, controllers.Webhook.GetSubscription)
+		webhookRoutes.DELETE("/:id", admin, controllers.Webhook.DeleteSubscription)
+		webhookRoutes.GET("/:id/deliveries", admin, controllers.Webhook.GetDeliveries)
+		webhookRoutes.POST("/deliveries/:id/retry", admin, controllers.Webhook.RetryDelivery)
+	}
+
+	// Change feed routes
+	router.GET("/changes", read, controllers.Change.GetChanges)
+
+	// Route planning routes
+	routeRoutes := router.Group("/routes")
+	{
+		routeRoutes.POST("/optimize", read, controllers.Route.OptimizeRoute)
+	}
+
+	// Audit trail routes
+	auditRoutes := router.Group("/audit")
+	{
+		auditRoutes.GET("", admin, controllers.Audit.GetEntries)
+		auditRoutes.GET("/export", admin, controllers.Audit.ExportEntries)
+		auditRoutes.GET("/verify", admin, controllers.Audit.VerifyChain)
+	}
+
+	if controllers.RateLimit != nil {
+		if err := controllers.RateLimit.Check(router.Routes()); err != nil {
+			logger.Fatal(fmt.Sprintf("Invalid rate limit configuration: %v", err))
+		}
 	}
 
 	logger.Info("App routes registered successfully!")
@@ -47,33 +213,24 @@ func RegisterRoutes(conf *config.Config) *gin.Engine {
 	return router
 }
 
-// corsMiddleware handles CORS headers
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
+// scopes returns the middleware requiring the read, write and admin scopes.
+// Without an authenticator they let every request through.
+func scopes(authenticator *http.Authenticator) (read, write, admin gin.HandlerFunc) {
+	if authenticator == nil {
+		open := func(c *gin.Context) { c.Next() }
+		return open, open, open
 	}
+	return authenticator.Require(auth.ScopeRead), authenticator.Require(auth.ScopeWrite), authenticator.Require(auth.ScopeAdmin)
 }
 
-func errorReporterMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Next()
-
-		if len(c.Errors) > 0 {
-			log.WithFields(log.Fields{
-				"method": c.Request.Method,
-				"path":   c.Request.URL.Path,
-				"errors": c.Errors.String(),
-			}).Error("Request completed with errors")
-		}
+// corsOptions converts the CORS configuration
+func corsOptions(conf config.CORS) http.CORSOptions {
+	return http.CORSOptions{
+		Origins:        conf.AllowedOrigins,
+		Methods:        conf.AllowedMethods,
+		Headers:        conf.AllowedHeaders,
+		ExposedHeaders: conf.ExposedHeaders,
+		MaxAge:         time.Duration(conf.MaxAgeSeconds) * time.Second,
+		Credentials:    conf.AllowCredentials,
 	}
 }
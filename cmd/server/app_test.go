@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/config"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	apihttp "github.com/youngprinnce/geolocation-service/internal/http"
+	"github.com/youngprinnce/geolocation-service/internal/openapi"
+	"github.com/youngprinnce/geolocation-service/internal/service/apikey"
+)
+
+// TestOpenAPICoversRoutes fails when a registered route is missing from the
+// OpenAPI document, or when the document describes a route that is not registered
+func TestOpenAPICoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := RegisterRoutes(&config.Config{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+
+	registered := make(map[string]bool)
+	for _, r := range router.Routes() {
+		path := openapi.Path(r.Path)
+		method := strings.ToLower(r.Method)
+		registered[method+" "+path] = true
+
+		op := doc.Paths[path][method]
+		if assert.NotNil(t, op, "%s %s is not in the OpenAPI document", r.Method, r.Path) {
+			assert.NotEmpty(t, op.Responses, "%s %s has no responses", r.Method, r.Path)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not registered", method, path)
+		}
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := RegisterRoutes(&config.Config{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "openapi.json")
+}
+
+// scopeKeys accepts every scope name as a key granting that scope
+type scopeKeys struct{}
+
+func (scopeKeys) CreateKey(apikey.CreateKeyRequest) (*apikey.CreatedKey, error) { return nil, nil }
+func (scopeKeys) ListKeys() ([]apikey.APIKey, error)                            { return nil, nil }
+func (scopeKeys) RevokeKey(uint) (*apikey.APIKey, error)                        { return nil, nil }
+
+func (scopeKeys) Authenticate(key string) (*auth.Principal, error) {
+	if !auth.ValidScope(key) {
+		return nil, apikey.ErrInvalidKey
+	}
+	return &auth.Principal{ID: key, Method: auth.MethodAPIKey, Scopes: []string{key}}, nil
+}
+
+// TestRoutesRequireDocumentedScope checks that every route rejects callers
+// without the scope the OpenAPI document says it requires
+func TestRoutesRequireDocumentedScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf := &config.Config{}
+	controllers := wiredControllers(conf)
+	controllers.Auth = apihttp.NewAuthenticator(scopeKeys{}, nil)
+	router := NewRouter(conf, controllers)
+	doc := openapi.Build("")
+
+	serve := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set(apihttp.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	below := map[string][]string{
+		auth.ScopeRead:  nil,
+		auth.ScopeWrite: {auth.ScopeRead},
+		auth.ScopeAdmin: {auth.ScopeRead, auth.ScopeWrite},
+	}
+
+	for _, r := range router.Routes() {
+		path := strings.NewReplacer(":id", "1", ":uuid", "1", ":name", "x").Replace(r.Path)
+		scope := doc.Paths[openapi.Path(r.Path)][strings.ToLower(r.Method)].RequiredScope
+
+		w := serve(r.Method, path, "not-a-key")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "%s %s accepted an invalid key", r.Method, r.Path)
+		if scope == "" {
+			continue
+		}
+
+		w = serve(r.Method, path, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "%s %s accepted a request without a key", r.Method, r.Path)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		for _, lower := range below[scope] {
+			w = serve(r.Method, path, lower)
+			assert.Equal(t, http.StatusForbidden, w.Code, "%s %s accepted the %s scope, documented as %s", r.Method, r.Path, lower, scope)
+		}
+	}
+
+	w := serve(http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, w.Code, "the health check is public")
+}
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	clientIP := func(conf *config.Config) string {
+		router := NewRouter(conf, Controllers{})
+		router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "10.0.0.1", clientIP(&config.Config{}), "forwarding headers are ignored by default")
+
+	conf := &config.Config{}
+	conf.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	assert.Equal(t, "203.0.113.7", clientIP(conf))
+}
@@ -1,20 +1,38 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	gohttp "net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/youngprinnce/geolocation-service/config"
+	"github.com/youngprinnce/geolocation-service/internal/app/manualwire"
 	"github.com/youngprinnce/geolocation-service/internal/logger"
 	"github.com/youngprinnce/geolocation-service/internal/postgres"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	grpclib "google.golang.org/grpc"
+)
+
+// Server defaults, used when the configuration leaves them at zero
+const (
+	defaultReadTimeout     = 15 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 120 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 func StartServerCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "server",
 		Short: "Start the API server",
-		Long:  `Start the HTTP API server`,
+		Long:  `Start the HTTP API server. SIGINT or SIGTERM stops it after the requests in flight have finished.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			configFile, _ := cmd.Flags().GetString("config")
 			conf := config.LoadConfig(configFile)
@@ -25,12 +43,107 @@ func StartServerCmd() *cobra.Command {
 				logger.Fatal(fmt.Sprintf("Failed to initialize postgres: %v", err))
 			}
 
-			router := RegisterRoutes(conf)
+			controllers := wiredControllers(conf)
+			router := NewRouter(conf, controllers)
+
+			manualwire.GetWebhookService().Start()
+			manualwire.GetOutboxService().Start()
+			var meter *ratelimit.Meter
+			if controllers.RateLimit != nil {
+				meter = manualwire.GetUsageMeter()
+				meter.Start()
+			}
+
+			// The first signal starts the shutdown; a second one kills the process
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
 
-			log.WithField("port", conf.Server.Listen).Info("Starting server")
-			if err := router.Run(conf.Server.Listen); err != nil {
-				logger.Fatal(fmt.Sprintf("Failed to start server: %v", err))
+			var grpcServer *grpclib.Server
+			if conf.Server.GRPCListen != "" {
+				listener, err := net.Listen("tcp", conf.Server.GRPCListen)
+				if err != nil {
+					logger.Fatal(fmt.Sprintf("Failed to listen for gRPC: %v", err))
+				}
+				grpcServer = manualwire.GetGRPCServer()
+				go func() {
+					log.WithField("port", conf.Server.GRPCListen).Info("Starting gRPC server")
+					if err := grpcServer.Serve(listener); err != nil {
+						logger.Fatal(fmt.Sprintf("Failed to start gRPC server: %v", err))
+					}
+				}()
 			}
+
+			server := &gohttp.Server{
+				Addr:         conf.Server.Listen,
+				Handler:      router,
+				ReadTimeout:  seconds(conf.Server.ReadTimeoutSeconds, defaultReadTimeout),
+				WriteTimeout: seconds(conf.Server.WriteTimeoutSeconds, defaultWriteTimeout),
+				IdleTimeout:  seconds(conf.Server.IdleTimeoutSeconds, defaultIdleTimeout),
+			}
+			// Streams, sockets and long polls would otherwise hold the shutdown until its deadline
+			server.RegisterOnShutdown(controllers.Shutdown)
+
+			go func() {
+				log.WithField("port", conf.Server.Listen).Info("Starting server")
+				if err := server.ListenAndServe(); err != nil && !errors.Is(err, gohttp.ErrServerClosed) {
+					logger.Fatal(fmt.Sprintf("Failed to start server: %v", err))
+				}
+			}()
+
+			<-ctx.Done()
+			stop()
+			shutdown(server, grpcServer, meter, seconds(conf.Server.ShutdownTimeoutSeconds, defaultShutdownTimeout))
 		},
 	}
 }
+
+// shutdown stops accepting connections, waits up to timeout for the requests in flight,
+// then stops the background workers, which store what they still hold, and closes the database
+func shutdown(server *gohttp.Server, grpcServer *grpclib.Server, meter *ratelimit.Meter, timeout time.Duration) {
+	log.WithField("timeout", timeout.String()).Warn("Shutting down, draining requests in flight")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		if grpcServer == nil {
+			return
+		}
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.WithError(err).Error("Requests were still running at the shutdown deadline, closing their connections")
+		_ = server.Close()
+	}
+	<-drained
+
+	manualwire.GetWebhookService().Stop()
+	manualwire.GetOutboxService().Stop()
+	if meter != nil {
+		meter.Stop()
+	}
+
+	if err := postgres.Close(); err != nil {
+		log.WithError(err).Error("Failed to close the database connections")
+	}
+	log.Warn("Server stopped")
+}
+
+// seconds converts a configured number of seconds, using fallback for zero or less
+func seconds(n int, fallback time.Duration) time.Duration {
+	if n <= 0 {
+		return fallback
+	}
+	return time.Duration(n) * time.Second
+}
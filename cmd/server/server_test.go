@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/config"
+	apihttp "github.com/youngprinnce/geolocation-service/internal/http"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/stream"
+)
+
+// waitingChanges is a change feed without changes whose long polls wait until they are cancelled
+type waitingChanges struct {
+	waiting chan struct{}
+}
+
+func (w waitingChanges) GetChanges(ctx context.Context, since string, limit int, wait time.Duration) (*outbox.ChangePage, error) {
+	close(w.waiting)
+	<-ctx.Done()
+	return &outbox.ChangePage{Changes: []outbox.Change{}, NextCursor: since}, nil
+}
+
+// TestShutdownDrainsRequests checks that a shutdown lets the requests in flight finish
+// while the streams and long polls held open end as soon as it begins
+func TestShutdownDrainsRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conf := &config.Config{Auth: config.Auth{Disabled: true}}
+	controllers := wiredControllers(conf)
+	controllers.Stream = apihttp.NewStreamController(stream.NewBroker(10, 10), time.Minute, nil)
+	changes := waitingChanges{waiting: make(chan struct{})}
+	controllers.Change = apihttp.NewChangeController(changes)
+
+	router := NewRouter(conf, controllers)
+	entered, release := make(chan struct{}), make(chan struct{})
+	router.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.String(http.StatusOK, "done")
+	})
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.RegisterOnShutdown(controllers.Shutdown)
+	server.Start()
+	defer server.Close()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	get := func(path string, results chan<- result) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{status: resp.StatusCode, body: string(body), err: err}
+	}
+
+	slow := make(chan result, 1)
+	go get("/slow", slow)
+	<-entered
+
+	polled := make(chan result, 1)
+	go get("/changes?since=abc&wait=30", polled)
+	<-changes.waiting
+
+	resp, err := http.Get(server.URL + "/locations/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	streamed := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, resp.Body)
+		streamed <- err
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		shutdown(server.Config, nil, nil, 5*time.Second)
+		close(stopped)
+	}()
+
+	select {
+	case err := <-streamed:
+		assert.NoError(t, err, "the stream should end cleanly")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the stream was still open after the shutdown began")
+	}
+
+	select {
+	case r := <-polled:
+		require.NoError(t, r.err)
+		assert.Equal(t, http.StatusOK, r.status)
+		assert.JSONEq(t, `{"changes": [], "next_cursor": "abc"}`, r.body, "the long poll is answered with what it has so far")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the long poll was still waiting after the shutdown began")
+	}
+
+	select {
+	case <-stopped:
+		t.Fatal("the shutdown finished before the request in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case r := <-slow:
+		require.NoError(t, r.err)
+		assert.Equal(t, http.StatusOK, r.status)
+		assert.Equal(t, "done", r.body)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the request in flight did not finish")
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the shutdown did not finish after the last request")
+	}
+
+	_, err = http.Get(server.URL + "/slow")
+	assert.Error(t, err, "no connections are accepted after the shutdown")
+}
@@ -22,14 +22,151 @@ type Database struct {
 	DbName   string `yaml:"db_name"`
 }
 
+// Server sets where the API listens and how long connections may take; zero timeouts use the defaults.
+// On SIGINT or SIGTERM in-flight requests get up to ShutdownTimeoutSeconds to finish.
 type Server struct {
-	Listen string `yaml:"listen"`
+	Listen     string `yaml:"listen"`
+	GRPCListen string `yaml:"grpc_listen"`
+	// GRPCReflection lets clients such as grpcurl discover the gRPC services; off by default
+	GRPCReflection         bool `yaml:"grpc_reflection"`
+	ReadTimeoutSeconds     int  `yaml:"read_timeout_seconds"`
+	WriteTimeoutSeconds    int  `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds     int  `yaml:"idle_timeout_seconds"`
+	ShutdownTimeoutSeconds int  `yaml:"shutdown_timeout_seconds"`
+	// TrustedProxies are the addresses or CIDRs of the proxies whose forwarding headers
+	// give the client IP. None are trusted by default, so the IP is the peer's.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// Locations limits location searches; zero uses the defaults
+type Locations struct {
+	MaxRoutePoints int `yaml:"max_route_points"`
+}
+
+type Tracking struct {
+	StationRadiusMeters float64 `yaml:"station_radius_m"`
+	DebounceSeconds     int     `yaml:"debounce_seconds"`
+	DwellSeconds        int     `yaml:"dwell_seconds"`
+}
+
+// Webhooks configures delivery. Receivers on private, loopback or link-local addresses are
+// refused unless AllowPrivateNetworks is set.
+type Webhooks struct {
+	MaxAttempts           int  `yaml:"max_attempts"`
+	InitialBackoffSeconds int  `yaml:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int  `yaml:"max_backoff_seconds"`
+	TimeoutSeconds        int  `yaml:"timeout_seconds"`
+	Workers               int  `yaml:"workers"`
+	AllowPrivateNetworks  bool `yaml:"allow_private_networks"`
+}
+
+// Outbox configures the change feed. Entries older than RetentionHours are deleted once
+// relayed; zero keeps them forever.
+type Outbox struct {
+	SinkPath             string `yaml:"sink_path"`
+	RelayIntervalSeconds int    `yaml:"relay_interval_seconds"`
+	RetentionHours       int    `yaml:"retention_hours"`
+}
+
+type Stream struct {
+	HistorySize      int `yaml:"history_size"`
+	ClientBuffer     int `yaml:"client_buffer"`
+	HeartbeatSeconds int `yaml:"heartbeat_seconds"`
+}
+
+type NearestSocket struct {
+	PingSeconds        int   `yaml:"ping_seconds"`
+	PongWaitSeconds    int   `yaml:"pong_wait_seconds"`
+	IdleTimeoutSeconds int   `yaml:"idle_timeout_seconds"`
+	MaxMessageBytes    int64 `yaml:"max_message_bytes"`
+}
+
+// JWT configures bearer tokens issued by single sign-on; they are refused unless a key set is set
+type JWT struct {
+	JWKSFile       string              `yaml:"jwks_file"`
+	JWKSURL        string              `yaml:"jwks_url"`
+	Issuer         string              `yaml:"issuer"`
+	Audiences      []string            `yaml:"audiences"`
+	RefreshSeconds int                 `yaml:"refresh_seconds"`
+	LeewaySeconds  int                 `yaml:"leeway_seconds"`
+	RolesClaim     string              `yaml:"roles_claim"`
+	RoleScopes     map[string][]string `yaml:"role_scopes"`
+	TenantClaim    string              `yaml:"tenant_claim"`
+}
+
+// Policy limits the holders of Role to the locations of Categories inside BBox or Polygon
+type Policy struct {
+	Role       string   `yaml:"role"`
+	Actions    []string `yaml:"actions"`
+	Categories []string `yaml:"categories"`
+	// BBox is "minLng,minLat,maxLng,maxLat", as in the bbox query parameter
+	BBox string `yaml:"bbox"`
+	// Polygon lists [lng, lat] pairs, as in GeoJSON
+	Polygon [][]float64 `yaml:"polygon"`
+}
+
+type Auth struct {
+	// Disabled leaves every route open, for local development only
+	Disabled bool     `yaml:"disabled"`
+	JWT      JWT      `yaml:"jwt"`
+	Policies []Policy `yaml:"policies"`
+}
+
+// TenantQuota limits what one tenant may store; zero is unlimited
+type TenantQuota struct {
+	MaxLocations int `yaml:"max_locations"`
+}
+
+// Tenancy sets the quota of every tenant, which Tenants overrides per tenant ID
+type Tenancy struct {
+	MaxLocations int                    `yaml:"max_locations"`
+	Tenants      map[string]TenantQuota `yaml:"tenants"`
+}
+
+// RouteLimit is a token bucket of Burst requests refilled at RequestsPerSecond; zero is unlimited
+type RouteLimit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+// RateLimit limits the requests of each client, told apart by API key, token
+// subject or IP. Routes overrides the limit per route, keyed by method and path
+// such as "GET /locations/nearest"; KeyQuotas overrides the monthly quota per API key ID.
+type RateLimit struct {
+	RequestsPerSecond    float64               `yaml:"requests_per_second"`
+	Burst                int                   `yaml:"burst"`
+	Routes               map[string]RouteLimit `yaml:"routes"`
+	MonthlyQuota         int64                 `yaml:"monthly_quota"`
+	KeyQuotas            map[string]int64      `yaml:"key_quotas"`
+	FlushIntervalSeconds int                   `yaml:"flush_interval_seconds"`
+}
+
+// CORS sets which browser origins may call the API. Origins are exact, contain
+// wildcards such as "https://*.example.com", or are regular expressions between
+// slashes; "*" allows every origin but not together with credentials.
+type CORS struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	MaxAgeSeconds    int      `yaml:"max_age_seconds"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
 }
 
 type Config struct {
-	App      App      `yaml:"app"`
-	Server   Server   `yaml:"server"`
-	Database Database `yaml:"database"`
+	App           App           `yaml:"app"`
+	Server        Server        `yaml:"server"`
+	Database      Database      `yaml:"database"`
+	Locations     Locations     `yaml:"locations"`
+	Tracking      Tracking      `yaml:"tracking"`
+	Webhooks      Webhooks      `yaml:"webhooks"`
+	Outbox        Outbox        `yaml:"outbox"`
+	Stream        Stream        `yaml:"stream"`
+	NearestSocket NearestSocket `yaml:"nearest_socket"`
+	Auth          Auth          `yaml:"auth"`
+	Tenancy       Tenancy       `yaml:"tenancy"`
+	RateLimit     RateLimit     `yaml:"rate_limit"`
+	CORS          CORS          `yaml:"cors"`
 }
 
 var conf Config
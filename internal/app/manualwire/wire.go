@@ -1,26 +1,537 @@
 package manualwire
 
 import (
+	"fmt"
+	gohttp "net/http"
+	"sync"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/config"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/auth/jwt"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/graphql"
+	"github.com/youngprinnce/geolocation-service/internal/grpc"
 	"github.com/youngprinnce/geolocation-service/internal/http"
+	"github.com/youngprinnce/geolocation-service/internal/logger"
 	"github.com/youngprinnce/geolocation-service/internal/postgres"
+	"github.com/youngprinnce/geolocation-service/internal/service/access"
+	"github.com/youngprinnce/geolocation-service/internal/service/apikey"
+	"github.com/youngprinnce/geolocation-service/internal/service/audit"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
 	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"github.com/youngprinnce/geolocation-service/internal/service/search"
+	"github.com/youngprinnce/geolocation-service/internal/service/stream"
+	"github.com/youngprinnce/geolocation-service/internal/service/tracking"
+	"github.com/youngprinnce/geolocation-service/internal/service/webhook"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	grpclib "google.golang.org/grpc"
+)
+
+var (
+	geofenceServiceOnce sync.Once
+	geofenceService     geofence.GeofenceBC
+
+	eventBusOnce sync.Once
+	eventBus     *events.Bus
+
+	webhookServiceOnce sync.Once
+	webhookService     *webhook.WebhookService
+
+	outboxServiceOnce sync.Once
+	outboxService     *outbox.OutboxService
+
+	streamBrokerOnce sync.Once
+	streamBroker     *stream.Broker
+
+	searchServiceOnce sync.Once
+	searchService     *search.SearchService
+
+	locationServicesOnce sync.Once
+	locationServices     *location.TenantServices
+
+	auditServiceOnce sync.Once
+	auditService     *audit.AuditService
+
+	usageMeterOnce sync.Once
+	usageMeter     *ratelimit.Meter
+
+	rateLimiterOnce sync.Once
+	rateLimiter     *http.RateLimiter
+
+	tokenVerifierOnce sync.Once
+	tokenVerifier     http.TokenVerifier
 )
 
-func GetLocationRepository() location.LocationStore {
+// GetEventBus returns the shared bus that services publish their changes to
+func GetEventBus() *events.Bus {
+	eventBusOnce.Do(func() {
+		eventBus = events.NewBus()
+		eventBus.Subscribe(GetWebhookService())
+		eventBus.Subscribe(GetOutboxService())
+		eventBus.Subscribe(GetStreamBroker())
+		eventBus.Subscribe(GetSearchService())
+	})
+	return eventBus
+}
+
+// GetLocationRepositories returns the factory of stores scoped to the locations of each tenant
+func GetLocationRepositories() location.StoreFactory {
 	session := postgres.GetSession()
-	return location.NewLocationRepo(session)
+	return func(tenant string) location.LocationStore {
+		return location.NewLocationRepo(session, tenant)
+	}
+}
+
+// GetLocationQuotas returns the configured quota of every tenant
+func GetLocationQuotas() location.Quotas {
+	conf := config.GetConfig().Tenancy
+	quotas := location.Quotas{
+		Default: location.Quota{MaxLocations: conf.MaxLocations},
+		Tenants: make(map[string]location.Quota, len(conf.Tenants)),
+	}
+	for id, quota := range conf.Tenants {
+		if !tenant.Valid(id) {
+			logger.Fatal(fmt.Sprintf("Invalid tenancy configuration: %q is not a valid tenant ID", id))
+		}
+		quotas.Tenants[id] = location.Quota{MaxLocations: quota.MaxLocations}
+	}
+	return quotas
+}
+
+// GetLocationOptions returns the configured limits of location searches
+func GetLocationOptions() location.Options {
+	options := location.DefaultOptions()
+	if conf := config.GetConfig().Locations; conf.MaxRoutePoints > 0 {
+		options.MaxRoutePoints = conf.MaxRoutePoints
+	}
+	return options
+}
+
+// GetTenantLocationServices returns the shared per-tenant location services so every consumer
+// queries the same spatial indexes
+func GetTenantLocationServices() *location.TenantServices {
+	locationServicesOnce.Do(func() {
+		locationServices = location.NewTenantServices(GetLocationRepositories(), GetLocationDistanceCalculator(), GetEventBus(), GetLocationQuotas(), GetLocationOptions())
+	})
+	return locationServices
 }
 
-func GetLocationService(repo location.LocationStore, calculator *location.DistanceCalculator) location.LocationBC {
-	return location.NewLocationService(repo, calculator)
+// GetLocationService returns the location service with its changes audited and,
+// when a policy is configured, its access guarded
+func GetLocationService() location.LocationBC {
+	service := audit.NewLocationRecorder(GetTenantLocationServices(), GetAuditService())
+	if policy := GetLocationPolicy(); policy != nil {
+		service = access.NewLocationGuard(service, policy)
+	}
+	return service
+}
+
+// GetLocationPolicy returns the configured access policy for locations, or nil when none is configured
+func GetLocationPolicy() *access.Policy {
+	policies := config.GetConfig().Auth.Policies
+	if len(policies) == 0 {
+		return nil
+	}
+
+	rules := make([]access.Rule, len(policies))
+	for i, p := range policies {
+		rules[i] = access.Rule{Role: p.Role, Actions: p.Actions, Categories: p.Categories}
+		switch {
+		case p.BBox != "" && len(p.Polygon) > 0:
+			logger.Fatal(fmt.Sprintf("Invalid policy %d: set either bbox or polygon", i+1))
+		case p.BBox != "":
+			box, err := location.ParseBoundingBox(p.BBox)
+			if err != nil {
+				logger.Fatal(fmt.Sprintf("Invalid policy %d: %v", i+1, err))
+			}
+			rules[i].Area = &access.Area{BBox: box}
+		case len(p.Polygon) > 0:
+			area := &access.Area{}
+			for _, pair := range p.Polygon {
+				if len(pair) != 2 {
+					logger.Fatal(fmt.Sprintf("Invalid policy %d: polygon points must be [lng, lat] pairs", i+1))
+				}
+				area.Polygon = append(area.Polygon, location.Point{Latitude: pair[1], Longitude: pair[0]})
+			}
+			rules[i].Area = area
+		}
+	}
+
+	policy, err := access.NewPolicy(rules)
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("Invalid access policy: %v", err))
+	}
+	return policy
 }
 
 func GetLocationController() *http.LocationController {
-	repo := GetLocationRepository()
-	service := GetLocationService(repo, GetLocationDistanceCalculator())
-	return http.NewLocationController(service)
+	return http.NewLocationController(GetLocationService())
 }
 
 func GetLocationDistanceCalculator() *location.DistanceCalculator {
 	return &location.DistanceCalculator{}
 }
+
+// GetSearchService returns the shared search service so every consumer queries the same name index
+func GetSearchService() *search.SearchService {
+	searchServiceOnce.Do(func() {
+		searchService = search.NewSearchService(GetLocationRepositories(), GetLocationDistanceCalculator())
+	})
+	return searchService
+}
+
+// GetSearchController returns the search controller, with its results guarded when a policy is configured
+func GetSearchController() *http.SearchController {
+	var service search.SearchBC = GetSearchService()
+	if policy := GetLocationPolicy(); policy != nil {
+		service = access.NewSearchGuard(service, policy)
+	}
+	return http.NewSearchController(service)
+}
+
+func GetRouteService(repos location.StoreFactory, calculator *location.DistanceCalculator) route.RouteBC {
+	return route.NewRouteService(repos, calculator)
+}
+
+// GetRouteController returns the route controller, with its stations guarded when a policy is configured
+func GetRouteController() *http.RouteController {
+	service := GetRouteService(GetLocationRepositories(), GetLocationDistanceCalculator())
+	if policy := GetLocationPolicy(); policy != nil {
+		service = access.NewRouteGuard(service, GetLocationRepositories(), policy)
+	}
+	return http.NewRouteController(service)
+}
+
+func GetGeofenceRepository() geofence.GeofenceStore {
+	session := postgres.GetSession()
+	return geofence.NewGeofenceRepo(session)
+}
+
+// GetGeofenceService returns the shared geofence service so every consumer queries the same spatial index
+func GetGeofenceService() geofence.GeofenceBC {
+	geofenceServiceOnce.Do(func() {
+		geofenceService = geofence.NewGeofenceService(GetGeofenceRepository(), GetLocationDistanceCalculator())
+	})
+	return geofenceService
+}
+
+func GetGeofenceController() *http.GeofenceController {
+	return http.NewGeofenceController(GetGeofenceService())
+}
+
+func GetTrackingRepository() tracking.TrackingStore {
+	session := postgres.GetSession()
+	return tracking.NewTrackingRepo(session)
+}
+
+func GetTrackingOptions() tracking.Options {
+	options := tracking.DefaultOptions()
+	conf := config.GetConfig().Tracking
+	if conf.StationRadiusMeters > 0 {
+		options.StationRadiusMeters = conf.StationRadiusMeters
+	}
+	if conf.DebounceSeconds > 0 {
+		options.Debounce = time.Duration(conf.DebounceSeconds) * time.Second
+	}
+	if conf.DwellSeconds > 0 {
+		options.Dwell = time.Duration(conf.DwellSeconds) * time.Second
+	}
+	return options
+}
+
+func GetTrackingService() tracking.TrackingBC {
+	return tracking.NewTrackingService(
+		GetTrackingRepository(),
+		GetLocationRepositories(),
+		GetGeofenceService(),
+		GetLocationDistanceCalculator(),
+		GetTrackingOptions(),
+		GetEventBus(),
+	)
+}
+
+func GetTrackingController() *http.TrackingController {
+	return http.NewTrackingController(GetTrackingService())
+}
+
+func GetWebhookRepository() webhook.WebhookStore {
+	session := postgres.GetSession()
+	return webhook.NewWebhookRepo(session)
+}
+
+func GetWebhookOptions() webhook.Options {
+	options := webhook.DefaultOptions()
+	conf := config.GetConfig().Webhooks
+	if conf.MaxAttempts > 0 {
+		options.MaxAttempts = conf.MaxAttempts
+	}
+	if conf.InitialBackoffSeconds > 0 {
+		options.InitialBackoff = time.Duration(conf.InitialBackoffSeconds) * time.Second
+	}
+	if conf.MaxBackoffSeconds > 0 {
+		options.MaxBackoff = time.Duration(conf.MaxBackoffSeconds) * time.Second
+	}
+	if conf.TimeoutSeconds > 0 {
+		options.Timeout = time.Duration(conf.TimeoutSeconds) * time.Second
+	}
+	if conf.Workers > 0 {
+		options.Workers = conf.Workers
+	}
+	options.AllowPrivateNetworks = conf.AllowPrivateNetworks
+	return options
+}
+
+// GetWebhookService returns the shared webhook service, which also runs the delivery worker
+func GetWebhookService() *webhook.WebhookService {
+	webhookServiceOnce.Do(func() {
+		webhookService = webhook.NewWebhookService(GetWebhookRepository(), GetWebhookOptions())
+	})
+	return webhookService
+}
+
+func GetWebhookController() *http.WebhookController {
+	return http.NewWebhookController(GetWebhookService())
+}
+
+func GetOutboxRepository() outbox.OutboxStore {
+	session := postgres.GetSession()
+	return outbox.NewOutboxRepo(session)
+}
+
+// GetOutboxPublisher returns the configured change sink, or nil when relaying is disabled
+func GetOutboxPublisher() outbox.Publisher {
+	path := config.GetConfig().Outbox.SinkPath
+	if path == "" {
+		return nil
+	}
+
+	sink, err := outbox.NewFileSink(path)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to open outbox sink %s: %v", path, err))
+		return nil
+	}
+	return sink
+}
+
+// GetOutboxService returns the shared outbox service, which serves the change feed and runs the relay
+func GetOutboxService() *outbox.OutboxService {
+	outboxServiceOnce.Do(func() {
+		interval := time.Second
+		if seconds := config.GetConfig().Outbox.RelayIntervalSeconds; seconds > 0 {
+			interval = time.Duration(seconds) * time.Second
+		}
+		retention := time.Duration(config.GetConfig().Outbox.RetentionHours) * time.Hour
+		outboxService = outbox.NewOutboxService(GetOutboxRepository(), GetOutboxPublisher(), interval, retention)
+	})
+	return outboxService
+}
+
+// GetChangeController returns the change feed controller, with its changes guarded when a policy is configured
+func GetChangeController() *http.ChangeController {
+	var service outbox.OutboxBC = GetOutboxService()
+	if policy := GetLocationPolicy(); policy != nil {
+		service = access.NewChangeGuard(service, policy)
+	}
+	return http.NewChangeController(service)
+}
+
+func GetAuditRepository() audit.AuditStore {
+	session := postgres.GetSession()
+	return audit.NewAuditRepo(session)
+}
+
+// GetAuditService returns the shared audit service
+func GetAuditService() *audit.AuditService {
+	auditServiceOnce.Do(func() {
+		auditService = audit.NewAuditService(GetAuditRepository())
+	})
+	return auditService
+}
+
+func GetAuditController() *http.AuditController {
+	return http.NewAuditController(GetAuditService())
+}
+
+// GetStreamBroker returns the shared broker feeding the location change stream
+func GetStreamBroker() *stream.Broker {
+	streamBrokerOnce.Do(func() {
+		conf := config.GetConfig().Stream
+		historySize, clientBuffer := 1000, 64
+		if conf.HistorySize > 0 {
+			historySize = conf.HistorySize
+		}
+		if conf.ClientBuffer > 0 {
+			clientBuffer = conf.ClientBuffer
+		}
+		streamBroker = stream.NewBroker(historySize, clientBuffer)
+	})
+	return streamBroker
+}
+
+func GetStreamController() *http.StreamController {
+	heartbeat := 15 * time.Second
+	if seconds := config.GetConfig().Stream.HeartbeatSeconds; seconds > 0 {
+		heartbeat = time.Duration(seconds) * time.Second
+	}
+	return http.NewStreamController(GetStreamBroker(), heartbeat, GetLocationPolicy())
+}
+
+func GetNearestSocketOptions() http.NearestSocketOptions {
+	options := http.DefaultNearestSocketOptions()
+	conf := config.GetConfig().NearestSocket
+	if conf.PingSeconds > 0 {
+		options.PingInterval = time.Duration(conf.PingSeconds) * time.Second
+	}
+	if conf.PongWaitSeconds > 0 {
+		options.PongWait = time.Duration(conf.PongWaitSeconds) * time.Second
+	}
+	if conf.IdleTimeoutSeconds > 0 {
+		options.IdleTimeout = time.Duration(conf.IdleTimeoutSeconds) * time.Second
+	}
+	if conf.MaxMessageBytes > 0 {
+		options.MaxMessageBytes = conf.MaxMessageBytes
+	}
+	return options
+}
+
+func GetNearestSocketController() *http.NearestSocketController {
+	return http.NewNearestSocketController(GetLocationService(), GetNearestSocketOptions())
+}
+
+func GetLocationGRPCServer() *grpc.LocationServer {
+	return grpc.NewLocationServer(GetLocationService())
+}
+
+// GetGRPCServer returns the gRPC server, authenticating and rate limiting calls like the HTTP API
+func GetGRPCServer() *grpclib.Server {
+	options := grpc.ServerOptions{Reflection: config.GetConfig().Server.GRPCReflection}
+	if !config.GetConfig().Auth.Disabled {
+		options.Auth = GetAuthenticator()
+	}
+	// A nil limiter must not become a non-nil interface
+	if limiter := GetRateLimiter(); limiter != nil {
+		options.RateLimit = limiter
+	}
+	return grpc.NewServer(GetLocationGRPCServer(), options)
+}
+
+func GetGraphQLController() *http.GraphQLController {
+	schema, err := graphql.NewSchema(GetLocationService(), GetStreamBroker(), GetLocationPolicy())
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("Failed to build GraphQL schema: %v", err))
+	}
+	return http.NewGraphQLController(schema)
+}
+
+func GetAPIKeyRepository() apikey.APIKeyStore {
+	session := postgres.GetSession()
+	return apikey.NewAPIKeyRepo(session)
+}
+
+func GetAPIKeyService() apikey.APIKeyBC {
+	return apikey.NewAPIKeyService(GetAPIKeyRepository())
+}
+
+// GetTokenVerifier returns the shared verifier of single sign-on bearer tokens, or nil when none
+// is configured. HTTP and gRPC share it, so they share one cached key set.
+func GetTokenVerifier() http.TokenVerifier {
+	tokenVerifierOnce.Do(func() {
+		if verifier := newTokenVerifier(); verifier != nil {
+			tokenVerifier = verifier
+		}
+	})
+	return tokenVerifier
+}
+
+func newTokenVerifier() *jwt.Verifier {
+	conf := config.GetConfig().Auth.JWT
+	refresh := time.Hour
+	if conf.RefreshSeconds > 0 {
+		refresh = time.Duration(conf.RefreshSeconds) * time.Second
+	}
+
+	var keys *jwt.KeySet
+	switch {
+	case conf.JWKSURL != "":
+		keys = jwt.NewURLKeySet(conf.JWKSURL, &gohttp.Client{Timeout: 10 * time.Second}, refresh)
+	case conf.JWKSFile != "":
+		keys = jwt.NewFileKeySet(conf.JWKSFile, refresh)
+	default:
+		return nil
+	}
+
+	verifier, err := jwt.NewVerifier(keys, jwt.Options{
+		Issuer:      conf.Issuer,
+		Audiences:   conf.Audiences,
+		Leeway:      time.Duration(conf.LeewaySeconds) * time.Second,
+		RolesClaim:  conf.RolesClaim,
+		RoleScopes:  conf.RoleScopes,
+		TenantClaim: conf.TenantClaim,
+	})
+	if err != nil {
+		logger.Fatal(fmt.Sprintf("Invalid JWT configuration: %v", err))
+	}
+	return verifier
+}
+
+func GetAuthenticator() *http.Authenticator {
+	return http.NewAuthenticator(GetAPIKeyService(), GetTokenVerifier())
+}
+
+// GetRateLimitPolicy returns the configured rate limit of every route
+func GetRateLimitPolicy() ratelimit.Policy {
+	conf := config.GetConfig().RateLimit
+	policy := ratelimit.Policy{
+		Default: ratelimit.Limit{Rate: conf.RequestsPerSecond, Burst: conf.Burst},
+		Routes:  make(map[string]ratelimit.Limit, len(conf.Routes)),
+	}
+	for route, limit := range conf.Routes {
+		if limit.RequestsPerSecond < 0 || limit.Burst < 0 {
+			logger.Fatal(fmt.Sprintf("Invalid rate limit configuration: the limit of %q must not be negative", route))
+		}
+		policy.Routes[route] = ratelimit.Limit{Rate: limit.RequestsPerSecond, Burst: limit.Burst}
+	}
+	return policy
+}
+
+func GetUsageRepository() ratelimit.UsageStore {
+	session := postgres.GetSession()
+	return ratelimit.NewUsageRepo(session)
+}
+
+// GetUsageMeter returns the shared meter counting the monthly requests of each API key
+func GetUsageMeter() *ratelimit.Meter {
+	usageMeterOnce.Do(func() {
+		conf := config.GetConfig().RateLimit
+		quotas := ratelimit.Quotas{
+			Monthly: conf.MonthlyQuota,
+			Clients: make(map[string]int64, len(conf.KeyQuotas)),
+		}
+		for id, quota := range conf.KeyQuotas {
+			quotas.Clients[ratelimit.ClientKey(auth.MethodAPIKey, id)] = quota
+		}
+		interval := 10 * time.Second
+		if seconds := conf.FlushIntervalSeconds; seconds > 0 {
+			interval = time.Duration(seconds) * time.Second
+		}
+		usageMeter = ratelimit.NewMeter(GetUsageRepository(), quotas, interval)
+	})
+	return usageMeter
+}
+
+// GetRateLimiter returns the rate limiter shared by the HTTP and gRPC servers, or nil
+// when no rate limit or quota is configured
+func GetRateLimiter() *http.RateLimiter {
+	rateLimiterOnce.Do(func() {
+		conf := config.GetConfig().RateLimit
+		if conf.RequestsPerSecond <= 0 && len(conf.Routes) == 0 && conf.MonthlyQuota <= 0 && len(conf.KeyQuotas) == 0 {
+			return
+		}
+		rateLimiter = http.NewRateLimiter(GetRateLimitPolicy(), ratelimit.NewLimiter(), GetUsageMeter())
+	})
+	return rateLimiter
+}
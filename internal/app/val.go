@@ -2,6 +2,7 @@ package app
 
 import (
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/gin-gonic/gin/binding"
@@ -32,6 +33,18 @@ func (v *DefaultValidator) lazyinit() {
 		v.validate = validator.New()
 		v.validate.SetTagName("binding")
 
+		// Report fields by the names clients send them under
+		v.validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			switch name {
+			case "-":
+				return ""
+			case "":
+				return field.Name
+			}
+			return name
+		})
+
 		// add any custom validations etc. here
 	})
 }
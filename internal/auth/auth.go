@@ -0,0 +1,105 @@
+// Package auth describes who is calling the API and what they are allowed to do.
+// Authentication methods resolve a Principal, which the HTTP layer stores in
+// the request context for handlers and services further down.
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// Scopes grant access to groups of routes. Each scope includes the ones before it.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// Authentication methods
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// scopeRank orders the scopes so a higher one includes the lower ones
+var scopeRank = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// ValidScope reports whether scope is one of the known scopes
+func ValidScope(scope string) bool {
+	_, ok := scopeRank[scope]
+	return ok
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	// ID identifies the credential, such as the ID of an API key
+	ID string
+	// Name is a human readable name of the caller
+	Name string
+	// Method is the authentication method that resolved the caller
+	Method string
+	// Scopes are the scopes granted to the caller
+	Scopes []string
+	// Roles are the roles asserted by the identity provider of a bearer token
+	Roles []string
+	// Tenant is the tenant the credential is bound to; empty for credentials
+	// that are not bound to one
+	Tenant string
+}
+
+// Allows reports whether the principal was granted scope or a scope that includes it
+func (p *Principal) Allows(scope string) bool {
+	needed, ok := scopeRank[scope]
+	if !ok {
+		return false
+	}
+	for _, granted := range p.Scopes {
+		if scopeRank[granted] >= needed {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of a request, if it was authenticated
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// UnauthorizedError is returned when a request carries no valid credentials
+type UnauthorizedError struct {
+	Reason string
+}
+
+func (e *UnauthorizedError) Error() string {
+	if e.Reason == "" {
+		return "Authentication is required"
+	}
+	return e.Reason
+}
+
+// ForbiddenError is returned when the caller lacks the scope an action needs,
+// or when a policy denies the action; Reason then explains why
+type ForbiddenError struct {
+	Scope  string
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("The %s scope is required", e.Scope)
+}
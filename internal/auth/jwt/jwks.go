@@ -0,0 +1,288 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// maxJWKSBytes bounds the size of a fetched key set
+const maxJWKSBytes = 1 << 20
+
+// DefaultMinRefresh limits how often an unknown key ID or a failed load triggers a reload, so
+// tokens with made-up key IDs or an outage cannot make the server hammer the identity provider
+const DefaultMinRefresh = 30 * time.Second
+
+// key is a verification key of the set
+type key struct {
+	id     string
+	alg    string
+	public crypto.PublicKey
+}
+
+// KeySet is a JSON Web Key Set loaded from a file or URL. Keys are cached for
+// the refresh interval and reloaded early when a token names an unknown key,
+// which picks up keys the identity provider rotated in. Concurrent requests
+// share a single load, and no request waits for a load it did not need.
+type KeySet struct {
+	load       func(ctx context.Context) ([]byte, error)
+	source     string
+	refresh    time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+	loads      singleflight.Group
+
+	mu   sync.Mutex
+	keys []key
+	// fetched is when the last load was attempted, and err why it failed
+	fetched time.Time
+	err     error
+}
+
+// NewFileKeySet reads the key set from a local file
+func NewFileKeySet(path string, refresh time.Duration) *KeySet {
+	return newKeySet(path, refresh, func(context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	})
+}
+
+// NewURLKeySet fetches the key set from url, such as the jwks_uri of an OpenID provider
+func NewURLKeySet(url string, client *http.Client, refresh time.Duration) *KeySet {
+	return newKeySet(url, refresh, func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	})
+}
+
+func newKeySet(source string, refresh time.Duration, load func(ctx context.Context) ([]byte, error)) *KeySet {
+	return &KeySet{
+		load:       load,
+		source:     source,
+		refresh:    refresh,
+		minRefresh: DefaultMinRefresh,
+		now:        time.Now,
+	}
+}
+
+// Key returns the key with the given ID. A token without a key ID may only be
+// verified when the set holds exactly one key.
+func (s *KeySet) Key(ctx context.Context, id string) (crypto.PublicKey, string, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	keys, fetched, err := s.keys, s.fetched, s.err
+	s.mu.Unlock()
+
+	// After a failed load the keys are not reloaded sooner than minRefresh
+	wait := s.refresh
+	if err != nil {
+		wait = s.minRefresh
+	}
+	if fetched.IsZero() || now.Sub(fetched) >= wait {
+		keys, fetched, err = s.reload(ctx)
+	}
+	if keys == nil {
+		return nil, "", err
+	}
+
+	if found, ok := find(keys, id); ok {
+		return found.public, found.alg, nil
+	}
+	// The provider may have rotated in a key since the last load
+	if now.Sub(fetched) >= s.minRefresh {
+		if keys, _, err = s.reload(ctx); err == nil {
+			if found, ok := find(keys, id); ok {
+				return found.public, found.alg, nil
+			}
+		}
+	}
+	return nil, "", errUnknownKey
+}
+
+func find(keys []key, id string) (key, bool) {
+	if id == "" {
+		if len(keys) == 1 {
+			return keys[0], true
+		}
+		return key{}, false
+	}
+	for _, k := range keys {
+		if k.id == id {
+			return k, true
+		}
+	}
+	return key{}, false
+}
+
+// loaded is the outcome of a load shared by the requests that waited for it
+type loaded struct {
+	keys    []key
+	fetched time.Time
+}
+
+// reload loads the keys, or waits for the load already running, and returns the keys in use
+// with the time of the load. On failure the previous keys stay in use until the next attempt,
+// so a short outage of the provider does not lock everybody out.
+func (s *KeySet) reload(ctx context.Context) ([]key, time.Time, error) {
+	result, err, _ := s.loads.Do("", func() (interface{}, error) {
+		// The load is shared, so it must not end when the request that started it does
+		data, err := s.load(context.WithoutCancel(ctx))
+		var keys []key
+		if err == nil {
+			keys, err = parseKeySet(data)
+		}
+		if err != nil {
+			log.WithError(err).WithField("jwks", s.source).Error("Failed to load the JSON Web Key Set")
+			err = fmt.Errorf("failed to load the JSON Web Key Set: %w", err)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetched = s.now()
+		s.err = err
+		if err == nil {
+			s.keys = keys
+		}
+		return loaded{keys: s.keys, fetched: s.fetched}, err
+	})
+	current := result.(loaded)
+	return current.keys, current.fetched, err
+}
+
+// jwk is the JSON form of a key; only public key members are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseKeySet decodes the signing keys of a key set. Keys for other uses or of
+// unsupported types are skipped, as RFC 7517 asks.
+func parseKeySet(data []byte) ([]key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	keys := make([]key, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.publicKey()
+		if err != nil {
+			log.WithError(err).WithField("kid", k.Kid).Warn("Skipping unusable JSON Web Key")
+			continue
+		}
+		keys = append(keys, key{id: k.Kid, alg: k.Alg, public: public})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the key set holds no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("the point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,337 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+)
+
+const (
+	testIssuer   = "https://sso.example.com"
+	testAudience = "geolocation-service"
+)
+
+var testNow = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// signer signs tokens with a locally generated key
+type signer struct {
+	kid     string
+	alg     string
+	private crypto.Signer
+}
+
+func newRSASigner(t *testing.T, kid string) signer {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return signer{kid: kid, alg: "RS256", private: private}
+}
+
+func newECSigner(t *testing.T, kid string) signer {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return signer{kid: kid, alg: "ES256", private: private}
+}
+
+func newEdSigner(t *testing.T, kid string) signer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return signer{kid: kid, alg: "EdDSA", private: private}
+}
+
+// jwk returns the public key in JSON Web Key form
+func (s signer) jwk() map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch public := s.private.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig", "alg": s.alg,
+			"n": encode(public.N.Bytes()), "e": encode(big.NewInt(int64(public.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": s.kid, "crv": "P-256",
+			"x": encode(public.X.FillBytes(make([]byte, 32))), "y": encode(public.Y.FillBytes(make([]byte, 32)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": s.kid, "crv": "Ed25519", "x": encode(public)}
+	}
+	panic("unsupported key")
+}
+
+func (s signer) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"}) + "." + encode(claims)
+
+	var signature []byte
+	var err error
+	switch private := s.private.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(private, []byte(signed))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		r, sig, signErr := ecdsa.Sign(rand.Reader, private, digest[:])
+		require.NoError(t, signErr)
+		signature = append(r.FillBytes(make([]byte, 32)), sig.FillBytes(make([]byte, 32))...)
+	default:
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = s.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+		require.NoError(t, err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func keySet(signers ...signer) []byte {
+	keys := make([]map[string]string, len(signers))
+	for i, s := range signers {
+		keys[i] = s.jwk()
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return data
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                testIssuer,
+		"aud":                []string{"other", testAudience},
+		"sub":                "user-1",
+		"preferred_username": "ada",
+		"exp":                testNow.Add(time.Hour).Unix(),
+		"iat":                testNow.Add(-time.Minute).Unix(),
+		"realm_access":       map[string]interface{}{"roles": []string{"geo-editor", "offline_access"}},
+		"org":                map[string]interface{}{"tenant": "acme"},
+	}
+}
+
+func newTestVerifier(t *testing.T, keys *KeySet) *Verifier {
+	t.Helper()
+	verifier, err := NewVerifier(keys, Options{
+		Issuer:      testIssuer,
+		Audiences:   []string{testAudience},
+		Leeway:      30 * time.Second,
+		RolesClaim:  "realm_access.roles",
+		TenantClaim: "org.tenant",
+		RoleScopes: map[string][]string{
+			"geo-viewer": {auth.ScopeRead},
+			"geo-editor": {auth.ScopeRead, auth.ScopeWrite},
+		},
+	})
+	require.NoError(t, err)
+	verifier.now = func() time.Time { return testNow }
+	keys.now = verifier.now
+	return verifier
+}
+
+func fileKeySet(t *testing.T, signers ...signer) *KeySet {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, keySet(signers...), 0o600))
+	return NewFileKeySet(path, time.Hour)
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, ecKey, edKey := newRSASigner(t, "rsa"), newECSigner(t, "ec"), newEdSigner(t, "ed")
+	verifier := newTestVerifier(t, fileKeySet(t, rsaKey, ecKey, edKey))
+
+	for _, s := range []signer{rsaKey, ecKey, edKey} {
+		principal, err := verifier.Verify(context.Background(), s.sign(t, validClaims()))
+		require.NoError(t, err, s.alg)
+		assert.Equal(t, &auth.Principal{
+			ID:     "user-1",
+			Name:   "ada",
+			Method: auth.MethodJWT,
+			Scopes: []string{auth.ScopeRead, auth.ScopeWrite},
+			Roles:  []string{"geo-editor", "offline_access"},
+			Tenant: "acme",
+		}, principal, s.alg)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	rsaKey := newRSASigner(t, "rsa")
+	verifier := newTestVerifier(t, fileKeySet(t, rsaKey))
+	with := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	token := rsaKey.sign(t, validClaims())
+	tests := map[string]string{
+		"malformed":        "not.a-token",
+		"unsigned":         base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + strings.Split(token, ".")[1] + ".",
+		"tampered":         token[:len(token)-4] + "AAAA",
+		"unknown key":      newRSASigner(t, "other").sign(t, validClaims()),
+		"foreign key":      signer{kid: "rsa", alg: "RS256", private: newRSASigner(t, "x").private}.sign(t, validClaims()),
+		"wrong issuer":     rsaKey.sign(t, with("iss", "https://evil.example.com")),
+		"wrong audience":   rsaKey.sign(t, with("aud", "another-service")),
+		"missing subject":  rsaKey.sign(t, with("sub", nil)),
+		"missing expiry":   rsaKey.sign(t, with("exp", nil)),
+		"expired":          rsaKey.sign(t, with("exp", testNow.Add(-time.Minute).Unix())),
+		"not yet valid":    rsaKey.sign(t, with("nbf", testNow.Add(time.Hour).Unix())),
+		"issued in future": rsaKey.sign(t, with("iat", testNow.Add(time.Hour).Unix())),
+		"algorithm of key": signer{kid: "rsa", alg: "RS384", private: rsaKey.private}.sign(t, validClaims()),
+		"symmetric":        signer{kid: "rsa", alg: "HS256", private: rsaKey.private}.sign(t, validClaims()),
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), token)
+			var unauthorized *auth.UnauthorizedError
+			assert.ErrorAs(t, err, &unauthorized)
+		})
+	}
+
+	// Expiry within the leeway is tolerated
+	_, err := verifier.Verify(context.Background(), rsaKey.sign(t, with("exp", testNow.Add(-10*time.Second).Unix())))
+	assert.NoError(t, err)
+}
+
+func TestRolesWithoutScopes(t *testing.T) {
+	rsaKey := newRSASigner(t, "rsa")
+	verifier := newTestVerifier(t, fileKeySet(t, rsaKey))
+
+	claims := validClaims()
+	claims["realm_access"] = map[string]interface{}{"roles": []string{"unmapped"}}
+	principal, err := verifier.Verify(context.Background(), rsaKey.sign(t, claims))
+	require.NoError(t, err)
+	assert.Empty(t, principal.Scopes)
+	assert.False(t, principal.Allows(auth.ScopeRead))
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := newRSASigner(t, "2024"), newRSASigner(t, "2025")
+
+	var published atomic.Value
+	published.Store(keySet(oldKey))
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(published.Load().([]byte))
+	}))
+	defer server.Close()
+
+	keys := NewURLKeySet(server.URL, server.Client(), time.Hour)
+	verifier := newTestVerifier(t, keys)
+	now := testNow
+	keys.now = func() time.Time { return now }
+	verifier.now = keys.now
+
+	_, err := verifier.Verify(context.Background(), oldKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), oldKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load(), "keys are cached")
+
+	// The provider rotates in a new key; an unknown key ID reloads the set
+	published.Store(keySet(newKey))
+	now = now.Add(DefaultMinRefresh)
+	_, err = verifier.Verify(context.Background(), newKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// Unknown key IDs do not reload again before the minimum interval
+	_, err = verifier.Verify(context.Background(), newRSASigner(t, "forged").sign(t, validClaims()))
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), fetches.Load())
+
+	// An outage after the refresh interval keeps the cached keys in use
+	published.Store([]byte("not json"))
+	now = now.Add(2 * time.Hour)
+	claims := validClaims()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	_, err = verifier.Verify(context.Background(), newKey.sign(t, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), fetches.Load())
+}
+
+func TestFailedLoadsBackOff(t *testing.T) {
+	signingKey := newRSASigner(t, "2025")
+	var published atomic.Value
+	published.Store([]byte("not json"))
+	var loads atomic.Int32
+	release := make(chan struct{})
+	keys := newKeySet("test", time.Hour, func(context.Context) ([]byte, error) {
+		loads.Add(1)
+		<-release
+		return published.Load().([]byte), nil
+	})
+	now := testNow
+	keys.now = func() time.Time { return now }
+
+	// Requests arriving during a load wait for it instead of starting their own
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := keys.Key(context.Background(), "2025")
+			assert.Error(t, err)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	// A failed load is not retried before the minimum interval
+	_, _, err := keys.Key(context.Background(), "2025")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), loads.Load())
+
+	published.Store(keySet(signingKey))
+	now = now.Add(DefaultMinRefresh)
+	_, _, err = keys.Key(context.Background(), "2025")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), loads.Load())
+}
+
+func TestNewVerifierValidation(t *testing.T) {
+	keys := NewFileKeySet("unused", time.Hour)
+
+	_, err := NewVerifier(keys, Options{Audiences: []string{testAudience}})
+	assert.Error(t, err, "issuer is required")
+	_, err = NewVerifier(keys, Options{Issuer: testIssuer})
+	assert.Error(t, err, "audience is required")
+	_, err = NewVerifier(keys, Options{Issuer: testIssuer, Audiences: []string{testAudience},
+		RoleScopes: map[string][]string{"geo-admin": {"root"}}})
+	assert.Error(t, err, "scopes must be known")
+}
+
+func TestMissingKeySet(t *testing.T) {
+	verifier := newTestVerifier(t, NewFileKeySet(filepath.Join(t.TempDir(), "absent.json"), time.Hour))
+
+	_, err := verifier.Verify(context.Background(), newRSASigner(t, "rsa").sign(t, validClaims()))
+	var unauthorized *auth.UnauthorizedError
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &unauthorized), "an unavailable key set is a server error")
+}
@@ -0,0 +1,338 @@
+// Package jwt verifies JSON Web Tokens issued by a single sign-on provider and
+// turns their claims into an auth.Principal. Tokens must be signed with a key
+// of the provider's JSON Web Key Set; symmetric and unsigned tokens are refused.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+)
+
+// DefaultRolesClaim is the claim holding the roles of a token when none is configured
+const DefaultRolesClaim = "roles"
+
+var errUnknownKey = errors.New("signed with an unknown key")
+
+// Options configures a Verifier
+type Options struct {
+	// Issuer must equal the iss claim
+	Issuer string
+	// Audiences lists accepted values of the aud claim; a token must name at least one
+	Audiences []string
+	// Leeway tolerates clock skew when checking exp, nbf and iat
+	Leeway time.Duration
+	// RolesClaim is the claim holding the roles, with dots separating nested
+	// objects such as realm_access.roles. Its value may be an array or a space separated string.
+	RolesClaim string
+	// RoleScopes grants scopes to the holders of each role
+	RoleScopes map[string][]string
+	// TenantClaim is the claim binding a token to a tenant, with dots
+	// separating nested objects; empty leaves tokens unbound
+	TenantClaim string
+}
+
+// Verifier checks bearer tokens against a key set
+type Verifier struct {
+	keys    *KeySet
+	options Options
+	now     func() time.Time
+}
+
+// NewVerifier creates a verifier of tokens signed by keys
+func NewVerifier(keys *KeySet, options Options) (*Verifier, error) {
+	if options.Issuer == "" {
+		return nil, errors.New("the token issuer is required")
+	}
+	if len(options.Audiences) == 0 {
+		return nil, errors.New("at least one token audience is required")
+	}
+	for role, scopes := range options.RoleScopes {
+		for _, scope := range scopes {
+			if !auth.ValidScope(scope) {
+				return nil, fmt.Errorf("role %q maps to unknown scope %q", role, scope)
+			}
+		}
+	}
+	if options.RolesClaim == "" {
+		options.RolesClaim = DefaultRolesClaim
+	}
+
+	return &Verifier{
+		keys:    keys,
+		options: options,
+		now:     time.Now,
+	}, nil
+}
+
+// header is the JOSE header of a token
+type header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Typ  string   `json:"typ"`
+	Crit []string `json:"crit"`
+}
+
+// Verify checks the signature and registered claims of a compact serialized
+// token and returns the principal it identifies
+func (v *Verifier) Verify(ctx context.Context, token string) (*auth.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("it is not a signed JWT")
+	}
+
+	var h header
+	if err := decodePart(parts[0], &h); err != nil {
+		return nil, invalid("the header is malformed")
+	}
+	if len(h.Crit) > 0 {
+		return nil, invalid("it uses unsupported critical extensions")
+	}
+	hash, ok := algorithms[h.Alg]
+	if !ok {
+		return nil, invalid(fmt.Sprintf("the %q algorithm is not accepted", h.Alg))
+	}
+
+	public, keyAlg, err := v.keys.Key(ctx, h.Kid)
+	if errors.Is(err, errUnknownKey) {
+		return nil, invalid(err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if keyAlg != "" && keyAlg != h.Alg {
+		return nil, invalid(errKeyAlgorithm.Error())
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("the signature is malformed")
+	}
+	if err := verifySignature(h.Alg, hash, public, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	var claims map[string]interface{}
+	if err := decodePart(parts[1], &claims); err != nil {
+		return nil, invalid("the claims are malformed")
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return v.principal(claims), nil
+}
+
+// checkClaims validates the issuer, audience and validity period
+func (v *Verifier) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != v.options.Issuer {
+		return invalid("it was issued by an unexpected issuer")
+	}
+	if !v.audienceMatches(claims["aud"]) {
+		return invalid("it is intended for another audience")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return invalid("the sub claim is missing")
+	}
+
+	now := v.now()
+	leeway := v.options.Leeway
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return invalid("the exp claim is missing")
+	}
+	if !now.Before(exp.Add(leeway)) {
+		return invalid("it has expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(leeway).Before(nbf) {
+		return invalid("it is not valid yet")
+	}
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(leeway).Before(iat) {
+		return invalid("it was issued in the future")
+	}
+	return nil
+}
+
+func (v *Verifier) audienceMatches(aud interface{}) bool {
+	var audiences []string
+	switch aud := aud.(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	for _, a := range audiences {
+		for _, accepted := range v.options.Audiences {
+			if a == accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// principal maps the claims of a verified token to the caller
+func (v *Verifier) principal(claims map[string]interface{}) *auth.Principal {
+	sub, _ := claims["sub"].(string)
+	principal := &auth.Principal{
+		ID:     sub,
+		Name:   sub,
+		Method: auth.MethodJWT,
+		Roles:  stringList(lookup(claims, v.options.RolesClaim)),
+	}
+	if v.options.TenantClaim != "" {
+		principal.Tenant, _ = lookup(claims, v.options.TenantClaim).(string)
+	}
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if name, _ := claims[claim].(string); name != "" {
+			principal.Name = name
+			break
+		}
+	}
+
+	granted := make(map[string]bool)
+	for _, role := range principal.Roles {
+		for _, scope := range v.options.RoleScopes[role] {
+			granted[scope] = true
+		}
+	}
+	for scope := range granted {
+		principal.Scopes = append(principal.Scopes, scope)
+	}
+	sort.Strings(principal.Scopes)
+	return principal
+}
+
+// algorithms maps the accepted signature algorithms to their hash
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+// curveBits is the curve size each ECDSA algorithm is defined for
+var curveBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+var (
+	errSignature    = errors.New("the signature does not match")
+	errKeyAlgorithm = errors.New("the algorithm does not match the key")
+)
+
+func verifySignature(alg string, hash crypto.Hash, public crypto.PublicKey, signed, signature []byte) error {
+	if alg == "EdDSA" {
+		key, ok := public.(ed25519.PublicKey)
+		if !ok {
+			return errKeyAlgorithm
+		}
+		if !ed25519.Verify(key, signed, signature) {
+			return errSignature
+		}
+		return nil
+	}
+
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	var valid bool
+	switch family := alg[:2]; family {
+	case "RS", "PS":
+		key, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return errKeyAlgorithm
+		}
+		if family == "RS" {
+			valid = rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+		} else {
+			valid = rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	default:
+		key, ok := public.(*ecdsa.PublicKey)
+		if !ok || key.Curve.Params().BitSize != curveBits[alg] {
+			return errKeyAlgorithm
+		}
+		// JWS encodes the signature as r and s, each big-endian and padded to the curve size
+		size := (curveBits[alg] + 7) / 8
+		if len(signature) == 2*size {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(key, digest, r, s)
+		}
+	}
+
+	if !valid {
+		return errSignature
+	}
+	return nil
+}
+
+func decodePart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate reads a claim holding seconds since the epoch
+func numericDate(claim interface{}) (time.Time, bool) {
+	seconds, ok := claim.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second))), true
+}
+
+// lookup follows a dotted path through nested claims
+func lookup(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// stringList reads a claim that is an array of strings or a space separated string
+func stringList(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		var values []string
+		for _, v := range claim {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func invalid(reason string) error {
+	return &auth.UnauthorizedError{Reason: "The bearer token is invalid: " + reason}
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published by the services
+const (
+	LocationCreated = "location.created"
+	LocationUpdated = "location.updated"
+	LocationDeleted = "location.deleted"
+	ZoneEnter       = "zone.enter"
+	ZoneExit        = "zone.exit"
+	ZoneDwell       = "zone.dwell"
+)
+
+// Types lists every event type published by the services
+var Types = []string{LocationCreated, LocationUpdated, LocationDeleted, ZoneEnter, ZoneExit, ZoneDwell}
+
+// Event is a change that happened in one of the services
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Tenant     string      `json:"tenant,omitempty"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// New creates an event with a fresh ID stamped with the current time
+func New(eventType string, data interface{}) Event {
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	}
+}
+
+// ForTenant creates an event that happened in the data of a tenant
+func ForTenant(tenant, eventType string, data interface{}) Event {
+	event := New(eventType, data)
+	event.Tenant = tenant
+	return event
+}
+
+// Publisher receives events. Implementations must not block the caller for long.
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Bus fans every published event out to its subscribers in registration order
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []Publisher
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a publisher to receive every event published on the bus
+func (b *Bus) Subscribe(subscriber Publisher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// Publish delivers the event to every subscriber
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	subscribers := append([]Publisher(nil), b.subscribers...)
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		subscriber.Publish(event)
+	}
+}
+
+// Nop discards every event
+type Nop struct{}
+
+// Publish ignores the event
+func (Nop) Publish(Event) {}
@@ -0,0 +1,494 @@
+package graphql
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/access"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/stream"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// resolver resolves the schema fields through LocationBC and the location stream
+type resolver struct {
+	service location.LocationBC
+	broker  *stream.Broker
+	policy  *access.Policy
+}
+
+// NewSchema builds the GraphQL schema over locations. Subscriptions are fed by broker and
+// limited to the locations policy lets the subscriber read; a nil policy limits nothing.
+func NewSchema(service location.LocationBC, broker *stream.Broker, policy *access.Policy) (graphql.Schema, error) {
+	r := &resolver{service: service, broker: broker, policy: policy}
+
+	var locationType *graphql.Object
+
+	nearestMatchType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NearestMatch",
+		Description: "A location and its distance from the point a query was made for",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"location": &graphql.Field{
+					Type: graphql.NewNonNull(locationType),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(location.NearestMatch).Location, nil
+					},
+				},
+				"distanceKm": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.Float),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(location.NearestMatch).DistanceKm, nil
+					},
+				},
+			}
+		}),
+	})
+
+	locationType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Location",
+		Description: "A registered station",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        locationField(graphql.NewNonNull(graphql.Int), func(l *location.Location) interface{} { return int(l.ID) }),
+				"uuid":      locationField(graphql.NewNonNull(graphql.ID), func(l *location.Location) interface{} { return l.UUID.String() }),
+				"name":      locationField(graphql.NewNonNull(graphql.String), func(l *location.Location) interface{} { return l.Name }),
+				"latitude":  locationField(graphql.NewNonNull(graphql.Float), func(l *location.Location) interface{} { return l.Latitude }),
+				"longitude": locationField(graphql.NewNonNull(graphql.Float), func(l *location.Location) interface{} { return l.Longitude }),
+				"category":  locationField(graphql.String, func(l *location.Location) interface{} { return l.Category }),
+				"radiusM":   locationField(graphql.Float, func(l *location.Location) interface{} { return l.RadiusMeters }),
+				"createdAt": locationField(graphql.NewNonNull(graphql.DateTime), func(l *location.Location) interface{} { return l.CreatedAt }),
+				"updatedAt": locationField(graphql.NewNonNull(graphql.DateTime), func(l *location.Location) interface{} { return l.UpdatedAt }),
+				"distanceKm": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.Float),
+					Description: "Great-circle distance in kilometers from the given point",
+					Args:        pointArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						lat, lng, err := pointFromArgs(p.Args)
+						if err != nil {
+							return nil, err
+						}
+						l := asLocation(p.Source)
+						return (&location.DistanceCalculator{}).HaversineDistance(lat, lng, l.Latitude, l.Longitude), nil
+					},
+				},
+				"nearestNeighbours": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(nearestMatchType))),
+					Description: "The k other locations closest to this one, nearest first",
+					Args: graphql.FieldConfigArgument{
+						"k": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 3},
+					},
+					Resolve: r.nearestNeighbours,
+				},
+			}
+		}),
+	})
+
+	locationEventType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "LocationEvent",
+		Description: "A location that was created, updated or deleted",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return strconv.FormatUint(p.Source.(stream.Message).ID, 10), nil
+				},
+			},
+			"type": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "location.created, location.updated or location.deleted",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(stream.Message).Type, nil
+				},
+			},
+			"location": &graphql.Field{
+				Type: graphql.NewNonNull(locationType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					msg := p.Source.(stream.Message)
+					return &msg.Location, nil
+				},
+			},
+			"occurredAt": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(stream.Message).OccurredAt, nil
+				},
+			},
+		},
+	})
+
+	boundingBoxInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "BoundingBoxInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"minLatitude":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"minLongitude": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"maxLatitude":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"maxLongitude": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+
+	locationInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "LocationInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"latitude":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"longitude": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"category":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"radiusM":   &graphql.InputObjectFieldConfig{Type: graphql.Float},
+		},
+	})
+
+	nearestMatches := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(nearestMatchType)))
+	locations := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(locationType)))
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"locations": &graphql.Field{
+				Type:        locations,
+				Description: "Locations in ID order; pass the last id seen as after to fetch the next page",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: location.DefaultPageSize},
+					"after": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: r.locations,
+			},
+			"location": &graphql.Field{
+				Type: locationType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: r.location,
+			},
+			"nearest": &graphql.Field{
+				Type:        nearestMatches,
+				Description: "The k locations closest to a point, nearest first",
+				Args:        withArgs(pointArgs(), "k", &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1}),
+				Resolve:     r.nearest,
+			},
+			"withinRadius": &graphql.Field{
+				Type:        nearestMatches,
+				Description: "Every location within radiusKm of a point, nearest first",
+				Args:        withArgs(pointArgs(), "radiusKm", &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)}),
+				Resolve:     r.withinRadius,
+			},
+			"inBoundingBox": &graphql.Field{
+				Type: locations,
+				Args: graphql.FieldConfigArgument{
+					"bbox": &graphql.ArgumentConfig{Type: graphql.NewNonNull(boundingBoxInput)},
+				},
+				Resolve: r.inBoundingBox,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createLocation": &graphql.Field{
+				Type: graphql.NewNonNull(locationType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(locationInput)},
+				},
+				Resolve: r.createLocation,
+			},
+			"updateLocation": &graphql.Field{
+				Type: graphql.NewNonNull(locationType),
+				Args: graphql.FieldConfigArgument{
+					"name":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(locationInput)},
+				},
+				Resolve: r.updateLocation,
+			},
+			"deleteLocation": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: r.deleteLocation,
+			},
+		},
+	})
+
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"locationChanged": &graphql.Field{
+				Type:        graphql.NewNonNull(locationEventType),
+				Description: "Location changes, optionally limited to a bounding box and categories",
+				Args: graphql.FieldConfigArgument{
+					"bbox":       &graphql.ArgumentConfig{Type: boundingBoxInput},
+					"categories": &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+				},
+				Subscribe: r.subscribeLocationChanged,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Mutation:     mutation,
+		Subscription: subscription,
+	})
+}
+
+func (r *resolver) locations(p graphql.ResolveParams) (interface{}, error) {
+	after := p.Args["after"].(int)
+	if after < 0 {
+		return nil, &location.ValidationError{Field: "after", Message: "must not be negative"}
+	}
+
+	query := location.ListQuery{Limit: p.Args["first"].(int)}
+	if after > 0 {
+		query.After = &location.Cursor{Sort: location.SortID, ID: uint(after)}
+	}
+
+	page, err := r.service.ListLocations(p.Context, query)
+	if err != nil {
+		return nil, resolveError(err, "Failed to get locations")
+	}
+	return page.Locations, nil
+}
+
+func (r *resolver) location(p graphql.ResolveParams) (interface{}, error) {
+	found, err := r.service.GetLocation(p.Context, p.Args["name"].(string))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, resolveError(err, "Failed to get location")
+	}
+	return found, nil
+}
+
+func (r *resolver) nearest(p graphql.ResolveParams) (interface{}, error) {
+	lat, lng, err := pointFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := r.service.FindKNearest(p.Context, lat, lng, p.Args["k"].(int))
+	if _, ok := err.(*location.NoLocationsError); ok {
+		return []location.NearestMatch{}, nil
+	}
+	if err != nil {
+		return nil, resolveError(err, "Failed to find nearest locations")
+	}
+	return matches, nil
+}
+
+func (r *resolver) withinRadius(p graphql.ResolveParams) (interface{}, error) {
+	lat, lng, err := pointFromArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := r.service.FindWithinRadius(p.Context, lat, lng, p.Args["radiusKm"].(float64))
+	if err != nil {
+		return nil, resolveError(err, "Failed to find locations within radius")
+	}
+	return matches, nil
+}
+
+func (r *resolver) inBoundingBox(p graphql.ResolveParams) (interface{}, error) {
+	locations, err := r.service.FindInBoundingBox(p.Context, boundingBoxFromArg(p.Args["bbox"]))
+	if err != nil {
+		return nil, resolveError(err, "Failed to find locations in bounding box")
+	}
+	return locations, nil
+}
+
+// nearestNeighbours finds the k locations closest to the source location, leaving out the location itself
+func (r *resolver) nearestNeighbours(p graphql.ResolveParams) (interface{}, error) {
+	k := p.Args["k"].(int)
+	if k < 1 || k >= location.MaxNearest {
+		return nil, &location.ValidationError{Field: "k", Message: "must be between 1 and 49"}
+	}
+
+	self := asLocation(p.Source)
+	matches, err := r.service.FindKNearest(p.Context, self.Latitude, self.Longitude, k+1)
+	if err != nil {
+		return nil, resolveError(err, "Failed to find nearest neighbours")
+	}
+
+	neighbours := make([]location.NearestMatch, 0, k)
+	for _, match := range matches {
+		if match.Location.ID != self.ID && len(neighbours) < k {
+			neighbours = append(neighbours, match)
+		}
+	}
+	return neighbours, nil
+}
+
+func (r *resolver) createLocation(p graphql.ResolveParams) (interface{}, error) {
+	input := p.Args["input"].(map[string]interface{})
+	req := location.CreateLocationRequest{
+		Name:      input["name"].(string),
+		Latitude:  input["latitude"].(float64),
+		Longitude: input["longitude"].(float64),
+	}
+	req.Category, _ = input["category"].(string)
+	req.RadiusMeters, _ = input["radiusM"].(float64)
+
+	if err := validateInput(req.Name, req.Latitude, req.Longitude, req.RadiusMeters); err != nil {
+		return nil, err
+	}
+
+	created, err := r.service.CreateLocation(p.Context, req)
+	if err != nil {
+		return nil, resolveError(err, "Failed to create location")
+	}
+	return created, nil
+}
+
+func (r *resolver) updateLocation(p graphql.ResolveParams) (interface{}, error) {
+	input := p.Args["input"].(map[string]interface{})
+	req := location.UpdateLocationRequest{
+		Name:      input["name"].(string),
+		Latitude:  input["latitude"].(float64),
+		Longitude: input["longitude"].(float64),
+	}
+	req.Category, _ = input["category"].(string)
+	req.RadiusMeters, _ = input["radiusM"].(float64)
+
+	if err := validateInput(req.Name, req.Latitude, req.Longitude, req.RadiusMeters); err != nil {
+		return nil, err
+	}
+
+	updated, err := r.service.UpdateLocation(p.Context, p.Args["name"].(string), req)
+	if err != nil {
+		return nil, resolveError(err, "Failed to update location")
+	}
+	return updated, nil
+}
+
+func (r *resolver) deleteLocation(p graphql.ResolveParams) (interface{}, error) {
+	if err := r.service.DeleteLocationByName(p.Context, p.Args["name"].(string)); err != nil {
+		return nil, resolveError(err, "Failed to delete location")
+	}
+	return true, nil
+}
+
+// subscribeLocationChanged returns a channel of stream messages that closes when the subscription ends
+func (r *resolver) subscribeLocationChanged(p graphql.ResolveParams) (interface{}, error) {
+	principal, _ := auth.FromContext(p.Context)
+	filter := stream.Filter{Tenant: tenant.FromContext(p.Context), Visible: r.policy.Readable(principal)}
+	if arg, ok := p.Args["bbox"]; ok && arg != nil {
+		box := boundingBoxFromArg(arg)
+		if err := box.Validate(); err != nil {
+			return nil, err
+		}
+		filter.BBox = &box
+	}
+	if categories, ok := p.Args["categories"].([]interface{}); ok {
+		for _, category := range categories {
+			filter.Categories = append(filter.Categories, category.(string))
+		}
+	}
+
+	sub, _, _ := r.broker.Subscribe(filter, 0)
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		defer r.broker.Unsubscribe(sub)
+		for {
+			select {
+			case <-p.Context.Done():
+				return
+			case msg, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				select {
+				case out <- msg:
+				case <-p.Context.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// locationField resolves a scalar field of a location
+func locationField(fieldType graphql.Output, value func(*location.Location) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return value(asLocation(p.Source)), nil
+		},
+	}
+}
+
+// asLocation accepts a location by value, as found in lists, or by pointer
+func asLocation(source interface{}) *location.Location {
+	if l, ok := source.(location.Location); ok {
+		return &l
+	}
+	return source.(*location.Location)
+}
+
+func pointArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"latitude":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
+		"longitude": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)},
+	}
+}
+
+func withArgs(args graphql.FieldConfigArgument, name string, arg *graphql.ArgumentConfig) graphql.FieldConfigArgument {
+	args[name] = arg
+	return args
+}
+
+func pointFromArgs(args map[string]interface{}) (float64, float64, error) {
+	lat, lng := args["latitude"].(float64), args["longitude"].(float64)
+	if err := location.ValidateCoordinates(lat, lng); err != nil {
+		return 0, 0, err
+	}
+	return lat, lng, nil
+}
+
+func boundingBoxFromArg(arg interface{}) location.BoundingBox {
+	fields := arg.(map[string]interface{})
+	return location.BoundingBox{
+		MinLat: fields["minLatitude"].(float64),
+		MinLng: fields["minLongitude"].(float64),
+		MaxLat: fields["maxLatitude"].(float64),
+		MaxLng: fields["maxLongitude"].(float64),
+	}
+}
+
+func validateInput(name string, lat, lng, radius float64) error {
+	if name == "" {
+		return &location.ValidationError{Field: "name", Message: "is required"}
+	}
+	if radius < 0 {
+		return &location.ValidationError{Field: "radiusM", Message: "must not be negative"}
+	}
+	return location.ValidateCoordinates(lat, lng)
+}
+
+// resolveError passes client errors through and hides unexpected ones behind message
+func resolveError(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("Location not found")
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return errors.New("The name is already taken")
+	}
+
+	switch err.(type) {
+	case *location.ValidationError, *location.DuplicateNameError, *location.NoLocationsError, *location.QuotaExceededError, *auth.ForbiddenError:
+		return err
+	default:
+		log.WithError(err).Error(message)
+		return errors.New(message)
+	}
+}
@@ -0,0 +1,197 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/stream"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory LocationStore
+type memStore struct {
+	location.LocationStore
+	locations []location.Location
+}
+
+func (m *memStore) Create(ctx context.Context, l *location.Location) error {
+	l.ID = uint(len(m.locations) + 1)
+	m.locations = append(m.locations, *l)
+	return nil
+}
+
+func (m *memStore) GetAll() ([]location.Location, error) {
+	return m.locations, nil
+}
+
+// List supports the default ID order only
+func (m *memStore) List(query location.ListQuery) ([]location.Location, error) {
+	var afterID uint
+	if query.After != nil {
+		afterID = query.After.ID
+	}
+
+	var page []location.Location
+	for _, l := range m.locations {
+		if l.ID > afterID && len(page) < query.Limit {
+			page = append(page, l)
+		}
+	}
+	return page, nil
+}
+
+func (m *memStore) GetInBoundingBox(box location.BoundingBox) ([]location.Location, error) {
+	var inside []location.Location
+	for _, l := range m.locations {
+		if box.Contains(l.Latitude, l.Longitude) {
+			inside = append(inside, l)
+		}
+	}
+	return inside, nil
+}
+
+func (m *memStore) GetByName(name string) (*location.Location, error) {
+	for _, l := range m.locations {
+		if l.Name == name {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) GetByUUID(id uuid.UUID) (*location.Location, error) {
+	for _, l := range m.locations {
+		if l.UUID == id {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) NameExists(name string) (bool, error) {
+	_, err := m.GetByName(name)
+	return err == nil, nil
+}
+
+func (m *memStore) Update(ctx context.Context, l *location.Location) error {
+	m.locations[l.ID-1] = *l
+	return nil
+}
+
+func newSchema(t *testing.T, broker *stream.Broker) graphql.Schema {
+	t.Helper()
+
+	store := &memStore{}
+	for _, l := range []location.Location{
+		{Name: "Near", Latitude: 0, Longitude: 0.01, Category: "fuel"},
+		{Name: "Middle", Latitude: 0, Longitude: 0.1},
+		{Name: "Far", Latitude: 0, Longitude: 1},
+	} {
+		require.NoError(t, store.Create(context.Background(), &l))
+	}
+
+	schema, err := NewSchema(location.NewLocationService(store, &location.DistanceCalculator{}, nil), broker, nil)
+	require.NoError(t, err)
+	return schema
+}
+
+// run executes a query and returns its data re-encoded as JSON for easy comparison
+func run(t *testing.T, schema graphql.Schema, query string) (string, *graphql.Result) {
+	t.Helper()
+
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: query, Context: context.Background()})
+	data, err := json.Marshal(result.Data)
+	require.NoError(t, err)
+	return string(data), result
+}
+
+func TestQueries(t *testing.T) {
+	schema := newSchema(t, stream.NewBroker(10, 10))
+
+	data, result := run(t, schema, `{ locations(first: 2, after: 1) { name } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"locations": [{"name": "Middle"}, {"name": "Far"}]}`, data)
+
+	data, result = run(t, schema, `{ location(name: "Near") { category } missing: location(name: "Nowhere") { name } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"location": {"category": "fuel"}, "missing": null}`, data)
+
+	data, result = run(t, schema, `{ nearest(latitude: 0, longitude: 0, k: 2) { location { name nearestNeighbours(k: 1) { location { name } } } } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"nearest": [
+		{"location": {"name": "Near", "nearestNeighbours": [{"location": {"name": "Middle"}}]}},
+		{"location": {"name": "Middle", "nearestNeighbours": [{"location": {"name": "Near"}}]}}
+	]}`, data)
+
+	data, result = run(t, schema, `{ withinRadius(latitude: 0, longitude: 0, radiusKm: 20) { location { name } } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"withinRadius": [{"location": {"name": "Near"}}, {"location": {"name": "Middle"}}]}`, data)
+
+	data, result = run(t, schema, `{ inBoundingBox(bbox: {minLatitude: -1, minLongitude: 0.05, maxLatitude: 1, maxLongitude: 0.5}) { name distanceKm(latitude: 0, longitude: 0.1) } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"inBoundingBox": [{"name": "Middle", "distanceKm": 0}]}`, data)
+
+	_, result = run(t, schema, `{ nearest(latitude: 95, longitude: 0) { distanceKm } }`)
+	require.True(t, result.HasErrors())
+	assert.Contains(t, result.Errors[0].Message, "latitude")
+}
+
+func TestMutations(t *testing.T) {
+	schema := newSchema(t, stream.NewBroker(10, 10))
+
+	data, result := run(t, schema, `mutation { createLocation(input: {name: "New", latitude: 1, longitude: 2, radiusM: 50}) { id name radiusM } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"createLocation": {"id": 4, "name": "New", "radiusM": 50}}`, data)
+
+	_, result = run(t, schema, `mutation { createLocation(input: {name: "New", latitude: 1, longitude: 2}) { id } }`)
+	require.True(t, result.HasErrors())
+	assert.Contains(t, result.Errors[0].Message, "already exists")
+
+	data, result = run(t, schema, `mutation { updateLocation(name: "New", input: {name: "Renamed", latitude: 3, longitude: 4}) { name latitude } }`)
+	require.False(t, result.HasErrors(), "%v", result.Errors)
+	assert.JSONEq(t, `{"updateLocation": {"name": "Renamed", "latitude": 3}}`, data)
+
+	_, result = run(t, schema, `mutation { deleteLocation(name: "Nowhere") }`)
+	require.True(t, result.HasErrors())
+	assert.Equal(t, "Location not found", result.Errors[0].Message)
+}
+
+func TestLocationChangedSubscription(t *testing.T) {
+	broker := stream.NewBroker(10, 10)
+	schema := newSchema(t, broker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := graphql.Subscribe(graphql.Params{
+		Schema:        schema,
+		RequestString: `subscription { locationChanged(categories: ["fuel"]) { type location { name } } }`,
+		Context:       ctx,
+	})
+
+	// Wait for the subscription to register before publishing
+	require.Eventually(t, func() bool {
+		broker.Publish(events.New(events.LocationCreated, &location.Location{Name: "Skipped"}))
+		broker.Publish(events.New(events.LocationUpdated, &location.Location{Name: "Pump", Category: "fuel"}))
+		select {
+		case result := <-results:
+			data, _ := json.Marshal(result.Data)
+			assert.JSONEq(t, `{"locationChanged": {"type": "location.updated", "location": {"name": "Pump"}}}`, string(data))
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	for range results {
+	}
+}
@@ -0,0 +1,77 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+
+	locationv1 "github.com/youngprinnce/geolocation-service/api/proto/location/v1"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys carrying the credentials of a call, like the X-API-Key and Authorization headers
+const (
+	apiKeyMetadata        = "x-api-key"
+	authorizationMetadata = "authorization"
+)
+
+// Authenticator resolves the principal of a call's credentials. It returns nil
+// without an error when the call carries none; *http.Authenticator implements it.
+type Authenticator interface {
+	Resolve(ctx context.Context, key, authorization string) (*auth.Principal, error)
+}
+
+// RateLimiter counts calls against the limits of their client; *http.RateLimiter implements it
+type RateLimiter interface {
+	Admit(client string, isKey bool, method, path string) (rate, quota ratelimit.Decision, err error)
+}
+
+// methodScopes is the scope each RPC requires. Methods that are not listed,
+// such as those of the reflection service, require the admin scope.
+var methodScopes = map[string]string{
+	locationv1.LocationService_CreateLocation_FullMethodName:   auth.ScopeWrite,
+	locationv1.LocationService_DeleteLocation_FullMethodName:   auth.ScopeWrite,
+	locationv1.LocationService_GetLocation_FullMethodName:      auth.ScopeRead,
+	locationv1.LocationService_ListLocations_FullMethodName:    auth.ScopeRead,
+	locationv1.LocationService_StreamLocations_FullMethodName:  auth.ScopeRead,
+	locationv1.LocationService_FindNearest_FullMethodName:      auth.ScopeRead,
+	locationv1.LocationService_FindKNearest_FullMethodName:     auth.ScopeRead,
+	locationv1.LocationService_FindWithinRadius_FullMethodName: auth.ScopeRead,
+}
+
+// scopeOf returns the scope the RPC method requires
+func scopeOf(method string) string {
+	if scope, ok := methodScopes[method]; ok {
+		return scope
+	}
+	return auth.ScopeAdmin
+}
+
+// authenticate resolves the principal of a call and checks it was granted the scope of method.
+// Every call must carry credentials; only a nil authenticator, when authentication is
+// disabled, lets calls through without a principal.
+func authenticate(ctx context.Context, authenticator Authenticator, method string) (*auth.Principal, error) {
+	if authenticator == nil {
+		return nil, nil
+	}
+	principal, err := authenticator.Resolve(ctx, firstValue(ctx, apiKeyMetadata), firstValue(ctx, authorizationMetadata))
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, &auth.UnauthorizedError{}
+	}
+	if scope := scopeOf(method); !principal.Allows(scope) {
+		return nil, &auth.ForbiddenError{Scope: scope}
+	}
+	return principal, nil
+}
+
+// firstValue returns the first value of a metadata key, or an empty string
+func firstValue(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
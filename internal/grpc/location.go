@@ -0,0 +1,226 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	locationv1 "github.com/youngprinnce/geolocation-service/api/proto/location/v1"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// LocationServer implements the gRPC location service on top of LocationBC
+type LocationServer struct {
+	locationv1.UnimplementedLocationServiceServer
+	service location.LocationBC
+}
+
+// NewLocationServer creates a new gRPC location server
+func NewLocationServer(service location.LocationBC) *LocationServer {
+	return &LocationServer{
+		service: service,
+	}
+}
+
+// CreateLocation registers a new location
+func (s *LocationServer) CreateLocation(ctx context.Context, req *locationv1.CreateLocationRequest) (*locationv1.Location, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if req.GetRadiusM() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "radius_m must not be negative")
+	}
+	if err := location.ValidateCoordinates(req.GetLatitude(), req.GetLongitude()); err != nil {
+		return nil, toStatus(err, "Failed to create location")
+	}
+
+	created, err := s.service.CreateLocation(ctx, location.CreateLocationRequest{
+		Name:         req.GetName(),
+		Latitude:     req.GetLatitude(),
+		Longitude:    req.GetLongitude(),
+		Category:     req.GetCategory(),
+		RadiusMeters: req.GetRadiusM(),
+	})
+	if err != nil {
+		return nil, toStatus(err, "Failed to create location")
+	}
+
+	return toProto(created), nil
+}
+
+// GetLocation returns a location by name
+func (s *LocationServer) GetLocation(ctx context.Context, req *locationv1.GetLocationRequest) (*locationv1.Location, error) {
+	found, err := s.service.GetLocation(ctx, req.GetName())
+	if err != nil {
+		return nil, toStatus(err, "Failed to get location")
+	}
+
+	return toProto(found), nil
+}
+
+// ListLocations returns one page of locations in ID order
+func (s *LocationServer) ListLocations(ctx context.Context, req *locationv1.ListLocationsRequest) (*locationv1.ListLocationsResponse, error) {
+	query := location.ListQuery{Limit: int(req.GetPageSize())}
+	if query.Limit < 0 || query.Limit > location.MaxPageSize {
+		return nil, status.Error(codes.InvalidArgument, "page_size must be between 1 and 1000")
+	}
+	if token := req.GetPageToken(); token != "" {
+		cursor, err := location.DecodeCursor(token)
+		if err != nil || cursor.Sort != location.SortID {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		query.After = cursor
+	}
+
+	page, err := s.service.ListLocations(ctx, query)
+	if err != nil {
+		return nil, toStatus(err, "Failed to list locations")
+	}
+
+	resp := &locationv1.ListLocationsResponse{NextPageToken: page.NextCursor}
+	for i := range page.Locations {
+		resp.Locations = append(resp.Locations, toProto(&page.Locations[i]))
+	}
+
+	return resp, nil
+}
+
+// StreamLocations streams every location in ID order, reading them one page at a time
+func (s *LocationServer) StreamLocations(req *locationv1.StreamLocationsRequest, stream locationv1.LocationService_StreamLocationsServer) error {
+	var query location.ListQuery
+	for {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		page, err := s.service.ListLocations(stream.Context(), query)
+		if err != nil {
+			return toStatus(err, "Failed to list locations")
+		}
+
+		for i := range page.Locations {
+			if err := stream.Send(toProto(&page.Locations[i])); err != nil {
+				return err
+			}
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.After, _ = location.DecodeCursor(page.NextCursor)
+	}
+}
+
+// DeleteLocation removes a location by name
+func (s *LocationServer) DeleteLocation(ctx context.Context, req *locationv1.DeleteLocationRequest) (*emptypb.Empty, error) {
+	if err := s.service.DeleteLocationByName(ctx, req.GetName()); err != nil {
+		return nil, toStatus(err, "Failed to delete location")
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// FindNearest returns the location closest to a point
+func (s *LocationServer) FindNearest(ctx context.Context, req *locationv1.FindNearestRequest) (*locationv1.NearestMatch, error) {
+	if err := location.ValidateCoordinates(req.GetLatitude(), req.GetLongitude()); err != nil {
+		return nil, toStatus(err, "Failed to find nearest location")
+	}
+
+	nearest, distance, err := s.service.FindNearestLocation(ctx, req.GetLatitude(), req.GetLongitude())
+	if err != nil {
+		return nil, toStatus(err, "Failed to find nearest location")
+	}
+
+	return &locationv1.NearestMatch{Location: toProto(nearest), DistanceKm: distance}, nil
+}
+
+// FindKNearest returns the k locations closest to a point
+func (s *LocationServer) FindKNearest(ctx context.Context, req *locationv1.FindKNearestRequest) (*locationv1.FindKNearestResponse, error) {
+	if err := location.ValidateCoordinates(req.GetLatitude(), req.GetLongitude()); err != nil {
+		return nil, toStatus(err, "Failed to find nearest locations")
+	}
+
+	matches, err := s.service.FindKNearest(ctx, req.GetLatitude(), req.GetLongitude(), int(req.GetK()))
+	if err != nil {
+		return nil, toStatus(err, "Failed to find nearest locations")
+	}
+
+	return &locationv1.FindKNearestResponse{Matches: toProtoMatches(matches)}, nil
+}
+
+// FindWithinRadius returns every location within a radius of a point
+func (s *LocationServer) FindWithinRadius(ctx context.Context, req *locationv1.FindWithinRadiusRequest) (*locationv1.FindWithinRadiusResponse, error) {
+	if err := location.ValidateCoordinates(req.GetLatitude(), req.GetLongitude()); err != nil {
+		return nil, toStatus(err, "Failed to find locations within radius")
+	}
+
+	matches, err := s.service.FindWithinRadius(ctx, req.GetLatitude(), req.GetLongitude(), req.GetRadiusKm())
+	if err != nil {
+		return nil, toStatus(err, "Failed to find locations within radius")
+	}
+
+	return &locationv1.FindWithinRadiusResponse{Matches: toProtoMatches(matches)}, nil
+}
+
+// toStatus maps a service error to a gRPC status, logging and hiding unexpected errors
+func toStatus(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return status.Error(codes.NotFound, "Location not found")
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return status.Error(codes.AlreadyExists, "The name is already taken")
+	}
+
+	switch err.(type) {
+	case *location.ValidationError:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case *location.DuplicateNameError:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case *location.NoLocationsError:
+		return status.Error(codes.NotFound, err.Error())
+	case *location.QuotaExceededError:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case *auth.UnauthorizedError:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case *auth.ForbiddenError:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case *ratelimit.LimitedError:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		log.WithError(err).Error(message)
+		return status.Error(codes.Internal, message)
+	}
+}
+
+func toProto(l *location.Location) *locationv1.Location {
+	return &locationv1.Location{
+		Id:        uint64(l.ID),
+		Uuid:      service.UUIDToString(l.UUID),
+		Name:      l.Name,
+		Latitude:  l.Latitude,
+		Longitude: l.Longitude,
+		Category:  l.Category,
+		RadiusM:   l.RadiusMeters,
+		CreatedAt: timestamppb.New(l.CreatedAt),
+		UpdatedAt: timestamppb.New(l.UpdatedAt),
+	}
+}
+
+func toProtoMatches(matches []location.NearestMatch) []*locationv1.NearestMatch {
+	result := make([]*locationv1.NearestMatch, len(matches))
+	for i := range matches {
+		result[i] = &locationv1.NearestMatch{
+			Location:   toProto(&matches[i].Location),
+			DistanceKm: matches[i].DistanceKm,
+		}
+	}
+	return result
+}
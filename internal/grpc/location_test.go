@@ -0,0 +1,381 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	locationv1 "github.com/youngprinnce/geolocation-service/api/proto/location/v1"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory LocationStore
+type memStore struct {
+	location.LocationStore
+	locations []location.Location
+	nextID    uint
+}
+
+func (m *memStore) Create(ctx context.Context, l *location.Location) error {
+	m.nextID++
+	l.ID = m.nextID
+	m.locations = append(m.locations, *l)
+	return nil
+}
+
+func (m *memStore) GetAll() ([]location.Location, error) {
+	return m.locations, nil
+}
+
+func (m *memStore) Count(within []location.Grant) (int64, error) {
+	return int64(len(m.locations)), nil
+}
+
+// List supports the default ID order only
+func (m *memStore) List(query location.ListQuery) ([]location.Location, error) {
+	var afterID uint
+	if query.After != nil {
+		afterID = query.After.ID
+	}
+
+	var page []location.Location
+	for _, l := range m.locations {
+		if l.ID > afterID && len(page) < query.Limit {
+			page = append(page, l)
+		}
+	}
+	return page, nil
+}
+
+func (m *memStore) GetByName(name string) (*location.Location, error) {
+	for _, l := range m.locations {
+		if l.Name == name {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) NameExists(name string) (bool, error) {
+	_, err := m.GetByName(name)
+	return err == nil, nil
+}
+
+func (m *memStore) GetByUUID(id uuid.UUID) (*location.Location, error) {
+	for _, l := range m.locations {
+		if l.UUID == id {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) Delete(ctx context.Context, deleted *location.Location) error {
+	for i, l := range m.locations {
+		if l.UUID == deleted.UUID {
+			m.locations = append(m.locations[:i], m.locations[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func newClient(t *testing.T) locationv1.LocationServiceClient {
+	t.Helper()
+	return serve(t, location.NewLocationService(&memStore{}, &location.DistanceCalculator{}, nil))
+}
+
+func serve(t *testing.T, service location.LocationBC) locationv1.LocationServiceClient {
+	t.Helper()
+	return serveWith(t, service, ServerOptions{})
+}
+
+func serveWith(t *testing.T, service location.LocationBC, options ServerOptions) locationv1.LocationServiceClient {
+	t.Helper()
+	return locationv1.NewLocationServiceClient(connect(t, service, options))
+}
+
+// connect starts a server on an in-memory listener and returns a connection to it
+func connect(t *testing.T, service location.LocationBC, options ServerOptions) *grpc.ClientConn {
+	t.Helper()
+
+	server := NewServer(NewLocationServer(service), options)
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func create(t *testing.T, client locationv1.LocationServiceClient, name string, lat, lng float64) {
+	t.Helper()
+	_, err := client.CreateLocation(context.Background(), &locationv1.CreateLocationRequest{Name: name, Latitude: lat, Longitude: lng})
+	require.NoError(t, err)
+}
+
+func TestCreateGetDelete(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	created, err := client.CreateLocation(ctx, &locationv1.CreateLocationRequest{Name: "A", Latitude: 1, Longitude: 2, Category: "fuel"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), created.GetId())
+	assert.NotEmpty(t, created.GetUuid())
+
+	_, err = client.CreateLocation(ctx, &locationv1.CreateLocationRequest{Name: "A", Latitude: 1, Longitude: 2})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.CreateLocation(ctx, &locationv1.CreateLocationRequest{Name: "B", Latitude: 91, Longitude: 2})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	found, err := client.GetLocation(ctx, &locationv1.GetLocationRequest{Name: "A"})
+	require.NoError(t, err)
+	assert.Equal(t, "fuel", found.GetCategory())
+	assert.Equal(t, created.GetUuid(), found.GetUuid())
+
+	_, err = client.DeleteLocation(ctx, &locationv1.DeleteLocationRequest{Name: "A"})
+	require.NoError(t, err)
+
+	_, err = client.GetLocation(ctx, &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestListLocationsPaginates(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		create(t, client, name, 0, 0)
+	}
+
+	var names []string
+	token := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "pagination did not terminate")
+		resp, err := client.ListLocations(ctx, &locationv1.ListLocationsRequest{PageSize: 2, PageToken: token})
+		require.NoError(t, err)
+		for _, l := range resp.GetLocations() {
+			names = append(names, l.GetName())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		token = resp.GetNextPageToken()
+	}
+	assert.Equal(t, []string{"A", "B", "C", "D", "E"}, names)
+
+	_, err := client.ListLocations(ctx, &locationv1.ListLocationsRequest{PageToken: "garbage"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ListLocations(ctx, &locationv1.ListLocationsRequest{PageSize: 1001})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestStreamLocations(t *testing.T) {
+	client := newClient(t)
+	for _, name := range []string{"A", "B", "C"} {
+		create(t, client, name, 0, 0)
+	}
+
+	stream, err := client.StreamLocations(context.Background(), &locationv1.StreamLocationsRequest{})
+	require.NoError(t, err)
+
+	var names []string
+	for {
+		l, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, l.GetName())
+	}
+	assert.Equal(t, []string{"A", "B", "C"}, names)
+}
+
+func TestNearestQueries(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+
+	_, err := client.FindNearest(ctx, &locationv1.FindNearestRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	create(t, client, "Near", 0, 0.01)
+	create(t, client, "Middle", 0, 0.1)
+	create(t, client, "Far", 0, 1)
+
+	nearest, err := client.FindNearest(ctx, &locationv1.FindNearestRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "Near", nearest.GetLocation().GetName())
+
+	k, err := client.FindKNearest(ctx, &locationv1.FindKNearestRequest{K: 2})
+	require.NoError(t, err)
+	require.Len(t, k.GetMatches(), 2)
+	assert.Equal(t, "Middle", k.GetMatches()[1].GetLocation().GetName())
+
+	_, err = client.FindKNearest(ctx, &locationv1.FindKNearestRequest{K: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	radius, err := client.FindWithinRadius(ctx, &locationv1.FindWithinRadiusRequest{RadiusKm: 20})
+	require.NoError(t, err)
+	var names []string
+	for _, match := range radius.GetMatches() {
+		names = append(names, match.GetLocation().GetName())
+	}
+	assert.Equal(t, []string{"Near", "Middle"}, names)
+
+	_, err = client.FindWithinRadius(ctx, &locationv1.FindWithinRadiusRequest{RadiusKm: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTenantMetadata(t *testing.T) {
+	stores := map[string]*memStore{tenant.Default: {}, "acme": {}}
+	client := serve(t, location.NewTenantServices(func(id string) location.LocationStore { return stores[id] }, &location.DistanceCalculator{}, nil, location.Quotas{
+		Tenants: map[string]location.Quota{"acme": {MaxLocations: 1}},
+	}, location.DefaultOptions()))
+	acme := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "acme")
+
+	create(t, client, "A", 1, 2)
+	_, err := client.GetLocation(acme, &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.CreateLocation(acme, &locationv1.CreateLocationRequest{Name: "A", Latitude: 1, Longitude: 2})
+	require.NoError(t, err)
+	_, err = client.CreateLocation(acme, &locationv1.CreateLocationRequest{Name: "B", Latitude: 1, Longitude: 2})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	invalid := metadata.AppendToOutgoingContext(context.Background(), "x-tenant-id", "Not A Tenant")
+	_, err = client.GetLocation(invalid, &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// keyAuthenticator accepts the API keys it knows
+type keyAuthenticator map[string]*auth.Principal
+
+func (a keyAuthenticator) Resolve(ctx context.Context, key, authorization string) (*auth.Principal, error) {
+	if key == "" {
+		return nil, nil
+	}
+	if principal, ok := a[key]; ok {
+		return principal, nil
+	}
+	return nil, &auth.UnauthorizedError{Reason: "Invalid API key"}
+}
+
+// countingLimiter refuses every call of a client after its first allowed ones
+type countingLimiter struct {
+	allowed int
+	calls   map[string]int
+}
+
+func (l *countingLimiter) Admit(client string, isKey bool, method, path string) (rate, quota ratelimit.Decision, err error) {
+	l.calls[client]++
+	if l.calls[client] > l.allowed {
+		return rate, quota, &ratelimit.LimitedError{RetryAfter: time.Second, Reason: "Too many requests"}
+	}
+	return rate, quota, nil
+}
+
+func withKey(key string, pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{"x-api-key", key}, pairs...)...)
+}
+
+func TestAuthentication(t *testing.T) {
+	stores := map[string]*memStore{tenant.Default: {}, "acme": {}}
+	limiter := &countingLimiter{allowed: 100, calls: make(map[string]int)}
+	client := serveWith(t, location.NewTenantServices(func(id string) location.LocationStore { return stores[id] }, &location.DistanceCalculator{}, nil, location.Quotas{}, location.DefaultOptions()),
+		ServerOptions{
+			Auth: keyAuthenticator{
+				"reader": {ID: "1", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeRead}},
+				"writer": {ID: "2", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeWrite}, Tenant: "acme"},
+				"admin":  {ID: "3", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeAdmin}},
+			},
+			RateLimit: limiter,
+		})
+	req := &locationv1.CreateLocationRequest{Name: "A", Latitude: 1, Longitude: 2}
+
+	_, err := client.CreateLocation(context.Background(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "calls without credentials")
+	_, err = client.CreateLocation(withKey("unknown"), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.CreateLocation(withKey("reader"), req)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "writes need the write scope")
+
+	stream, err := client.StreamLocations(context.Background(), &locationv1.StreamLocationsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "streams are authenticated too")
+
+	rejected := 0
+	for client, calls := range limiter.calls {
+		if strings.HasPrefix(client, "ip:") {
+			rejected += calls
+		}
+	}
+	assert.Equal(t, 3, rejected, "rejected credentials count against the IP of the call")
+
+	// A key bound to a tenant acts for it, and may not choose another
+	_, err = client.CreateLocation(withKey("writer"), req)
+	require.NoError(t, err)
+	assert.Len(t, stores["acme"].locations, 1)
+	_, err = client.GetLocation(withKey("writer", "x-tenant-id", "default"), &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Only unbound admins choose a tenant
+	_, err = client.GetLocation(withKey("reader", "x-tenant-id", "acme"), &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.GetLocation(withKey("admin", "x-tenant-id", "acme"), &locationv1.GetLocationRequest{Name: "A"})
+	assert.NoError(t, err)
+	_, err = client.GetLocation(withKey("admin"), &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "the default tenant has no location A")
+
+	// Calls count against the limits of their credentials
+	assert.Equal(t, 2, limiter.calls["api_key:3"])
+	limiter.allowed = 2
+	_, err = client.GetLocation(withKey("admin", "x-tenant-id", "acme"), &locationv1.GetLocationRequest{Name: "A"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestReflection(t *testing.T) {
+	listServices := func(conn *grpc.ClientConn) (*reflectionv1.ServerReflectionResponse, error) {
+		stream, err := reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_ListServices{},
+		}))
+		return stream.Recv()
+	}
+	service := location.NewLocationService(&memStore{}, &location.DistanceCalculator{}, nil)
+
+	_, err := listServices(connect(t, service, ServerOptions{}))
+	assert.Equal(t, codes.Unimplemented, status.Code(err), "reflection is off by default")
+
+	resp, err := listServices(connect(t, service, ServerOptions{Reflection: true}))
+	require.NoError(t, err)
+	var names []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	assert.Contains(t, names, "location.v1.LocationService")
+}
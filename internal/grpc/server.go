@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime/debug"
+
+	log "github.com/sirupsen/logrus"
+	locationv1 "github.com/youngprinnce/geolocation-service/api/proto/location/v1"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/audit"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// ServerOptions configures the interceptors of the gRPC server
+type ServerOptions struct {
+	// Auth authenticates every call; nil disables authentication, letting every call through
+	Auth Authenticator
+	// RateLimit limits the calls of each client; nil lets every call through
+	RateLimit RateLimiter
+	// Reflection registers the reflection service, which lists every service and message of the server
+	Reflection bool
+}
+
+// NewServer creates a gRPC server exposing the location service, with panic recovery and,
+// when enabled, reflection. Calls are authenticated, rate limited and resolved to a tenant like HTTP requests.
+func NewServer(locations *LocationServer, options ServerOptions) *grpc.Server {
+	admission := &admission{options: options}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(recoverUnary, admission.unary),
+		grpc.ChainStreamInterceptor(recoverStream, admission.stream),
+	)
+	locationv1.RegisterLocationServiceServer(server, locations)
+	if options.Reflection {
+		reflection.Register(server)
+	}
+	return server
+}
+
+// recoverUnary turns a panicking handler into an Internal error, like gin.Recovery does for HTTP
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(log.Fields{"method": info.FullMethod, "panic": r, "stack": string(debug.Stack())}).Error("gRPC handler panicked")
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func recoverStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(log.Fields{"method": info.FullMethod, "panic": r, "stack": string(debug.Stack())}).Error("gRPC handler panicked")
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(srv, stream)
+}
+
+// tenantMetadata is the metadata key choosing the tenant a call acts for, like the X-Tenant-ID header
+const tenantMetadata = "x-tenant-id"
+
+// requestIDMetadata is the metadata key carrying the caller's request ID, like the X-Request-ID header
+const requestIDMetadata = "x-request-id"
+
+// admission authenticates calls, counts them against the limits of their client and
+// stores their principal, tenant and origin in their context
+type admission struct {
+	options ServerOptions
+}
+
+// admit returns the context a call of method runs with, or the status refusing it
+func (a *admission) admit(ctx context.Context, method string) (context.Context, error) {
+	ip := peerIP(ctx)
+	principal, err := authenticate(ctx, a.options.Auth, method)
+	var unauthorized *auth.UnauthorizedError
+	if errors.As(err, &unauthorized) && a.options.RateLimit != nil {
+		// Rejected credentials count against the IP, so they cannot be guessed faster than the limit
+		client, _ := ratelimit.ClientOf(nil, ip)
+		if _, _, limited := a.options.RateLimit.Admit(client, false, "", ""); limited != nil {
+			err = limited
+		}
+	}
+	if err != nil {
+		return nil, toStatus(err, "Failed to authenticate call")
+	}
+	if principal != nil {
+		ctx = auth.WithPrincipal(ctx, principal)
+	}
+
+	if a.options.RateLimit != nil {
+		client, isKey := ratelimit.ClientOf(principal, ip)
+		if _, _, err := a.options.RateLimit.Admit(client, isKey, "", ""); err != nil {
+			return nil, toStatus(err, "Failed to rate limit call")
+		}
+	}
+
+	requested := firstValue(ctx, tenantMetadata)
+	if requested != "" && !tenant.Valid(requested) {
+		return nil, status.Error(codes.InvalidArgument, "x-tenant-id is not a valid tenant ID")
+	}
+	id, err := tenant.Resolve(principal, requested)
+	if err != nil {
+		return nil, toStatus(err, "Failed to resolve tenant")
+	}
+	ctx = tenant.WithTenant(ctx, id)
+
+	return audit.WithOrigin(ctx, audit.Origin{IP: ip, RequestID: firstValue(ctx, requestIDMetadata)}), nil
+}
+
+func (a *admission) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.admit(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *admission) stream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.admit(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &admittedServerStream{ServerStream: stream, ctx: ctx})
+}
+
+// admittedServerStream replaces the context of a stream with the one it was admitted with
+type admittedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *admittedServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// peerIP returns the IP address of the caller, or an empty string when unknown
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+	return ip
+}
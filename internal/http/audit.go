@@ -0,0 +1,159 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service/audit"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+)
+
+// AuditController handles HTTP requests for the audit trail
+type AuditController struct {
+	service audit.AuditBC
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(service audit.AuditBC) *AuditController {
+	return &AuditController{
+		service: service,
+	}
+}
+
+// AuditOrigin stores the client IP and request ID in the request context, so
+// that changes made while serving the request can be traced back to it
+func AuditOrigin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := audit.Origin{
+			IP:        c.ClientIP(),
+			RequestID: c.GetString(requestIDKey),
+		}
+		c.Request = c.Request.WithContext(audit.WithOrigin(c.Request.Context(), origin))
+		c.Next()
+	}
+}
+
+// GetEntries handles GET /audit?actor=A&action=X&target=T&since=TIME&until=TIME&cursor=C&limit=N
+func (h *AuditController) GetEntries(c *gin.Context) {
+	query, err := auditQuery(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > audit.MaxPageSize {
+			_ = c.Error(badRequest("limit must be between 1 and %d", audit.MaxPageSize))
+			return
+		}
+		query.Limit = n
+	}
+
+	after, err := outbox.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	query.AfterID = after
+
+	page, err := h.service.GetEntries(c.Request.Context(), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ExportEntries handles GET /audit/export, streaming every selected entry as NDJSON
+func (h *AuditController) ExportEntries(c *gin.Context) {
+	query, err := auditQuery(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	// The headers go out with the first entry, so that a failing query can still be reported as a problem
+	start := func() {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="audit.ndjson"`)
+		c.Status(http.StatusOK)
+	}
+
+	// A large trail may take longer to send than the write timeout allows
+	holdOpen(c)
+
+	written := 0
+	encoder := json.NewEncoder(c.Writer)
+	err = h.service.Export(c.Request.Context(), query, func(entry audit.Entry) error {
+		if written == 0 {
+			start()
+		}
+		written++
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+		if written%100 == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && written == 0:
+		_ = c.Error(err)
+	case err != nil:
+		// The response has started, so the client can only tell from the missing lines
+		log.WithError(err).WithField("entries", written).Error("Audit export was cut short")
+	case written == 0:
+		start()
+		c.Writer.WriteHeaderNow()
+	}
+}
+
+// VerifyChain handles GET /audit/verify
+func (h *AuditController) VerifyChain(c *gin.Context) {
+	result, err := h.service.Verify(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// auditQuery parses the filters shared by GET /audit and GET /audit/export
+func auditQuery(c *gin.Context) (audit.Query, error) {
+	query := audit.Query{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+	}
+
+	var err error
+	if query.Since, err = queryTime(c, "since"); err != nil {
+		return query, err
+	}
+	if query.Until, err = queryTime(c, "until"); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// queryTime parses an optional RFC 3339 time from the query string
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, badRequest("%s must be an RFC 3339 time", name)
+	}
+	return &t, nil
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/apikey"
+)
+
+// APIKeyHeader carries the API key of a client
+const APIKeyHeader = "X-API-Key"
+
+// authChallenge is the WWW-Authenticate header sent with 401 responses
+const authChallenge = `APIKey header="` + APIKeyHeader + `", Bearer`
+
+// TokenVerifier resolves the principal of a bearer token
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*auth.Principal, error)
+}
+
+// Authenticator resolves the credentials of requests and guards routes by scope
+type Authenticator struct {
+	keys   apikey.APIKeyBC
+	tokens TokenVerifier
+}
+
+// NewAuthenticator creates an authenticator checking API keys with keys and
+// bearer tokens with tokens. Bearer tokens are refused when tokens is nil.
+func NewAuthenticator(keys apikey.APIKeyBC, tokens TokenVerifier) *Authenticator {
+	return &Authenticator{
+		keys:   keys,
+		tokens: tokens,
+	}
+}
+
+// Authenticate resolves the principal of requests that carry an API key or a
+// bearer token, preferring the key when both are sent, and stores it in the
+// request context. Requests without credentials pass through, so public routes
+// stay reachable; invalid credentials are always rejected. When limiter is not
+// nil, rejected requests count against the rate limit of their IP, so credentials
+// cannot be guessed faster than anonymous clients may call the API.
+func (a *Authenticator) Authenticate(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Resolve(c.Request.Context(), c.GetHeader(APIKeyHeader), c.GetHeader("Authorization"))
+		if err != nil {
+			if limiter != nil && c.FullPath() != "" {
+				if limited := limiter.admit(c, nil); limited != nil {
+					err = limited
+				}
+			}
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if principal != nil {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		}
+		c.Next()
+	}
+}
+
+// Resolve returns the principal of an API key or an Authorization header,
+// preferring the key when both are given. It returns nil without an error
+// when neither carries credentials, so callers decide whether they are needed.
+func (a *Authenticator) Resolve(ctx context.Context, key, authorization string) (*auth.Principal, error) {
+	token, bearer := bearerToken(authorization)
+	switch {
+	case key != "":
+		return a.keys.Authenticate(key)
+	case bearer && a.tokens == nil:
+		return nil, &auth.UnauthorizedError{Reason: "Bearer tokens are not accepted, use an API key"}
+	case bearer:
+		return a.tokens.Verify(ctx, token)
+	default:
+		return nil, nil
+	}
+}
+
+// Require rejects requests whose principal was not granted scope
+func (a *Authenticator) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			_ = c.Error(&auth.UnauthorizedError{})
+			c.Abort()
+			return
+		}
+		if !principal.Allows(scope) {
+			_ = c.Error(&auth.ForbiddenError{Scope: scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerToken extracts the token of an Authorization header using the Bearer scheme
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
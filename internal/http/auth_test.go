@@ -0,0 +1,185 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/apikey"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// fakeKeys resolves keys from a fixed table
+type fakeKeys map[string]*auth.Principal
+
+func (fakeKeys) CreateKey(apikey.CreateKeyRequest) (*apikey.CreatedKey, error) { return nil, nil }
+func (fakeKeys) ListKeys() ([]apikey.APIKey, error)                            { return nil, nil }
+func (fakeKeys) RevokeKey(uint) (*apikey.APIKey, error)                        { return nil, nil }
+
+func (f fakeKeys) Authenticate(key string) (*auth.Principal, error) {
+	if key == "broken" {
+		return nil, errors.New("database is down")
+	}
+	if principal, ok := f[key]; ok {
+		return principal, nil
+	}
+	return nil, apikey.ErrInvalidKey
+}
+
+// fakeTokens accepts the token "editor"
+type fakeTokens struct{}
+
+func (fakeTokens) Verify(_ context.Context, token string) (*auth.Principal, error) {
+	if token != "editor" {
+		return nil, &auth.UnauthorizedError{Reason: "The bearer token is invalid"}
+	}
+	return &auth.Principal{ID: "sso-user", Method: auth.MethodJWT, Scopes: []string{auth.ScopeWrite}}, nil
+}
+
+func TestAuthenticator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := fakeKeys{
+		"reader": {ID: "1", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeRead}},
+		"admin":  {ID: "2", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeAdmin}},
+	}
+	authenticator := NewAuthenticator(keys, fakeTokens{})
+	router := gin.New()
+	router.Use(RequestID(), Problems(), authenticator.Authenticate(nil))
+	router.GET("/public", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.DELETE("/private", authenticator.Require(auth.ScopeWrite), func(c *gin.Context) {
+		principal, _ := auth.FromContext(c.Request.Context())
+		c.String(http.StatusOK, principal.ID)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		bearer string
+		status int
+		code   string
+	}{
+		{"public without key", http.MethodGet, "/public", "", "", http.StatusNoContent, ""},
+		{"public with invalid key", http.MethodGet, "/public", "nope", "", http.StatusUnauthorized, CodeUnauthorized},
+		{"private without key", http.MethodDelete, "/private", "", "", http.StatusUnauthorized, CodeUnauthorized},
+		{"private with invalid key", http.MethodDelete, "/private", "nope", "", http.StatusUnauthorized, CodeUnauthorized},
+		{"insufficient scope", http.MethodDelete, "/private", "reader", "", http.StatusForbidden, CodeForbidden},
+		{"including scope", http.MethodDelete, "/private", "admin", "", http.StatusOK, ""},
+		{"failing lookup", http.MethodDelete, "/private", "broken", "", http.StatusInternalServerError, CodeInternal},
+		{"bearer token", http.MethodDelete, "/private", "", "editor", http.StatusOK, ""},
+		{"invalid bearer token", http.MethodDelete, "/private", "", "forged", http.StatusUnauthorized, CodeUnauthorized},
+		{"key wins over token", http.MethodDelete, "/private", "reader", "editor", http.StatusForbidden, CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				assert.Equal(t, tt.code, decodeProblem(t, w).Code)
+			}
+			if tt.status == http.StatusUnauthorized {
+				assert.Equal(t, authChallenge, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestResolveTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := fakeKeys{
+		"writer":     {ID: "1", Scopes: []string{auth.ScopeWrite}},
+		"admin":      {ID: "2", Scopes: []string{auth.ScopeAdmin}},
+		"acme":       {ID: "3", Scopes: []string{auth.ScopeWrite}, Tenant: "acme"},
+		"acme-admin": {ID: "4", Scopes: []string{auth.ScopeAdmin}, Tenant: "acme"},
+	}
+	router := gin.New()
+	router.Use(RequestID(), Problems(), NewAuthenticator(keys, nil).Authenticate(nil), ResolveTenant())
+	router.GET("/tenant", func(c *gin.Context) { c.String(http.StatusOK, tenant.FromContext(c.Request.Context())) })
+
+	tests := []struct {
+		name   string
+		key    string
+		header string
+		status int
+		tenant string
+	}{
+		{"anonymous", "", "", http.StatusOK, tenant.Default},
+		{"anonymous choosing", "", "globex", http.StatusOK, "globex"},
+		{"unbound key", "writer", "", http.StatusOK, tenant.Default},
+		{"unbound key choosing", "writer", "globex", http.StatusForbidden, ""},
+		{"admin choosing", "admin", "globex", http.StatusOK, "globex"},
+		{"bound key", "acme", "", http.StatusOK, "acme"},
+		{"bound key naming its tenant", "acme", "acme", http.StatusOK, "acme"},
+		{"bound admin choosing", "acme-admin", "globex", http.StatusForbidden, ""},
+		{"invalid header", "admin", "Globex Corp", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tenant", nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			if tt.header != "" {
+				req.Header.Set(tenant.Header, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.tenant, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBearerTokensRefusedWithoutVerifier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	authenticator := NewAuthenticator(fakeKeys{}, nil)
+	router := gin.New()
+	router.Use(RequestID(), Problems(), authenticator.Authenticate(nil))
+	router.GET("/public", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/public", nil)
+	req.Header.Set("Authorization", "Bearer editor")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Other schemes are not credentials this server understands
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAuthorizeOperation(t *testing.T) {
+	reader := &auth.Principal{Scopes: []string{auth.ScopeRead}}
+	writer := &auth.Principal{Scopes: []string{auth.ScopeWrite}}
+	mutation := graphqlRequest{Query: `mutation { deleteLocation(name: "Depot") }`}
+	query := graphqlRequest{Query: `{ locations { name } }`}
+
+	var forbidden *auth.ForbiddenError
+	assert.ErrorAs(t, authorizeOperation(reader, mutation), &forbidden)
+	assert.NoError(t, authorizeOperation(writer, mutation))
+	assert.NoError(t, authorizeOperation(reader, query))
+	assert.NoError(t, authorizeOperation(nil, mutation), "without authentication every operation is allowed")
+}
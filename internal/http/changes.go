@@ -0,0 +1,69 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+)
+
+// ChangeController handles HTTP requests for the change feed
+type ChangeController struct {
+	service outbox.OutboxBC
+	closing shutdown
+}
+
+// NewChangeController creates a new change feed controller
+func NewChangeController(service outbox.OutboxBC) *ChangeController {
+	return &ChangeController{
+		service: service,
+	}
+}
+
+// GetChanges handles GET /changes?since=CURSOR&limit=N&wait=SECONDS
+func (h *ChangeController) GetChanges(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > outbox.MaxPageSize {
+			_ = c.Error(badRequest("limit must be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+
+	var wait time.Duration
+	if value := c.Query("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > outbox.MaxWait {
+			_ = c.Error(badRequest("wait must be between 0 and 60 seconds"))
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	// A long poll may outlast the write timeout, and is answered early when the server shuts down
+	ctx := c.Request.Context()
+	if wait > 0 {
+		holdOpen(c)
+		var cancel context.CancelFunc
+		ctx, cancel = h.closing.context(ctx)
+		defer cancel()
+	}
+
+	page, err := h.service.GetChanges(ctx, c.Query("since"), limit, wait)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// Shutdown answers the waiting long polls with the changes they have so far
+func (h *ChangeController) Shutdown() {
+	h.closing.begin()
+}
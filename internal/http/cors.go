@@ -0,0 +1,165 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// CORSOptions describes which browser origins may call the API and what they may send and read.
+// Origins are exact ("https://app.example.com"), contain wildcards ("https://*.example.com",
+// "http://localhost:*") or are regular expressions between slashes ("/^https://[a-z]+\.example\.org$/");
+// "*" allows every origin. Empty methods, headers and exposed headers fall back to those the API uses.
+type CORSOptions struct {
+	Origins        []string
+	Methods        []string
+	Headers        []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+	Credentials    bool
+}
+
+// Defaults of CORSOptions
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", APIKeyHeader, tenant.Header, RequestIDHeader, "Last-Event-ID"}
+	defaultCORSExposed = []string{RequestIDHeader, "Link", "X-Total-Count", "Retry-After",
+		RateLimitLimitHeader, RateLimitRemainingHeader, RateLimitResetHeader,
+		QuotaLimitHeader, QuotaRemainingHeader, QuotaResetHeader}
+)
+
+// CORS answers preflight requests and marks the responses browsers may read
+type CORS struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	patterns    []*regexp.Regexp
+	methods     string
+	headers     string
+	anyHeader   bool
+	exposed     string
+	maxAge      string
+	credentials bool
+}
+
+// NewCORS compiles a CORS policy. Allowing every origin together with credentials
+// is refused, since browsers reject it and it would let any site act for the user.
+func NewCORS(options CORSOptions) (*CORS, error) {
+	cors := &CORS{
+		origins:     make(map[string]bool),
+		methods:     strings.Join(orDefault(options.Methods, defaultCORSMethods), ", "),
+		headers:     strings.Join(orDefault(options.Headers, defaultCORSHeaders), ", "),
+		exposed:     strings.Join(orDefault(options.ExposedHeaders, defaultCORSExposed), ", "),
+		credentials: options.Credentials,
+	}
+	cors.anyHeader = cors.headers == "*"
+	if options.MaxAge > 0 {
+		cors.maxAge = strconv.Itoa(int(options.MaxAge / time.Second))
+	}
+
+	for _, origin := range options.Origins {
+		switch {
+		case origin == "*":
+			if options.Credentials {
+				return nil, errors.New(`the origin "*" cannot be allowed with credentials, list the origins instead`)
+			}
+			cors.anyOrigin = true
+		case len(origin) > 2 && strings.HasPrefix(origin, "/") && strings.HasSuffix(origin, "/"):
+			pattern, err := regexp.Compile(origin[1 : len(origin)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid origin pattern %s: %w", origin, err)
+			}
+			cors.patterns = append(cors.patterns, pattern)
+		case strings.Contains(origin, "*"):
+			// A wildcard stands for one or more DNS labels, or a port
+			quoted := strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[a-z0-9-]+(\.[a-z0-9-]+)*`)
+			cors.patterns = append(cors.patterns, regexp.MustCompile("^"+quoted+"$"))
+		default:
+			cors.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+		}
+	}
+	return cors, nil
+}
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+// Allows reports whether a browser at origin may call the API
+func (p *CORS) Allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle applies the policy to every request. Allowed origins are echoed back
+// rather than answered with "*", so responses vary by Origin and say so.
+// Preflight requests are answered here, without reaching the routes.
+func (p *CORS) Handle() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !p.anyOrigin || p.credentials {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := c.GetHeader("Origin")
+		if origin != "" && p.Allows(origin) {
+			if p.anyOrigin && !p.credentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if p.credentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				header.Set("Access-Control-Allow-Methods", p.methods)
+				if p.anyHeader {
+					// "*" is taken literally with credentials, so the requested headers are echoed instead
+					if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+						header.Set("Access-Control-Allow-Headers", requested)
+					}
+				} else {
+					header.Set("Access-Control-Allow-Headers", p.headers)
+				}
+				if p.maxAge != "" {
+					header.Set("Access-Control-Max-Age", p.maxAge)
+				}
+			} else {
+				header.Set("Access-Control-Expose-Headers", p.exposed)
+			}
+		}
+
+		// Preflights from other origins are answered too, but without the headers the browser needs to proceed
+		if preflight {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
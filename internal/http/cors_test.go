@@ -0,0 +1,122 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func corsRouter(t *testing.T, options CORSOptions) *gin.Engine {
+	t.Helper()
+	cors, err := NewCORS(options)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(cors.Handle())
+	router.GET("/locations", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/locations", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSOrigins(t *testing.T) {
+	router := corsRouter(t, CORSOptions{
+		Origins:     []string{"https://app.example.com", "https://*.example.org", "http://localhost:*", `/^https://[a-z]+\.example\.net$/`},
+		Credentials: true,
+	})
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"https://evil.example.com", false},
+		{"https://eu.maps.example.org", true},
+		{"https://example.org", false},
+		{"https://example.org.evil.com", false},
+		{"http://localhost:3000", true},
+		{"https://localhost:3000", false},
+		{"https://maps.example.net", true},
+		{"https://maps2.example.net", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			w := corsRequest(router, http.MethodGet, tt.origin, nil)
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.Contains(t, w.Header().Values("Vary"), "Origin")
+			if tt.allowed {
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+				assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), RequestIDHeader)
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router := corsRouter(t, CORSOptions{
+		Origins: []string{"https://app.example.com"},
+		Methods: []string{http.MethodGet, http.MethodPost},
+		Headers: []string{"Content-Type", APIKeyHeader},
+		MaxAge:  10 * time.Minute,
+	})
+	preflight := map[string]string{"Access-Control-Request-Method": http.MethodPost, "Access-Control-Request-Headers": "content-type"}
+
+	w := corsRequest(router, http.MethodOptions, "https://app.example.com", preflight)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-API-Key", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = corsRequest(router, http.MethodOptions, "https://evil.example.com", preflight)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+
+	// Without an origin nothing is added, but caches still learn that responses depend on it
+	w = corsRequest(router, http.MethodGet, "", nil)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	router := corsRouter(t, CORSOptions{Origins: []string{"*"}, Headers: []string{"*"}})
+
+	w := corsRequest(router, http.MethodGet, "https://anywhere.test", nil)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Values("Vary"))
+
+	w = corsRequest(router, http.MethodOptions, "https://anywhere.test", map[string]string{
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "x-custom",
+	})
+	assert.Equal(t, "x-custom", w.Header().Get("Access-Control-Allow-Headers"))
+
+	_, err := NewCORS(CORSOptions{Origins: []string{"*"}, Credentials: true})
+	assert.Error(t, err, "every origin must not be allowed with credentials")
+	_, err = NewCORS(CORSOptions{Origins: []string{"/[/"}})
+	assert.Error(t, err)
+}
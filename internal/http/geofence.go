@@ -0,0 +1,129 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+)
+
+// GeofenceController handles HTTP requests for geofence endpoints
+type GeofenceController struct {
+	service geofence.GeofenceBC
+}
+
+// NewGeofenceController creates a new geofence controller
+func NewGeofenceController(service geofence.GeofenceBC) *GeofenceController {
+	return &GeofenceController{
+		service: service,
+	}
+}
+
+// CreateGeofence handles POST /geofences
+func (h *GeofenceController) CreateGeofence(c *gin.Context) {
+	var req geofence.GeofenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	created, err := h.service.CreateGeofence(c.Request.Context(), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"name": created.Name,
+		"kind": created.Kind,
+	}).Info("Geofence created successfully")
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetGeofences handles GET /geofences
+func (h *GeofenceController) GetGeofences(c *gin.Context) {
+	geofences, err := h.service.GetAllGeofences(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, geofences)
+}
+
+// GetGeofence handles GET /geofences/{id}
+func (h *GeofenceController) GetGeofence(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	found, err := h.service.GetGeofence(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// UpdateGeofence handles PUT /geofences/{id}
+func (h *GeofenceController) UpdateGeofence(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	var req geofence.GeofenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	updated, err := h.service.UpdateGeofence(c.Request.Context(), id, req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithField("id", id).Info("Geofence updated successfully")
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteGeofence handles DELETE /geofences/{id}
+func (h *GeofenceController) DeleteGeofence(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.service.DeleteGeofence(c.Request.Context(), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithField("id", id).Info("Geofence deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Geofence deleted successfully"})
+}
+
+// GetContaining handles GET /geofences/contains?lat=LAT&lng=LNG
+func (h *GeofenceController) GetContaining(c *gin.Context) {
+	lat, lng, err := queryCoordinates(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	geofences, err := h.service.FindContaining(c.Request.Context(), lat, lng)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, geofences)
+}
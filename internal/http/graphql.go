@@ -0,0 +1,481 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+)
+
+// graphqlTransportWS is the WebSocket subprotocol used for GraphQL subscriptions
+// (https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md)
+const graphqlTransportWS = "graphql-transport-ws"
+
+// GraphQL WebSocket limits
+const (
+	graphqlInitTimeout     = 10 * time.Second
+	graphqlPingInterval    = 20 * time.Second
+	graphqlPongWait        = 60 * time.Second
+	graphqlMaxMessageBytes = 64 << 10
+)
+
+// graphqlMaxDepth is how deeply the fields of an operation may nest, so that a single
+// request cannot fan out into an unbounded amount of work
+const graphqlMaxDepth = 8
+
+// graphqlFanOutField runs a search for every location it is selected on, so it may not be
+// selected within itself where the searches would multiply
+const graphqlFanOutField = "nearestNeighbours"
+
+// Close codes defined by the graphql-transport-ws protocol
+const (
+	closeBadRequest      = 4400
+	closeUnauthorized    = 4401
+	closeNotAcceptable   = 4406
+	closeInitTimeout     = 4408
+	closeSubscriberInUse = 4409
+	closeTooManyInits    = 4429
+)
+
+// GraphQLController serves the GraphQL schema over HTTP and, for subscriptions, WebSocket
+type GraphQLController struct {
+	schema   graphql.Schema
+	upgrader websocket.Upgrader
+	closing  shutdown
+}
+
+// NewGraphQLController creates a new GraphQL controller
+func NewGraphQLController(schema graphql.Schema) *GraphQLController {
+	return &GraphQLController{
+		schema: schema,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{graphqlTransportWS},
+		},
+	}
+}
+
+// graphqlRequest is the standard GraphQL request body
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Execute handles POST /graphql for queries and mutations
+func (h *GraphQLController) Execute(c *gin.Context) {
+	var req graphqlRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if req.Query == "" {
+		_ = c.Error(badRequest("query is required"))
+		return
+	}
+	if operationType(req) == ast.OperationTypeSubscription {
+		_ = c.Error(badRequest("Subscriptions require a WebSocket connection to GET /graphql"))
+		return
+	}
+	principal, _ := auth.FromContext(c.Request.Context())
+	if err := authorizeOperation(principal, req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if err := limitDepth(req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        c.Request.Context(),
+	})
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Subscribe handles GET /graphql, which must be a WebSocket upgrade speaking graphql-transport-ws.
+// Queries and mutations may be sent over the socket as well.
+func (h *GraphQLController) Subscribe(c *gin.Context) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		_ = c.Error(badRequest("GET /graphql only accepts WebSocket connections, send queries with POST"))
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		log.WithError(err).Warn("Failed to upgrade GraphQL socket")
+		return
+	}
+	defer conn.Close()
+
+	principal, _ := auth.FromContext(c.Request.Context())
+	session := &graphqlSession{
+		conn:       conn,
+		schema:     h.schema,
+		values:     context.WithoutCancel(c.Request.Context()),
+		principal:  principal,
+		operations: make(map[string]*graphqlOperation),
+		closing:    h.closing.done(),
+	}
+	if conn.Subprotocol() != graphqlTransportWS {
+		session.close(closeNotAcceptable, "Subprotocol not acceptable")
+		return
+	}
+
+	session.run()
+}
+
+// Shutdown closes the open subscription sockets, telling clients the server is going away
+func (h *GraphQLController) Shutdown() {
+	h.closing.begin()
+}
+
+// graphqlSession is one graphql-transport-ws connection
+type graphqlSession struct {
+	conn   *websocket.Conn
+	schema graphql.Schema
+	// values carries the principal and tenant of the upgrade request to every operation
+	values context.Context
+	// principal authenticated the upgrade request; nil when authentication is disabled
+	principal *auth.Principal
+	// closing is closed when the server shuts down
+	closing <-chan struct{}
+
+	writeMu sync.Mutex
+
+	mu           sync.Mutex
+	acknowledged bool
+	operations   map[string]*graphqlOperation
+}
+
+// graphqlOperation is a running operation; the pointer identifies it if its ID is reused after completion
+type graphqlOperation struct {
+	stop context.CancelFunc
+}
+
+// graphqlMessage is the envelope of every graphql-transport-ws message
+type graphqlMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func (s *graphqlSession) run() {
+	ctx, cancel := context.WithCancel(s.values)
+	defer cancel()
+
+	initTimer := time.AfterFunc(graphqlInitTimeout, func() {
+		s.mu.Lock()
+		acknowledged := s.acknowledged
+		s.mu.Unlock()
+		if !acknowledged {
+			s.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	go s.keepAlive(ctx)
+	go func() {
+		select {
+		case <-s.closing:
+			s.close(websocket.CloseGoingAway, "Server shutting down")
+		case <-ctx.Done():
+		}
+	}()
+
+	s.conn.SetReadLimit(graphqlMaxMessageBytes)
+	extend := func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(graphqlPongWait))
+	}
+	_ = extend("")
+	s.conn.SetPongHandler(extend)
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.WithError(err).Debug("GraphQL socket closed")
+			}
+			return
+		}
+		_ = extend("")
+
+		var msg graphqlMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.close(closeBadRequest, "Invalid message received")
+			return
+		}
+
+		switch msg.Type {
+		case "connection_init":
+			s.mu.Lock()
+			repeated := s.acknowledged
+			s.acknowledged = true
+			s.mu.Unlock()
+			if repeated {
+				s.close(closeTooManyInits, "Too many initialisation requests")
+				return
+			}
+			s.send(graphqlMessage{Type: "connection_ack"})
+
+		case "ping":
+			s.send(graphqlMessage{Type: "pong"})
+
+		case "pong":
+			// Unsolicited pongs are allowed as a heartbeat and need no answer
+
+		case "subscribe":
+			if !s.start(ctx, msg) {
+				return
+			}
+
+		case "complete":
+			s.mu.Lock()
+			if operation, ok := s.operations[msg.ID]; ok {
+				operation.stop()
+				delete(s.operations, msg.ID)
+			}
+			s.mu.Unlock()
+
+		default:
+			s.close(closeBadRequest, "Invalid message received")
+			return
+		}
+	}
+}
+
+// start runs the operation of a subscribe message, returning false if the connection was closed instead
+func (s *graphqlSession) start(ctx context.Context, msg graphqlMessage) bool {
+	var req graphqlRequest
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil || req.Query == "" {
+		s.close(closeBadRequest, "Invalid message received")
+		return false
+	}
+
+	s.mu.Lock()
+	if !s.acknowledged {
+		s.mu.Unlock()
+		s.close(closeUnauthorized, "Unauthorized")
+		return false
+	}
+	if _, ok := s.operations[msg.ID]; ok {
+		s.mu.Unlock()
+		s.close(closeSubscriberInUse, "Subscriber for "+msg.ID+" already exists")
+		return false
+	}
+	err := authorizeOperation(s.principal, req)
+	if err == nil {
+		err = limitDepth(req)
+	}
+	if err != nil {
+		s.mu.Unlock()
+		payload, _ := json.Marshal([]gqlerrors.FormattedError{gqlerrors.NewFormattedError(err.Error())})
+		s.send(graphqlMessage{ID: msg.ID, Type: "error", Payload: payload})
+		return true
+	}
+	opCtx, stop := context.WithCancel(ctx)
+	operation := &graphqlOperation{stop: stop}
+	s.operations[msg.ID] = operation
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			if s.operations[msg.ID] == operation {
+				delete(s.operations, msg.ID)
+			}
+			s.mu.Unlock()
+			stop()
+		}()
+
+		params := graphql.Params{
+			Schema:         s.schema,
+			RequestString:  req.Query,
+			OperationName:  req.OperationName,
+			VariableValues: req.Variables,
+			Context:        opCtx,
+		}
+
+		if operationType(req) != ast.OperationTypeSubscription {
+			if !s.result(msg.ID, graphql.Do(params)) {
+				stop()
+			}
+		} else {
+			// Keep draining after the client completes so the executor can shut down
+			for result := range graphql.Subscribe(params) {
+				if opCtx.Err() == nil && !s.result(msg.ID, result) {
+					stop()
+				}
+			}
+		}
+
+		if opCtx.Err() == nil {
+			s.send(graphqlMessage{ID: msg.ID, Type: "complete"})
+		}
+	}()
+
+	return true
+}
+
+// result sends an execution result. A result without data means the operation failed before
+// running and is reported as an error, which ends the operation.
+func (s *graphqlSession) result(id string, result *graphql.Result) bool {
+	if result.Data == nil && result.HasErrors() {
+		payload, _ := json.Marshal(result.Errors)
+		s.send(graphqlMessage{ID: id, Type: "error", Payload: payload})
+		return false
+	}
+
+	payload, _ := json.Marshal(result)
+	s.send(graphqlMessage{ID: id, Type: "next", Payload: payload})
+	return true
+}
+
+func (s *graphqlSession) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(graphqlPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.writeMu.Lock()
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+			s.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *graphqlSession) send(msg graphqlMessage) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := writeSocketJSON(s.conn, msg); err != nil {
+		log.WithError(err).Debug("Failed to write to GraphQL socket")
+	}
+}
+
+// close ends the connection with a protocol close code
+func (s *graphqlSession) close(code int, reason string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(socketWriteWait))
+	s.conn.Close()
+}
+
+// authorizeOperation rejects mutations from principals without the write scope.
+// Without a principal, authentication is disabled and every operation is allowed.
+func authorizeOperation(principal *auth.Principal, req graphqlRequest) error {
+	if principal == nil || operationType(req) != ast.OperationTypeMutation || principal.Allows(auth.ScopeWrite) {
+		return nil
+	}
+	return &auth.ForbiddenError{Scope: auth.ScopeWrite}
+}
+
+// limitDepth rejects operations whose fields nest deeper than graphqlMaxDepth or that nest graphqlFanOutField
+func limitDepth(req graphqlRequest) error {
+	document, operation := parseOperation(req)
+	if operation == nil {
+		return nil
+	}
+
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+	depth, fanOuts := selectionDepth(operation.SelectionSet, fragments, make(map[string]bool))
+	if depth > graphqlMaxDepth {
+		return badRequest(fmt.Sprintf("Queries may nest at most %d fields deep", graphqlMaxDepth))
+	}
+	if fanOuts > 1 {
+		return badRequest(graphqlFanOutField + " cannot be selected within " + graphqlFanOutField)
+	}
+	return nil
+}
+
+// selectionDepth returns how deeply the fields of a selection set nest, and how many times
+// graphqlFanOutField appears along the deepest chain of it. Fragments count as the fields they
+// contain; a fragment spreading itself is left to validation.
+func selectionDepth(set *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition, spreading map[string]bool) (depth, fanOuts int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, f int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, f = selectionDepth(selection.SelectionSet, fragments, spreading)
+			d++
+			if selection.Name.Value == graphqlFanOutField {
+				f++
+			}
+		case *ast.InlineFragment:
+			d, f = selectionDepth(selection.SelectionSet, fragments, spreading)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := fragments[name]
+			if !ok || spreading[name] {
+				continue
+			}
+			spreading[name] = true
+			d, f = selectionDepth(fragment.SelectionSet, fragments, spreading)
+			delete(spreading, name)
+		}
+		depth, fanOuts = max(depth, d), max(fanOuts, f)
+	}
+	return depth, fanOuts
+}
+
+// operationType returns the type of the operation a request will run, or "" if the document does not parse;
+// execution then reports the syntax error
+func operationType(req graphqlRequest) string {
+	if _, operation := parseOperation(req); operation != nil {
+		return operation.Operation
+	}
+	return ""
+}
+
+// parseOperation returns the document of a request and the operation it will run, or nil if there is none
+func parseOperation(req graphqlRequest) (*ast.Document, *ast.OperationDefinition) {
+	document, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return nil, nil
+	}
+
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if req.OperationName == "" || (operation.Name != nil && operation.Name.Value == req.OperationName) {
+			return document, operation
+		}
+	}
+	return document, nil
+}
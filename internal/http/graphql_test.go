@@ -0,0 +1,185 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSchema has a hello query and a ticks subscription emitting 1, 2 and then completing
+func testSchema(t *testing.T) graphql.Schema {
+	t.Helper()
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"hello": &graphql.Field{
+					Type:    graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) { return "world", nil },
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"ticks": &graphql.Field{
+					Type: graphql.Int,
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ticks := make(chan interface{})
+						go func() {
+							defer close(ticks)
+							for i := 1; i <= 2; i++ {
+								select {
+								case ticks <- i:
+								case <-p.Context.Done():
+									return
+								}
+							}
+						}()
+						return ticks, nil
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source, nil },
+				},
+			},
+		}),
+	})
+	require.NoError(t, err)
+	return schema
+}
+
+func graphqlServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	controller := NewGraphQLController(testSchema(t))
+	router := gin.New()
+	router.Use(RequestID(), Problems())
+	router.POST("/graphql", controller.Execute)
+	router.GET("/graphql", controller.Subscribe)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialGraphQL(t *testing.T, server *httptest.Server, subprotocols ...string) *websocket.Conn {
+	t.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/graphql", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readGraphQL(t *testing.T, conn *websocket.Conn) graphqlMessage {
+	t.Helper()
+
+	var msg graphqlMessage
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func TestGraphQLExecute(t *testing.T) {
+	server := graphqlServer(t)
+
+	body, _ := json.Marshal(graphqlRequest{Query: "{ hello }"})
+	resp, err := http.Post(server.URL+"/graphql", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]interface{}{"hello": "world"}, result["data"])
+
+	body, _ = json.Marshal(graphqlRequest{Query: "subscription { ticks }"})
+	resp, err = http.Post(server.URL+"/graphql", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestLimitDepth(t *testing.T) {
+	allowed := []graphqlRequest{
+		{Query: "{ hello }"},
+		{Query: "{ nearest(latitude: 0, longitude: 0) { location { nearestNeighbours { location { name } } } } }"},
+		{Query: "query A { hello } query B { a { b { c { d { e { f { g { h { i } } } } } } } } }", OperationName: "A"},
+		{Query: "{ ...Self } fragment Self on Query { ...Self }"},
+	}
+	for _, req := range allowed {
+		assert.NoError(t, limitDepth(req), req.Query)
+	}
+
+	rejected := []string{
+		"{ a { b { c { d { e { f { g { h { i } } } } } } } } }",
+		"{ ...Deep } fragment Deep on Query { a { b { c { d { e { f { g { h { i } } } } } } } } }",
+		"{ nearest { location { nearestNeighbours { location { nearestNeighbours { distanceKm } } } } } }",
+		"{ nearest { location { nearestNeighbours { location { ...Again } } } } } fragment Again on Location { n: nearestNeighbours { distanceKm } }",
+	}
+	for _, query := range rejected {
+		assert.Error(t, limitDepth(graphqlRequest{Query: query}), query)
+	}
+}
+
+func TestGraphQLSocketProtocol(t *testing.T) {
+	server := graphqlServer(t)
+	conn := dialGraphQL(t, server, graphqlTransportWS)
+
+	require.NoError(t, conn.WriteJSON(graphqlMessage{Type: "connection_init"}))
+	assert.Equal(t, "connection_ack", readGraphQL(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(graphqlMessage{Type: "ping"}))
+	assert.Equal(t, "pong", readGraphQL(t, conn).Type)
+
+	require.NoError(t, conn.WriteJSON(graphqlMessage{ID: "q", Type: "subscribe", Payload: json.RawMessage(`{"query": "{ hello }"}`)}))
+	msg := readGraphQL(t, conn)
+	assert.Equal(t, "next", msg.Type)
+	assert.JSONEq(t, `{"data": {"hello": "world"}}`, string(msg.Payload))
+	assert.Equal(t, graphqlMessage{ID: "q", Type: "complete"}, readGraphQL(t, conn))
+
+	require.NoError(t, conn.WriteJSON(graphqlMessage{ID: "s", Type: "subscribe", Payload: json.RawMessage(`{"query": "subscription { ticks }"}`)}))
+	for _, expected := range []string{`{"data": {"ticks": 1}}`, `{"data": {"ticks": 2}}`} {
+		msg := readGraphQL(t, conn)
+		assert.Equal(t, "next", msg.Type)
+		assert.JSONEq(t, expected, string(msg.Payload))
+	}
+	assert.Equal(t, graphqlMessage{ID: "s", Type: "complete"}, readGraphQL(t, conn))
+
+	require.NoError(t, conn.WriteJSON(graphqlMessage{ID: "e", Type: "subscribe", Payload: json.RawMessage(`{"query": "{ missing }"}`)}))
+	assert.Equal(t, "error", readGraphQL(t, conn).Type)
+}
+
+func TestGraphQLSocketCloseCodes(t *testing.T) {
+	server := graphqlServer(t)
+
+	expectClose := func(conn *websocket.Conn, code int) {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, code), "expected close %d, got %v", code, err)
+	}
+
+	expectClose(dialGraphQL(t, server), closeNotAcceptable)
+
+	conn := dialGraphQL(t, server, graphqlTransportWS)
+	require.NoError(t, conn.WriteJSON(graphqlMessage{ID: "q", Type: "subscribe", Payload: json.RawMessage(`{"query": "{ hello }"}`)}))
+	expectClose(conn, closeUnauthorized)
+
+	conn = dialGraphQL(t, server, graphqlTransportWS)
+	require.NoError(t, conn.WriteJSON(graphqlMessage{Type: "connection_init"}))
+	readGraphQL(t, conn)
+	require.NoError(t, conn.WriteJSON(graphqlMessage{Type: "connection_init"}))
+	expectClose(conn, closeTooManyInits)
+}
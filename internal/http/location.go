@@ -3,14 +3,17 @@ package http
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service"
 	"github.com/youngprinnce/geolocation-service/internal/service/location"
-	"gorm.io/gorm"
 )
 
-// LocationController handles HTTP requests for location endpoints
+// LocationController handles HTTP requests for location endpoints.
+// Errors are recorded with c.Error and answered by the Problems middleware.
 type LocationController struct {
 	service location.LocationBC
 }
@@ -26,28 +29,20 @@ func NewLocationController(service location.LocationBC) *LocationController {
 func (h *LocationController) CreateLocation(c *gin.Context) {
 	var req location.CreateLocationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		log.WithError(err).Error("Failed to bind location request")
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
 	// Validate coordinates
 	if err := location.ValidateCoordinates(req.Latitude, req.Longitude); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		_ = c.Error(err)
 		return
 	}
 
-	createdLocation, err := h.service.CreateLocation(req)
+	createdLocation, err := h.service.CreateLocation(c.Request.Context(), req)
 	if err != nil {
-		switch err.(type) {
-		case *location.DuplicateNameError:
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-			return
-		default:
-			log.WithError(err).Error("Failed to create location")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create location"})
-			return
-		}
+		_ = c.Error(err)
+		return
 	}
 
 	log.WithFields(log.Fields{
@@ -59,86 +54,286 @@ func (h *LocationController) CreateLocation(c *gin.Context) {
 	c.JSON(http.StatusCreated, createdLocation)
 }
 
-// GetLocations handles GET /locations
+// GetLocations handles GET /locations?limit=N&cursor=C&sort=[-]FIELD&lat=LAT&lng=LNG&fields=a,b&total=true.
+// The next page is linked from the Link header; the total count is returned in X-Total-Count.
 func (h *LocationController) GetLocations(c *gin.Context) {
-	locations, err := h.service.GetAllLocations()
+	query, err := listQuery(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	page, err := h.service.ListLocations(c.Request.Context(), query)
 	if err != nil {
-		log.WithError(err).Error("Failed to get locations")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get locations"})
+		_ = c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, locations)
+	if page.NextCursor != "" {
+		next := *c.Request.URL
+		values := next.Query()
+		values.Set("cursor", page.NextCursor)
+		next.RawQuery = values.Encode()
+		c.Header("Link", "<"+next.RequestURI()+">; rel=\"next\"")
+	}
+	if page.Total != nil {
+		c.Header("X-Total-Count", strconv.FormatInt(*page.Total, 10))
+	}
+
+	if len(query.Fields) == 0 {
+		c.JSON(http.StatusOK, page.Locations)
+		return
+	}
+
+	fields := query.Fields
+	if query.Sort == location.SortDistance {
+		fields = append(fields, "distance_km")
+	}
+	c.JSON(http.StatusOK, selectFields(page.Locations, fields))
+}
+
+// listQuery parses the listing parameters of GET /locations
+func listQuery(c *gin.Context) (location.ListQuery, error) {
+	var query location.ListQuery
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return query, badRequest("Invalid limit")
+		}
+		query.Limit = n
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := location.DecodeCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	query.Sort = strings.TrimPrefix(c.Query("sort"), "-")
+	query.Desc = strings.HasPrefix(c.Query("sort"), "-")
+	if query.Sort == location.SortDistance {
+		lat, lng, err := queryCoordinates(c)
+		if err != nil {
+			return query, err
+		}
+		query.Near = &location.Point{Latitude: lat, Longitude: lng}
+	}
+
+	if fields := c.Query("fields"); fields != "" {
+		query.Fields = strings.Split(fields, ",")
+	}
+
+	if total := c.Query("total"); total != "" {
+		withTotal, err := strconv.ParseBool(total)
+		if err != nil {
+			return query, badRequest("Invalid total")
+		}
+		query.WithTotal = withTotal
+	}
+
+	return query, nil
+}
+
+// selectFields renders only the requested fields of each location
+func selectFields(locations []location.Location, fields []string) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(locations))
+	for i, l := range locations {
+		all := map[string]interface{}{
+			"id":          l.ID,
+			"uuid":        l.UUID,
+			"name":        l.Name,
+			"latitude":    l.Latitude,
+			"longitude":   l.Longitude,
+			"category":    l.Category,
+			"radius_m":    l.RadiusMeters,
+			"created_at":  l.CreatedAt,
+			"updated_at":  l.UpdatedAt,
+			"distance_km": l.DistanceKm,
+		}
+
+		result[i] = make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			result[i][field] = all[field]
+		}
+	}
+	return result
 }
 
 // GetNearest handles GET /nearest?lat=LAT&lng=LNG
 func (h *LocationController) GetNearest(c *gin.Context) {
-	latStr := c.Query("lat")
-	lngStr := c.Query("lng")
+	lat, lng, err := queryCoordinates(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 
-	if latStr == "" || lngStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng query parameters are required"})
+	nearest, distance, err := h.service.FindNearestLocation(c.Request.Context(), lat, lng)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	lat, err := strconv.ParseFloat(latStr, 64)
+	response := gin.H{
+		"location":    nearest,
+		"distance_km": distance,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// FindAlongRoute handles POST /locations/along-route
+func (h *LocationController) FindAlongRoute(c *gin.Context) {
+	var req location.AlongRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	matches, err := h.service.FindAlongRoute(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid latitude value"})
+		_ = c.Error(err)
 		return
 	}
 
-	lng, err := strconv.ParseFloat(lngStr, 64)
+	c.JSON(http.StatusOK, matches)
+}
+
+// GetLocationByUUID handles GET /locations/id/{uuid}
+func (h *LocationController) GetLocationByUUID(c *gin.Context) {
+	id, err := pathUUID(c, "uuid")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid longitude value"})
+		_ = c.Error(err)
 		return
 	}
 
-	// Validate coordinates
-	if err := location.ValidateCoordinates(lat, lng); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	found, err := h.service.GetLocationByUUID(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	nearest, distance, err := h.service.FindNearestLocation(lat, lng)
+	c.JSON(http.StatusOK, found)
+}
+
+// UpdateLocation handles PUT /locations/{name}
+func (h *LocationController) UpdateLocation(c *gin.Context) {
+	name := c.Param("name")
+	h.updateLocation(c, func(req location.UpdateLocationRequest) (*location.Location, error) {
+		return h.service.UpdateLocation(c.Request.Context(), name, req)
+	})
+}
+
+// UpdateLocationByUUID handles PUT /locations/id/{uuid}
+func (h *LocationController) UpdateLocationByUUID(c *gin.Context) {
+	id, err := pathUUID(c, "uuid")
 	if err != nil {
-		switch err.(type) {
-		case *location.NoLocationsError:
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		default:
-			log.WithError(err).Error("Failed to find nearest location")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find nearest location"})
-			return
-		}
+		_ = c.Error(err)
+		return
 	}
+	h.updateLocation(c, func(req location.UpdateLocationRequest) (*location.Location, error) {
+		return h.service.UpdateLocationByUUID(c.Request.Context(), id, req)
+	})
+}
 
-	response := gin.H{
-		"location":    nearest,
-		"distance_km": distance,
+// updateLocation binds and validates an update request and applies it with update
+func (h *LocationController) updateLocation(c *gin.Context, update func(req location.UpdateLocationRequest) (*location.Location, error)) {
+	var req location.UpdateLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Validate coordinates
+	if err := location.ValidateCoordinates(req.Latitude, req.Longitude); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	updated, err := update(req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"uuid": updated.UUID,
+		"name": updated.Name,
+	}).Info("Location updated successfully")
+	c.JSON(http.StatusOK, updated)
 }
 
 // DeleteLocation handles DELETE /locations/{name}
 func (h *LocationController) DeleteLocation(c *gin.Context) {
 	name := c.Param("name")
 	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Location name is required"})
+		_ = c.Error(badRequest("Location name is required"))
 		return
 	}
 
-	err := h.service.DeleteLocationByName(name)
+	h.deleteLocation(c, log.WithField("name", name), func() error {
+		return h.service.DeleteLocationByName(c.Request.Context(), name)
+	})
+}
+
+// DeleteLocationByUUID handles DELETE /locations/id/{uuid}
+func (h *LocationController) DeleteLocationByUUID(c *gin.Context) {
+	id, err := pathUUID(c, "uuid")
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
-			return
-		}
-		log.WithError(err).Error("Failed to delete location")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		_ = c.Error(err)
+		return
+	}
+
+	h.deleteLocation(c, log.WithField("uuid", id), func() error {
+		return h.service.DeleteLocationByUUID(c.Request.Context(), id)
+	})
+}
+
+// deleteLocation runs remove and writes its outcome
+func (h *LocationController) deleteLocation(c *gin.Context, entry *log.Entry, remove func() error) {
+	if err := remove(); err != nil {
+		_ = c.Error(err)
 		return
 	}
 
-	log.WithField("name", name).Info("Location deleted successfully")
+	entry.Info("Location deleted successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Location deleted successfully"})
 }
+
+// pathUUID parses a UUID path parameter
+func pathUUID(c *gin.Context, name string) (uuid.UUID, error) {
+	id := service.StringToUUID(c.Param(name))
+	if id == uuid.Nil {
+		return uuid.Nil, badRequest("Invalid %s", name)
+	}
+	return id, nil
+}
+
+// queryCoordinates parses and validates the lat and lng query parameters
+func queryCoordinates(c *gin.Context) (float64, float64, error) {
+	latStr := c.Query("lat")
+	lngStr := c.Query("lng")
+
+	if latStr == "" || lngStr == "" {
+		return 0, 0, badRequest("lat and lng query parameters are required")
+	}
+
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil {
+		return 0, 0, badRequest("Invalid latitude value")
+	}
+
+	lng, err := strconv.ParseFloat(lngStr, 64)
+	if err != nil {
+		return 0, 0, badRequest("Invalid longitude value")
+	}
+
+	// Validate coordinates
+	if err := location.ValidateCoordinates(lat, lng); err != nil {
+		return 0, 0, err
+	}
+
+	return lat, lng, nil
+}
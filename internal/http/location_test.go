@@ -2,13 +2,16 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"gorm.io/gorm"
 )
 
 func TestCreateLocation(t *testing.T) {
@@ -63,3 +66,92 @@ func TestLocationControllerStructure(t *testing.T) {
 
 	assert.NotNil(t, controller)
 }
+
+// listService returns a fixed page and records the query it was asked for
+type listService struct {
+	location.LocationBC
+	page  *location.LocationPage
+	query location.ListQuery
+}
+
+func (s *listService) ListLocations(ctx context.Context, query location.ListQuery) (*location.LocationPage, error) {
+	s.query = query
+	return s.page, nil
+}
+
+func TestGetLocationsPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	total := int64(42)
+	service := &listService{page: &location.LocationPage{
+		Locations:  []location.Location{{ID: 7, Name: "Alpha", Latitude: 1, Longitude: 2}},
+		NextCursor: "abc",
+		Total:      &total,
+	}}
+	router := gin.New()
+	router.Use(RequestID(), Problems())
+	router.GET("/locations", NewLocationController(service).GetLocations)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/locations?limit=1&sort=-name&fields=name,latitude&total=true", nil))
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, location.ListQuery{Sort: "name", Desc: true, Limit: 1, Fields: []string{"name", "latitude"}, WithTotal: true}, service.query)
+	assert.Equal(t, `</locations?cursor=abc&fields=name%2Clatitude&limit=1&sort=-name&total=true>; rel="next"`, w.Header().Get("Link"))
+	assert.Equal(t, "42", w.Header().Get("X-Total-Count"))
+	assert.JSONEq(t, `[{"name": "Alpha", "latitude": 1}]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/locations?sort=distance", nil))
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/locations?cursor=!!!", nil))
+	assert.Equal(t, 400, w.Code)
+}
+
+// uuidService serves a single location by its UUID
+type uuidService struct {
+	location.LocationBC
+	location location.Location
+}
+
+func (s *uuidService) GetLocationByUUID(ctx context.Context, id uuid.UUID) (*location.Location, error) {
+	if id != s.location.UUID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &s.location, nil
+}
+
+func (s *uuidService) DeleteLocationByUUID(ctx context.Context, id uuid.UUID) error {
+	_, err := s.GetLocationByUUID(ctx, id)
+	return err
+}
+
+func TestLocationByUUID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := &uuidService{location: location.Location{ID: 3, UUID: uuid.New(), Name: "Depot/North"}}
+	controller := NewLocationController(service)
+	router := gin.New()
+	router.Use(RequestID(), Problems())
+	router.GET("/locations/id/:uuid", controller.GetLocationByUUID)
+	router.DELETE("/locations/id/:uuid", controller.DeleteLocationByUUID)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/locations/id/"+service.location.UUID.String(), nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"uuid":"`+service.location.UUID.String()+`"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/locations/id/"+uuid.NewString(), nil))
+	assert.Equal(t, 404, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/locations/id/not-a-uuid", nil))
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/locations/id/"+service.location.UUID.String(), nil))
+	assert.Equal(t, 200, w.Code)
+}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// NearestSocketOptions tunes the keepalive and timeouts of nearest-station sockets
+type NearestSocketOptions struct {
+	// PingInterval is how often the server pings the client
+	PingInterval time.Duration
+	// PongWait is how long the server waits for any message or pong before giving up on the client
+	PongWait time.Duration
+	// IdleTimeout closes sockets that have not sent a position for this long
+	IdleTimeout time.Duration
+	// MaxMessageBytes caps the size of a single client message
+	MaxMessageBytes int64
+}
+
+// DefaultNearestSocketOptions returns the options used when nothing is configured
+func DefaultNearestSocketOptions() NearestSocketOptions {
+	return NearestSocketOptions{
+		PingInterval:    20 * time.Second,
+		PongWait:        60 * time.Second,
+		IdleTimeout:     5 * time.Minute,
+		MaxMessageBytes: 4096,
+	}
+}
+
+// socketWriteWait bounds how long a single write to a socket may block
+const socketWriteWait = 10 * time.Second
+
+// NearestSocketController serves nearest-station lookups over a WebSocket
+type NearestSocketController struct {
+	service  location.LocationBC
+	options  NearestSocketOptions
+	upgrader websocket.Upgrader
+	closing  shutdown
+}
+
+// NewNearestSocketController creates a new nearest-station socket controller
+func NewNearestSocketController(service location.LocationBC, options NearestSocketOptions) *NearestSocketController {
+	return &NearestSocketController{
+		service:  service,
+		options:  options,
+		upgrader: websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024},
+	}
+}
+
+// nearestFix is a position sent by the client. K overrides the k given when connecting.
+type nearestFix struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	K         int      `json:"k"`
+
+	err error
+}
+
+// nearestUpdate is sent whenever the nearest stations change
+type nearestUpdate struct {
+	Type    string                  `json:"type"`
+	Results []location.NearestMatch `json:"results"`
+}
+
+// socketError reports a rejected message without closing the socket
+type socketError struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// StreamNearest handles GET /locations/nearest/ws?k=K. The client sends
+// {"latitude": LAT, "longitude": LNG} messages and receives {"type": "nearest", "results": [...]}
+// whenever the k nearest stations differ from the last answer sent.
+func (h *NearestSocketController) StreamNearest(c *gin.Context) {
+	k := 1
+	if value := c.Query("k"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > location.MaxNearest {
+			_ = c.Error(badRequest("k must be an integer between 1 and 50"))
+			return
+		}
+		k = n
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		log.WithError(err).Warn("Failed to upgrade nearest-station socket")
+		return
+	}
+	defer conn.Close()
+
+	// Holds at most the latest unprocessed fix, so a client sending faster than lookups
+	// complete only ever gets answers for its most recent position
+	fixes := make(chan nearestFix, 1)
+	go h.readFixes(conn, k, fixes)
+
+	h.writeUpdates(c.Request.Context(), conn, fixes)
+}
+
+// Shutdown closes the open sockets, telling clients the server is going away
+func (h *NearestSocketController) Shutdown() {
+	h.closing.begin()
+}
+
+// readFixes reads and validates client messages until the connection fails, then closes fixes
+func (h *NearestSocketController) readFixes(conn *websocket.Conn, k int, fixes chan nearestFix) {
+	defer close(fixes)
+
+	conn.SetReadLimit(h.options.MaxMessageBytes)
+	extend := func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.options.PongWait))
+	}
+	_ = extend("")
+	conn.SetPongHandler(extend)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.WithError(err).Debug("Nearest-station socket closed")
+			}
+			return
+		}
+		_ = extend("")
+
+		fix := nearestFix{K: k}
+		if err := json.Unmarshal(data, &fix); err != nil || fix.Latitude == nil || fix.Longitude == nil {
+			fix.err = &location.ValidationError{Field: "message", Message: "must be a JSON object with latitude and longitude"}
+		} else if err := location.ValidateCoordinates(*fix.Latitude, *fix.Longitude); err != nil {
+			fix.err = err
+		}
+
+		// Replace any fix the writer has not picked up yet
+		select {
+		case <-fixes:
+		default:
+		}
+		fixes <- fix
+	}
+}
+
+// writeUpdates answers fixes, keeps the connection alive with pings and closes idle sockets
+func (h *NearestSocketController) writeUpdates(ctx context.Context, conn *websocket.Conn, fixes <-chan nearestFix) {
+	ping := time.NewTicker(h.options.PingInterval)
+	defer ping.Stop()
+	idle := time.NewTimer(h.options.IdleTimeout)
+	defer idle.Stop()
+
+	var last []location.NearestMatch
+	sent := false
+
+	for {
+		select {
+		case fix, ok := <-fixes:
+			if !ok {
+				return
+			}
+			idle.Reset(h.options.IdleTimeout)
+
+			if fix.err != nil {
+				if err := writeSocketJSON(conn, socketError{Type: "error", Error: fix.err.Error()}); err != nil {
+					return
+				}
+				continue
+			}
+
+			matches, err := h.service.FindKNearest(ctx, *fix.Latitude, *fix.Longitude, fix.K)
+			if err != nil {
+				switch err.(type) {
+				case *location.NoLocationsError:
+					matches = []location.NearestMatch{}
+				case *location.ValidationError:
+					if err := writeSocketJSON(conn, socketError{Type: "error", Error: err.Error()}); err != nil {
+						return
+					}
+					continue
+				default:
+					log.WithError(err).Error("Failed to find nearest locations")
+					if err := writeSocketJSON(conn, socketError{Type: "error", Error: "Failed to find nearest locations"}); err != nil {
+						return
+					}
+					continue
+				}
+			}
+
+			if sent && sameStations(last, matches) {
+				continue
+			}
+			if err := writeSocketJSON(conn, nearestUpdate{Type: "nearest", Results: matches}); err != nil {
+				return
+			}
+			last, sent = matches, true
+
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+
+		case <-idle.C:
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "idle timeout")
+			_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+			return
+
+		case <-h.closing.done():
+			message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteWait))
+			return
+		}
+	}
+}
+
+// sameStations reports whether two answers list the same stations, unchanged and in the same order
+func sameStations(a, b []location.NearestMatch) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Location.ID != b[i].Location.ID || !a[i].Location.UpdatedAt.Equal(b[i].Location.UpdatedAt) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeSocketJSON(conn *websocket.Conn, v interface{}) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(socketWriteWait)); err != nil {
+		return err
+	}
+	return conn.WriteJSON(v)
+}
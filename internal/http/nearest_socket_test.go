@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// nearestService answers k-nearest queries from a fixed set of locations
+type nearestService struct {
+	location.LocationBC
+	service location.LocationBC
+}
+
+func (s *nearestService) FindKNearest(ctx context.Context, lat, lng float64, k int) ([]location.NearestMatch, error) {
+	return s.service.FindKNearest(ctx, lat, lng, k)
+}
+
+type fixedStore struct {
+	location.LocationStore
+	locations []location.Location
+}
+
+func (s *fixedStore) GetAll() ([]location.Location, error) {
+	return s.locations, nil
+}
+
+func dialNearest(t *testing.T, options NearestSocketOptions, query string) *websocket.Conn {
+	t.Helper()
+	conn, _ := dialNearestController(t, options, query)
+	return conn
+}
+
+func dialNearestController(t *testing.T, options NearestSocketOptions, query string) (*websocket.Conn, *NearestSocketController) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := &fixedStore{locations: []location.Location{
+		{ID: 1, Name: "West", Latitude: 0, Longitude: -1},
+		{ID: 2, Name: "East", Latitude: 0, Longitude: 1},
+	}}
+	service := &nearestService{service: location.NewLocationService(store, &location.DistanceCalculator{}, nil)}
+
+	controller := NewNearestSocketController(service, options)
+	router := gin.New()
+	router.Use(RequestID(), Problems())
+	router.GET("/locations/nearest/ws", controller.StreamNearest)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/locations/nearest/ws" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, controller
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	var msg map[string]interface{}
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	require.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func resultNames(msg map[string]interface{}) []string {
+	var names []string
+	for _, result := range msg["results"].([]interface{}) {
+		names = append(names, result.(map[string]interface{})["location"].(map[string]interface{})["name"].(string))
+	}
+	return names
+}
+
+func TestStreamNearestSendsOnlyChanges(t *testing.T) {
+	conn := dialNearest(t, DefaultNearestSocketOptions(), "?k=1")
+
+	require.NoError(t, conn.WriteJSON(map[string]float64{"latitude": 0, "longitude": -0.5}))
+	msg := readMessage(t, conn)
+	assert.Equal(t, "nearest", msg["type"])
+	assert.Equal(t, []string{"West"}, resultNames(msg))
+
+	// Same answer, nothing is sent; the next message is the answer for the move east
+	require.NoError(t, conn.WriteJSON(map[string]float64{"latitude": 0, "longitude": -0.4}))
+	require.NoError(t, conn.WriteJSON(map[string]float64{"latitude": 0, "longitude": 0.5}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, []string{"East"}, resultNames(msg))
+
+	// Asking for more stations changes the answer too
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"latitude": 0, "longitude": 0.5, "k": 2}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, []string{"East", "West"}, resultNames(msg))
+}
+
+func TestStreamNearestRejectsInvalidFixes(t *testing.T) {
+	conn := dialNearest(t, DefaultNearestSocketOptions(), "")
+
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("not json")))
+	msg := readMessage(t, conn)
+	assert.Equal(t, "error", msg["type"])
+
+	require.NoError(t, conn.WriteJSON(map[string]float64{"latitude": 95, "longitude": 0}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, "error", msg["type"])
+	assert.Contains(t, msg["error"], "latitude")
+
+	// The socket stays usable after an error
+	require.NoError(t, conn.WriteJSON(map[string]float64{"latitude": 0, "longitude": 0.5}))
+	msg = readMessage(t, conn)
+	assert.Equal(t, []string{"East"}, resultNames(msg))
+}
+
+func TestStreamNearestClosesIdleSockets(t *testing.T) {
+	options := DefaultNearestSocketOptions()
+	options.IdleTimeout = 50 * time.Millisecond
+	conn := dialNearest(t, options, "")
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "expected an idle close, got %v", err)
+}
+
+func TestStreamNearestClosesOnShutdown(t *testing.T) {
+	conn, controller := dialNearestController(t, DefaultNearestSocketOptions(), "")
+	controller.Shutdown()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.CloseGoingAway, closeErr.Code)
+	assert.Equal(t, "server shutting down", closeErr.Text)
+}
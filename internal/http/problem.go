@@ -0,0 +1,287 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"github.com/youngprinnce/geolocation-service/internal/service/webhook"
+	"gorm.io/gorm"
+)
+
+// problemContentType is the media type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// RequestIDHeader carries the ID of a request in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key holding the request ID
+const requestIDKey = "request_id"
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// Stable problem codes; clients should switch on these rather than on titles or details
+const (
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidBody      = "invalid_body"
+	CodeBadRequest       = "bad_request"
+	CodeInvalidCursor    = "invalid_cursor"
+	CodeNotFound         = "not_found"
+	CodeNoLocations      = "no_locations"
+	CodeUnknownStations  = "unknown_stations"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeDuplicateName    = "duplicate_name"
+	CodeDeliveryNotDead  = "delivery_not_dead"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// RequestID tags every request with an ID, reusing the client's X-Request-ID when it sent a usable one
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// Problems answers the last error a handler recorded with c.Error as problem details.
+// Errors recorded after a response was written are only logged.
+func Problems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		problem := problemFor(err)
+		problem.Instance = c.Request.URL.Path
+		problem.RequestID = c.GetString(requestIDKey)
+
+		entry := log.WithFields(log.Fields{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"request_id": problem.RequestID,
+			"code":       problem.Code,
+		}).WithError(err)
+		if problem.Status >= http.StatusInternalServerError {
+			entry.Error("Request failed")
+		} else {
+			entry.Debug("Request rejected")
+		}
+
+		if c.Writer.Written() {
+			return
+		}
+		if problem.Status == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", authChallenge)
+		}
+		writeProblem(c, problem)
+	}
+}
+
+// RecoverProblem reports a recovered panic as an internal error; use it with gin.CustomRecovery
+func RecoverProblem(c *gin.Context, recovered interface{}) {
+	_ = c.Error(fmt.Errorf("panic: %v", recovered))
+	c.Abort()
+}
+
+// NoRoute reports requests for unknown paths as problems
+func NoRoute(c *gin.Context) {
+	_ = c.Error(service.NotFound{Err: fmt.Errorf("No route for %s %s", c.Request.Method, c.Request.URL.Path)})
+}
+
+// NoMethod reports requests with an unsupported method as problems
+func NoMethod(c *gin.Context) {
+	writeProblem(c, Problem{
+		Type:      problemType(CodeMethodNotAllowed),
+		Title:     http.StatusText(http.StatusMethodNotAllowed),
+		Status:    http.StatusMethodNotAllowed,
+		Detail:    "Method " + c.Request.Method + " is not allowed on " + c.Request.URL.Path,
+		Instance:  c.Request.URL.Path,
+		Code:      CodeMethodNotAllowed,
+		RequestID: c.GetString(requestIDKey),
+	})
+	c.Abort()
+}
+
+// badRequest reports a malformed request parameter
+func badRequest(format string, args ...interface{}) error {
+	return service.BadRequest{Err: fmt.Errorf(format, args...)}
+}
+
+// problemFor maps a domain error to problem details
+func problemFor(err error) Problem {
+	var (
+		validationErr   *location.ValidationError
+		fieldErrs       validator.ValidationErrors
+		syntaxErr       *json.SyntaxError
+		typeErr         *json.UnmarshalTypeError
+		duplicateErr    *location.DuplicateNameError
+		duplicateGeoErr *geofence.DuplicateNameError
+		noLocationsErr  *location.NoLocationsError
+		unknownErr      *route.UnknownStationsError
+		cursorErr       *outbox.InvalidCursorError
+		notDeadErr      *webhook.NotDeadError
+		unauthorizedErr *auth.UnauthorizedError
+		forbiddenErr    *auth.ForbiddenError
+		quotaErr        *location.QuotaExceededError
+		limitedErr      *ratelimit.LimitedError
+		badRequestErr   interface{ BadRequest() }
+		notFoundErr     interface{ NotFound() }
+	)
+
+	switch {
+	case errors.As(err, &unauthorizedErr):
+		return newProblem(http.StatusUnauthorized, CodeUnauthorized, err.Error())
+	case errors.As(err, &forbiddenErr):
+		return newProblem(http.StatusForbidden, CodeForbidden, err.Error())
+	case errors.As(err, &quotaErr):
+		return newProblem(http.StatusForbidden, CodeQuotaExceeded, err.Error())
+	case errors.As(err, &limitedErr):
+		return newProblem(http.StatusTooManyRequests, CodeRateLimited, err.Error())
+	case errors.As(err, &validationErr):
+		return newProblem(http.StatusBadRequest, CodeValidationFailed, err.Error(),
+			FieldError{Field: validationErr.Field, Message: validationErr.Message})
+	case errors.As(err, &fieldErrs):
+		details := make([]FieldError, len(fieldErrs))
+		for i, fieldErr := range fieldErrs {
+			details[i] = FieldError{Field: fieldPath(fieldErr), Message: fieldMessage(fieldErr)}
+		}
+		return newProblem(http.StatusBadRequest, CodeValidationFailed, "The request has invalid fields", details...)
+	case errors.As(err, &typeErr):
+		return newProblem(http.StatusBadRequest, CodeValidationFailed, "The request has invalid fields",
+			FieldError{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return newProblem(http.StatusBadRequest, CodeInvalidBody, "The request body is not valid JSON")
+	case errors.As(err, &cursorErr):
+		return newProblem(http.StatusBadRequest, CodeInvalidCursor, err.Error())
+	case errors.As(err, &badRequestErr):
+		return newProblem(http.StatusBadRequest, CodeBadRequest, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return newProblem(http.StatusNotFound, CodeNotFound, "The requested resource was not found")
+	case errors.As(err, &notFoundErr):
+		return newProblem(http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.As(err, &noLocationsErr):
+		return newProblem(http.StatusNotFound, CodeNoLocations, err.Error())
+	case errors.As(err, &unknownErr):
+		return newProblem(http.StatusNotFound, CodeUnknownStations, err.Error())
+	case errors.As(err, &duplicateErr), errors.As(err, &duplicateGeoErr):
+		return newProblem(http.StatusConflict, CodeDuplicateName, err.Error())
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		// A concurrent request took the name between the service's check and the insert
+		return newProblem(http.StatusConflict, CodeDuplicateName, "The name is already taken")
+	case errors.As(err, &notDeadErr):
+		return newProblem(http.StatusConflict, CodeDeliveryNotDead, err.Error())
+	default:
+		// The cause is logged but never shown to clients
+		return newProblem(http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+func newProblem(status int, code, detail string, fields ...FieldError) Problem {
+	return Problem{
+		Type:   problemType(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: fields,
+	}
+}
+
+// problemType returns the URI identifying a problem code
+func problemType(code string) string {
+	return "urn:geolocation-service:problem:" + code
+}
+
+func writeProblem(c *gin.Context, problem Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.JSON(problem.Status, problem)
+}
+
+// fieldPath returns the JSON path of a rejected field without the name of the request struct
+func fieldPath(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.IndexByte(namespace, '.'); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// fieldMessage describes the failed validation rule of a field
+func fieldMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return "must be at least " + fieldErr.Param()
+	case "max", "lte":
+		return "must be at most " + fieldErr.Param()
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	case "lt":
+		return "must be less than " + fieldErr.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	case "url":
+		return "must be a URL"
+	default:
+		return "failed the " + fieldErr.Tag() + " check"
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/internal/app"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"gorm.io/gorm"
+)
+
+func newProblemRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	binding.Validator = new(app.DefaultValidator)
+
+	router := gin.New()
+	router.Use(RequestID(), Problems(), gin.CustomRecovery(RecoverProblem))
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(NoRoute)
+	router.NoMethod(NoMethod)
+	return router
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	return problem
+}
+
+func TestProblemMapping(t *testing.T) {
+	router := newProblemRouter()
+
+	errs := map[string]error{
+		"/validation": &location.ValidationError{Field: "latitude", Message: "must be between -90 and 90"},
+		"/duplicate":  &location.DuplicateNameError{Name: "Depot"},
+		"/raced":      fmt.Errorf("failed to create location: %w", gorm.ErrDuplicatedKey),
+		"/empty":      &location.NoLocationsError{},
+		"/unknown":    &route.UnknownStationsError{Names: []string{"Nowhere"}},
+		"/missing":    gorm.ErrRecordNotFound,
+		"/bad":        badRequest("Invalid limit"),
+		"/internal":   errors.New("connection refused by 10.0.0.3"),
+	}
+	for path, err := range errs {
+		err := err
+		router.GET(path, func(c *gin.Context) { _ = c.Error(err) })
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+		detail string
+	}{
+		{"/validation", 400, CodeValidationFailed, "latitude: must be between -90 and 90"},
+		{"/duplicate", 409, CodeDuplicateName, "Location name already exists: Depot"},
+		{"/raced", 409, CodeDuplicateName, "The name is already taken"},
+		{"/empty", 404, CodeNoLocations, "No locations found"},
+		{"/unknown", 404, CodeUnknownStations, "Unknown stations: Nowhere"},
+		{"/missing", 404, CodeNotFound, "The requested resource was not found"},
+		{"/bad", 400, CodeBadRequest, "Invalid limit"},
+		{"/internal", 500, CodeInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			problem := decodeProblem(t, w)
+			assert.Equal(t, tt.status, problem.Status)
+			assert.Equal(t, tt.code, problem.Code)
+			assert.Equal(t, "urn:geolocation-service:problem:"+tt.code, problem.Type)
+			assert.Equal(t, http.StatusText(tt.status), problem.Title)
+			assert.Equal(t, tt.detail, problem.Detail)
+			assert.Equal(t, tt.path, problem.Instance)
+			assert.Equal(t, w.Header().Get(RequestIDHeader), problem.RequestID)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/validation", nil))
+	assert.Equal(t, []FieldError{{Field: "latitude", Message: "must be between -90 and 90"}}, decodeProblem(t, w).Errors)
+}
+
+func TestProblemBindingErrors(t *testing.T) {
+	router := newProblemRouter()
+	router.POST("/locations", func(c *gin.Context) {
+		var req location.CreateLocationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/locations", strings.NewReader(`{"latitude": 95, "longitude": 1}`)))
+	assert.Equal(t, 400, w.Code)
+	problem := decodeProblem(t, w)
+	assert.Equal(t, CodeValidationFailed, problem.Code)
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "latitude", Message: "must be at most 90"},
+	}, problem.Errors)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/locations", strings.NewReader(`{"name": 1}`)))
+	assert.Equal(t, 400, w.Code)
+	problem = decodeProblem(t, w)
+	assert.Equal(t, CodeValidationFailed, problem.Code)
+	assert.Equal(t, []FieldError{{Field: "name", Message: "must be a string"}}, problem.Errors)
+
+	for _, body := range []string{`{"name": `, ``} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/locations", strings.NewReader(body)))
+		assert.Equal(t, 400, w.Code)
+		assert.Equal(t, CodeInvalidBody, decodeProblem(t, w).Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	router := newProblemRouter()
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set(RequestIDHeader, "trace-123")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "trace-123", w.Header().Get(RequestIDHeader))
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set(RequestIDHeader, "has spaces\n")
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, "has spaces\n", w.Header().Get(RequestIDHeader))
+	assert.Len(t, w.Header().Get(RequestIDHeader), 36)
+}
+
+func TestProblemRoutingAndPanics(t *testing.T) {
+	router := newProblemRouter()
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	assert.Equal(t, 500, w.Code)
+	problem := decodeProblem(t, w)
+	assert.Equal(t, CodeInternal, problem.Code)
+	assert.NotContains(t, w.Body.String(), "boom")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/nowhere", nil))
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, CodeNotFound, decodeProblem(t, w).Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/panic", nil))
+	assert.Equal(t, 405, w.Code)
+	assert.Equal(t, CodeMethodNotAllowed, decodeProblem(t, w).Code)
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+)
+
+// Headers describing the rate limit of a route, after the IETF RateLimit header fields draft
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// Headers describing the monthly quota of an API key
+const (
+	QuotaLimitHeader     = "X-Quota-Limit"
+	QuotaRemainingHeader = "X-Quota-Remaining"
+	QuotaResetHeader     = "X-Quota-Reset"
+)
+
+// RateLimiter refuses the requests of a client beyond the rate limit of their
+// route, and the requests of an API key beyond its monthly quota
+type RateLimiter struct {
+	policy  ratelimit.Policy
+	limiter *ratelimit.Limiter
+	meter   *ratelimit.Meter
+}
+
+// NewRateLimiter creates a rate limiter applying policy with limiter. Monthly
+// quotas are only enforced when meter is not nil.
+func NewRateLimiter(policy ratelimit.Policy, limiter *ratelimit.Limiter, meter *ratelimit.Meter) *RateLimiter {
+	return &RateLimiter{
+		policy:  policy,
+		limiter: limiter,
+		meter:   meter,
+	}
+}
+
+// Check returns an error naming the first route of the policy that is not registered
+func (r *RateLimiter) Check(routes gin.RoutesInfo) error {
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		registered[ratelimit.RouteKey(route.Method, route.Path)] = true
+	}
+	for key := range r.policy.Routes {
+		if !registered[key] {
+			return fmt.Errorf("no route %q, expected a method and path such as \"GET /locations/nearest\"", key)
+		}
+	}
+	return nil
+}
+
+// Limit counts every request against the limits of its client. It runs after
+// authentication, so clients are told apart by their credentials, and by their
+// IP when they send none.
+func (r *RateLimiter) Limit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "" {
+			// Unknown routes are answered without doing any work
+			c.Next()
+			return
+		}
+		principal, _ := auth.FromContext(c.Request.Context())
+		if err := r.admit(c, principal); err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// admit counts a request of principal, or of its IP when principal is nil, against the
+// limits of its route, sets the headers describing them and returns a LimitedError when
+// the request is refused
+func (r *RateLimiter) admit(c *gin.Context, principal *auth.Principal) error {
+	client, isKey := ratelimit.ClientOf(principal, c.ClientIP())
+
+	rate, quota, err := r.Admit(client, isKey, c.Request.Method, c.FullPath())
+	if rate.Limit > 0 {
+		c.Header(RateLimitLimitHeader, strconv.FormatInt(rate.Limit, 10))
+		c.Header(RateLimitRemainingHeader, strconv.FormatInt(rate.Remaining, 10))
+		c.Header(RateLimitResetHeader, strconv.FormatInt(ratelimit.Seconds(rate.Reset), 10))
+	}
+	if quota.Limit > 0 {
+		c.Header(QuotaLimitHeader, strconv.FormatInt(quota.Limit, 10))
+		c.Header(QuotaRemainingHeader, strconv.FormatInt(quota.Remaining, 10))
+		c.Header(QuotaResetHeader, strconv.FormatInt(ratelimit.Seconds(quota.Reset), 10))
+	}
+	var limited *ratelimit.LimitedError
+	if errors.As(err, &limited) {
+		c.Header("Retry-After", strconv.FormatInt(ratelimit.Seconds(limited.RetryAfter), 10))
+	}
+	return err
+}
+
+// Admit counts a request of client to a route against the route's rate limit and, for
+// API keys, against the monthly quota. It returns the decisions of the limits that
+// apply, zero for the others, and a LimitedError when the request is refused. Calls
+// that are not HTTP requests pass an empty method and path, sharing the default limit.
+func (r *RateLimiter) Admit(client string, isKey bool, method, path string) (rate, quota ratelimit.Decision, err error) {
+	limit, route := r.policy.For(method, path)
+	if !limit.Unlimited() {
+		rate = r.limiter.Allow(client+" "+route, limit)
+		if !rate.Allowed {
+			return rate, quota, &ratelimit.LimitedError{RetryAfter: rate.RetryAfter, Reason: "Too many requests"}
+		}
+	}
+
+	if r.meter != nil && isKey {
+		decision, err := r.meter.Use(client)
+		if err != nil {
+			// Losing count of a request is better than refusing it while the database is unavailable
+			log.WithError(err).WithField("client", client).Warn("Failed to count request against the monthly quota")
+			return rate, quota, nil
+		}
+		if decision.Limit > 0 {
+			quota = decision
+		}
+		if !decision.Allowed {
+			return rate, decision, &ratelimit.LimitedError{
+				RetryAfter: decision.RetryAfter,
+				Reason:     fmt.Sprintf("The monthly quota of %d requests is used up", decision.Limit),
+			}
+		}
+	}
+	return rate, quota, nil
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+)
+
+// fakeUsage is a UsageStore counting in memory
+type fakeUsage map[string]int64
+
+func (f fakeUsage) Add(client, period string, n int64) (int64, error) {
+	f[client+" "+period] += n
+	return f[client+" "+period], nil
+}
+
+func TestRateLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	keys := fakeKeys{
+		"reader": {ID: "1", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeRead}},
+		"capped": {ID: "2", Method: auth.MethodAPIKey, Scopes: []string{auth.ScopeRead}},
+	}
+	policy := ratelimit.Policy{
+		Default: ratelimit.Limit{Rate: 0.001, Burst: 2},
+		Routes:  map[string]ratelimit.Limit{"GET /nearest": {Rate: 0.001, Burst: 1}},
+	}
+	meter := ratelimit.NewMeter(fakeUsage{}, ratelimit.Quotas{Clients: map[string]int64{ratelimit.ClientKey(auth.MethodAPIKey, "2"): 1}}, time.Minute)
+	limiter := NewRateLimiter(policy, ratelimit.NewLimiter(), meter)
+
+	router := gin.New()
+	router.Use(RequestID(), Problems(), NewAuthenticator(keys, nil).Authenticate(limiter), limiter.Limit())
+	router.GET("/list", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("/nearest", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	assert.NoError(t, limiter.Check(router.Routes()))
+
+	serve := func(path, key, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Anonymous clients are limited by IP
+	assert.Equal(t, http.StatusNoContent, serve("/list", "", "10.0.0.1").Code)
+	w := serve("/list", "", "10.0.0.1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "2", w.Header().Get(RateLimitLimitHeader))
+	assert.Equal(t, "0", w.Header().Get(RateLimitRemainingHeader))
+	w = serve("/list", "", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), CodeRateLimited)
+	assert.Equal(t, http.StatusNoContent, serve("/list", "", "10.0.0.2").Code)
+
+	// Invalid credentials count against the IP they come from
+	assert.Equal(t, http.StatusUnauthorized, serve("/list", "guess", "10.0.0.4").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve("/list", "guess", "10.0.0.4").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/list", "guess", "10.0.0.4").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/list", "", "10.0.0.4").Code)
+
+	// Routes with their own limit have their own bucket
+	assert.Equal(t, http.StatusNoContent, serve("/nearest", "reader", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/nearest", "reader", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusNoContent, serve("/list", "reader", "10.0.0.1").Code)
+
+	// API keys are refused once their monthly quota is used up
+	w = serve("/list", "capped", "10.0.0.3")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "1", w.Header().Get(QuotaLimitHeader))
+	assert.Equal(t, "0", w.Header().Get(QuotaRemainingHeader))
+	w = serve("/list", "capped", "10.0.0.3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "monthly quota")
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	unknown := NewRateLimiter(ratelimit.Policy{Routes: map[string]ratelimit.Limit{"GET /missing": {Rate: 1}}}, ratelimit.NewLimiter(), nil)
+	assert.Error(t, unknown.Check(router.Routes()))
+}
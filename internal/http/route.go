@@ -0,0 +1,43 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+)
+
+// RouteController handles HTTP requests for route planning endpoints
+type RouteController struct {
+	service route.RouteBC
+}
+
+// NewRouteController creates a new route controller
+func NewRouteController(service route.RouteBC) *RouteController {
+	return &RouteController{
+		service: service,
+	}
+}
+
+// OptimizeRoute handles POST /routes/optimize
+func (h *RouteController) OptimizeRoute(c *gin.Context) {
+	var req route.OptimizeRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	optimized, err := h.service.OptimizeRoute(c.Request.Context(), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"stations":    len(req.Stations),
+		"distance_km": optimized.TotalDistanceKm,
+	}).Info("Route optimized successfully")
+
+	c.JSON(http.StatusOK, optimized)
+}
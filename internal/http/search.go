@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/search"
+)
+
+// SearchController handles HTTP requests for location name search
+type SearchController struct {
+	service search.SearchBC
+}
+
+// NewSearchController creates a new search controller
+func NewSearchController(service search.SearchBC) *SearchController {
+	return &SearchController{
+		service: service,
+	}
+}
+
+// SearchLocations handles GET /locations/search?q=&lat=&lng=&limit=
+func (h *SearchController) SearchLocations(c *gin.Context) {
+	query := search.Query{Text: c.Query("q")}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			_ = c.Error(badRequest("Invalid limit"))
+			return
+		}
+		query.Limit = n
+	}
+
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		lat, lng, err := queryCoordinates(c)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		query.Near = &location.Point{Latitude: lat, Longitude: lng}
+	}
+
+	results, err := h.service.Search(c.Request.Context(), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
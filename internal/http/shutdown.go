@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shutdown is closed when the server begins shutting down, so handlers that hold
+// connections open, streams and sockets, end them instead of delaying the shutdown.
+// The zero value is ready to use.
+type shutdown struct {
+	mu   sync.Mutex
+	ch   chan struct{}
+	once sync.Once
+}
+
+// done returns a channel that is closed once the shutdown has begun
+func (s *shutdown) done() <-chan struct{} {
+	return s.channel()
+}
+
+// begin closes done; it may be called more than once
+func (s *shutdown) begin() {
+	ch := s.channel()
+	s.once.Do(func() {
+		close(ch)
+	})
+}
+
+func (s *shutdown) channel() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
+
+// context returns a copy of parent that is also cancelled when the shutdown begins
+func (s *shutdown) context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-s.done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// holdOpen lifts the server's read and write timeouts for a response that is
+// meant to outlive them, such as an event stream or a long poll
+func holdOpen(c *gin.Context) {
+	controller := http.NewResponseController(c.Writer)
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,131 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/access"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/stream"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// StreamController handles the Server-Sent Events stream of location changes
+type StreamController struct {
+	broker    *stream.Broker
+	heartbeat time.Duration
+	policy    *access.Policy
+	closing   shutdown
+}
+
+// NewStreamController creates a new stream controller sending a heartbeat comment every heartbeat.
+// Streams only carry the locations policy lets the caller read; a nil policy limits nothing.
+func NewStreamController(broker *stream.Broker, heartbeat time.Duration, policy *access.Policy) *StreamController {
+	return &StreamController{
+		broker:    broker,
+		heartbeat: heartbeat,
+		policy:    policy,
+	}
+}
+
+// StreamLocations handles GET /locations/stream?bbox=minLng,minLat,maxLng,maxLat&category=a,b
+func (h *StreamController) StreamLocations(c *gin.Context) {
+	principal, _ := auth.FromContext(c.Request.Context())
+	filter := stream.Filter{Tenant: tenant.FromContext(c.Request.Context()), Visible: h.policy.Readable(principal)}
+
+	if bbox := c.Query("bbox"); bbox != "" {
+		box, err := location.ParseBoundingBox(bbox)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		filter.BBox = box
+	}
+
+	if categories := c.Query("category"); categories != "" {
+		filter.Categories = strings.Split(categories, ",")
+	}
+
+	var lastEventID uint64
+	if value := c.GetHeader("Last-Event-ID"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			_ = c.Error(badRequest("Invalid Last-Event-ID header"))
+			return
+		}
+		lastEventID = id
+	}
+
+	sub, replay, complete := h.broker.Subscribe(filter, lastEventID)
+	defer h.broker.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	holdOpen(c)
+
+	w := c.Writer
+	if !complete {
+		// Some changes were missed, tell the client to reload before applying new ones
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", h.broker.LastID())
+	}
+	for _, msg := range replay {
+		if err := writeMessage(w, msg); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-h.closing.done():
+			// Clients reconnect to another instance and resume from Last-Event-ID
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case msg, ok := <-sub.C:
+			if !ok {
+				if sub.Overflowed() {
+					log.WithField("client", c.ClientIP()).Warn("Dropped slow location stream subscriber")
+				}
+				return
+			}
+			if err := writeMessage(w, msg); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+// Shutdown ends the open streams, and any opened from now on once they have replayed their history
+func (h *StreamController) Shutdown() {
+	h.closing.begin()
+}
+
+func writeMessage(w io.Writer, msg stream.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+	return err
+}
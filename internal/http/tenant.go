@@ -0,0 +1,33 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// ResolveTenant stores the tenant a request acts for in its context. Credentials
+// bound to a tenant always act for it. The X-Tenant-ID header chooses the tenant
+// for unbound admin credentials, and for every request while authentication is
+// disabled; everybody else acts for the default tenant.
+func ResolveTenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested := c.GetHeader(tenant.Header)
+		if requested != "" && !tenant.Valid(requested) {
+			_ = c.Error(badRequest("The %s header is not a valid tenant ID", tenant.Header))
+			c.Abort()
+			return
+		}
+
+		principal, _ := auth.FromContext(c.Request.Context())
+		id, err := tenant.Resolve(principal, requested)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service/tracking"
+)
+
+// TrackingController handles HTTP requests for device tracking endpoints
+type TrackingController struct {
+	service tracking.TrackingBC
+}
+
+// NewTrackingController creates a new tracking controller
+func NewTrackingController(service tracking.TrackingBC) *TrackingController {
+	return &TrackingController{
+		service: service,
+	}
+}
+
+// IngestPositions handles POST /devices/{id}/positions.
+// The body is either a single position object or an array of positions.
+func (h *TrackingController) IngestPositions(c *gin.Context) {
+	deviceID := c.Param("id")
+
+	body, err := c.GetRawData()
+	if err != nil {
+		_ = c.Error(badRequest("Failed to read request body"))
+		return
+	}
+
+	var positions []tracking.PositionRequest
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &positions)
+	} else {
+		var position tracking.PositionRequest
+		err = json.Unmarshal(trimmed, &position)
+		positions = append(positions, position)
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	for i := range positions {
+		if err := binding.Validator.ValidateStruct(&positions[i]); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	result, err := h.service.IngestPositions(c.Request.Context(), deviceID, positions)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"device_id": deviceID,
+		"accepted":  result.Accepted,
+		"ignored":   result.Ignored,
+		"events":    len(result.Events),
+	}).Info("Device positions ingested")
+
+	c.JSON(http.StatusAccepted, result)
+}
+
+// GetEvents handles GET /events?device_id=ID&type=TYPE&zone_type=TYPE&zone_id=ID&since=TIME&until=TIME&limit=N
+func (h *TrackingController) GetEvents(c *gin.Context) {
+	query := tracking.EventQuery{
+		DeviceID: c.Query("device_id"),
+		Type:     c.Query("type"),
+		ZoneType: c.Query("zone_type"),
+	}
+
+	if zoneID := c.Query("zone_id"); zoneID != "" {
+		id, err := strconv.ParseUint(zoneID, 10, 64)
+		if err != nil {
+			_ = c.Error(badRequest("Invalid zone_id value"))
+			return
+		}
+		query.ZoneID = uint(id)
+	}
+
+	for name, target := range map[string]**time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				_ = c.Error(badRequest("Invalid %s value, expected RFC 3339", name))
+				return
+			}
+			*target = &parsed
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > 1000 {
+			_ = c.Error(badRequest("limit must be between 1 and 1000"))
+			return
+		}
+		query.Limit = n
+	}
+
+	events, err := h.service.GetEvents(c.Request.Context(), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
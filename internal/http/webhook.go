@@ -0,0 +1,146 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/service/webhook"
+)
+
+// WebhookController handles HTTP requests for webhook subscription endpoints
+type WebhookController struct {
+	service webhook.WebhookBC
+}
+
+// NewWebhookController creates a new webhook controller
+func NewWebhookController(service webhook.WebhookBC) *WebhookController {
+	return &WebhookController{
+		service: service,
+	}
+}
+
+// CreateSubscription handles POST /webhooks
+func (h *WebhookController) CreateSubscription(c *gin.Context) {
+	var req webhook.CreateSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	subscription, err := h.service.CreateSubscription(c.Request.Context(), req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"id":  subscription.ID,
+		"url": subscription.URL,
+	}).Info("Webhook subscription created successfully")
+
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// GetSubscriptions handles GET /webhooks
+func (h *WebhookController) GetSubscriptions(c *gin.Context) {
+	subscriptions, err := h.service.GetSubscriptions(c.Request.Context())
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// GetSubscription handles GET /webhooks/{id}
+func (h *WebhookController) GetSubscription(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	subscription, err := h.service.GetSubscription(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteSubscription handles DELETE /webhooks/{id}
+func (h *WebhookController) DeleteSubscription(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	if err := h.service.DeleteSubscription(c.Request.Context(), id); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithField("id", id).Info("Webhook subscription deleted successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted successfully"})
+}
+
+// GetDeliveries handles GET /webhooks/{id}/deliveries?status=STATUS&limit=N
+func (h *WebhookController) GetDeliveries(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	query := webhook.DeliveryQuery{
+		SubscriptionID: id,
+		Status:         c.Query("status"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > 1000 {
+			_ = c.Error(badRequest("limit must be between 1 and 1000"))
+			return
+		}
+		query.Limit = n
+	}
+
+	deliveries, err := h.service.GetDeliveries(c.Request.Context(), query)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryDelivery handles POST /webhooks/deliveries/{id}/retry
+func (h *WebhookController) RetryDelivery(c *gin.Context) {
+	id, err := pathID(c, "id")
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	delivery, err := h.service.RetryDelivery(c.Request.Context(), id)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	log.WithField("id", id).Info("Webhook delivery requeued")
+	c.JSON(http.StatusOK, delivery)
+}
+
+// pathID parses a numeric path parameter
+func pathID(c *gin.Context, name string) (uint, error) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		return 0, badRequest("Invalid %s", name)
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,36 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// Handler serves the OpenAPI document and a page rendering it
+type Handler struct {
+	spec []byte
+}
+
+// NewHandler builds the document once; it does not change while the server runs
+func NewHandler(version string) (*Handler, error) {
+	spec, err := json.Marshal(Build(version))
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{spec: spec}, nil
+}
+
+// Spec handles GET /openapi.json
+func (h *Handler) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", h.spec)
+}
+
+// Docs handles GET /docs
+func (h *Handler) Docs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
@@ -0,0 +1,505 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/audit"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"github.com/youngprinnce/geolocation-service/internal/service/search"
+	"github.com/youngprinnce/geolocation-service/internal/service/tracking"
+	"github.com/youngprinnce/geolocation-service/internal/service/webhook"
+)
+
+// Operation tags
+const (
+	tagMeta      = "meta"
+	tagLocations = "locations"
+	tagGeofences = "geofences"
+	tagTracking  = "tracking"
+	tagWebhooks  = "webhooks"
+	tagChanges   = "changes"
+	tagRoutes    = "routes"
+	tagGraphQL   = "graphql"
+	tagAudit     = "audit"
+)
+
+var tags = []Tag{
+	{Name: tagMeta, Description: "Health check and API documentation"},
+	{Name: tagLocations, Description: "Registered locations and proximity queries"},
+	{Name: tagGeofences, Description: "Circular and polygonal areas"},
+	{Name: tagTracking, Description: "Device positions and the zone events they raise"},
+	{Name: tagWebhooks, Description: "Subscriptions to location events and their deliveries"},
+	{Name: tagChanges, Description: "Feed of committed changes"},
+	{Name: tagRoutes, Description: "Route planning"},
+	{Name: tagGraphQL, Description: "GraphQL endpoint"},
+	{Name: tagAudit, Description: "Tamper-evident trail of location changes"},
+}
+
+// endpoint is one route in the catalogue; Path uses gin syntax
+type endpoint struct {
+	Method    string
+	Path      string
+	Operation *Operation
+}
+
+// message is the body of responses that only confirm an action
+type message struct {
+	Message string `json:"message"`
+}
+
+// auditEntry is an audit entry as it is rendered, with the states around the change embedded as JSON
+type auditEntry struct {
+	audit.Entry
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// auditPage is one page of GET /audit
+type auditPage struct {
+	Entries    []auditEntry `json:"entries"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// graphqlRequest is the standard GraphQL request body
+type graphqlRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// endpoints lists every route registered by the server. The server tests
+// compare it with the router in both directions, so a route cannot be added
+// or removed without updating its documentation.
+func endpoints(s *Schemas) []endpoint {
+	limit := func(max string) Parameter {
+		return query("limit", "Maximum number of results, at most "+max, &Schema{Type: "integer", Minimum: float(1)})
+	}
+	lat := query("lat", "Latitude of the point", &Schema{Type: "number", Minimum: float(-90), Maximum: float(90)})
+	lng := query("lng", "Longitude of the point", &Schema{Type: "number", Minimum: float(-180), Maximum: float(180)})
+	requiredLat, requiredLng := lat, lng
+	requiredLat.Required, requiredLng.Required = true, true
+
+	return []endpoint{
+		{http.MethodGet, "/", &Operation{
+			OperationID: "healthCheck",
+			Summary:     "Health check",
+			Tags:        []string{tagMeta},
+			Responses:   responses(http.StatusOK, "The server is up", "text/plain", &Schema{Type: "string"}),
+		}},
+		{http.MethodGet, "/openapi.json", &Operation{
+			OperationID: "getOpenAPI",
+			Summary:     "This OpenAPI document",
+			Tags:        []string{tagMeta},
+			Responses:   responses(http.StatusOK, "The OpenAPI document", "application/json", &Schema{Type: "object"}),
+		}},
+		{http.MethodGet, "/docs", &Operation{
+			OperationID: "getDocs",
+			Summary:     "Interactive API documentation",
+			Tags:        []string{tagMeta},
+			Responses:   responses(http.StatusOK, "An HTML page rendering this document", "text/html", &Schema{Type: "string"}),
+		}},
+
+		// Locations
+		{http.MethodPost, "/locations", &Operation{
+			OperationID: "createLocation",
+			Summary:     "Create a location",
+			Tags:        []string{tagLocations},
+			RequestBody: jsonBody(s.Of(location.CreateLocationRequest{})),
+			Responses:   problems(jsonResponse(http.StatusCreated, "The created location", s.Of(location.Location{})), 400, 409),
+		}},
+		{http.MethodGet, "/locations", &Operation{
+			OperationID: "listLocations",
+			Summary:     "List locations",
+			Description: "Pages are linked with an opaque cursor; the next page is in the Link header. " +
+				"Sorting by distance requires lat and lng. With fields, only the listed fields are returned.",
+			Tags: []string{tagLocations},
+			Parameters: []Parameter{
+				limit("1000"),
+				query("cursor", "Cursor of the page to return, taken from the Link header", &Schema{Type: "string"}),
+				query("sort", "Sort field, prefixed with - for descending order", &Schema{Type: "string", Enum: sortValues()}),
+				lat, lng,
+				query("fields", "Comma-separated fields to return", &Schema{Type: "string"}),
+				query("total", "Return the total count in X-Total-Count", &Schema{Type: "boolean"}),
+			},
+			Responses: problems(map[string]*Response{
+				"200": {
+					Description: "A page of locations",
+					Headers: map[string]Header{
+						"Link":          {Description: "Link to the next page with rel=\"next\"", Schema: &Schema{Type: "string"}},
+						"X-Total-Count": {Description: "Number of locations, when total=true", Schema: &Schema{Type: "integer"}},
+					},
+					Content: content("application/json", s.ArrayOf(location.Location{})),
+				},
+			}, 400),
+		}},
+		{http.MethodGet, "/locations/search", &Operation{
+			OperationID: "searchLocations",
+			Summary:     "Search locations by name",
+			Description: "Matches are ranked by prefix, word and fuzzy similarity; with lat and lng, closer locations rank higher.",
+			Tags:        []string{tagLocations},
+			Parameters: []Parameter{
+				{Name: "q", In: "query", Description: "Text to search for", Required: true, Schema: &Schema{Type: "string"}},
+				lat, lng, limit("50"),
+			},
+			Responses: problems(jsonResponse(http.StatusOK, "Matches, best first", s.ArrayOf(search.Result{})), 400),
+		}},
+		{http.MethodGet, "/locations/nearest", &Operation{
+			OperationID: "getNearestLocation",
+			Summary:     "Find the nearest location",
+			Tags:        []string{tagLocations},
+			Parameters:  []Parameter{requiredLat, requiredLng},
+			Responses:   problems(jsonResponse(http.StatusOK, "The nearest location", s.Of(location.NearestMatch{})), 400, 404),
+		}},
+		{http.MethodGet, "/locations/nearest/ws", &Operation{
+			OperationID: "streamNearestLocations",
+			Summary:     "Track the nearest locations over a WebSocket",
+			Description: "After the upgrade the client sends {\"latitude\": LAT, \"longitude\": LNG} messages and receives " +
+				"{\"type\": \"nearest\", \"results\": [...]} whenever the k nearest locations change.",
+			Tags: []string{tagLocations},
+			Parameters: []Parameter{
+				query("k", "Number of nearest locations to track", &Schema{Type: "integer", Minimum: float(1), Maximum: float(location.MaxNearest)}),
+			},
+			Responses: problems(map[string]*Response{
+				"101": {Description: "Switched to the WebSocket protocol"},
+			}, 400),
+		}},
+		{http.MethodGet, "/locations/stream", &Operation{
+			OperationID: "streamLocations",
+			Summary:     "Stream location changes as server-sent events",
+			Description: "Reconnecting clients send Last-Event-ID to replay the changes they missed.",
+			Tags:        []string{tagLocations},
+			Parameters: []Parameter{
+				query("bbox", "Only changes inside minLng,minLat,maxLng,maxLat", &Schema{Type: "string"}),
+				query("category", "Comma-separated categories to include", &Schema{Type: "string"}),
+				{Name: "Last-Event-ID", In: "header", Description: "ID of the last event received", Schema: &Schema{Type: "integer"}},
+			},
+			Responses: problems(responses(http.StatusOK, "An event stream of location changes", "text/event-stream", &Schema{Type: "string"}), 400),
+		}},
+		{http.MethodPost, "/locations/along-route", &Operation{
+			OperationID: "findLocationsAlongRoute",
+			Summary:     "Find locations along a route",
+			Description: "Exactly one of polyline (Google encoded, precision 5) or line_string (GeoJSON) must be set.",
+			Tags:        []string{tagLocations},
+			RequestBody: jsonBody(s.Of(location.AlongRouteRequest{})),
+			Responses:   problems(jsonResponse(http.StatusOK, "Locations within the corridor, in route order", s.ArrayOf(location.RouteMatch{})), 400),
+		}},
+		{http.MethodGet, "/locations/id/:uuid", &Operation{
+			OperationID: "getLocation",
+			Summary:     "Get a location by UUID",
+			Tags:        []string{tagLocations},
+			Responses:   problems(jsonResponse(http.StatusOK, "The location", s.Of(location.Location{})), 400, 404),
+		}},
+		{http.MethodPut, "/locations/id/:uuid", &Operation{
+			OperationID: "updateLocation",
+			Summary:     "Replace a location by UUID",
+			Tags:        []string{tagLocations},
+			RequestBody: jsonBody(s.Of(location.UpdateLocationRequest{})),
+			Responses:   problems(jsonResponse(http.StatusOK, "The updated location", s.Of(location.Location{})), 400, 404, 409),
+		}},
+		{http.MethodDelete, "/locations/id/:uuid", &Operation{
+			OperationID: "deleteLocation",
+			Summary:     "Delete a location by UUID",
+			Tags:        []string{tagLocations},
+			Responses:   problems(jsonResponse(http.StatusOK, "The location was deleted", s.Of(message{})), 400, 404),
+		}},
+		{http.MethodPut, "/locations/:name", &Operation{
+			OperationID: "updateLocationByName",
+			Summary:     "Replace a location by name",
+			Tags:        []string{tagLocations},
+			RequestBody: jsonBody(s.Of(location.UpdateLocationRequest{})),
+			Responses:   problems(jsonResponse(http.StatusOK, "The updated location", s.Of(location.Location{})), 400, 404, 409),
+		}},
+		{http.MethodDelete, "/locations/:name", &Operation{
+			OperationID: "deleteLocationByName",
+			Summary:     "Delete a location by name",
+			Tags:        []string{tagLocations},
+			Responses:   problems(jsonResponse(http.StatusOK, "The location was deleted", s.Of(message{})), 400, 404),
+		}},
+
+		// Geofences
+		{http.MethodPost, "/geofences", &Operation{
+			OperationID: "createGeofence",
+			Summary:     "Create a geofence",
+			Description: "Circles use latitude, longitude and radius_m; polygons use polygon.",
+			Tags:        []string{tagGeofences},
+			RequestBody: jsonBody(s.Of(geofence.GeofenceRequest{})),
+			Responses:   problems(jsonResponse(http.StatusCreated, "The created geofence", s.Of(geofence.Geofence{})), 400, 409),
+		}},
+		{http.MethodGet, "/geofences", &Operation{
+			OperationID: "listGeofences",
+			Summary:     "List geofences",
+			Tags:        []string{tagGeofences},
+			Responses:   problems(jsonResponse(http.StatusOK, "All geofences", s.ArrayOf(geofence.Geofence{}))),
+		}},
+		{http.MethodGet, "/geofences/contains", &Operation{
+			OperationID: "findContainingGeofences",
+			Summary:     "Find the geofences containing a point",
+			Tags:        []string{tagGeofences},
+			Parameters:  []Parameter{requiredLat, requiredLng},
+			Responses:   problems(jsonResponse(http.StatusOK, "Geofences containing the point", s.ArrayOf(geofence.Geofence{})), 400),
+		}},
+		{http.MethodGet, "/geofences/:id", &Operation{
+			OperationID: "getGeofence",
+			Summary:     "Get a geofence",
+			Tags:        []string{tagGeofences},
+			Responses:   problems(jsonResponse(http.StatusOK, "The geofence", s.Of(geofence.Geofence{})), 400, 404),
+		}},
+		{http.MethodPut, "/geofences/:id", &Operation{
+			OperationID: "updateGeofence",
+			Summary:     "Replace a geofence",
+			Tags:        []string{tagGeofences},
+			RequestBody: jsonBody(s.Of(geofence.GeofenceRequest{})),
+			Responses:   problems(jsonResponse(http.StatusOK, "The updated geofence", s.Of(geofence.Geofence{})), 400, 404, 409),
+		}},
+		{http.MethodDelete, "/geofences/:id", &Operation{
+			OperationID: "deleteGeofence",
+			Summary:     "Delete a geofence",
+			Tags:        []string{tagGeofences},
+			Responses:   problems(jsonResponse(http.StatusOK, "The geofence was deleted", s.Of(message{})), 400, 404),
+		}},
+
+		// GraphQL
+		{http.MethodPost, "/graphql", &Operation{
+			OperationID: "executeGraphQL",
+			Summary:     "Run a GraphQL query or mutation",
+			Tags:        []string{tagGraphQL},
+			RequestBody: jsonBody(s.Of(graphqlRequest{})),
+			Responses:   problems(jsonResponse(http.StatusOK, "The GraphQL result, including any GraphQL errors", &Schema{Type: "object"}), 400),
+		}},
+		{http.MethodGet, "/graphql", &Operation{
+			OperationID: "subscribeGraphQL",
+			Summary:     "Run GraphQL subscriptions over a WebSocket",
+			Description: "The connection must be a WebSocket upgrade speaking the graphql-transport-ws subprotocol.",
+			Tags:        []string{tagGraphQL},
+			Responses: problems(map[string]*Response{
+				"101": {Description: "Switched to the WebSocket protocol"},
+			}, 400),
+		}},
+
+		// Tracking
+		{http.MethodPost, "/devices/:id/positions", &Operation{
+			OperationID: "ingestPositions",
+			Summary:     "Report device positions",
+			Description: "The body is a single position or an array of positions. Positions older than the " +
+				"device's latest are ignored; the rest may raise zone events.",
+			Tags: []string{tagTracking},
+			Parameters: []Parameter{
+				{Name: "id", In: "path", Description: "ID of the device", Required: true, Schema: &Schema{Type: "string"}},
+			},
+			RequestBody: jsonBody(&Schema{OneOf: []*Schema{s.Of(tracking.PositionRequest{}), s.ArrayOf(tracking.PositionRequest{})}}),
+			Responses:   problems(jsonResponse(http.StatusAccepted, "The positions were processed", s.Of(tracking.IngestResult{})), 400),
+		}},
+		{http.MethodGet, "/events", &Operation{
+			OperationID: "listZoneEvents",
+			Summary:     "List zone events raised by devices",
+			Tags:        []string{tagTracking},
+			Parameters: []Parameter{
+				query("device_id", "Only events of this device", &Schema{Type: "string"}),
+				query("type", "Only events of this type", &Schema{Type: "string"}),
+				query("zone_type", "Only events of this zone type", &Schema{Type: "string"}),
+				query("zone_id", "Only events of this zone", &Schema{Type: "integer", Minimum: float(0)}),
+				query("since", "Only events at or after this time", &Schema{Type: "string", Format: "date-time"}),
+				query("until", "Only events before this time", &Schema{Type: "string", Format: "date-time"}),
+				limit("1000"),
+			},
+			Responses: problems(jsonResponse(http.StatusOK, "Matching events, oldest first", s.ArrayOf(tracking.Event{})), 400),
+		}},
+
+		// Webhooks
+		{http.MethodPost, "/webhooks", &Operation{
+			OperationID: "createWebhook",
+			Summary:     "Subscribe a URL to events",
+			Description: "Deliveries are signed with the secret, which is generated when not given.",
+			Tags:        []string{tagWebhooks},
+			RequestBody: jsonBody(s.Of(webhook.CreateSubscriptionRequest{})),
+			Responses:   problems(jsonResponse(http.StatusCreated, "The created subscription", s.Of(webhook.Subscription{})), 400),
+		}},
+		{http.MethodGet, "/webhooks", &Operation{
+			OperationID: "listWebhooks",
+			Summary:     "List webhook subscriptions",
+			Tags:        []string{tagWebhooks},
+			Responses:   problems(jsonResponse(http.StatusOK, "All subscriptions", s.ArrayOf(webhook.Subscription{}))),
+		}},
+		{http.MethodGet, "/webhooks/:id", &Operation{
+			OperationID: "getWebhook",
+			Summary:     "Get a webhook subscription",
+			Tags:        []string{tagWebhooks},
+			Responses:   problems(jsonResponse(http.StatusOK, "The subscription", s.Of(webhook.Subscription{})), 400, 404),
+		}},
+		{http.MethodDelete, "/webhooks/:id", &Operation{
+			OperationID: "deleteWebhook",
+			Summary:     "Delete a webhook subscription",
+			Tags:        []string{tagWebhooks},
+			Responses:   problems(jsonResponse(http.StatusOK, "The subscription was deleted", s.Of(message{})), 400, 404),
+		}},
+		{http.MethodGet, "/webhooks/:id/deliveries", &Operation{
+			OperationID: "listWebhookDeliveries",
+			Summary:     "List the deliveries of a subscription",
+			Tags:        []string{tagWebhooks},
+			Parameters: []Parameter{
+				query("status", "Only deliveries in this status", &Schema{Type: "string", Enum: []string{
+					webhook.StatusPending, webhook.StatusSucceeded, webhook.StatusDead}}),
+				limit("1000"),
+			},
+			Responses: problems(jsonResponse(http.StatusOK, "Deliveries, newest first", s.ArrayOf(webhook.Delivery{})), 400, 404),
+		}},
+		{http.MethodPost, "/webhooks/deliveries/:id/retry", &Operation{
+			OperationID: "retryWebhookDelivery",
+			Summary:     "Retry a dead delivery",
+			Tags:        []string{tagWebhooks},
+			Responses:   problems(jsonResponse(http.StatusOK, "The delivery, queued again", s.Of(webhook.Delivery{})), 400, 404, 409),
+		}},
+
+		// Changes
+		{http.MethodGet, "/changes", &Operation{
+			OperationID: "listChanges",
+			Summary:     "Read the change feed",
+			Description: "With wait, the request blocks until a change arrives or the wait elapses.",
+			Tags:        []string{tagChanges},
+			Parameters: []Parameter{
+				query("since", "Cursor of the last change seen; omitted to start from the beginning", &Schema{Type: "string"}),
+				limit("1000"),
+				query("wait", "Seconds to wait for a change when none are pending", &Schema{Type: "integer", Minimum: float(0), Maximum: float(60)}),
+			},
+			Responses: problems(jsonResponse(http.StatusOK, "Changes after the cursor", s.Of(outbox.ChangePage{})), 400),
+		}},
+
+		// Route planning
+		{http.MethodPost, "/routes/optimize", &Operation{
+			OperationID: "optimizeRoute",
+			Summary:     "Order stations into a short route",
+			Tags:        []string{tagRoutes},
+			RequestBody: jsonBody(s.Of(route.OptimizeRouteRequest{})),
+			Responses:   problems(jsonResponse(http.StatusOK, "The optimized route", s.Of(route.OptimizedRoute{})), 400, 404),
+		}},
+
+		// Audit trail
+		{http.MethodGet, "/audit", &Operation{
+			OperationID: "listAuditEntries",
+			Summary:     "Read the audit trail",
+			Description: "Entries are returned oldest first; next_cursor continues after the last one.",
+			Tags:        []string{tagAudit},
+			Parameters: append(auditFilters(),
+				query("cursor", "next_cursor of the previous page; omitted to start from the beginning", &Schema{Type: "string"}),
+				limit("1000"),
+			),
+			Responses: problems(jsonResponse(http.StatusOK, "Matching entries", s.Of(auditPage{})), 400),
+		}},
+		{http.MethodGet, "/audit/export", &Operation{
+			OperationID: "exportAuditEntries",
+			Summary:     "Export the audit trail",
+			Description: "Streams every matching entry, oldest first, one JSON object per line.",
+			Tags:        []string{tagAudit},
+			Parameters:  auditFilters(),
+			Responses:   problems(responses(http.StatusOK, "Matching entries as NDJSON", "application/x-ndjson", s.Of(auditEntry{})), 400),
+		}},
+		{http.MethodGet, "/audit/verify", &Operation{
+			OperationID: "verifyAuditTrail",
+			Summary:     "Verify the hash chain of the audit trail",
+			Description: "Reports the first entry that was altered, removed from or inserted into the chain.",
+			Tags:        []string{tagAudit},
+			Responses:   problems(jsonResponse(http.StatusOK, "The result of the check", s.Of(audit.Verification{}))),
+		}},
+	}
+}
+
+// auditFilters lists the filters shared by GET /audit and GET /audit/export
+func auditFilters() []Parameter {
+	return []Parameter{
+		query("actor", "Only changes made by this principal", &Schema{Type: "string"}),
+		query("action", "Only changes of this kind", &Schema{Type: "string", Enum: []string{
+			events.LocationCreated, events.LocationUpdated, events.LocationDeleted}}),
+		query("target", "Only changes to the location with this UUID or name", &Schema{Type: "string"}),
+		query("since", "Only changes at or after this time", &Schema{Type: "string", Format: "date-time"}),
+		query("until", "Only changes before this time", &Schema{Type: "string", Format: "date-time"}),
+	}
+}
+
+// sortValues lists the values accepted by the sort parameter of GET /locations
+func sortValues() []string {
+	var values []string
+	for _, field := range []string{location.SortID, location.SortName, location.SortCreatedAt, location.SortUpdatedAt, location.SortDistance} {
+		values = append(values, field, "-"+field)
+	}
+	return values
+}
+
+// Path converts a gin route path to an OpenAPI path template, e.g. /geofences/:id to /geofences/{id}
+func Path(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// pathParameters describes the parameters of a gin path
+func pathParameters(ginPath string) []Parameter {
+	var params []Parameter
+	for _, segment := range strings.Split(ginPath, "/") {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+
+		name := segment[1:]
+		param := Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+		switch name {
+		case "uuid":
+			param.Description = "UUID of the location"
+			param.Schema.Format = "uuid"
+		case "id":
+			param.Description = "Numeric ID"
+			param.Schema = &Schema{Type: "integer", Minimum: float(1)}
+		case "name":
+			param.Description = "Name of the location"
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func query(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func content(contentType string, schema *Schema) map[string]MediaType {
+	return map[string]MediaType{contentType: {Schema: schema}}
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: content("application/json", schema)}
+}
+
+func responses(status int, description, contentType string, schema *Schema) map[string]*Response {
+	return map[string]*Response{
+		statusKey(status): {Description: description, Content: content(contentType, schema)},
+	}
+}
+
+func jsonResponse(status int, description string, schema *Schema) map[string]*Response {
+	return responses(status, description, "application/json", schema)
+}
+
+// problems adds the given error statuses, and 500, as problem details responses
+func problems(responses map[string]*Response, statuses ...int) map[string]*Response {
+	for _, status := range append(statuses, http.StatusInternalServerError) {
+		responses[statusKey(status)] = &Response{
+			Description: http.StatusText(status),
+			Content:     content("application/problem+json", &Schema{Ref: "#/components/schemas/Problem"}),
+		}
+	}
+	return responses
+}
+
+func statusKey(status int) string {
+	return strconv.Itoa(status)
+}
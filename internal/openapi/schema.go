@@ -0,0 +1,205 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schemas derives JSON Schemas from Go types the way encoding/json and the
+// binding validator see them: property names come from json tags and
+// constraints from binding tags. Structs become named components referenced
+// with $ref so every type is described once.
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+// NewSchemas creates an empty schema registry
+func NewSchemas() *Schemas {
+	return &Schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// Components returns the named schemas registered so far
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// Of returns the schema of the type of v
+func (s *Schemas) Of(v interface{}) *Schema {
+	return s.schema(reflect.TypeOf(v))
+}
+
+// ArrayOf returns the schema of an array of the type of v
+func (s *Schemas) ArrayOf(v interface{}) *Schema {
+	return &Schema{Type: "array", Items: s.Of(v)}
+}
+
+func (s *Schemas) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float(0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	default:
+		// Interfaces and anything else may hold any JSON value
+		return &Schema{}
+	}
+}
+
+// component registers a struct as a named schema and returns its name
+func (s *Schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := s.components[name]; taken || name == "" {
+		// Qualify clashing names with their package, e.g. tracking.Event as TrackingEvent
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = exported(pkg) + name
+	}
+
+	// Register before walking the fields so recursive types terminate
+	s.names[t] = name
+	object := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	s.components[name] = object
+	s.fields(t, object)
+	return name
+}
+
+// fields adds the JSON properties of struct t to object, flattening embedded structs
+func (s *Schemas) fields(t reflect.Type, object *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.fields(field.Type, object)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.schema(field.Type)
+		if constrain(property, field.Tag.Get("binding")) {
+			object.Required = append(object.Required, name)
+		}
+		object.Properties[name] = property
+	}
+}
+
+// constrain applies the rules of a binding tag to a property schema and
+// reports whether the property is required. Rules after dive apply to the
+// elements of a slice.
+func constrain(property *Schema, binding string) bool {
+	if binding == "" {
+		return false
+	}
+
+	required := false
+	target := property
+	for _, rule := range strings.Split(binding, ",") {
+		if rule == "dive" {
+			if property.Items == nil {
+				break
+			}
+			target = property.Items
+			continue
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		if target != property || target.Ref != "" {
+			// Element rules and rules on referenced structs only matter to the validator
+			continue
+		}
+
+		switch name {
+		case "required":
+			required = true
+		case "min", "gte":
+			bound(target, param, &target.Minimum, &target.MinItems)
+		case "max", "lte":
+			bound(target, param, &target.Maximum, &target.MaxItems)
+		case "gt":
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				target.ExclusiveMinimum = &n
+			}
+		case "oneof":
+			target.Enum = strings.Fields(param)
+		case "url":
+			target.Format = "uri"
+		}
+	}
+	return required
+}
+
+// bound sets a numeric bound on numbers or a length bound on arrays
+func bound(target *Schema, param string, number **float64, items **int) {
+	if target.Type == "array" {
+		if n, err := strconv.Atoi(param); err == nil {
+			*items = &n
+		}
+		return
+	}
+	if n, err := strconv.ParseFloat(param, 64); err == nil {
+		*number = &n
+	}
+}
+
+func float(n float64) *float64 {
+	return &n
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
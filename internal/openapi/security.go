@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	apihttp "github.com/youngprinnce/geolocation-service/internal/http"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// Names of the security schemes
+const (
+	securityAPIKey = "apiKey"
+	securityBearer = "bearer"
+)
+
+var securitySchemes = map[string]*SecurityScheme{
+	securityAPIKey: {
+		Type:        "apiKey",
+		Description: "A key issued with the apikey create command. Keys grant the read, write or admin scope; each includes the ones before it.",
+		Name:        apihttp.APIKeyHeader,
+		In:          "header",
+	},
+	securityBearer: {
+		Type:         "http",
+		Description:  "A JWT issued by single sign-on, when the server is configured to accept them. Its roles map to scopes.",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	},
+}
+
+// requiredScope returns the scope the server requires for a route, or "" for public routes.
+// Reads need read, changes need write, and managing webhooks and reading the audit trail need admin; the
+// POST routes that only compute answers from their body are reads.
+func requiredScope(e endpoint) string {
+	switch {
+	case e.Path == "/" || e.Path == "/openapi.json" || e.Path == "/docs":
+		return ""
+	case strings.HasPrefix(e.Path, "/webhooks"), strings.HasPrefix(e.Path, "/audit"):
+		return auth.ScopeAdmin
+	case e.Method == http.MethodGet,
+		e.Path == "/locations/along-route", e.Path == "/routes/optimize", e.Path == "/graphql":
+		return auth.ScopeRead
+	default:
+		return auth.ScopeWrite
+	}
+}
+
+// tenantParameter chooses the tenant an authenticated request acts for
+var tenantParameter = Parameter{
+	Name:        tenant.Header,
+	In:          "header",
+	Description: "The tenant to act for. Only admin credentials that are not bound to a tenant may choose one; others act for their own tenant, or the default tenant when unbound.",
+	Schema:      &Schema{Type: "string"},
+}
+
+// secure documents the credentials an operation requires and the problems answered without them
+func secure(op *Operation, scope string) {
+	if scope == "" {
+		return
+	}
+	op.Security = []SecurityRequirement{{securityAPIKey: {}}, {securityBearer: {}}}
+	op.RequiredScope = scope
+	op.Parameters = append(op.Parameters, tenantParameter)
+	problems(op.Responses, http.StatusUnauthorized, http.StatusForbidden)
+}
@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"net/http"
+	"strings"
+
+	apihttp "github.com/youngprinnce/geolocation-service/internal/http"
+)
+
+// Build generates the OpenAPI document of the HTTP API. Request and response
+// schemas are reflected from the types the handlers bind and render, so they
+// follow changes to those types without editing the document.
+func Build(version string) *Document {
+	if version == "" {
+		version = "dev"
+	}
+
+	schemas := NewSchemas()
+	schemas.Of(apihttp.Problem{})
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   "Geolocation Service API",
+			Version: version,
+			Description: "Store locations and query them by proximity, name, route and geofence. " +
+				"Errors are RFC 7807 problem details whose code field is stable; every response carries an " +
+				apihttp.RequestIDHeader + " header. Routes other than the health check and documentation require an API key " +
+				"in the " + apihttp.APIKeyHeader + " header or a bearer token issued by single sign-on. Clients sending too many " +
+				"requests are answered 429 with a Retry-After header; " + apihttp.RateLimitRemainingHeader + " tells how many more they may send.",
+		},
+		Tags:  tags,
+		Paths: make(map[string]PathItem),
+	}
+
+	for _, e := range endpoints(schemas) {
+		op := e.Operation
+		op.Parameters = append(missingPathParameters(e.Path, op.Parameters), op.Parameters...)
+		secure(op, requiredScope(e))
+		// Any route may be rate limited
+		problems(op.Responses, http.StatusTooManyRequests)
+
+		path := Path(e.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(PathItem)
+		}
+		doc.Paths[path][strings.ToLower(e.Method)] = op
+	}
+
+	doc.Components.Schemas = schemas.Components()
+	doc.Components.SecuritySchemes = securitySchemes
+	return doc
+}
+
+// missingPathParameters describes the path parameters the operation does not declare itself
+func missingPathParameters(ginPath string, declared []Parameter) []Parameter {
+	var missing []Parameter
+	for _, param := range pathParameters(ginPath) {
+		found := false
+		for _, d := range declared {
+			if d.In == "path" && d.Name == param.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, param)
+		}
+	}
+	return missing
+}
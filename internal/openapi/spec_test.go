@@ -0,0 +1,83 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/locations/id/{uuid}", Path("/locations/id/:uuid"))
+	assert.Equal(t, "/webhooks/deliveries/{id}/retry", Path("/webhooks/deliveries/:id/retry"))
+	assert.Equal(t, "/", Path("/"))
+}
+
+func TestSchemasFromTypes(t *testing.T) {
+	doc := Build("1.2.3")
+	assert.Equal(t, "1.2.3", doc.Info.Version)
+	schemas := doc.Components.Schemas
+
+	request := schemas["CreateLocationRequest"]
+	require.NotNil(t, request)
+	assert.ElementsMatch(t, []string{"name", "latitude", "longitude"}, request.Required)
+	assert.Equal(t, -90.0, *request.Properties["latitude"].Minimum)
+	assert.Equal(t, 90.0, *request.Properties["latitude"].Maximum)
+	assert.Equal(t, 0.0, *request.Properties["radius_m"].Minimum)
+
+	loc := schemas["Location"]
+	require.NotNil(t, loc)
+	assert.Equal(t, "uuid", loc.Properties["uuid"].Format)
+	assert.Equal(t, "date-time", loc.Properties["created_at"].Format)
+
+	geofence := schemas["GeofenceRequest"]
+	require.NotNil(t, geofence)
+	assert.Equal(t, []string{"circle", "polygon"}, geofence.Properties["kind"].Enum)
+	assert.Equal(t, "#/components/schemas/Point", geofence.Properties["polygon"].Items.Ref)
+
+	subscription := schemas["CreateSubscriptionRequest"]
+	require.NotNil(t, subscription)
+	assert.Equal(t, "uri", subscription.Properties["url"].Format)
+	assert.Equal(t, 1, *subscription.Properties["event_types"].MinItems)
+
+	problem := schemas["Problem"]
+	require.NotNil(t, problem)
+	assert.Contains(t, problem.Properties, "request_id")
+	assert.Equal(t, "#/components/schemas/FieldError", problem.Properties["errors"].Items.Ref)
+
+	change := schemas["Change"]
+	require.NotNil(t, change)
+	assert.Nil(t, change.Properties["payload"].Type, "raw JSON may hold any value")
+}
+
+func TestReferencesResolve(t *testing.T) {
+	doc := Build("")
+	raw, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	for _, part := range strings.Split(string(raw), `"$ref":"#/components/schemas/`)[1:] {
+		name := part[:strings.IndexByte(part, '"')]
+		assert.Contains(t, doc.Components.Schemas, name)
+	}
+
+	ids := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			assert.False(t, ids[op.OperationID], "duplicate operationId %s", op.OperationID)
+			ids[op.OperationID] = true
+
+			for _, segment := range strings.Split(path, "/") {
+				if strings.HasPrefix(segment, "{") {
+					name := strings.Trim(segment, "{}")
+					found := false
+					for _, param := range op.Parameters {
+						found = found || (param.In == "path" && param.Name == name)
+					}
+					assert.True(t, found, "%s %s does not describe path parameter %s", method, path, name)
+				}
+			}
+		}
+	}
+}
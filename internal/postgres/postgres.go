@@ -5,7 +5,14 @@ import (
 
 	"github.com/youngprinnce/geolocation-service/config"
 	"github.com/youngprinnce/geolocation-service/internal/logger"
+	"github.com/youngprinnce/geolocation-service/internal/service/apikey"
+	"github.com/youngprinnce/geolocation-service/internal/service/audit"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
 	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/ratelimit"
+	"github.com/youngprinnce/geolocation-service/internal/service/tracking"
+	"github.com/youngprinnce/geolocation-service/internal/service/webhook"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -20,6 +27,18 @@ func GetDB() *gorm.DB {
 	return session
 }
 
+// Close closes the connection pool. Queries still running are not interrupted.
+func Close() error {
+	if session == nil {
+		return nil
+	}
+	db, err := session.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
 func Load(config *config.Config) error {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		config.Database.Host,
@@ -28,17 +47,51 @@ func Load(config *config.Config) error {
 		config.Database.Password,
 		config.Database.DbName)
 
-	// Connect to the database
-	db, err := gorm.Open(postgres.Open(connStr), &gorm.Config{})
+	// Connect to the database, translating unique violations into gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(connStr), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	// Run automatic migrations
 	logger.Info("Running database auto-migrations...")
-	if err := db.AutoMigrate(&location.Location{}); err != nil {
+	if err := db.AutoMigrate(
+		&location.Location{},
+		&outbox.Entry{},
+		&geofence.Geofence{},
+		&tracking.DevicePosition{},
+		&tracking.ZoneState{},
+		&tracking.Event{},
+		&webhook.Subscription{},
+		&webhook.Delivery{},
+		&apikey.APIKey{},
+		&audit.Entry{},
+		&ratelimit.Usage{},
+	); err != nil {
 		return fmt.Errorf("failed to run auto-migrations: %w", err)
 	}
+	// Locations created before they had a public UUID get one
+	if err := db.Exec("UPDATE locations SET uuid = gen_random_uuid() WHERE uuid IS NULL").Error; err != nil {
+		return fmt.Errorf("failed to backfill location UUIDs: %w", err)
+	}
+	// Devices are identified per tenant
+	for _, statement := range tracking.TenantKeySQL {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to migrate device tracking: %w", err)
+		}
+	}
+	// The change feed is ordered by the transactions that wrote it
+	for _, statement := range outbox.FeedSQL {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to migrate the outbox: %w", err)
+		}
+	}
+	// The audit trail is append-only, whoever connects
+	for _, statement := range audit.ImmutableSQL {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to protect the audit trail: %w", err)
+		}
+	}
 	logger.Info("Database auto-migrations completed successfully")
 
 	session = db.Session(&gorm.Session{})
@@ -0,0 +1,55 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+)
+
+// ChangeGuard enforces a Policy in front of the change feed, leaving out the
+// changes of locations the caller may not read. Pages may then hold fewer
+// changes than the limit, or none, while their cursor still moves past the
+// changes left out.
+type ChangeGuard struct {
+	next   outbox.OutboxBC
+	policy *Policy
+}
+
+// NewChangeGuard returns next restricted by policy
+func NewChangeGuard(next outbox.OutboxBC, policy *Policy) outbox.OutboxBC {
+	return &ChangeGuard{
+		next:   next,
+		policy: policy,
+	}
+}
+
+// GetChanges returns the changes after the since cursor that the caller may read
+func (g *ChangeGuard) GetChanges(ctx context.Context, since string, limit int, wait time.Duration) (*outbox.ChangePage, error) {
+	page, err := g.next.GetChanges(ctx, since, limit, wait)
+	if err != nil {
+		return nil, err
+	}
+
+	principal, _ := auth.FromContext(ctx)
+	keep := g.policy.Readable(principal)
+	if keep == nil {
+		return page, nil
+	}
+
+	kept := make([]outbox.Change, 0, len(page.Changes))
+	for _, change := range page.Changes {
+		if change.Aggregate == location.OutboxAggregate {
+			var l location.Location
+			if err := json.Unmarshal(change.Payload, &l); err != nil || !keep(&l) {
+				continue
+			}
+		}
+		kept = append(kept, change)
+	}
+	page.Changes = kept
+	return page, nil
+}
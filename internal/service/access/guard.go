@@ -0,0 +1,377 @@
+package access
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"gorm.io/gorm"
+)
+
+// errWriteDenied is returned when a policy does not let the caller change a location
+var errWriteDenied = &auth.ForbiddenError{
+	Scope:  auth.ScopeWrite,
+	Reason: "Your roles do not allow changing locations of this category or in this area",
+}
+
+// LocationGuard enforces a Policy in front of a LocationBC, for the principal
+// found in the context of each call. Changes the principal may not make are
+// refused, and locations it may not read are left out of every result as if
+// they did not exist.
+type LocationGuard struct {
+	next   location.LocationBC
+	policy *Policy
+}
+
+// NewLocationGuard returns next restricted by policy
+func NewLocationGuard(next location.LocationBC, policy *Policy) location.LocationBC {
+	return &LocationGuard{
+		next:   next,
+		policy: policy,
+	}
+}
+
+// CreateLocation creates the location if the caller may write it
+func (g *LocationGuard) CreateLocation(ctx context.Context, req location.CreateLocationRequest) (*location.Location, error) {
+	if err := g.authorizeWrite(ctx, &location.Location{Latitude: req.Latitude, Longitude: req.Longitude, Category: req.Category}); err != nil {
+		return nil, err
+	}
+	return g.next.CreateLocation(ctx, req)
+}
+
+// GetAllLocations returns the locations the caller may read
+func (g *LocationGuard) GetAllLocations(ctx context.Context) ([]location.Location, error) {
+	locations, err := g.next.GetAllLocations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter(locations, g.readable(ctx)), nil
+}
+
+// GetLocation returns the location called name, which is not found if the caller may not read it
+func (g *LocationGuard) GetLocation(ctx context.Context, name string) (*location.Location, error) {
+	return g.visible(ctx, func() (*location.Location, error) {
+		return g.next.GetLocation(ctx, name)
+	})
+}
+
+// GetLocationByUUID returns the location with the given UUID, which is not found if the caller may not read it
+func (g *LocationGuard) GetLocationByUUID(ctx context.Context, id uuid.UUID) (*location.Location, error) {
+	return g.visible(ctx, func() (*location.Location, error) {
+		return g.next.GetLocationByUUID(ctx, id)
+	})
+}
+
+// ListLocations returns the page of readable locations selected by query. Pages
+// are filled from as many underlying pages as needed, so only the last one may
+// hold fewer than the limit.
+func (g *LocationGuard) ListLocations(ctx context.Context, query location.ListQuery) (*location.LocationPage, error) {
+	keep := g.readable(ctx)
+	if keep == nil {
+		return g.next.ListLocations(ctx, query)
+	}
+
+	page, err := g.collect(ctx, query, keep)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.WithTotal {
+		total, err := g.count(ctx, keep)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+
+// FindNearestLocation finds the nearest location the caller may read
+func (g *LocationGuard) FindNearestLocation(ctx context.Context, lat, lng float64) (*location.Location, float64, error) {
+	keep := g.readable(ctx)
+	if keep == nil {
+		return g.next.FindNearestLocation(ctx, lat, lng)
+	}
+
+	matches, err := g.nearest(ctx, lat, lng, 1, keep)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &matches[0].Location, matches[0].DistanceKm, nil
+}
+
+// FindKNearest returns the k readable locations closest to the given coordinates, nearest first
+func (g *LocationGuard) FindKNearest(ctx context.Context, lat, lng float64, k int) ([]location.NearestMatch, error) {
+	keep := g.readable(ctx)
+	if keep == nil {
+		return g.next.FindKNearest(ctx, lat, lng, k)
+	}
+
+	if k < 1 || k > location.MaxNearest {
+		return nil, &location.ValidationError{Field: "k", Message: "must be between 1 and 50"}
+	}
+	return g.nearest(ctx, lat, lng, k, keep)
+}
+
+// FindWithinRadius returns the readable locations within radiusKm of the given coordinates
+func (g *LocationGuard) FindWithinRadius(ctx context.Context, lat, lng, radiusKm float64) ([]location.NearestMatch, error) {
+	matches, err := g.next.FindWithinRadius(ctx, lat, lng, radiusKm)
+	if err != nil {
+		return nil, err
+	}
+	keep := g.readable(ctx)
+	if keep == nil {
+		return matches, nil
+	}
+	kept := make([]location.NearestMatch, 0, len(matches))
+	for _, match := range matches {
+		if keep(&match.Location) {
+			kept = append(kept, match)
+		}
+	}
+	return kept, nil
+}
+
+// FindInBoundingBox returns the readable locations inside the box
+func (g *LocationGuard) FindInBoundingBox(ctx context.Context, box location.BoundingBox) ([]location.Location, error) {
+	locations, err := g.next.FindInBoundingBox(ctx, box)
+	if err != nil {
+		return nil, err
+	}
+	return filter(locations, g.readable(ctx)), nil
+}
+
+// FindAlongRoute returns the readable locations within the corridor around a route
+func (g *LocationGuard) FindAlongRoute(ctx context.Context, req location.AlongRouteRequest) ([]location.RouteMatch, error) {
+	matches, err := g.next.FindAlongRoute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	keep := g.readable(ctx)
+	if keep == nil {
+		return matches, nil
+	}
+	kept := make([]location.RouteMatch, 0, len(matches))
+	for _, match := range matches {
+		if keep(&match.Location) {
+			kept = append(kept, match)
+		}
+	}
+	return kept, nil
+}
+
+// UpdateLocation updates the location called name if the caller may write it both before and after the change
+func (g *LocationGuard) UpdateLocation(ctx context.Context, name string, req location.UpdateLocationRequest) (*location.Location, error) {
+	if err := g.authorizeUpdate(ctx, req, func() (*location.Location, error) {
+		return g.GetLocation(ctx, name)
+	}); err != nil {
+		return nil, err
+	}
+	return g.next.UpdateLocation(ctx, name, req)
+}
+
+// UpdateLocationByUUID updates the location with the given UUID if the caller may write it both before and after the change
+func (g *LocationGuard) UpdateLocationByUUID(ctx context.Context, id uuid.UUID, req location.UpdateLocationRequest) (*location.Location, error) {
+	if err := g.authorizeUpdate(ctx, req, func() (*location.Location, error) {
+		return g.GetLocationByUUID(ctx, id)
+	}); err != nil {
+		return nil, err
+	}
+	return g.next.UpdateLocationByUUID(ctx, id, req)
+}
+
+// DeleteLocationByName deletes the location called name if the caller may write it
+func (g *LocationGuard) DeleteLocationByName(ctx context.Context, name string) error {
+	if err := g.authorizeDelete(ctx, func() (*location.Location, error) {
+		return g.GetLocation(ctx, name)
+	}); err != nil {
+		return err
+	}
+	return g.next.DeleteLocationByName(ctx, name)
+}
+
+// DeleteLocationByUUID deletes the location with the given UUID if the caller may write it
+func (g *LocationGuard) DeleteLocationByUUID(ctx context.Context, id uuid.UUID) error {
+	if err := g.authorizeDelete(ctx, func() (*location.Location, error) {
+		return g.GetLocationByUUID(ctx, id)
+	}); err != nil {
+		return err
+	}
+	return g.next.DeleteLocationByUUID(ctx, id)
+}
+
+// readable returns whether the caller of ctx may read a location, or nil when the policy hides nothing from it
+func (g *LocationGuard) readable(ctx context.Context) func(l *location.Location) bool {
+	principal, _ := auth.FromContext(ctx)
+	return g.policy.Readable(principal)
+}
+
+// within returns the grants narrowing the queries of the caller of ctx to the locations it may
+// read, and whether they are exact
+func (g *LocationGuard) within(ctx context.Context) ([]location.Grant, bool) {
+	principal, _ := auth.FromContext(ctx)
+	return g.policy.grants(principal)
+}
+
+func (g *LocationGuard) authorizeWrite(ctx context.Context, l *location.Location) error {
+	principal, _ := auth.FromContext(ctx)
+	if !g.policy.Allows(principal, ActionWrite, l) {
+		return errWriteDenied
+	}
+	return nil
+}
+
+// authorizeUpdate checks that the caller may write the location found by current,
+// and may still write it once req is applied, so nobody moves a station out of their reach
+func (g *LocationGuard) authorizeUpdate(ctx context.Context, req location.UpdateLocationRequest, current func() (*location.Location, error)) error {
+	if err := g.authorizeDelete(ctx, current); err != nil {
+		return err
+	}
+	return g.authorizeWrite(ctx, &location.Location{Latitude: req.Latitude, Longitude: req.Longitude, Category: req.Category})
+}
+
+// authorizeDelete checks that the caller may write the location found by current
+func (g *LocationGuard) authorizeDelete(ctx context.Context, current func() (*location.Location, error)) error {
+	principal, _ := auth.FromContext(ctx)
+	if !g.policy.Restricts(principal) {
+		return nil
+	}
+
+	existing, err := current()
+	if err != nil {
+		return err
+	}
+	return g.authorizeWrite(ctx, existing)
+}
+
+// visible returns the location found by get, hiding it when the caller may not read it
+func (g *LocationGuard) visible(ctx context.Context, get func() (*location.Location, error)) (*location.Location, error) {
+	found, err := get()
+	if err != nil {
+		return nil, err
+	}
+	if keep := g.readable(ctx); keep != nil && !keep(found) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return found, nil
+}
+
+// collect reads pages of query until it has found a page of locations to keep or the listing ends.
+// The store only returns locations within the grants of the caller, so few are read to be left out.
+func (g *LocationGuard) collect(ctx context.Context, query location.ListQuery, keep func(l *location.Location) bool) (*location.LocationPage, error) {
+	page := &location.LocationPage{Locations: make([]location.Location, 0)}
+	query.Within, _ = g.within(ctx)
+	if len(query.Within) == 0 {
+		// No rule grants the caller anything, and an empty query would read every location
+		return page, nil
+	}
+	if query.Sort == "" {
+		query.Sort = location.SortID
+	}
+	if query.Limit == 0 {
+		query.Limit = location.DefaultPageSize
+	}
+	if len(query.Fields) > 0 {
+		// The policy needs these fields to decide; they are not rendered unless asked for
+		query.Fields = append(append([]string{}, query.Fields...), "latitude", "longitude", "category")
+	}
+	query.WithTotal = false
+
+	for {
+		batch, err := g.next.ListLocations(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range batch.Locations {
+			l := batch.Locations[i]
+			if !keep(&l) {
+				continue
+			}
+			page.Locations = append(page.Locations, l)
+			if len(page.Locations) == query.Limit {
+				if i < len(batch.Locations)-1 || batch.NextCursor != "" {
+					page.NextCursor = location.EncodeCursor(location.CursorAfter(query, l))
+				}
+				return page, nil
+			}
+		}
+
+		if batch.NextCursor == "" {
+			return page, nil
+		}
+		query.After, _ = location.DecodeCursor(batch.NextCursor)
+	}
+}
+
+// count returns the number of locations the caller of ctx may read. The store counts them when
+// the grants of the caller are exact; otherwise the locations within them are read and checked.
+func (g *LocationGuard) count(ctx context.Context, keep func(l *location.Location) bool) (int64, error) {
+	within, exact := g.within(ctx)
+	if len(within) == 0 {
+		return 0, nil
+	}
+	if exact {
+		page, err := g.next.ListLocations(ctx, location.ListQuery{Limit: 1, Fields: []string{"id"}, Within: within, WithTotal: true})
+		if err != nil {
+			return 0, err
+		}
+		return *page.Total, nil
+	}
+
+	var total int64
+	query := location.ListQuery{Limit: location.MaxPageSize, Fields: []string{"latitude", "longitude", "category"}, Within: within}
+	for {
+		batch, err := g.next.ListLocations(ctx, query)
+		if err != nil {
+			return 0, err
+		}
+		for i := range batch.Locations {
+			if keep(&batch.Locations[i]) {
+				total++
+			}
+		}
+		if batch.NextCursor == "" {
+			return total, nil
+		}
+		query.After, _ = location.DecodeCursor(batch.NextCursor)
+	}
+}
+
+// nearest returns the k readable locations nearest to a point, walking the locations in order of distance
+func (g *LocationGuard) nearest(ctx context.Context, lat, lng float64, k int, keep func(l *location.Location) bool) ([]location.NearestMatch, error) {
+	page, err := g.collect(ctx, location.ListQuery{
+		Sort:  location.SortDistance,
+		Near:  &location.Point{Latitude: lat, Longitude: lng},
+		Limit: k,
+	}, keep)
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Locations) == 0 {
+		return nil, &location.NoLocationsError{}
+	}
+
+	matches := make([]location.NearestMatch, len(page.Locations))
+	for i, l := range page.Locations {
+		distance := l.DistanceKm
+		l.DistanceKm = 0
+		matches[i] = location.NearestMatch{Location: l, DistanceKm: distance}
+	}
+	return matches, nil
+}
+
+// filter returns the locations to keep; a nil keep keeps every location
+func filter(locations []location.Location, keep func(l *location.Location) bool) []location.Location {
+	if keep == nil {
+		return locations
+	}
+	kept := make([]location.Location, 0, len(locations))
+	for i := range locations {
+		if keep(&locations[i]) {
+			kept = append(kept, locations[i])
+		}
+	}
+	return kept
+}
@@ -0,0 +1,416 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"github.com/youngprinnce/geolocation-service/internal/service/search"
+	"gorm.io/gorm"
+)
+
+// memStore keeps locations in memory, listing them by ID or by distance
+type memStore struct {
+	location.LocationStore
+	locations []location.Location
+	// scans counts the reads of every location
+	scans int
+}
+
+func (m *memStore) Create(ctx context.Context, l *location.Location) error {
+	l.ID = uint(len(m.locations) + 1)
+	m.locations = append(m.locations, *l)
+	return nil
+}
+
+func (m *memStore) GetAll() ([]location.Location, error) {
+	m.scans++
+	return append([]location.Location(nil), m.locations...), nil
+}
+
+func (m *memStore) GetByNames(names []string) ([]location.Location, error) {
+	var found []location.Location
+	for _, name := range names {
+		if l, err := m.GetByName(name); err == nil {
+			found = append(found, *l)
+		}
+	}
+	return found, nil
+}
+
+// within returns the locations of any of the grants, or every location without grants
+func (m *memStore) within(grants []location.Grant) []location.Location {
+	var matching []location.Location
+	for _, l := range m.locations {
+		for _, grant := range grants {
+			if grant.Matches(&l) {
+				matching = append(matching, l)
+				break
+			}
+		}
+		if len(grants) == 0 {
+			matching = append(matching, l)
+		}
+	}
+	return matching
+}
+
+func (m *memStore) Count(within []location.Grant) (int64, error) {
+	return int64(len(m.within(within))), nil
+}
+
+func (m *memStore) List(query location.ListQuery) ([]location.Location, error) {
+	calculator := &location.DistanceCalculator{}
+	sorted := m.within(query.Within)
+	for i := range sorted {
+		if query.Near != nil {
+			sorted[i].DistanceKm = calculator.HaversineDistance(query.Near.Latitude, query.Near.Longitude, sorted[i].Latitude, sorted[i].Longitude)
+		}
+	}
+	less := func(a, b location.Location) bool {
+		if a.DistanceKm != b.DistanceKm {
+			return a.DistanceKm < b.DistanceKm
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+
+	var page []location.Location
+	for _, l := range sorted {
+		if query.After != nil {
+			key, _ := query.After.SortKey()
+			after := location.Location{ID: query.After.ID}
+			after.DistanceKm, _ = key.(float64)
+			if !less(after, l) {
+				continue
+			}
+		}
+		if len(page) < query.Limit {
+			page = append(page, l)
+		}
+	}
+	return page, nil
+}
+
+func (m *memStore) GetByName(name string) (*location.Location, error) {
+	for _, l := range m.locations {
+		if l.Name == name {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) GetByUUID(id uuid.UUID) (*location.Location, error) {
+	for _, l := range m.locations {
+		if l.UUID == id {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) NameExists(name string) (bool, error) {
+	_, err := m.GetByName(name)
+	return err == nil, nil
+}
+
+func (m *memStore) Update(ctx context.Context, l *location.Location) error {
+	for i := range m.locations {
+		if m.locations[i].ID == l.ID {
+			m.locations[i] = *l
+		}
+	}
+	return nil
+}
+
+func (m *memStore) Delete(ctx context.Context, deleted *location.Location) error {
+	for i, l := range m.locations {
+		if l.UUID == deleted.UUID {
+			m.locations = append(m.locations[:i], m.locations[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// north covers the stations above the 50th parallel
+var north = &location.BoundingBox{MinLat: 50, MinLng: -10, MaxLat: 60, MaxLng: 10}
+
+func newGuardedService(t *testing.T) location.LocationBC {
+	t.Helper()
+	service, _ := newGuardedStore(t)
+	return service
+}
+
+// newGuardedStore returns a guarded service over four stations, two in the north and two
+// in the south, with the store it reads them from
+func newGuardedStore(t *testing.T) (location.LocationBC, *memStore) {
+	t.Helper()
+	store := &memStore{}
+	for _, l := range []location.Location{
+		{Name: "North Fuel", Latitude: 55, Longitude: 0, Category: "fuel"},
+		{Name: "North Charging", Latitude: 56, Longitude: 1, Category: "charging"},
+		{Name: "South Fuel", Latitude: 40, Longitude: 0, Category: "fuel"},
+		{Name: "South Charging", Latitude: 41, Longitude: 1, Category: "charging"},
+	} {
+		l.UUID = uuid.New()
+		_ = store.Create(context.Background(), &l)
+	}
+
+	return NewLocationGuard(location.NewLocationService(store, &location.DistanceCalculator{}, nil), newPolicy(t)), store
+}
+
+func newPolicy(t *testing.T) *Policy {
+	t.Helper()
+	policy, err := NewPolicy([]Rule{
+		{Role: "ops-north", Actions: []string{ActionWrite}, Area: &Area{BBox: north}},
+		{Role: "ev-auditor", Actions: []string{ActionRead}, Categories: []string{"charging"}},
+		{Role: "ops-wedge", Actions: []string{ActionRead}, Area: &Area{Polygon: []location.Point{
+			{Latitude: 50, Longitude: -1}, {Latitude: 60, Longitude: -1}, {Latitude: 60, Longitude: 1.5},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	return policy
+}
+
+func as(principal *auth.Principal) context.Context {
+	return auth.WithPrincipal(context.Background(), principal)
+}
+
+func names(locations []location.Location) string {
+	var names []string
+	for _, l := range locations {
+		names = append(names, l.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+var (
+	northOps  = &auth.Principal{ID: "ada", Roles: []string{"ops-north"}, Scopes: []string{auth.ScopeWrite}}
+	evAuditor = &auth.Principal{ID: "bob", Roles: []string{"ev-auditor"}, Scopes: []string{auth.ScopeRead}}
+)
+
+func TestGuardWrites(t *testing.T) {
+	service := newGuardedService(t)
+	ctx := as(northOps)
+	var forbidden *auth.ForbiddenError
+
+	if _, err := service.CreateLocation(ctx, location.CreateLocationRequest{Name: "North Depot", Latitude: 52, Longitude: 2}); err != nil {
+		t.Errorf("CreateLocation() in the region error = %v", err)
+	}
+	if _, err := service.CreateLocation(ctx, location.CreateLocationRequest{Name: "South Depot", Latitude: 42, Longitude: 2}); !errors.As(err, &forbidden) {
+		t.Errorf("CreateLocation() outside the region error = %v, expected forbidden", err)
+	}
+
+	move := location.UpdateLocationRequest{Name: "North Fuel", Latitude: 45, Longitude: 0, Category: "fuel"}
+	if _, err := service.UpdateLocation(ctx, "North Fuel", move); !errors.As(err, &forbidden) {
+		t.Errorf("UpdateLocation() moving out of the region error = %v, expected forbidden", err)
+	}
+	move.Latitude = 57
+	if _, err := service.UpdateLocation(ctx, "North Fuel", move); err != nil {
+		t.Errorf("UpdateLocation() within the region error = %v", err)
+	}
+
+	// Locations the principal may not read do not exist for it
+	if err := service.DeleteLocationByName(ctx, "South Fuel"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteLocationByName() outside the region error = %v, expected not found", err)
+	}
+	if err := service.DeleteLocationByName(ctx, "North Charging"); err != nil {
+		t.Errorf("DeleteLocationByName() in the region error = %v", err)
+	}
+
+	// Read-only rules do not allow changes
+	auditor := as(evAuditor)
+	if err := service.DeleteLocationByName(auditor, "South Charging"); !errors.As(err, &forbidden) {
+		t.Errorf("DeleteLocationByName() by a reader error = %v, expected forbidden", err)
+	}
+
+	// Roles named by no rule grant nothing
+	editor := as(&auth.Principal{Roles: []string{"geo-editor"}, Scopes: []string{auth.ScopeWrite}})
+	if _, err := service.CreateLocation(editor, location.CreateLocationRequest{Name: "Any Depot", Latitude: 42, Longitude: 2}); !errors.As(err, &forbidden) {
+		t.Errorf("CreateLocation() by a role without rules error = %v, expected forbidden", err)
+	}
+	if err := service.DeleteLocationByName(editor, "South Charging"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("DeleteLocationByName() by a role without rules error = %v, expected not found", err)
+	}
+
+	// Admins and principals without roles are limited by their scopes alone
+	for _, principal := range []*auth.Principal{
+		{Roles: []string{"ops-north"}, Scopes: []string{auth.ScopeAdmin}},
+		{Scopes: []string{auth.ScopeWrite}},
+		nil,
+	} {
+		if err := service.DeleteLocationByName(as(principal), "South Charging"); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("DeleteLocationByName() by %+v error = %v", principal, err)
+		}
+	}
+}
+
+func TestGuardReads(t *testing.T) {
+	service, store := newGuardedStore(t)
+	ctx := as(evAuditor)
+
+	all, _ := service.GetAllLocations(ctx)
+	if got := names(all); got != "North Charging,South Charging" {
+		t.Errorf("GetAllLocations() = %v", got)
+	}
+	if _, err := service.GetLocation(ctx, "North Fuel"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetLocation() of a hidden location error = %v, expected not found", err)
+	}
+
+	// Pages are filled past hidden locations and stay continuous
+	var listed []location.Location
+	query := location.ListQuery{Limit: 1, WithTotal: true}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := service.ListLocations(ctx, query)
+		if err != nil {
+			t.Fatalf("ListLocations() error = %v", err)
+		}
+		if page.Total == nil || *page.Total != 2 {
+			t.Errorf("Total = %v, expected 2", page.Total)
+		}
+		listed = append(listed, page.Locations...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.After, _ = location.DecodeCursor(page.NextCursor)
+	}
+	if got := names(listed); got != "North Charging,South Charging" {
+		t.Errorf("ListLocations() = %v", got)
+	}
+	if store.scans != 1 {
+		t.Errorf("ListLocations() read every location %d times, expected the policy to narrow the queries", store.scans-1)
+	}
+
+	// A polygon is narrowed to its bounding box in the store and checked exactly afterwards
+	wedge := as(&auth.Principal{Roles: []string{"ops-wedge"}, Scopes: []string{auth.ScopeRead}})
+	page, err := service.ListLocations(wedge, location.ListQuery{WithTotal: true})
+	if err != nil || names(page.Locations) != "North Fuel" || page.Total == nil || *page.Total != 1 {
+		t.Errorf("ListLocations() within a polygon = %v, total %v, error %v", names(page.Locations), page.Total, err)
+	}
+
+	nearest, distance, err := service.FindNearestLocation(ctx, 40, 0)
+	if err != nil || nearest.Name != "South Charging" || distance <= 0 {
+		t.Errorf("FindNearestLocation() = %v, %v, %v", nearest, distance, err)
+	}
+	matches, err := service.FindKNearest(as(northOps), 40, 0, 5)
+	if err != nil || len(matches) != 2 || matches[0].Location.Name != "North Fuel" {
+		t.Errorf("FindKNearest() = %v, %v", matches, err)
+	}
+	if _, err := service.FindKNearest(ctx, 40, 0, 0); err == nil {
+		t.Error("FindKNearest() should validate k")
+	}
+
+	radius, _ := service.FindWithinRadius(ctx, 40, 0, 500)
+	if len(radius) != 1 || radius[0].Location.Name != "South Charging" {
+		t.Errorf("FindWithinRadius() = %v", radius)
+	}
+
+	unrestricted, _ := service.GetAllLocations(as(&auth.Principal{Scopes: []string{auth.ScopeRead}}))
+	if len(unrestricted) != 4 {
+		t.Errorf("GetAllLocations() without roles = %d locations, expected 4", len(unrestricted))
+	}
+
+	// The policy fails closed for roles named by no rule
+	viewer := as(&auth.Principal{Roles: []string{"geo-viewer"}, Scopes: []string{auth.ScopeRead}})
+	if denied, _ := service.GetAllLocations(viewer); len(denied) != 0 {
+		t.Errorf("GetAllLocations() by a role without rules = %v, expected none", names(denied))
+	}
+	page, err = service.ListLocations(viewer, location.ListQuery{WithTotal: true})
+	if err != nil || len(page.Locations) != 0 || page.Total == nil || *page.Total != 0 {
+		t.Errorf("ListLocations() by a role without rules = %v, total %v, error %v", names(page.Locations), page.Total, err)
+	}
+	if _, _, err := service.FindNearestLocation(viewer, 40, 0); !errors.As(err, new(*location.NoLocationsError)) {
+		t.Errorf("FindNearestLocation() by a role without rules error = %v, expected no locations", err)
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	invalid := map[string]Rule{
+		"missing role":    {Actions: []string{ActionRead}},
+		"missing actions": {Role: "ops"},
+		"unknown action":  {Role: "ops", Actions: []string{"delete"}},
+		"empty area":      {Role: "ops", Actions: []string{ActionRead}, Area: &Area{}},
+		"inverted bbox":   {Role: "ops", Actions: []string{ActionRead}, Area: &Area{BBox: &location.BoundingBox{MinLat: 10, MaxLat: 0}}},
+		"short polygon":   {Role: "ops", Actions: []string{ActionRead}, Area: &Area{Polygon: []location.Point{{}, {Latitude: 1}}}},
+	}
+	for name, rule := range invalid {
+		if _, err := NewPolicy([]Rule{rule}); err == nil {
+			t.Errorf("NewPolicy() with %s should fail", name)
+		}
+	}
+
+	triangle := &Area{Polygon: []location.Point{{Latitude: 0, Longitude: 0}, {Latitude: 10, Longitude: 0}, {Latitude: 0, Longitude: 10}}}
+	if !triangle.Contains(2, 2) || triangle.Contains(8, 8) {
+		t.Error("Contains() does not follow the polygon")
+	}
+}
+
+// fixedChanges is a change feed serving one page
+type fixedChanges struct {
+	page outbox.ChangePage
+}
+
+func (f fixedChanges) GetChanges(ctx context.Context, since string, limit int, wait time.Duration) (*outbox.ChangePage, error) {
+	page := f.page
+	return &page, nil
+}
+
+func TestGuardsOfOtherReads(t *testing.T) {
+	_, store := newGuardedStore(t)
+	policy := newPolicy(t)
+	stores := func(string) location.LocationStore { return store }
+	calculator := &location.DistanceCalculator{}
+	ctx := as(evAuditor)
+
+	searches := NewSearchGuard(search.NewSearchService(stores, calculator), policy)
+	results, err := searches.Search(ctx, search.Query{Text: "fuel"})
+	if err != nil || len(results) != 0 {
+		t.Errorf("Search() = %v, %v, expected no fuel stations for a charging auditor", results, err)
+	}
+	if results, _ := searches.Search(ctx, search.Query{Text: "charging"}); len(results) != 2 {
+		t.Errorf("Search() = %d results, expected both charging stations", len(results))
+	}
+
+	routes := NewRouteGuard(route.NewRouteService(stores, calculator), stores, policy)
+	req := route.OptimizeRouteRequest{Start: &location.Point{}, Stations: []string{"North Charging", "South Fuel", "Nowhere"}}
+	var unknown *route.UnknownStationsError
+	if _, err := routes.OptimizeRoute(ctx, req); !errors.As(err, &unknown) || strings.Join(unknown.Names, ",") != "Nowhere,South Fuel" {
+		t.Errorf("OptimizeRoute() error = %v, expected hidden and missing stations to be unknown", err)
+	}
+	req.Stations = []string{"North Charging", "South Charging"}
+	if _, err := routes.OptimizeRoute(ctx, req); err != nil {
+		t.Errorf("OptimizeRoute() of readable stations error = %v", err)
+	}
+
+	payload := func(l location.Location) json.RawMessage {
+		data, _ := json.Marshal(l)
+		return data
+	}
+	changes := NewChangeGuard(fixedChanges{page: outbox.ChangePage{NextCursor: "next", Changes: []outbox.Change{
+		{Aggregate: location.OutboxAggregate, Payload: payload(store.locations[0])},
+		{Aggregate: location.OutboxAggregate, Payload: payload(store.locations[1])},
+	}}}, policy)
+	page, err := changes.GetChanges(ctx, "", 0, 0)
+	if err != nil || len(page.Changes) != 1 || page.NextCursor != "next" {
+		t.Errorf("GetChanges() = %+v, %v, expected only the charging station and the cursor past both", page, err)
+	}
+	if page, _ := changes.GetChanges(context.Background(), "", 0, 0); len(page.Changes) != 2 {
+		t.Errorf("GetChanges() without a principal = %d changes, expected 2", len(page.Changes))
+	}
+}
@@ -0,0 +1,194 @@
+// Package access restricts which locations a caller may read and write.
+// Policies grant actions on locations to the holders of a role, optionally
+// limited to some categories and to a geographic area, so that regional teams
+// can only change the stations of their own region.
+package access
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// Actions granted by rules. Write includes read.
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// Area is the part of the world a rule applies to: a bounding box or a polygon
+type Area struct {
+	BBox    *location.BoundingBox
+	Polygon []location.Point
+}
+
+// Contains reports whether the point lies inside the area.
+// Polygons are treated as planar in degrees and must not cross the antimeridian.
+func (a *Area) Contains(lat, lng float64) bool {
+	if a.BBox != nil {
+		return a.BBox.Contains(lat, lng)
+	}
+	fence := geofence.Geofence{Kind: geofence.KindPolygon, Polygon: a.Polygon}
+	return fence.Contains(nil, lat, lng)
+}
+
+// bounds returns the smallest bounding box around the area
+func (a *Area) bounds() *location.BoundingBox {
+	if a.BBox != nil {
+		return a.BBox
+	}
+	box := &location.BoundingBox{MinLat: a.Polygon[0].Latitude, MinLng: a.Polygon[0].Longitude, MaxLat: a.Polygon[0].Latitude, MaxLng: a.Polygon[0].Longitude}
+	for _, p := range a.Polygon[1:] {
+		box.MinLat = min(box.MinLat, p.Latitude)
+		box.MinLng = min(box.MinLng, p.Longitude)
+		box.MaxLat = max(box.MaxLat, p.Latitude)
+		box.MaxLng = max(box.MaxLng, p.Longitude)
+	}
+	return box
+}
+
+func (a *Area) validate() error {
+	if (a.BBox == nil) == (len(a.Polygon) == 0) {
+		return errors.New("exactly one of bbox or polygon is required")
+	}
+	if a.BBox != nil {
+		return a.BBox.Validate()
+	}
+	if len(a.Polygon) < 3 {
+		return errors.New("a polygon needs at least three points")
+	}
+	for _, p := range a.Polygon {
+		if err := location.ValidateCoordinates(p.Latitude, p.Longitude); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rule grants actions on locations to the holders of a role
+type Rule struct {
+	Role    string
+	Actions []string
+	// Categories limits the rule to locations of these categories; empty matches every category
+	Categories []string
+	// Area limits the rule to locations inside it; nil matches everywhere
+	Area *Area
+}
+
+// matches reports whether the rule grants action on l
+func (r *Rule) matches(action string, l *location.Location) bool {
+	if !r.grants(action) {
+		return false
+	}
+	if len(r.Categories) > 0 && !contains(r.Categories, l.Category) {
+		return false
+	}
+	return r.Area == nil || r.Area.Contains(l.Latitude, l.Longitude)
+}
+
+func (r *Rule) grants(action string) bool {
+	for _, granted := range r.Actions {
+		if granted == action || granted == ActionWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy decides which locations a principal may read and write. Principals
+// holding roles may only act on the locations the rules of their roles grant,
+// so roles named by no rule grant nothing and the policy fails closed.
+// Admins, principals without roles such as API keys, and anonymous callers,
+// which only exist while authentication is disabled, are limited by their
+// scopes alone.
+type Policy struct {
+	rules map[string][]Rule
+}
+
+// NewPolicy checks the rules and returns the policy they form
+func NewPolicy(rules []Rule) (*Policy, error) {
+	policy := &Policy{rules: make(map[string][]Rule)}
+	for i, rule := range rules {
+		if rule.Role == "" {
+			return nil, fmt.Errorf("policy %d: the role is required", i+1)
+		}
+		if len(rule.Actions) == 0 {
+			return nil, fmt.Errorf("policy %d: at least one action is required", i+1)
+		}
+		for _, action := range rule.Actions {
+			if action != ActionRead && action != ActionWrite {
+				return nil, fmt.Errorf("policy %d: unknown action %q, use read or write", i+1, action)
+			}
+		}
+		if rule.Area != nil {
+			if err := rule.Area.validate(); err != nil {
+				return nil, fmt.Errorf("policy %d: %w", i+1, err)
+			}
+		}
+		policy.rules[rule.Role] = append(policy.rules[rule.Role], rule)
+	}
+	return policy, nil
+}
+
+// Restricts reports whether the policy limits what principal may access
+func (p *Policy) Restricts(principal *auth.Principal) bool {
+	if principal == nil || principal.Allows(auth.ScopeAdmin) {
+		return false
+	}
+	return len(principal.Roles) > 0
+}
+
+// Allows reports whether principal may perform action on l
+func (p *Policy) Allows(principal *auth.Principal, action string, l *location.Location) bool {
+	if !p.Restricts(principal) {
+		return true
+	}
+	for _, role := range principal.Roles {
+		for i := range p.rules[role] {
+			if p.rules[role][i].matches(action, l) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Readable returns whether principal may read a location, or nil when the policy hides nothing
+// from it. A nil policy hides nothing from anyone.
+func (p *Policy) Readable(principal *auth.Principal) func(l *location.Location) bool {
+	if p == nil || !p.Restricts(principal) {
+		return nil
+	}
+	return func(l *location.Location) bool {
+		return p.Allows(principal, ActionRead, l)
+	}
+}
+
+// grants returns the locations principal may read as grants a store can query. They are exact
+// unless a rule covers a polygon, which is widened to the bounding box around it.
+func (p *Policy) grants(principal *auth.Principal) (grants []location.Grant, exact bool) {
+	exact = true
+	for _, role := range principal.Roles {
+		for _, rule := range p.rules[role] {
+			grant := location.Grant{Categories: rule.Categories}
+			if rule.Area != nil {
+				grant.BBox = rule.Area.bounds()
+				exact = exact && rule.Area.BBox != nil
+			}
+			grants = append(grants, grant)
+		}
+	}
+	return grants, exact
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package access
+
+import (
+	"context"
+	"sort"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// RouteGuard enforces a Policy in front of a RouteBC. Stations the caller may
+// not read are unknown to it, exactly like stations that do not exist.
+type RouteGuard struct {
+	next      route.RouteBC
+	locations location.StoreFactory
+	policy    *Policy
+}
+
+// NewRouteGuard returns next restricted by policy, looking stations up in locations
+func NewRouteGuard(next route.RouteBC, locations location.StoreFactory, policy *Policy) route.RouteBC {
+	return &RouteGuard{
+		next:      next,
+		locations: locations,
+		policy:    policy,
+	}
+}
+
+// OptimizeRoute orders the requested stations if the caller may read every one of them
+func (g *RouteGuard) OptimizeRoute(ctx context.Context, req route.OptimizeRouteRequest) (*route.OptimizedRoute, error) {
+	principal, _ := auth.FromContext(ctx)
+	keep := g.policy.Readable(principal)
+	if keep == nil || len(req.Stations) == 0 {
+		return g.next.OptimizeRoute(ctx, req)
+	}
+
+	found, err := g.locations(tenant.FromContext(ctx)).GetByNames(req.Stations)
+	if err != nil {
+		return nil, err
+	}
+	readable := make(map[string]bool, len(found))
+	for i := range found {
+		readable[found[i].Name] = keep(&found[i])
+	}
+
+	var unknown []string
+	for _, name := range req.Stations {
+		if !readable[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, &route.UnknownStationsError{Names: unknown}
+	}
+	return g.next.OptimizeRoute(ctx, req)
+}
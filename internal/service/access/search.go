@@ -0,0 +1,32 @@
+package access
+
+import (
+	"context"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/search"
+)
+
+// SearchGuard enforces a Policy in front of a SearchBC, leaving the locations
+// the caller may not read out of its results
+type SearchGuard struct {
+	next   search.SearchBC
+	policy *Policy
+}
+
+// NewSearchGuard returns next restricted by policy
+func NewSearchGuard(next search.SearchBC, policy *Policy) search.SearchBC {
+	return &SearchGuard{
+		next:   next,
+		policy: policy,
+	}
+}
+
+// Search returns the best matches among the locations the caller may read
+func (g *SearchGuard) Search(ctx context.Context, query search.Query) ([]search.Result, error) {
+	principal, _ := auth.FromContext(ctx)
+	if keep := g.policy.Readable(principal); keep != nil {
+		query.Visible = keep
+	}
+	return g.next.Search(ctx, query)
+}
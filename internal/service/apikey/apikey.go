@@ -0,0 +1,43 @@
+package apikey
+
+import "time"
+
+// APIKey is a credential granting scopes to its holder. Only a hash of the
+// secret part of the key is stored; the key itself is shown once on creation.
+type APIKey struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	Name   string `json:"name" gorm:"not null"`
+	Prefix string `json:"prefix" gorm:"uniqueIndex;not null"`
+	// Hash is the hex SHA-256 of the whole key
+	Hash   string   `json:"-" gorm:"not null"`
+	Scopes []string `json:"scopes" gorm:"type:jsonb;serializer:json;not null"`
+	// Tenant binds the key to one tenant; empty keys act for the default tenant,
+	// or with the admin scope for the tenant they name
+	Tenant     string     `json:"tenant,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key may still be used at the given time
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// CreateKeyRequest describes a new key. A zero TTL creates a key that does not expire.
+type CreateKeyRequest struct {
+	Name   string
+	Scopes []string
+	TTL    time.Duration
+	Tenant string
+}
+
+// CreatedKey is a new key together with its secret, which cannot be retrieved again
+type CreatedKey struct {
+	APIKey
+	Key string `json:"key"`
+}
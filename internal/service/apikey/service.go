@@ -0,0 +1,190 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// keyPrefix starts every key so leaked keys are easy to recognise, e.g. by secret scanners
+const keyPrefix = "gsk_"
+
+// Sizes of the random parts of a key in bytes
+const (
+	prefixBytes = 6
+	secretBytes = 32
+)
+
+// lastUsedGranularity limits how often the last use of a key is written back,
+// so a busy key does not cost a database write per request
+const lastUsedGranularity = time.Minute
+
+// ErrInvalidKey is returned for every key that cannot be used, so callers cannot
+// tell unknown, revoked and expired keys apart
+var ErrInvalidKey = &auth.UnauthorizedError{Reason: "The API key is invalid, expired or revoked"}
+
+type APIKeyBC interface {
+	CreateKey(req CreateKeyRequest) (*CreatedKey, error)
+	ListKeys() ([]APIKey, error)
+	RevokeKey(id uint) (*APIKey, error)
+	Authenticate(key string) (*auth.Principal, error)
+}
+
+// APIKeyService issues API keys and resolves the keys presented by clients
+type APIKeyService struct {
+	repo APIKeyStore
+	now  func() time.Time
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(repo APIKeyStore) *APIKeyService {
+	return &APIKeyService{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// CreateKey generates and stores a new key. The returned key is the only copy of its secret.
+func (s *APIKeyService) CreateKey(req CreateKeyRequest) (*CreatedKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, service.BadRequest{Err: errors.New("name is required")}
+	}
+	if len(req.Scopes) == 0 {
+		return nil, service.BadRequest{Err: errors.New("at least one scope is required")}
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			return nil, service.BadRequest{Err: fmt.Errorf("unknown scope %q, expected read, write or admin", scope)}
+		}
+	}
+	if req.TTL < 0 {
+		return nil, service.BadRequest{Err: errors.New("the time to live must not be negative")}
+	}
+	if req.Tenant != "" && !tenant.Valid(req.Tenant) {
+		return nil, service.BadRequest{Err: fmt.Errorf("invalid tenant %q", req.Tenant)}
+	}
+
+	prefix, err := randomString(prefixBytes, hex.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(secretBytes, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	key := keyPrefix + prefix + "_" + secret
+
+	created := &CreatedKey{
+		APIKey: APIKey{
+			Name:   name,
+			Prefix: prefix,
+			Hash:   hash(key),
+			Scopes: req.Scopes,
+			Tenant: req.Tenant,
+		},
+		Key: key,
+	}
+	if req.TTL > 0 {
+		expiresAt := s.now().UTC().Add(req.TTL)
+		created.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(&created.APIKey); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// ListKeys returns every key, revoked and expired ones included
+func (s *APIKeyService) ListKeys() ([]APIKey, error) {
+	return s.repo.GetAll()
+}
+
+// RevokeKey stops a key from being accepted. Revoking a revoked key changes nothing.
+func (s *APIKeyService) RevokeKey(id uint) (*APIKey, error) {
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Revoke(id, s.now().UTC()); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(id)
+}
+
+// Authenticate resolves the principal holding key
+func (s *APIKeyService) Authenticate(key string) (*auth.Principal, error) {
+	prefix, ok := parsePrefix(key)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	stored, err := s.repo.GetByPrefix(prefix)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	if subtle.ConstantTimeCompare([]byte(hash(key)), []byte(stored.Hash)) != 1 || !stored.Active(now) {
+		return nil, ErrInvalidKey
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= lastUsedGranularity {
+		if err := s.repo.TouchLastUsed(stored.ID, now); err != nil {
+			// Tracking is best effort and must not lock out a valid key
+			log.WithError(err).WithField("api_key_id", stored.ID).Warn("Failed to record API key use")
+		}
+	}
+
+	return &auth.Principal{
+		ID:     strconv.FormatUint(uint64(stored.ID), 10),
+		Name:   stored.Name,
+		Method: auth.MethodAPIKey,
+		Scopes: stored.Scopes,
+		Tenant: stored.Tenant,
+	}, nil
+}
+
+// parsePrefix extracts the public prefix of a well-formed key
+func parsePrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, keyPrefix)
+	if !ok {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 2*prefixBytes || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// hash returns the hex SHA-256 of a key. Keys carry 256 random bits, so a fast
+// hash is enough; a slow password hash would only cost time on every request.
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return encode(buf), nil
+}
@@ -0,0 +1,210 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory APIKeyStore used by the service tests
+type memStore struct {
+	mu      sync.Mutex
+	keys    []APIKey
+	touches int
+}
+
+func (m *memStore) Create(key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key.ID = uint(len(m.keys) + 1)
+	m.keys = append(m.keys, *key)
+	return nil
+}
+
+func (m *memStore) GetAll() ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]APIKey(nil), m.keys...), nil
+}
+
+func (m *memStore) GetByID(id uint) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.keys) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	key := m.keys[id-1]
+	return &key, nil
+}
+
+func (m *memStore) GetByPrefix(prefix string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) Revoke(id uint, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keys[id-1].RevokedAt == nil {
+		m.keys[id-1].RevokedAt = &at
+	}
+	return nil
+}
+
+func (m *memStore) TouchLastUsed(id uint, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[id-1].LastUsedAt = &at
+	m.touches++
+	return nil
+}
+
+func newTestService() (*APIKeyService, *memStore, *time.Time) {
+	store := &memStore{}
+	service := NewAPIKeyService(store)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	return service, store, &now
+}
+
+func TestCreateKeyStoresOnlyTheHash(t *testing.T) {
+	service, store, _ := newTestService()
+
+	created, err := service.CreateKey(CreateKeyRequest{Name: " ci ", Scopes: []string{auth.ScopeWrite}, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	if !strings.HasPrefix(created.Key, keyPrefix+created.Prefix+"_") {
+		t.Errorf("key %q does not start with its prefix %q", created.Key, created.Prefix)
+	}
+	if created.Name != "ci" {
+		t.Errorf("Name = %q, expected it trimmed", created.Name)
+	}
+	if want := time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC); created.ExpiresAt == nil || !created.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, expected %v", created.ExpiresAt, want)
+	}
+
+	stored := store.keys[0]
+	if stored.Hash == "" || strings.Contains(stored.Hash, created.Key) || stored.Hash == created.Key {
+		t.Errorf("stored hash %q must not contain the key", stored.Hash)
+	}
+}
+
+func TestCreateKeyValidation(t *testing.T) {
+	service, _, _ := newTestService()
+
+	tests := []struct {
+		name string
+		req  CreateKeyRequest
+	}{
+		{"missing name", CreateKeyRequest{Scopes: []string{auth.ScopeRead}}},
+		{"missing scopes", CreateKeyRequest{Name: "ci"}},
+		{"unknown scope", CreateKeyRequest{Name: "ci", Scopes: []string{"root"}}},
+		{"negative ttl", CreateKeyRequest{Name: "ci", Scopes: []string{auth.ScopeRead}, TTL: -time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.CreateKey(tt.req); err == nil {
+				t.Error("CreateKey() succeeded, expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	service, _, now := newTestService()
+
+	created, err := service.CreateKey(CreateKeyRequest{Name: "ci", Scopes: []string{auth.ScopeWrite}, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+
+	principal, err := service.Authenticate(created.Key)
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if principal.ID != "1" || principal.Name != "ci" || principal.Method != auth.MethodAPIKey {
+		t.Errorf("principal = %+v", principal)
+	}
+	if !principal.Allows(auth.ScopeRead) || !principal.Allows(auth.ScopeWrite) || principal.Allows(auth.ScopeAdmin) {
+		t.Errorf("a write key must allow read and write but not admin")
+	}
+
+	for name, key := range map[string]string{
+		"empty":        "",
+		"malformed":    "not-a-key",
+		"wrong secret": created.Key[:len(created.Key)-1] + "x",
+		"unknown":      keyPrefix + "000000000000_secret",
+	} {
+		if _, err := service.Authenticate(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%s) error = %v, expected ErrInvalidKey", name, err)
+		}
+	}
+
+	*now = now.Add(time.Hour)
+	if _, err := service.Authenticate(created.Key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Authenticate(expired) error = %v, expected ErrInvalidKey", err)
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	service, _, _ := newTestService()
+
+	created, err := service.CreateKey(CreateKeyRequest{Name: "ci", Scopes: []string{auth.ScopeRead}})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+
+	revoked, err := service.RevokeKey(created.ID)
+	if err != nil {
+		t.Fatalf("RevokeKey() error = %v", err)
+	}
+	if revoked.RevokedAt == nil {
+		t.Error("RevokedAt is not set")
+	}
+	if _, err := service.Authenticate(created.Key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Authenticate(revoked) error = %v, expected ErrInvalidKey", err)
+	}
+
+	if _, err := service.RevokeKey(42); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("RevokeKey(unknown) error = %v, expected not found", err)
+	}
+}
+
+func TestLastUsedIsThrottled(t *testing.T) {
+	service, store, now := newTestService()
+
+	created, err := service.CreateKey(CreateKeyRequest{Name: "ci", Scopes: []string{auth.ScopeRead}})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.Authenticate(created.Key); err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		*now = now.Add(10 * time.Second)
+	}
+	if store.touches != 1 {
+		t.Errorf("last use written %d times within a minute, expected once", store.touches)
+	}
+
+	*now = now.Add(time.Minute)
+	if _, err := service.Authenticate(created.Key); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if store.touches != 2 || !store.keys[0].LastUsedAt.Equal(*now) {
+		t.Errorf("last use = %v after %d writes, expected %v", store.keys[0].LastUsedAt, store.touches, *now)
+	}
+}
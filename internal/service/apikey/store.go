@@ -0,0 +1,71 @@
+package apikey
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyStore defines the interface for API key data access
+type APIKeyStore interface {
+	Create(key *APIKey) error
+	GetAll() ([]APIKey, error)
+	GetByID(id uint) (*APIKey, error)
+	GetByPrefix(prefix string) (*APIKey, error)
+	Revoke(id uint, at time.Time) error
+	TouchLastUsed(id uint, at time.Time) error
+}
+
+// APIKeyRepo provides data access methods for API keys
+type APIKeyRepo struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepo creates a new API key repository
+func NewAPIKeyRepo(db *gorm.DB) APIKeyStore {
+	return &APIKeyRepo{
+		db: db,
+	}
+}
+
+// Create creates a new API key in the database
+func (s *APIKeyRepo) Create(key *APIKey) error {
+	return s.db.Create(key).Error
+}
+
+// GetAll retrieves all API keys, revoked ones included
+func (s *APIKeyRepo) GetAll() ([]APIKey, error) {
+	var keys []APIKey
+	err := s.db.Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// GetByID retrieves an API key by ID
+func (s *APIKeyRepo) GetByID(id uint) (*APIKey, error) {
+	var key APIKey
+	err := s.db.First(&key, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetByPrefix retrieves the API key with the given public prefix
+func (s *APIKeyRepo) GetByPrefix(prefix string) (*APIKey, error) {
+	var key APIKey
+	err := s.db.Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Revoke marks an API key as revoked unless it already is
+func (s *APIKeyRepo) Revoke(id uint, at time.Time) error {
+	return s.db.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", at).Error
+}
+
+// TouchLastUsed records when an API key was last used
+func (s *APIKeyRepo) TouchLastUsed(id uint, at time.Time) error {
+	return s.db.Model(&APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
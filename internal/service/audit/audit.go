@@ -0,0 +1,157 @@
+// Package audit keeps an append-only trail of the changes made to locations.
+// Each tenant's entries form a hash chain: every entry seals the hash of the
+// one before it, so editing, removing or reordering entries breaks the chain.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// TargetLocation is the target type of location changes
+const TargetLocation = "location"
+
+// AnonymousActor is recorded for changes made while authentication is disabled
+const AnonymousActor = "anonymous"
+
+// Entry is one recorded change. Before and After hold the JSON of the target
+// around the change; Before is empty for creations and After for deletions.
+type Entry struct {
+	ID          uint64    `json:"id" gorm:"primaryKey"`
+	Tenant      string    `json:"tenant" gorm:"not null;index"`
+	Actor       string    `json:"actor" gorm:"not null;index"`
+	ActorName   string    `json:"actor_name,omitempty"`
+	ActorMethod string    `json:"actor_method,omitempty"`
+	Action      string    `json:"action" gorm:"not null;index"`
+	TargetType  string    `json:"target_type" gorm:"not null"`
+	TargetID    string    `json:"target_id" gorm:"not null;index"`
+	TargetName  string    `json:"target_name,omitempty"`
+	Before      string    `json:"-" gorm:"type:text"`
+	After       string    `json:"-" gorm:"type:text"`
+	IP          string    `json:"ip,omitempty"`
+	RequestID   string    `json:"request_id,omitempty"`
+	OccurredAt  time.Time `json:"occurred_at" gorm:"not null;index"`
+	PrevHash    string    `json:"prev_hash" gorm:"not null"`
+	Hash        string    `json:"hash" gorm:"not null;uniqueIndex"`
+}
+
+// TableName keeps the table name independent of the package name
+func (Entry) TableName() string {
+	return "audit_entries"
+}
+
+// MarshalJSON embeds the before and after states as JSON rather than strings
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type plain Entry
+	return json.Marshal(struct {
+		plain
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}{plain(e), rawOrNull(e.Before), rawOrNull(e.After)})
+}
+
+func rawOrNull(state string) json.RawMessage {
+	if state == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(state)
+}
+
+// sealed lists the fields covered by the hash of an entry, in a fixed order
+type sealed struct {
+	PrevHash    string `json:"prev_hash"`
+	Tenant      string `json:"tenant"`
+	Actor       string `json:"actor"`
+	ActorName   string `json:"actor_name"`
+	ActorMethod string `json:"actor_method"`
+	Action      string `json:"action"`
+	TargetType  string `json:"target_type"`
+	TargetID    string `json:"target_id"`
+	TargetName  string `json:"target_name"`
+	Before      string `json:"before"`
+	After       string `json:"after"`
+	IP          string `json:"ip"`
+	RequestID   string `json:"request_id"`
+	OccurredAt  string `json:"occurred_at"`
+}
+
+// Digest returns the hex SHA-256 of the entry's fields and the hash it follows
+func (e *Entry) Digest() string {
+	data, _ := json.Marshal(sealed{
+		PrevHash:    e.PrevHash,
+		Tenant:      e.Tenant,
+		Actor:       e.Actor,
+		ActorName:   e.ActorName,
+		ActorMethod: e.ActorMethod,
+		Action:      e.Action,
+		TargetType:  e.TargetType,
+		TargetID:    e.TargetID,
+		TargetName:  e.TargetName,
+		Before:      e.Before,
+		After:       e.After,
+		IP:          e.IP,
+		RequestID:   e.RequestID,
+		OccurredAt:  e.OccurredAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal links the entry to the hash of the entry before it, or "" for the first entry of a tenant
+func (e *Entry) Seal(prevHash string) {
+	e.PrevHash = prevHash
+	e.Hash = e.Digest()
+}
+
+// Query selects entries of one tenant. Zero values match every entry.
+type Query struct {
+	Actor  string
+	Action string
+	// Target matches the target's ID or name
+	Target string
+	Since  *time.Time
+	Until  *time.Time
+	// AfterID continues after the entry with this ID
+	AfterID uint64
+	Limit   int
+}
+
+// Page is one response of an audit query
+type Page struct {
+	Entries    []Entry `json:"entries"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Verification is the result of checking a tenant's chain
+type Verification struct {
+	Valid   bool  `json:"valid"`
+	Entries int64 `json:"entries"`
+	// BrokenAt is the ID of the first entry that does not match the chain
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	// Head is the hash of the last entry. Entries dropped from the end of the chain leave
+	// it valid, so keep the head outside the database to compare later verifications with.
+	Head string `json:"head,omitempty"`
+}
+
+// Origin is where a change came from
+type Origin struct {
+	IP        string
+	RequestID string
+}
+
+type originKey struct{}
+
+// WithOrigin returns a copy of ctx carrying the origin of the request
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin of the request ctx belongs to, if it is known
+func OriginFrom(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	return origin
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/service"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"gorm.io/gorm"
+)
+
+// LocationRecorder records every change made through a LocationBC, within the transaction
+// that makes it, so a change is only committed together with its entry. Reads pass straight
+// through to the wrapped service.
+type LocationRecorder struct {
+	location.LocationBC
+	audit AuditBC
+}
+
+// NewLocationRecorder returns next with its changes recorded to audit
+func NewLocationRecorder(next location.LocationBC, audit AuditBC) location.LocationBC {
+	return &LocationRecorder{
+		LocationBC: next,
+		audit:      audit,
+	}
+}
+
+// CreateLocation creates a location and records it
+func (r *LocationRecorder) CreateLocation(ctx context.Context, req location.CreateLocationRequest) (*location.Location, error) {
+	return r.LocationBC.CreateLocation(location.WithJournal(ctx, r), req)
+}
+
+// UpdateLocation updates the location called name and records its state before and after
+func (r *LocationRecorder) UpdateLocation(ctx context.Context, name string, req location.UpdateLocationRequest) (*location.Location, error) {
+	return r.LocationBC.UpdateLocation(location.WithJournal(ctx, r), name, req)
+}
+
+// UpdateLocationByUUID updates the location with the given UUID and records its state before and after
+func (r *LocationRecorder) UpdateLocationByUUID(ctx context.Context, id uuid.UUID, req location.UpdateLocationRequest) (*location.Location, error) {
+	return r.LocationBC.UpdateLocationByUUID(location.WithJournal(ctx, r), id, req)
+}
+
+// DeleteLocationByName deletes the location called name and records its last state
+func (r *LocationRecorder) DeleteLocationByName(ctx context.Context, name string) error {
+	return r.LocationBC.DeleteLocationByName(location.WithJournal(ctx, r), name)
+}
+
+// DeleteLocationByUUID deletes the location with the given UUID and records its last state
+func (r *LocationRecorder) DeleteLocationByUUID(ctx context.Context, id uuid.UUID) error {
+	return r.LocationBC.DeleteLocationByUUID(location.WithJournal(ctx, r), id)
+}
+
+// RecordChange appends a change to the trail within tx. Failing to record it fails the change.
+func (r *LocationRecorder) RecordChange(ctx context.Context, tx *gorm.DB, action string, before, after *location.Location) error {
+	target := after
+	if target == nil {
+		target = before
+	}
+	entry := Entry{
+		Action:     action,
+		TargetType: TargetLocation,
+		TargetID:   service.UUIDToString(target.UUID),
+		TargetName: target.Name,
+		Before:     state(before),
+		After:      state(after),
+	}
+	if err := r.audit.Record(ctx, tx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// state returns the JSON of a location, or "" when there is none
+func state(l *location.Location) string {
+	if l == nil {
+		return ""
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// Query limits
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// batchSize is how many entries exports and verification read at a time
+const batchSize = 500
+
+type AuditBC interface {
+	Record(ctx context.Context, tx *gorm.DB, entry Entry) error
+	GetEntries(ctx context.Context, query Query) (*Page, error)
+	Export(ctx context.Context, query Query, write func(Entry) error) error
+	Verify(ctx context.Context) (*Verification, error)
+}
+
+// AuditService records changes and serves the trail of the tenant each request acts for
+type AuditService struct {
+	repo AuditStore
+	now  func() time.Time
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo AuditStore) *AuditService {
+	return &AuditService{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+// Record appends a change made by the caller of ctx, filling in its tenant, actor and origin.
+// The entry is appended within tx, the transaction making the change, when it is not nil.
+func (s *AuditService) Record(ctx context.Context, tx *gorm.DB, entry Entry) error {
+	entry.Tenant = tenant.FromContext(ctx)
+	entry.Actor = AnonymousActor
+	if principal, ok := auth.FromContext(ctx); ok {
+		entry.Actor = principal.ID
+		entry.ActorName = principal.Name
+		entry.ActorMethod = principal.Method
+	}
+	origin := OriginFrom(ctx)
+	entry.IP = origin.IP
+	entry.RequestID = origin.RequestID
+	// The database keeps microseconds, so the hash must not cover more
+	entry.OccurredAt = s.now().UTC().Truncate(time.Microsecond)
+
+	return s.repo.Within(tx).Append(&entry)
+}
+
+// GetEntries returns the page of the tenant's entries selected by query, oldest first
+func (s *AuditService) GetEntries(ctx context.Context, query Query) (*Page, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultPageSize
+	}
+	if query.Limit > MaxPageSize {
+		query.Limit = MaxPageSize
+	}
+
+	// Read one entry more than asked for to learn whether another page follows
+	limit := query.Limit
+	query.Limit++
+	entries, err := s.repo.Find(tenant.FromContext(ctx), query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = outbox.EncodeCursor(page.Entries[limit-1].ID)
+	}
+	if page.Entries == nil {
+		page.Entries = []Entry{}
+	}
+	return page, nil
+}
+
+// Export hands every entry of the tenant selected by query to write, oldest first.
+// The query's limit is ignored.
+func (s *AuditService) Export(ctx context.Context, query Query, write func(Entry) error) error {
+	id := tenant.FromContext(ctx)
+	query.Limit = batchSize
+	for {
+		entries, err := s.repo.Find(id, query)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := write(entry); err != nil {
+				return err
+			}
+		}
+		if len(entries) < batchSize {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		query.AfterID = entries[len(entries)-1].ID
+	}
+}
+
+// Verify walks the tenant's whole chain and reports the first entry that was altered,
+// or that does not follow the entry before it
+func (s *AuditService) Verify(ctx context.Context) (*Verification, error) {
+	id := tenant.FromContext(ctx)
+	result := &Verification{Valid: true}
+	query := Query{Limit: batchSize}
+	prev := ""
+	for {
+		entries, err := s.repo.Find(id, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch {
+			case entry.PrevHash != prev:
+				result.Reason = "The entry does not follow the entry before it"
+			case entry.Digest() != entry.Hash:
+				result.Reason = "The entry does not match its hash"
+			}
+			if result.Reason != "" {
+				result.Valid = false
+				result.BrokenAt = entry.ID
+				return result, nil
+			}
+			prev = entry.Hash
+			result.Entries++
+		}
+		if len(entries) < batchSize {
+			result.Head = prev
+			return result, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		query.AfterID = entries[len(entries)-1].ID
+	}
+}
@@ -0,0 +1,343 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory AuditStore that chains entries like AuditRepo
+type memStore struct {
+	mu      sync.Mutex
+	entries []Entry
+	fail    error
+}
+
+func (m *memStore) Append(entry *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fail != nil {
+		return m.fail
+	}
+	prev := ""
+	for _, e := range m.entries {
+		if e.Tenant == entry.Tenant {
+			prev = e.Hash
+		}
+	}
+	entry.ID = uint64(len(m.entries) + 1)
+	entry.Seal(prev)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func (m *memStore) Find(tenant string, query Query) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []Entry
+	for _, e := range m.entries {
+		switch {
+		case e.Tenant != tenant, e.ID <= query.AfterID,
+			query.Actor != "" && e.Actor != query.Actor,
+			query.Action != "" && e.Action != query.Action,
+			query.Target != "" && e.TargetID != query.Target && e.TargetName != query.Target,
+			query.Since != nil && e.OccurredAt.Before(*query.Since),
+			query.Until != nil && !e.OccurredAt.Before(*query.Until):
+			continue
+		}
+		if len(found) < query.Limit {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+func (m *memStore) Within(*gorm.DB) AuditStore {
+	return m
+}
+
+func record(t *testing.T, service *AuditService, ctx context.Context, action, target string) {
+	t.Helper()
+	err := service.Record(ctx, nil, Entry{Action: action, TargetType: TargetLocation, TargetID: target, After: `{"name":"` + target + `"}`})
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+}
+
+func TestRecordChainsEntries(t *testing.T) {
+	store := &memStore{}
+	service := NewAuditService(store)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "key-1", Name: "ops", Method: auth.MethodAPIKey})
+	ctx = WithOrigin(ctx, Origin{IP: "10.0.0.1", RequestID: "req-1"})
+
+	record(t, service, ctx, events.LocationCreated, "a")
+	record(t, service, ctx, events.LocationUpdated, "a")
+	record(t, service, context.Background(), events.LocationDeleted, "a")
+
+	first, second, third := store.entries[0], store.entries[1], store.entries[2]
+	if first.Actor != "key-1" || first.ActorName != "ops" || first.ActorMethod != auth.MethodAPIKey {
+		t.Errorf("actor = %q %q %q, expected the principal", first.Actor, first.ActorName, first.ActorMethod)
+	}
+	if first.IP != "10.0.0.1" || first.RequestID != "req-1" {
+		t.Errorf("origin = %q %q, expected 10.0.0.1 req-1", first.IP, first.RequestID)
+	}
+	if first.Tenant != tenant.Default {
+		t.Errorf("Tenant = %q, expected %q", first.Tenant, tenant.Default)
+	}
+	if third.Actor != AnonymousActor {
+		t.Errorf("Actor without a principal = %q, expected %q", third.Actor, AnonymousActor)
+	}
+	if first.PrevHash != "" || second.PrevHash != first.Hash || third.PrevHash != second.Hash {
+		t.Error("entries are not chained to the entries before them")
+	}
+	if first.OccurredAt.Nanosecond()%1000 != 0 {
+		t.Errorf("OccurredAt = %v, expected microsecond precision", first.OccurredAt)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	store := &memStore{}
+	service := NewAuditService(store)
+	ctx := context.Background()
+	for _, target := range []string{"a", "b", "c", "d"} {
+		record(t, service, ctx, events.LocationCreated, target)
+	}
+
+	result, err := service.Verify(ctx)
+	if err != nil || !result.Valid || result.Entries != 4 {
+		t.Fatalf("Verify() = %+v, %v, expected a valid chain of 4", result, err)
+	}
+	if result.Head != store.entries[3].Hash {
+		t.Errorf("Head = %q, expected the hash of the last entry", result.Head)
+	}
+
+	store.entries[1].After = `{"name":"forged"}`
+	result, _ = service.Verify(ctx)
+	if result.Valid || result.BrokenAt != 2 {
+		t.Errorf("Verify() after editing = %+v, expected broken at 2", result)
+	}
+
+	// Resealing the edited entry moves the break to the entry that follows it
+	store.entries[1].Seal(store.entries[1].PrevHash)
+	result, _ = service.Verify(ctx)
+	if result.Valid || result.BrokenAt != 3 {
+		t.Errorf("Verify() after resealing = %+v, expected broken at 3", result)
+	}
+
+	store.entries = append(store.entries[:1], store.entries[2:]...)
+	result, _ = service.Verify(ctx)
+	if result.Valid || result.BrokenAt != 3 {
+		t.Errorf("Verify() after removing = %+v, expected broken at 3", result)
+	}
+}
+
+func TestTenantsHaveSeparateChains(t *testing.T) {
+	store := &memStore{}
+	service := NewAuditService(store)
+	acme := tenant.WithTenant(context.Background(), "acme")
+	globex := tenant.WithTenant(context.Background(), "globex")
+
+	record(t, service, acme, events.LocationCreated, "a")
+	record(t, service, globex, events.LocationCreated, "b")
+	record(t, service, acme, events.LocationDeleted, "a")
+
+	if store.entries[1].PrevHash != "" || store.entries[2].PrevHash != store.entries[0].Hash {
+		t.Error("tenants share a chain")
+	}
+	page, _ := service.GetEntries(globex, Query{})
+	if len(page.Entries) != 1 || page.Entries[0].TargetID != "b" {
+		t.Errorf("GetEntries() for globex = %+v, expected only its entry", page.Entries)
+	}
+	for _, ctx := range []context.Context{acme, globex} {
+		if result, _ := service.Verify(ctx); !result.Valid {
+			t.Errorf("Verify() = %+v, expected valid", result)
+		}
+	}
+}
+
+func TestGetEntriesPages(t *testing.T) {
+	service := NewAuditService(&memStore{})
+	ctx := context.Background()
+	for _, target := range []string{"a", "b", "c"} {
+		record(t, service, ctx, events.LocationCreated, target)
+	}
+	record(t, service, ctx, events.LocationDeleted, "a")
+
+	page, err := service.GetEntries(ctx, Query{Limit: 2})
+	if err != nil || len(page.Entries) != 2 || page.NextCursor == "" {
+		t.Fatalf("GetEntries() = %+v, %v, expected 2 entries and a cursor", page, err)
+	}
+
+	page, _ = service.GetEntries(ctx, Query{Limit: 2, AfterID: page.Entries[1].ID})
+	if len(page.Entries) != 2 || page.NextCursor != "" {
+		t.Errorf("second page = %+v, expected the last 2 entries without a cursor", page)
+	}
+
+	page, _ = service.GetEntries(ctx, Query{Target: "a"})
+	if len(page.Entries) != 2 {
+		t.Errorf("GetEntries(target a) returned %d entries, expected 2", len(page.Entries))
+	}
+	page, _ = service.GetEntries(ctx, Query{Action: events.LocationDeleted})
+	if len(page.Entries) != 1 {
+		t.Errorf("GetEntries(action deleted) returned %d entries, expected 1", len(page.Entries))
+	}
+
+	page, _ = service.GetEntries(ctx, Query{Actor: "nobody"})
+	if page.Entries == nil {
+		t.Error("GetEntries() with no match returned nil entries, expected an empty list")
+	}
+}
+
+func TestExportReadsEveryEntry(t *testing.T) {
+	service := NewAuditService(&memStore{})
+	ctx := context.Background()
+	for i := 0; i < batchSize+10; i++ {
+		record(t, service, ctx, events.LocationCreated, "a")
+	}
+
+	var exported []Entry
+	err := service.Export(ctx, Query{Limit: 1}, func(entry Entry) error {
+		exported = append(exported, entry)
+		return nil
+	})
+	if err != nil || len(exported) != batchSize+10 {
+		t.Fatalf("Export() wrote %d entries, %v, expected %d", len(exported), err, batchSize+10)
+	}
+	for i := 1; i < len(exported); i++ {
+		if exported[i].PrevHash != exported[i-1].Hash {
+			t.Fatalf("entry %d was exported out of order", exported[i].ID)
+		}
+	}
+
+	stop := errors.New("stop")
+	err = service.Export(ctx, Query{}, func(Entry) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("Export() error = %v, expected the writer's error", err)
+	}
+}
+
+func TestEntryJSONEmbedsStates(t *testing.T) {
+	data, err := json.Marshal(Entry{Action: events.LocationCreated, After: `{"name":"Depot"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	_ = json.Unmarshal(data, &decoded)
+	if decoded["before"] != nil {
+		t.Errorf("before = %v, expected null", decoded["before"])
+	}
+	if after, ok := decoded["after"].(map[string]interface{}); !ok || after["name"] != "Depot" {
+		t.Errorf("after = %v, expected the embedded location", decoded["after"])
+	}
+}
+
+// memLocations is a LocationBC holding locations by name, which like LocationRepo only
+// applies a change once the journal of its context recorded it; methods it does not override panic
+type memLocations struct {
+	location.LocationBC
+	locations map[string]*location.Location
+}
+
+func (m *memLocations) CreateLocation(ctx context.Context, req location.CreateLocationRequest) (*location.Location, error) {
+	l := &location.Location{UUID: uuid.New(), Name: req.Name, Latitude: req.Latitude, Longitude: req.Longitude}
+	if err := location.RecordChange(ctx, nil, events.LocationCreated, nil, l); err != nil {
+		return nil, err
+	}
+	m.locations[l.Name] = l
+	return l, nil
+}
+
+func (m *memLocations) UpdateLocation(ctx context.Context, name string, req location.UpdateLocationRequest) (*location.Location, error) {
+	before, ok := m.locations[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	updated := *before
+	updated.Name, updated.Latitude, updated.Longitude = req.Name, req.Latitude, req.Longitude
+	if err := location.RecordChange(ctx, nil, events.LocationUpdated, before, &updated); err != nil {
+		return nil, err
+	}
+	delete(m.locations, name)
+	m.locations[updated.Name] = &updated
+	return &updated, nil
+}
+
+func (m *memLocations) DeleteLocationByName(ctx context.Context, name string) error {
+	before, ok := m.locations[name]
+	if !ok {
+		return errors.New("not found")
+	}
+	if err := location.RecordChange(ctx, nil, events.LocationDeleted, before, nil); err != nil {
+		return err
+	}
+	delete(m.locations, name)
+	return nil
+}
+
+func TestLocationRecorder(t *testing.T) {
+	store := &memStore{}
+	locations := &memLocations{locations: make(map[string]*location.Location)}
+	recorder := NewLocationRecorder(locations, NewAuditService(store))
+	ctx := context.Background()
+
+	created, _ := recorder.CreateLocation(ctx, location.CreateLocationRequest{Name: "Depot", Latitude: 1, Longitude: 2})
+	_, _ = recorder.UpdateLocation(ctx, "Depot", location.UpdateLocationRequest{Name: "Hub", Latitude: 3, Longitude: 4})
+	_ = recorder.DeleteLocationByName(ctx, "Hub")
+	if err := recorder.DeleteLocationByName(ctx, "Hub"); err == nil {
+		t.Error("deleting a missing location succeeded")
+	}
+
+	if len(store.entries) != 3 {
+		t.Fatalf("recorded %d entries, expected 3", len(store.entries))
+	}
+	actions := []string{events.LocationCreated, events.LocationUpdated, events.LocationDeleted}
+	for i, entry := range store.entries {
+		if entry.Action != actions[i] || entry.TargetID != created.UUID.String() {
+			t.Errorf("entry %d = %s %s, expected %s %s", i, entry.Action, entry.TargetID, actions[i], created.UUID)
+		}
+	}
+
+	update := store.entries[1]
+	var before, after location.Location
+	_ = json.Unmarshal([]byte(update.Before), &before)
+	_ = json.Unmarshal([]byte(update.After), &after)
+	if before.Name != "Depot" || after.Name != "Hub" {
+		t.Errorf("update states = %q to %q, expected Depot to Hub", before.Name, after.Name)
+	}
+	if store.entries[0].Before != "" || store.entries[2].After != "" {
+		t.Error("creations must have no before state and deletions no after state")
+	}
+}
+
+func TestLocationRecorderFailsUnrecordedChanges(t *testing.T) {
+	store := &memStore{fail: errors.New("database unavailable")}
+	locations := &memLocations{locations: make(map[string]*location.Location)}
+	recorder := NewLocationRecorder(locations, NewAuditService(store))
+
+	if _, err := recorder.CreateLocation(context.Background(), location.CreateLocationRequest{Name: "Depot"}); !errors.Is(err, store.fail) {
+		t.Errorf("CreateLocation() error = %v, expected the audit failure", err)
+	}
+	if len(locations.locations) != 0 {
+		t.Error("the location was created without its audit entry")
+	}
+}
+
+func TestOccurredAtSurvivesRoundTrip(t *testing.T) {
+	entry := Entry{Action: events.LocationCreated, OccurredAt: time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)}
+	entry.Seal("")
+	entry.OccurredAt = entry.OccurredAt.In(time.FixedZone("CET", 3600))
+	if entry.Digest() != entry.Hash {
+		t.Error("the hash depends on the time zone the time was read in")
+	}
+}
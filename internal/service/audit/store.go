@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// AuditStore defines the interface for audit data access. Entries can only be appended.
+type AuditStore interface {
+	Append(entry *Entry) error
+	Find(tenant string, query Query) ([]Entry, error)
+	// Within returns the store working inside tx, or the store itself when tx is nil
+	Within(tx *gorm.DB) AuditStore
+}
+
+// AuditRepo provides data access methods for audit entries
+type AuditRepo struct {
+	db *gorm.DB
+}
+
+// NewAuditRepo creates a new audit repository
+func NewAuditRepo(db *gorm.DB) AuditStore {
+	return &AuditRepo{
+		db: db,
+	}
+}
+
+// ImmutableSQL makes the database refuse to change, delete or truncate audit entries.
+// Entries can still be dropped from the end of a chain by whoever owns the table, which
+// only a head hash kept outside the database, such as Verification.Head, reveals.
+var ImmutableSQL = []string{
+	`CREATE OR REPLACE FUNCTION audit_entries_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit entries are immutable';
+END
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_entries_immutable ON audit_entries`,
+	`CREATE TRIGGER audit_entries_immutable BEFORE UPDATE OR DELETE ON audit_entries
+	FOR EACH ROW EXECUTE FUNCTION audit_entries_immutable()`,
+	`DROP TRIGGER IF EXISTS audit_entries_not_truncated ON audit_entries`,
+	`CREATE TRIGGER audit_entries_not_truncated BEFORE TRUNCATE ON audit_entries
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_immutable()`,
+}
+
+// Within returns the repository working inside tx, so entries are committed with the change they record
+func (s *AuditRepo) Within(tx *gorm.DB) AuditStore {
+	if tx == nil {
+		return s
+	}
+	return &AuditRepo{db: tx}
+}
+
+// Append seals the entry onto the end of its tenant's chain and stores it. A transaction-scoped
+// advisory lock per tenant keeps concurrent writers, in this or other instances, from forking the chain;
+// inside an enclosing transaction it is held until that commits.
+func (s *AuditRepo) Append(entry *Entry) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "audit:"+entry.Tenant).Error; err != nil {
+			return err
+		}
+
+		var last Entry
+		err := tx.Where("tenant = ?", entry.Tenant).Order("id DESC").Take(&last).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		entry.Seal(last.Hash)
+		return tx.Create(entry).Error
+	})
+}
+
+// Find retrieves the entries of tenant selected by query, in chain order
+func (s *AuditRepo) Find(tenant string, query Query) ([]Entry, error) {
+	db := s.db.Where("tenant = ? AND id > ?", tenant, query.AfterID)
+	if query.Actor != "" {
+		db = db.Where("actor = ?", query.Actor)
+	}
+	if query.Action != "" {
+		db = db.Where("action = ?", query.Action)
+	}
+	if query.Target != "" {
+		db = db.Where("target_id = ? OR target_name = ?", query.Target, query.Target)
+	}
+	if query.Since != nil {
+		db = db.Where("occurred_at >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		db = db.Where("occurred_at < ?", *query.Until)
+	}
+
+	var entries []Entry
+	err := db.Order("id").Limit(query.Limit).Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,112 @@
+package geofence
+
+import (
+	"math"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// Geofence shapes
+const (
+	KindCircle  = "circle"
+	KindPolygon = "polygon"
+)
+
+// Geofence represents a named area, either a circle around a centre or a polygon.
+// Names are unique within the tenant owning the geofence.
+type Geofence struct {
+	ID           uint             `json:"id" gorm:"primaryKey"`
+	Tenant       string           `json:"tenant" gorm:"not null;default:default;uniqueIndex:idx_geofences_tenant_name,priority:1"`
+	Name         string           `json:"name" gorm:"not null;uniqueIndex:idx_geofences_tenant_name,priority:2"`
+	Kind         string           `json:"kind" gorm:"not null"`
+	Latitude     float64          `json:"latitude,omitempty"`
+	Longitude    float64          `json:"longitude,omitempty"`
+	RadiusMeters float64          `json:"radius_m,omitempty"`
+	Polygon      []location.Point `json:"polygon,omitempty" gorm:"type:jsonb;serializer:json"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// GeofenceRequest represents the request body for creating or updating a geofence.
+// Circles use Latitude, Longitude and RadiusMeters; polygons use Polygon.
+type GeofenceRequest struct {
+	Name         string           `json:"name" binding:"required"`
+	Kind         string           `json:"kind" binding:"required,oneof=circle polygon"`
+	Latitude     float64          `json:"latitude" binding:"min=-90,max=90"`
+	Longitude    float64          `json:"longitude" binding:"min=-180,max=180"`
+	RadiusMeters float64          `json:"radius_m" binding:"min=0"`
+	Polygon      []location.Point `json:"polygon" binding:"dive"`
+}
+
+// kmPerDegree is the length of one degree of latitude in kilometers
+const kmPerDegree = 111.32
+
+// Bounds returns the bounding boxes covering the geofence. A circle that crosses the
+// antimeridian is split into a box on either side of it.
+func (g *Geofence) Bounds() []location.BoundingBox {
+	if g.Kind == KindCircle {
+		dLat := g.RadiusMeters / 1000 / kmPerDegree
+		box := location.BoundingBox{
+			MinLat: math.Max(-90, g.Latitude-dLat),
+			MinLng: -180,
+			MaxLat: math.Min(90, g.Latitude+dLat),
+			MaxLng: 180,
+		}
+
+		// Meridians converge towards the poles, so the circle is widest in longitude at the
+		// latitude it reaches furthest from the equator, and a circle reaching a pole spans them all
+		widest := math.Cos(math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat)) * math.Pi / 180)
+		if box.MinLat <= -90 || box.MaxLat >= 90 || widest <= 1e-6 {
+			return []location.BoundingBox{box}
+		}
+		dLng := dLat / widest
+		box.MinLng, box.MaxLng = g.Longitude-dLng, g.Longitude+dLng
+
+		switch {
+		case box.MaxLng-box.MinLng >= 360:
+			box.MinLng, box.MaxLng = -180, 180
+		case box.MinLng < -180:
+			west := box
+			west.MinLng, west.MaxLng = box.MinLng+360, 180
+			box.MinLng = -180
+			return []location.BoundingBox{west, box}
+		case box.MaxLng > 180:
+			east := box
+			east.MinLng, east.MaxLng = -180, box.MaxLng-360
+			box.MaxLng = 180
+			return []location.BoundingBox{box, east}
+		}
+		return []location.BoundingBox{box}
+	}
+
+	box := location.BoundingBox{MinLat: 90, MinLng: 180, MaxLat: -90, MaxLng: -180}
+	for _, p := range g.Polygon {
+		box.MinLat = math.Min(box.MinLat, p.Latitude)
+		box.MinLng = math.Min(box.MinLng, p.Longitude)
+		box.MaxLat = math.Max(box.MaxLat, p.Latitude)
+		box.MaxLng = math.Max(box.MaxLng, p.Longitude)
+	}
+	return []location.BoundingBox{box}
+}
+
+// Contains reports whether the point lies inside the geofence.
+// Polygons are treated as planar in degrees and must not cross the antimeridian.
+func (g *Geofence) Contains(calculator *location.DistanceCalculator, lat, lng float64) bool {
+	if g.Kind == KindCircle {
+		return calculator.HaversineDistance(g.Latitude, g.Longitude, lat, lng)*1000 <= g.RadiusMeters
+	}
+
+	// Ray casting: count how many edges a ray towards increasing longitude crosses
+	inside := false
+	for i, j := 0, len(g.Polygon)-1; i < len(g.Polygon); j, i = i, i+1 {
+		a, b := g.Polygon[i], g.Polygon[j]
+		if (a.Latitude > lat) != (b.Latitude > lat) {
+			crossing := (b.Longitude-a.Longitude)*(lat-a.Latitude)/(b.Latitude-a.Latitude) + a.Longitude
+			if lng < crossing {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
@@ -0,0 +1,128 @@
+package geofence
+
+import (
+	"math"
+	"sync"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// cellSizeDegrees is the edge length of a grid cell in the spatial index
+const cellSizeDegrees = 1.0
+
+type cell struct {
+	row, col int
+}
+
+// SpatialIndex is a uniform grid over latitude and longitude. Each geofence is
+// registered in every cell its bounding boxes overlap, so a point query only has
+// to run exact containment checks against the geofences sharing its cell.
+type SpatialIndex struct {
+	mu    sync.RWMutex
+	cells map[cell]map[uint]*Geofence
+	byID  map[uint]*Geofence
+}
+
+// NewSpatialIndex creates an empty spatial index
+func NewSpatialIndex() *SpatialIndex {
+	return &SpatialIndex{
+		cells: make(map[cell]map[uint]*Geofence),
+		byID:  make(map[uint]*Geofence),
+	}
+}
+
+// Insert adds or replaces a geofence in the index
+func (idx *SpatialIndex) Insert(g Geofence) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(g.ID)
+
+	stored := &g
+	idx.byID[g.ID] = stored
+	for _, c := range cellsFor(g.Bounds()...) {
+		bucket, ok := idx.cells[c]
+		if !ok {
+			bucket = make(map[uint]*Geofence)
+			idx.cells[c] = bucket
+		}
+		bucket[g.ID] = stored
+	}
+}
+
+// Remove deletes a geofence from the index
+func (idx *SpatialIndex) Remove(id uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+// Candidates returns the geofences whose bounding box cell contains the point
+func (idx *SpatialIndex) Candidates(lat, lng float64) []*Geofence {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	bucket := idx.cells[cellOf(lat, lng)]
+	candidates := make([]*Geofence, 0, len(bucket))
+	for _, g := range bucket {
+		candidates = append(candidates, g)
+	}
+	return candidates
+}
+
+// Len returns the number of indexed geofences
+func (idx *SpatialIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.byID)
+}
+
+func (idx *SpatialIndex) remove(id uint) {
+	existing, ok := idx.byID[id]
+	if !ok {
+		return
+	}
+
+	for _, c := range cellsFor(existing.Bounds()...) {
+		if bucket, ok := idx.cells[c]; ok {
+			delete(bucket, id)
+			if len(bucket) == 0 {
+				delete(idx.cells, c)
+			}
+		}
+	}
+	delete(idx.byID, id)
+}
+
+func cellOf(lat, lng float64) cell {
+	return cell{
+		row: int(math.Floor(lat / cellSizeDegrees)),
+		col: wrapCol(int(math.Floor(lng / cellSizeDegrees))),
+	}
+}
+
+// wrapCol maps a column onto the columns west of the antimeridian, so that
+// longitude 180 shares its cells with longitude -180
+func wrapCol(col int) int {
+	const cols = int(360 / cellSizeDegrees)
+	return ((col+cols/2)%cols+cols)%cols - cols/2
+}
+
+// cellsFor returns every cell overlapped by any of the boxes, each once
+func cellsFor(boxes ...location.BoundingBox) []cell {
+	seen := make(map[cell]bool)
+	var cells []cell
+	for _, box := range boxes {
+		for row := int(math.Floor(box.MinLat / cellSizeDegrees)); row <= int(math.Floor(box.MaxLat/cellSizeDegrees)); row++ {
+			for col := int(math.Floor(box.MinLng / cellSizeDegrees)); col <= int(math.Floor(box.MaxLng/cellSizeDegrees)); col++ {
+				if c := (cell{row: row, col: wrapCol(col)}); !seen[c] {
+					seen[c] = true
+					cells = append(cells, c)
+				}
+			}
+		}
+	}
+	return cells
+}
@@ -0,0 +1,270 @@
+package geofence
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// minPolygonPoints is the smallest number of distinct vertices describing an area
+const minPolygonPoints = 3
+
+// MaxPolygonPoints is the largest number of vertices a polygon may have
+const MaxPolygonPoints = 1000
+
+// MaxRadiusMeters is the largest radius of a circle, which bounds the index cells it is registered in
+const MaxRadiusMeters = 500000
+
+type GeofenceBC interface {
+	CreateGeofence(ctx context.Context, req GeofenceRequest) (*Geofence, error)
+	GetAllGeofences(ctx context.Context) ([]Geofence, error)
+	GetGeofence(ctx context.Context, id uint) (*Geofence, error)
+	UpdateGeofence(ctx context.Context, id uint, req GeofenceRequest) (*Geofence, error)
+	DeleteGeofence(ctx context.Context, id uint) error
+	FindContaining(ctx context.Context, lat, lng float64) ([]Geofence, error)
+}
+
+// GeofenceService handles geofence business logic and keeps a spatial index per tenant in sync.
+// Every method acts on the geofences of the tenant ctx acts for.
+type GeofenceService struct {
+	repo       GeofenceStore
+	Calculator *location.DistanceCalculator
+
+	mu      sync.Mutex
+	indexes map[string]*tenantIndex
+}
+
+// tenantIndex is the spatial index of one tenant, loaded from the store on first use.
+// A failed load is retried by the next call rather than remembered.
+type tenantIndex struct {
+	mu     sync.Mutex
+	loaded bool
+	index  *SpatialIndex
+}
+
+// NewGeofenceService creates a new geofence service
+func NewGeofenceService(repo GeofenceStore, calculator *location.DistanceCalculator) GeofenceBC {
+	return &GeofenceService{
+		repo:       repo,
+		Calculator: calculator,
+		indexes:    make(map[string]*tenantIndex),
+	}
+}
+
+// CreateGeofence validates and stores a new geofence
+func (s *GeofenceService) CreateGeofence(ctx context.Context, req GeofenceRequest) (*Geofence, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	id := tenant.FromContext(ctx)
+	exists, err := s.repo.NameExists(id, req.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, &DuplicateNameError{Name: req.Name}
+	}
+
+	geofence := &Geofence{Tenant: id}
+	applyRequest(geofence, req)
+
+	if err := s.repo.Create(geofence); err != nil {
+		return nil, err
+	}
+
+	s.indexed(id, func(idx *SpatialIndex) { idx.Insert(*geofence) })
+	return geofence, nil
+}
+
+// GetAllGeofences returns all geofences
+func (s *GeofenceService) GetAllGeofences(ctx context.Context) ([]Geofence, error) {
+	return s.repo.GetAll(tenant.FromContext(ctx))
+}
+
+// GetGeofence returns a single geofence
+func (s *GeofenceService) GetGeofence(ctx context.Context, id uint) (*Geofence, error) {
+	return s.repo.GetByID(tenant.FromContext(ctx), id)
+}
+
+// UpdateGeofence replaces the shape and name of an existing geofence
+func (s *GeofenceService) UpdateGeofence(ctx context.Context, id uint, req GeofenceRequest) (*Geofence, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	geofence, err := s.repo.GetByID(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.repo.NameExists(tenantID, req.Name, id)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, &DuplicateNameError{Name: req.Name}
+	}
+
+	applyRequest(geofence, req)
+	if err := s.repo.Update(geofence); err != nil {
+		return nil, err
+	}
+
+	s.indexed(tenantID, func(idx *SpatialIndex) { idx.Insert(*geofence) })
+	return geofence, nil
+}
+
+// DeleteGeofence deletes a geofence by ID
+func (s *GeofenceService) DeleteGeofence(ctx context.Context, id uint) error {
+	tenantID := tenant.FromContext(ctx)
+	// Check if geofence exists
+	if _, err := s.repo.GetByID(tenantID, id); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteByID(tenantID, id); err != nil {
+		return err
+	}
+
+	s.indexed(tenantID, func(idx *SpatialIndex) { idx.Remove(id) })
+	return nil
+}
+
+// FindContaining returns every geofence covering the given point, ordered by name
+func (s *GeofenceService) FindContaining(ctx context.Context, lat, lng float64) ([]Geofence, error) {
+	index, err := s.loadIndex(tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	containing := make([]Geofence, 0)
+	for _, candidate := range index.Candidates(lat, lng) {
+		if candidate.Contains(s.Calculator, lat, lng) {
+			containing = append(containing, *candidate)
+		}
+	}
+
+	sort.Slice(containing, func(i, j int) bool {
+		return containing[i].Name < containing[j].Name
+	})
+
+	return containing, nil
+}
+
+// loadIndex returns the spatial index of a tenant, filling it from the store until a load succeeds
+func (s *GeofenceService) loadIndex(id string) (*SpatialIndex, error) {
+	t := s.indexOf(id)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.loaded {
+		geofences, err := s.repo.GetAll(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range geofences {
+			t.index.Insert(g)
+		}
+		t.loaded = true
+	}
+	return t.index, nil
+}
+
+// indexed applies a change to the spatial index of a tenant. An index that is not loaded
+// yet is left alone: the change is already stored, so loading the index will pick it up.
+func (s *GeofenceService) indexed(id string, apply func(idx *SpatialIndex)) {
+	t := s.indexOf(id)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.loaded {
+		apply(t.index)
+	}
+}
+
+// indexOf returns the index of a tenant, creating it empty and unloaded
+func (s *GeofenceService) indexOf(id string) *tenantIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.indexes[id]
+	if !ok {
+		t = &tenantIndex{index: NewSpatialIndex()}
+		s.indexes[id] = t
+	}
+	return t
+}
+
+func applyRequest(geofence *Geofence, req GeofenceRequest) {
+	geofence.Name = req.Name
+	geofence.Kind = req.Kind
+	geofence.Latitude = 0
+	geofence.Longitude = 0
+	geofence.RadiusMeters = 0
+	geofence.Polygon = nil
+
+	if req.Kind == KindCircle {
+		geofence.Latitude = req.Latitude
+		geofence.Longitude = req.Longitude
+		geofence.RadiusMeters = req.RadiusMeters
+		return
+	}
+
+	// Drop an explicit closing vertex, the ring is always treated as closed
+	polygon := req.Polygon
+	if len(polygon) > minPolygonPoints && polygon[0] == polygon[len(polygon)-1] {
+		polygon = polygon[:len(polygon)-1]
+	}
+	geofence.Polygon = polygon
+}
+
+func validateRequest(req GeofenceRequest) error {
+	switch req.Kind {
+	case KindCircle:
+		if err := location.ValidateCoordinates(req.Latitude, req.Longitude); err != nil {
+			return err
+		}
+		if req.RadiusMeters <= 0 {
+			return &location.ValidationError{Field: "radius_m", Message: "must be greater than 0"}
+		}
+		if req.RadiusMeters > MaxRadiusMeters {
+			return &location.ValidationError{Field: "radius_m", Message: "must not exceed 500000"}
+		}
+	case KindPolygon:
+		if len(req.Polygon) < minPolygonPoints {
+			return &location.ValidationError{Field: "polygon", Message: "must contain at least 3 points"}
+		}
+		if len(req.Polygon) > MaxPolygonPoints {
+			return &location.ValidationError{Field: "polygon", Message: "must not contain more than 1000 points"}
+		}
+		minLng, maxLng := req.Polygon[0].Longitude, req.Polygon[0].Longitude
+		for _, p := range req.Polygon {
+			if err := location.ValidateCoordinates(p.Latitude, p.Longitude); err != nil {
+				return err
+			}
+			minLng, maxLng = math.Min(minLng, p.Longitude), math.Max(maxLng, p.Longitude)
+		}
+		// Containment treats polygons as planar, so one crossing the antimeridian would cover the wrong side
+		if maxLng-minLng > 180 {
+			return &location.ValidationError{Field: "polygon", Message: "must not span more than 180 degrees of longitude, polygons crossing the antimeridian are not supported"}
+		}
+	default:
+		return &location.ValidationError{Field: "kind", Message: "must be circle or polygon"}
+	}
+	return nil
+}
+
+// DuplicateNameError is returned when a geofence name is already taken
+type DuplicateNameError struct {
+	Name string
+}
+
+func (e *DuplicateNameError) Error() string {
+	return "Geofence name already exists: " + e.Name
+}
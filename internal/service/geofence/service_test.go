@@ -0,0 +1,238 @@
+package geofence
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory GeofenceStore used by the service tests
+type memStore struct {
+	nextID    uint
+	geofences map[uint]Geofence
+	// failGetAll fails loading every geofence while it is set
+	failGetAll error
+}
+
+func newMemStore() *memStore {
+	return &memStore{geofences: make(map[uint]Geofence)}
+}
+
+func (m *memStore) Create(g *Geofence) error {
+	m.nextID++
+	g.ID = m.nextID
+	m.geofences[g.ID] = *g
+	return nil
+}
+
+func (m *memStore) GetAll(tenant string) ([]Geofence, error) {
+	if m.failGetAll != nil {
+		return nil, m.failGetAll
+	}
+	all := make([]Geofence, 0, len(m.geofences))
+	for _, g := range m.geofences {
+		if g.Tenant == tenant {
+			all = append(all, g)
+		}
+	}
+	return all, nil
+}
+
+func (m *memStore) GetByID(tenant string, id uint) (*Geofence, error) {
+	g, ok := m.geofences[id]
+	if !ok || g.Tenant != tenant {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &g, nil
+}
+
+func (m *memStore) Update(g *Geofence) error {
+	m.geofences[g.ID] = *g
+	return nil
+}
+
+func (m *memStore) DeleteByID(tenant string, id uint) error {
+	if g, ok := m.geofences[id]; ok && g.Tenant == tenant {
+		delete(m.geofences, id)
+	}
+	return nil
+}
+
+func (m *memStore) NameExists(tenant, name string, excludeID uint) (bool, error) {
+	for id, g := range m.geofences {
+		if g.Tenant == tenant && g.Name == name && id != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func square(name string, minLat, minLng, size float64) GeofenceRequest {
+	return GeofenceRequest{
+		Name: name,
+		Kind: KindPolygon,
+		Polygon: []location.Point{
+			{Latitude: minLat, Longitude: minLng},
+			{Latitude: minLat, Longitude: minLng + size},
+			{Latitude: minLat + size, Longitude: minLng + size},
+			{Latitude: minLat + size, Longitude: minLng},
+		},
+	}
+}
+
+func TestFindContaining(t *testing.T) {
+	service := NewGeofenceService(newMemStore(), &location.DistanceCalculator{})
+	ctx := context.Background()
+
+	requests := []GeofenceRequest{
+		square("Depot", 10, 10, 1),
+		square("Region", 9, 9, 4),
+		{Name: "Yard", Kind: KindCircle, Latitude: 10.5, Longitude: 10.5, RadiusMeters: 1000},
+		{Name: "Dateline", Kind: KindCircle, Latitude: 0, Longitude: 179.99, RadiusMeters: 5000},
+		{Name: "Pole", Kind: KindCircle, Latitude: 89, Longitude: 0, RadiusMeters: 200000},
+	}
+	for _, req := range requests {
+		if _, err := service.CreateGeofence(ctx, req); err != nil {
+			t.Fatalf("CreateGeofence(%s) error = %v", req.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		lat, lng float64
+		expected []string
+	}{
+		{name: "Inside every geofence", lat: 10.5, lng: 10.5, expected: []string{"Depot", "Region", "Yard"}},
+		{name: "Inside the polygons only", lat: 10.9, lng: 10.1, expected: []string{"Depot", "Region"}},
+		{name: "Inside the large region only", lat: 12.5, lng: 12.5, expected: []string{"Region"}},
+		{name: "Outside everything", lat: -10, lng: -10, expected: []string{}},
+		{name: "On the antimeridian", lat: 0, lng: 180, expected: []string{"Dateline"}},
+		{name: "Across the antimeridian", lat: 0, lng: -179.99, expected: []string{"Dateline"}},
+		{name: "Across the pole", lat: 89.5, lng: 180, expected: []string{"Pole"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := service.FindContaining(ctx, tt.lat, tt.lng)
+			if err != nil {
+				t.Fatalf("FindContaining() error = %v", err)
+			}
+			names := make([]string, 0, len(found))
+			for _, g := range found {
+				names = append(names, g.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.expected) {
+				t.Errorf("FindContaining(%v, %v) = %v, expected %v", tt.lat, tt.lng, names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIndexFollowsUpdatesAndDeletes(t *testing.T) {
+	service := NewGeofenceService(newMemStore(), &location.DistanceCalculator{})
+	ctx := context.Background()
+
+	created, err := service.CreateGeofence(ctx, square("Zone", 0, 0, 1))
+	if err != nil {
+		t.Fatalf("CreateGeofence() error = %v", err)
+	}
+
+	if _, err := service.UpdateGeofence(ctx, created.ID, square("Zone", 20, 20, 1)); err != nil {
+		t.Fatalf("UpdateGeofence() error = %v", err)
+	}
+	if found, _ := service.FindContaining(ctx, 0.5, 0.5); len(found) != 0 {
+		t.Errorf("old shape still matched after update: %v", found)
+	}
+	if found, _ := service.FindContaining(ctx, 20.5, 20.5); len(found) != 1 {
+		t.Errorf("new shape not matched after update: %v", found)
+	}
+
+	if err := service.DeleteGeofence(ctx, created.ID); err != nil {
+		t.Fatalf("DeleteGeofence() error = %v", err)
+	}
+	if found, _ := service.FindContaining(ctx, 20.5, 20.5); len(found) != 0 {
+		t.Errorf("deleted geofence still matched: %v", found)
+	}
+}
+
+func TestCreateGeofenceValidation(t *testing.T) {
+	service := NewGeofenceService(newMemStore(), &location.DistanceCalculator{})
+	ctx := context.Background()
+
+	if _, err := service.CreateGeofence(ctx, square("Zone", 0, 0, 1)); err != nil {
+		t.Fatalf("CreateGeofence() error = %v", err)
+	}
+
+	if _, err := service.CreateGeofence(ctx, square("Zone", 5, 5, 1)); err == nil {
+		t.Error("expected a duplicate name error")
+	} else if _, ok := err.(*DuplicateNameError); !ok {
+		t.Errorf("error = %v, expected DuplicateNameError", err)
+	}
+
+	invalid := []GeofenceRequest{
+		{Name: "NoRadius", Kind: KindCircle, Latitude: 1, Longitude: 1},
+		{Name: "Line", Kind: KindPolygon, Polygon: []location.Point{{Latitude: 0, Longitude: 0}, {Latitude: 1, Longitude: 1}}},
+		{Name: "Continent", Kind: KindCircle, Latitude: 1, Longitude: 1, RadiusMeters: MaxRadiusMeters + 1},
+		{Name: "Dateline", Kind: KindPolygon, Polygon: []location.Point{{Latitude: 0, Longitude: 179}, {Latitude: 1, Longitude: -179}, {Latitude: 1, Longitude: 179}}},
+		{Name: "Detailed", Kind: KindPolygon, Polygon: make([]location.Point, MaxPolygonPoints+1)},
+	}
+	for _, req := range invalid {
+		if _, err := service.CreateGeofence(ctx, req); err == nil {
+			t.Errorf("CreateGeofence(%s) expected a validation error", req.Name)
+		}
+	}
+}
+
+func TestGeofencesAreIsolatedPerTenant(t *testing.T) {
+	service := NewGeofenceService(newMemStore(), &location.DistanceCalculator{})
+	ctx := context.Background()
+	acme := tenant.WithTenant(ctx, "acme")
+
+	created, err := service.CreateGeofence(ctx, square("Zone", 0, 0, 1))
+	if err != nil {
+		t.Fatalf("CreateGeofence() error = %v", err)
+	}
+	if _, err := service.CreateGeofence(acme, square("Zone", 0, 0, 1)); err != nil {
+		t.Errorf("CreateGeofence() in another tenant error = %v, expected names to be unique per tenant", err)
+	}
+
+	if found, _ := service.FindContaining(acme, 0.5, 0.5); len(found) != 1 || found[0].Tenant != "acme" {
+		t.Errorf("FindContaining() in acme = %+v, expected only its own geofence", found)
+	}
+	if _, err := service.GetGeofence(acme, created.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("GetGeofence() of another tenant's geofence error = %v, expected not found", err)
+	}
+	if err := service.DeleteGeofence(acme, created.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("DeleteGeofence() of another tenant's geofence error = %v, expected not found", err)
+	}
+	if all, _ := service.GetAllGeofences(ctx); len(all) != 1 {
+		t.Errorf("GetAllGeofences() = %d geofences, expected 1", len(all))
+	}
+}
+
+func TestIndexLoadIsRetriedAfterAFailure(t *testing.T) {
+	store := newMemStore()
+	service := NewGeofenceService(store, &location.DistanceCalculator{})
+	ctx := context.Background()
+
+	store.failGetAll = fmt.Errorf("database unavailable")
+	if _, err := service.FindContaining(ctx, 0.5, 0.5); err == nil {
+		t.Fatal("FindContaining() expected the load error")
+	}
+	if _, err := service.CreateGeofence(ctx, square("Zone", 0, 0, 1)); err != nil {
+		t.Fatalf("CreateGeofence() error = %v", err)
+	}
+
+	store.failGetAll = nil
+	found, err := service.FindContaining(ctx, 0.5, 0.5)
+	if err != nil {
+		t.Fatalf("FindContaining() error = %v, expected the load to be retried", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("FindContaining() = %d geofences, expected the one created while the index was not loaded", len(found))
+	}
+}
@@ -0,0 +1,67 @@
+package geofence
+
+import (
+	"gorm.io/gorm"
+)
+
+// GeofenceStore defines the interface for geofence data access. Queries are scoped
+// to the geofences of one tenant; Create and Update write the tenant of the geofence.
+type GeofenceStore interface {
+	Create(geofence *Geofence) error
+	GetAll(tenant string) ([]Geofence, error)
+	GetByID(tenant string, id uint) (*Geofence, error)
+	Update(geofence *Geofence) error
+	DeleteByID(tenant string, id uint) error
+	NameExists(tenant, name string, excludeID uint) (bool, error)
+}
+
+// GeofenceRepo provides data access methods for geofences
+type GeofenceRepo struct {
+	db *gorm.DB
+}
+
+// NewGeofenceRepo creates a new geofence repository
+func NewGeofenceRepo(db *gorm.DB) GeofenceStore {
+	return &GeofenceRepo{
+		db: db,
+	}
+}
+
+// Create creates a new geofence in the database, in the tenant it names
+func (s *GeofenceRepo) Create(geofence *Geofence) error {
+	return s.db.Create(geofence).Error
+}
+
+// GetAll retrieves all geofences of tenant
+func (s *GeofenceRepo) GetAll(tenant string) ([]Geofence, error) {
+	var geofences []Geofence
+	err := s.db.Where("tenant = ?", tenant).Find(&geofences).Error
+	return geofences, err
+}
+
+// GetByID retrieves a geofence of tenant by ID
+func (s *GeofenceRepo) GetByID(tenant string, id uint) (*Geofence, error) {
+	var geofence Geofence
+	err := s.db.Where("tenant = ?", tenant).First(&geofence, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &geofence, nil
+}
+
+// Update saves every field of an existing geofence, loaded from its tenant
+func (s *GeofenceRepo) Update(geofence *Geofence) error {
+	return s.db.Save(geofence).Error
+}
+
+// DeleteByID deletes a geofence of tenant by ID
+func (s *GeofenceRepo) DeleteByID(tenant string, id uint) error {
+	return s.db.Where("tenant = ?", tenant).Delete(&Geofence{}, id).Error
+}
+
+// NameExists checks if another geofence of tenant has the given name
+func (s *GeofenceRepo) NameExists(tenant, name string, excludeID uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&Geofence{}).Where("tenant = ? AND name = ? AND id <> ?", tenant, name, excludeID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,229 @@
+package location
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusKm is the mean Earth radius used by all great-circle calculations
+const earthRadiusKm = 6371
+
+// BoundingBox is an axis-aligned box in degrees
+type BoundingBox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// Contains reports whether the point lies inside the box, edges included
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// ParseBoundingBox parses a "minLng,minLat,maxLng,maxLat" string, the GeoJSON bbox order
+func ParseBoundingBox(value string) (*BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, &ValidationError{Field: "bbox", Message: "must be minLng,minLat,maxLng,maxLat"}
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, &ValidationError{Field: "bbox", Message: "must contain four numbers"}
+		}
+		coords[i] = n
+	}
+
+	box := &BoundingBox{MinLng: coords[0], MinLat: coords[1], MaxLng: coords[2], MaxLat: coords[3]}
+	if err := box.Validate(); err != nil {
+		return nil, err
+	}
+
+	return box, nil
+}
+
+// Validate checks that both corners are valid coordinates and that the minimums do not exceed the maximums
+func (b BoundingBox) Validate() error {
+	if err := ValidateCoordinates(b.MinLat, b.MinLng); err != nil {
+		return err
+	}
+	if err := ValidateCoordinates(b.MaxLat, b.MaxLng); err != nil {
+		return err
+	}
+	if b.MinLat > b.MaxLat || b.MinLng > b.MaxLng {
+		return &ValidationError{Field: "bbox", Message: "minimums must not exceed maximums"}
+	}
+	return nil
+}
+
+// PointToSegmentDistance returns the great-circle distance in kilometers from a point to the
+// segment between (lat1, lon1) and (lat2, lon2), along with how far along the segment the
+// closest point lies. Points beyond either end of the segment are measured to that end.
+func (dc *DistanceCalculator) PointToSegmentDistance(lat, lon, lat1, lon1, lat2, lon2 float64) (distance, along float64) {
+	segmentLength := dc.HaversineDistance(lat1, lon1, lat2, lon2)
+	toStart := dc.HaversineDistance(lat1, lon1, lat, lon)
+	if segmentLength == 0 {
+		return toStart, 0
+	}
+
+	// Angular distance and bearings from the segment start
+	delta13 := toStart / earthRadiusKm
+	theta13 := initialBearing(lat1, lon1, lat, lon)
+	theta12 := initialBearing(lat1, lon1, lat2, lon2)
+
+	crossTrack := math.Asin(math.Sin(delta13) * math.Sin(theta13-theta12))
+
+	// Clamp to guard against rounding pushing the ratio just outside [-1, 1]
+	ratio := math.Max(-1, math.Min(1, math.Cos(delta13)/math.Cos(crossTrack)))
+	alongTrack := math.Acos(ratio) * earthRadiusKm
+	if math.Cos(theta13-theta12) < 0 {
+		alongTrack = -alongTrack
+	}
+
+	switch {
+	case alongTrack <= 0:
+		return toStart, 0
+	case alongTrack >= segmentLength:
+		return dc.HaversineDistance(lat2, lon2, lat, lon), segmentLength
+	default:
+		return math.Abs(crossTrack) * earthRadiusKm, alongTrack
+	}
+}
+
+// routeBounds returns a box holding every point within corridorKm of the great-circle path. It covers
+// every longitude when the path or its corridor crosses the antimeridian or reaches a pole.
+func routeBounds(path []Point, corridorKm float64) BoundingBox {
+	first := path[0]
+	box := BoundingBox{MinLat: first.Latitude, MinLng: first.Longitude, MaxLat: first.Latitude, MaxLng: first.Longitude}
+	wraps := false
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		south, north := arcLatitudes(a, b)
+		box.MinLat, box.MaxLat = min(box.MinLat, south), max(box.MaxLat, north)
+		box.MinLng, box.MaxLng = min(box.MinLng, b.Longitude), max(box.MaxLng, b.Longitude)
+		if math.Abs(b.Longitude-a.Longitude) >= 180 {
+			wraps = true
+		}
+	}
+
+	dLat := corridorKm / kmPerDegree
+	box.MinLat, box.MaxLat = max(box.MinLat-dLat, -90), min(box.MaxLat+dLat, 90)
+
+	// Meridians converge towards the poles, so the corridor is widest in longitude furthest from the equator
+	widest := math.Cos(max(math.Abs(box.MinLat), math.Abs(box.MaxLat)) * math.Pi / 180)
+	if wraps || box.MinLat <= -90 || box.MaxLat >= 90 || widest <= 1e-6 {
+		box.MinLng, box.MaxLng = -180, 180
+		return box
+	}
+	dLng := dLat / widest
+	box.MinLng, box.MaxLng = box.MinLng-dLng, box.MaxLng+dLng
+	if box.MinLng < -180 || box.MaxLng > 180 {
+		box.MinLng, box.MaxLng = -180, 180
+	}
+	return box
+}
+
+// arcLatitudes returns the southernmost and northernmost latitudes of the great-circle arc
+// between a and b, which bulges towards a pole between its ends
+func arcLatitudes(a, b Point) (south, north float64) {
+	south, north = min(a.Latitude, b.Latitude), max(a.Latitude, b.Latitude)
+	if a == b {
+		return south, north
+	}
+
+	// The arc passes the vertex of its great circle when it heads towards a pole at a
+	// and away from it at b, where the bearing back towards a points to the same pole
+	start := initialBearing(a.Latitude, a.Longitude, b.Latitude, b.Longitude)
+	back := initialBearing(b.Latitude, b.Longitude, a.Latitude, a.Longitude)
+	vertex := math.Acos(math.Min(1, math.Abs(math.Sin(start)*math.Cos(a.Latitude*math.Pi/180)))) * 180 / math.Pi
+	switch {
+	case math.Cos(start) > 0 && math.Cos(back) > 0:
+		north = max(north, vertex)
+	case math.Cos(start) < 0 && math.Cos(back) < 0:
+		south = min(south, -vertex)
+	}
+	return south, north
+}
+
+// initialBearing returns the initial bearing in radians from the first point towards the second
+func initialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	dlon := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(dlon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(dlon)
+
+	return math.Atan2(y, x)
+}
+
+// DecodePolyline decodes a path encoded with the Google encoded polyline algorithm (precision 5)
+func DecodePolyline(encoded string) ([]Point, error) {
+	var points []Point
+	var lat, lng int
+
+	for i := 0; i < len(encoded); {
+		for _, coordinate := range []*int{&lat, &lng} {
+			var result, shift int
+			for {
+				if i >= len(encoded) {
+					return nil, &ValidationError{Field: "polyline", Message: "unexpected end of encoded polyline"}
+				}
+				b := int(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, &ValidationError{Field: "polyline", Message: "invalid character in encoded polyline"}
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				*coordinate += ^(result >> 1)
+			} else {
+				*coordinate += result >> 1
+			}
+		}
+
+		points = append(points, Point{Latitude: float64(lat) / 1e5, Longitude: float64(lng) / 1e5})
+	}
+
+	return points, nil
+}
+
+// geoJSONGeometry covers the subset of GeoJSON accepted for route lines
+type geoJSONGeometry struct {
+	Type        string           `json:"type"`
+	Coordinates [][]float64      `json:"coordinates"`
+	Geometry    *geoJSONGeometry `json:"geometry"`
+}
+
+// ParseGeoJSONLineString parses a GeoJSON LineString geometry, or a Feature wrapping one
+func ParseGeoJSONLineString(raw json.RawMessage) ([]Point, error) {
+	var geometry geoJSONGeometry
+	if err := json.Unmarshal(raw, &geometry); err != nil {
+		return nil, &ValidationError{Field: "line_string", Message: "invalid GeoJSON: " + err.Error()}
+	}
+
+	if geometry.Type == "Feature" && geometry.Geometry != nil {
+		geometry = *geometry.Geometry
+	}
+	if geometry.Type != "LineString" {
+		return nil, &ValidationError{Field: "line_string", Message: "geometry type must be LineString"}
+	}
+
+	points := make([]Point, 0, len(geometry.Coordinates))
+	for _, position := range geometry.Coordinates {
+		if len(position) < 2 {
+			return nil, &ValidationError{Field: "line_string", Message: "every position needs a longitude and a latitude"}
+		}
+		// GeoJSON positions are ordered longitude first
+		points = append(points, Point{Latitude: position[1], Longitude: position[0]})
+	}
+
+	return points, nil
+}
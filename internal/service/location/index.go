@@ -0,0 +1,191 @@
+package location
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// cellSizeDegrees is the edge length of a grid cell in the spatial index
+const cellSizeDegrees = 1.0
+
+// kmPerDegree is the length of a degree of latitude
+const kmPerDegree = 111.2
+
+type cell struct {
+	row, col int
+}
+
+// SpatialIndex is a uniform grid over latitude and longitude holding the locations of one
+// tenant. Radius queries only measure the distance to the locations in the cells overlapping
+// the circle's bounding box instead of scanning every location.
+type SpatialIndex struct {
+	mu    sync.RWMutex
+	cells map[cell]map[uint]*Location
+	byID  map[uint]*Location
+}
+
+// NewSpatialIndex creates an empty spatial index
+func NewSpatialIndex() *SpatialIndex {
+	return &SpatialIndex{
+		cells: make(map[cell]map[uint]*Location),
+		byID:  make(map[uint]*Location),
+	}
+}
+
+// Insert adds or replaces a location in the index
+func (idx *SpatialIndex) Insert(l Location) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(l.ID)
+
+	stored := &l
+	idx.byID[l.ID] = stored
+	c := cellOf(l.Latitude, l.Longitude)
+	bucket, ok := idx.cells[c]
+	if !ok {
+		bucket = make(map[uint]*Location)
+		idx.cells[c] = bucket
+	}
+	bucket[l.ID] = stored
+}
+
+// Remove deletes a location from the index
+func (idx *SpatialIndex) Remove(id uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+// Len returns the number of indexed locations
+func (idx *SpatialIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.byID)
+}
+
+// Within returns every indexed location within radiusKm of the point, nearest first
+func (idx *SpatialIndex) Within(calculator *DistanceCalculator, lat, lng, radiusKm float64) []NearestMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	matches := make([]NearestMatch, 0)
+	collect := func(l *Location) {
+		distance := calculator.HaversineDistance(lat, lng, l.Latitude, l.Longitude)
+		if distance <= radiusKm {
+			matches = append(matches, NearestMatch{Location: *l, DistanceKm: distance})
+		}
+	}
+
+	// Visiting the cells only pays off while there are fewer of them than locations
+	rows, cols := cellsAround(lat, lng, radiusKm)
+	if len(rows)*len(cols) >= len(idx.byID) {
+		for _, l := range idx.byID {
+			collect(l)
+		}
+	} else {
+		for _, row := range rows {
+			for _, col := range cols {
+				for _, l := range idx.cells[cell{row: row, col: col}] {
+					collect(l)
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].DistanceKm != matches[j].DistanceKm {
+			return matches[i].DistanceKm < matches[j].DistanceKm
+		}
+		return matches[i].Location.ID < matches[j].Location.ID
+	})
+	return matches
+}
+
+// Nearest returns the k indexed locations closest to the point, nearest first. The search
+// radius starts at one cell and doubles until enough locations are found.
+func (idx *SpatialIndex) Nearest(calculator *DistanceCalculator, lat, lng float64, k int) []NearestMatch {
+	total := idx.Len()
+	if k > total {
+		k = total
+	}
+
+	// Half the Earth's circumference reaches every point on it
+	const maxRadiusKm = math.Pi * 6371
+	radius := cellSizeDegrees * kmPerDegree
+	for {
+		matches := idx.Within(calculator, lat, lng, radius)
+		if len(matches) >= k || radius >= maxRadiusKm {
+			if len(matches) > k {
+				matches = matches[:k]
+			}
+			return matches
+		}
+		radius *= 2
+	}
+}
+
+func (idx *SpatialIndex) remove(id uint) {
+	existing, ok := idx.byID[id]
+	if !ok {
+		return
+	}
+
+	c := cellOf(existing.Latitude, existing.Longitude)
+	if bucket, ok := idx.cells[c]; ok {
+		delete(bucket, id)
+		if len(bucket) == 0 {
+			delete(idx.cells, c)
+		}
+	}
+	delete(idx.byID, id)
+}
+
+func cellOf(lat, lng float64) cell {
+	return cell{
+		row: int(math.Floor(lat / cellSizeDegrees)),
+		col: wrapCol(int(math.Floor(lng / cellSizeDegrees))),
+	}
+}
+
+// wrapCol maps a column onto the columns west of the antimeridian, so that
+// longitude 180 shares its cells with longitude -180
+func wrapCol(col int) int {
+	const cols = int(360 / cellSizeDegrees)
+	return ((col+cols/2)%cols+cols)%cols - cols/2
+}
+
+// cellsAround returns the rows and columns of the cells overlapping the bounding box of a circle
+func cellsAround(lat, lng, radiusKm float64) (rows, cols []int) {
+	dLat := radiusKm / kmPerDegree
+	minLat, maxLat := math.Max(lat-dLat, -90), math.Min(lat+dLat, 90)
+	for row := int(math.Floor(minLat / cellSizeDegrees)); row <= int(math.Floor(maxLat/cellSizeDegrees)); row++ {
+		rows = append(rows, row)
+	}
+
+	// Near the poles the circle wraps every meridian
+	const allCols = int(360 / cellSizeDegrees)
+	widest := math.Cos(math.Max(math.Abs(minLat), math.Abs(maxLat)) * math.Pi / 180)
+	dLng := 360.0
+	if widest > 0 {
+		dLng = radiusKm / (kmPerDegree * widest)
+	}
+	if maxLat >= 90 || minLat <= -90 || 2*dLng >= 360 {
+		for col := -allCols / 2; col < allCols/2; col++ {
+			cols = append(cols, col)
+		}
+		return rows, cols
+	}
+
+	seen := make(map[int]bool)
+	for col := int(math.Floor((lng - dLng) / cellSizeDegrees)); col <= int(math.Floor((lng+dLng)/cellSizeDegrees)); col++ {
+		if wrapped := wrapCol(col); !seen[wrapped] {
+			seen[wrapped] = true
+			cols = append(cols, wrapped)
+		}
+	}
+	return rows, cols
+}
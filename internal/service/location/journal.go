@@ -0,0 +1,30 @@
+package location
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Journal records changes to locations within the transaction that makes them.
+// An error rolls the change back, so no change is ever committed unrecorded.
+type Journal interface {
+	RecordChange(ctx context.Context, tx *gorm.DB, action string, before, after *Location) error
+}
+
+type journalKey struct{}
+
+// WithJournal returns a copy of ctx whose changes to locations are recorded to journal
+func WithJournal(ctx context.Context, journal Journal) context.Context {
+	return context.WithValue(ctx, journalKey{}, journal)
+}
+
+// RecordChange hands a change to the journal of ctx, if it has one. Stores call it
+// inside the transaction making the change and roll the change back on an error.
+func RecordChange(ctx context.Context, tx *gorm.DB, action string, before, after *Location) error {
+	journal, ok := ctx.Value(journalKey{}).(Journal)
+	if !ok {
+		return nil
+	}
+	return journal.RecordChange(ctx, tx, action, before, after)
+}
@@ -0,0 +1,193 @@
+package location
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Sort orders accepted by ListQuery
+const (
+	SortID        = "id"
+	SortName      = "name"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortDistance  = "distance"
+)
+
+// ListFields maps the field names accepted for sparse fieldsets to their columns
+var ListFields = map[string]string{
+	"id":         "id",
+	"uuid":       "uuid",
+	"name":       "name",
+	"latitude":   "latitude",
+	"longitude":  "longitude",
+	"category":   "category",
+	"radius_m":   "radius_meters",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// ListQuery selects one page of locations
+type ListQuery struct {
+	// Sort is one of the Sort constants; empty sorts by ID
+	Sort string
+	Desc bool
+	// Near is the point distances are measured from; required when sorting by distance
+	Near *Point
+	// After is the cursor returned with the previous page, nil for the first page
+	After *Cursor
+	// Limit defaults to DefaultPageSize
+	Limit int
+	// Fields limits the columns read to these ListFields names; empty reads every column
+	Fields []string
+	// Within limits the listing, and its total, to the locations of any of these grants;
+	// empty lists every location
+	Within []Grant
+	// WithTotal also counts every location the listing covers
+	WithTotal bool
+}
+
+// Grant is a part of the locations a listing may be limited to
+type Grant struct {
+	// Categories limits the grant to locations of these categories; empty matches every category
+	Categories []string
+	// BBox limits the grant to locations inside it; nil matches everywhere
+	BBox *BoundingBox
+}
+
+// Matches reports whether l is one of the locations of the grant
+func (g Grant) Matches(l *Location) bool {
+	if g.BBox != nil && !g.BBox.Contains(l.Latitude, l.Longitude) {
+		return false
+	}
+	if len(g.Categories) == 0 {
+		return true
+	}
+	for _, category := range g.Categories {
+		if category == l.Category {
+			return true
+		}
+	}
+	return false
+}
+
+// LocationPage is one page of a location listing
+type LocationPage struct {
+	Locations []Location
+	// NextCursor is empty on the last page
+	NextCursor string
+	// Total is set when the query asked for it
+	Total *int64
+}
+
+// Cursor marks where the next page starts: the sort key and ID of the last location of the
+// previous page. The sort it was issued for is kept so it cannot be replayed against another order.
+type Cursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  string `json:"k,omitempty"`
+	ID   uint   `json:"id"`
+}
+
+// EncodeCursor returns the opaque form of a cursor
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, &ValidationError{Field: "cursor", Message: "is invalid"}
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, &ValidationError{Field: "cursor", Message: "is invalid"}
+	}
+	return &cursor, nil
+}
+
+// CursorAfter returns the cursor pointing just after l in the sort of query
+func CursorAfter(query ListQuery, l Location) Cursor {
+	cursor := Cursor{Sort: query.Sort, Desc: query.Desc, ID: l.ID}
+	switch query.Sort {
+	case SortName:
+		cursor.Key = l.Name
+	case SortCreatedAt:
+		cursor.Key = l.CreatedAt.Format(time.RFC3339Nano)
+	case SortUpdatedAt:
+		cursor.Key = l.UpdatedAt.Format(time.RFC3339Nano)
+	case SortDistance:
+		cursor.Key = strconv.FormatFloat(l.DistanceKm, 'g', -1, 64)
+	}
+	return cursor
+}
+
+// SortKey returns the typed sort key held by the cursor
+func (c *Cursor) SortKey() (interface{}, error) {
+	switch c.Sort {
+	case SortName:
+		return c.Key, nil
+	case SortCreatedAt, SortUpdatedAt:
+		t, err := time.Parse(time.RFC3339Nano, c.Key)
+		if err != nil {
+			return nil, &ValidationError{Field: "cursor", Message: "is invalid"}
+		}
+		return t, nil
+	case SortDistance:
+		d, err := strconv.ParseFloat(c.Key, 64)
+		if err != nil {
+			return nil, &ValidationError{Field: "cursor", Message: "is invalid"}
+		}
+		return d, nil
+	default:
+		return c.ID, nil
+	}
+}
+
+// validate fills in the defaults of the query and checks it
+func (q *ListQuery) validate() error {
+	if q.Sort == "" {
+		q.Sort = SortID
+	}
+	switch q.Sort {
+	case SortID, SortName, SortCreatedAt, SortUpdatedAt:
+	case SortDistance:
+		if q.Near == nil {
+			return &ValidationError{Field: "sort", Message: "sorting by distance needs a point to measure from"}
+		}
+		if err := ValidateCoordinates(q.Near.Latitude, q.Near.Longitude); err != nil {
+			return err
+		}
+	default:
+		return &ValidationError{Field: "sort", Message: "must be one of id, name, created_at, updated_at or distance"}
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return &ValidationError{Field: "limit", Message: "must be between 1 and 1000"}
+	}
+
+	if q.After != nil {
+		if q.After.Sort != q.Sort || q.After.Desc != q.Desc {
+			return &ValidationError{Field: "cursor", Message: "was issued for a different sort order"}
+		}
+		if _, err := q.After.SortKey(); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range q.Fields {
+		if _, ok := ListFields[field]; !ok {
+			return &ValidationError{Field: "fields", Message: "unknown field " + field}
+		}
+	}
+
+	return nil
+}
@@ -1,25 +1,99 @@
 package location
 
 import (
+	"encoding/json"
 	"math"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// Location represents a geographical location with coordinates
+// Location represents a geographical location with coordinates.
+// UUID is its stable public identifier, which unlike the name never changes.
+// Names are unique within the tenant owning the location.
+// DistanceKm is not stored; it is only filled in by listings sorted by distance.
 type Location struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"unique;not null" binding:"required"`
-	Latitude  float64   `json:"latitude" gorm:"not null" binding:"required,min=-90,max=90"`
-	Longitude float64   `json:"longitude" gorm:"not null" binding:"required,min=-180,max=180"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UUID         uuid.UUID `json:"uuid" gorm:"type:uuid;uniqueIndex"`
+	Tenant       string    `json:"tenant" gorm:"not null;default:default;uniqueIndex:idx_locations_tenant_name,priority:1"`
+	Name         string    `json:"name" gorm:"not null;uniqueIndex:idx_locations_tenant_name,priority:2" binding:"required"`
+	Latitude     float64   `json:"latitude" gorm:"not null" binding:"required,min=-90,max=90"`
+	Longitude    float64   `json:"longitude" gorm:"not null" binding:"required,min=-180,max=180"`
+	Category     string    `json:"category,omitempty" gorm:"index"`
+	RadiusMeters float64   `json:"radius_m,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	DistanceKm   float64   `json:"distance_km,omitempty" gorm:"->;-:migration"`
+	// ChangeID is the ID of the outbox entry recording the last change made through the store.
+	// It is not stored.
+	ChangeID uint64 `json:"-" gorm:"-"`
 }
 
 // CreateLocationRequest represents the request body for creating a location
 type CreateLocationRequest struct {
-	Name      string  `json:"name" binding:"required"`
-	Latitude  float64 `json:"latitude" binding:"required,min=-90,max=90"`
-	Longitude float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Name         string  `json:"name" binding:"required"`
+	Latitude     float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude    float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Category     string  `json:"category"`
+	RadiusMeters float64 `json:"radius_m" binding:"omitempty,min=0"`
+}
+
+// UpdateLocationRequest represents the request body for replacing a location's name and coordinates
+type UpdateLocationRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	Latitude     float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude    float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Category     string  `json:"category"`
+	RadiusMeters float64 `json:"radius_m" binding:"omitempty,min=0"`
+}
+
+// Point represents a bare pair of coordinates that is not a registered location
+type Point struct {
+	Latitude  float64 `json:"latitude" binding:"min=-90,max=90"`
+	Longitude float64 `json:"longitude" binding:"min=-180,max=180"`
+}
+
+// DefaultCorridorKm is the corridor half-width used when a route search does not specify one
+const DefaultCorridorKm = 2
+
+// MaxCorridorKm is the widest corridor accepted by a route search
+const MaxCorridorKm = 50
+
+// DefaultMaxRoutePoints is the longest route a route search accepts when nothing is configured
+const DefaultMaxRoutePoints = 10000
+
+// AlongRouteRequest represents the request body for finding locations along a route.
+// Exactly one of Polyline (Google encoded, precision 5) or LineString (GeoJSON) must be set.
+type AlongRouteRequest struct {
+	Polyline   string          `json:"polyline"`
+	LineString json.RawMessage `json:"line_string"`
+	CorridorKm float64         `json:"corridor_km" binding:"omitempty,gt=0"`
+}
+
+// RouteMatch is a location found within the corridor around a route
+type RouteMatch struct {
+	Location            Location `json:"location"`
+	DistanceFromRouteKm float64  `json:"distance_from_route_km"`
+	AlongRouteKm        float64  `json:"along_route_km"`
+	DetourKm            float64  `json:"detour_km"`
+}
+
+// MaxNearest is the largest number of locations a k-nearest query may return
+const MaxNearest = 50
+
+// DefaultPageSize is the page size used when a list request does not specify one
+const DefaultPageSize = 100
+
+// MaxPageSize is the largest page a list request may ask for
+const MaxPageSize = 1000
+
+// MaxRadiusKm is the widest radius accepted by a radius search
+const MaxRadiusKm = 500
+
+// NearestMatch is a location returned by a k-nearest query
+type NearestMatch struct {
+	Location   Location `json:"location"`
+	DistanceKm float64  `json:"distance_km"`
 }
 
 // DistanceCalculator provides methods for calculating distances between coordinates
@@ -28,8 +102,6 @@ type DistanceCalculator struct{}
 // HaversineDistance calculates the distance between two points using the Haversine formula
 // Returns distance in kilometers
 func (dc *DistanceCalculator) HaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // Earth's radius in kilometers
-
 	// Convert degrees to radians
 	lat1Rad := lat1 * math.Pi / 180
 	lon1Rad := lon1 * math.Pi / 180
@@ -46,7 +118,7 @@ func (dc *DistanceCalculator) HaversineDistance(lat1, lon1, lat2, lon2 float64)
 			math.Sin(dlon/2)*math.Sin(dlon/2)
 
 	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	distance := R * c
+	distance := earthRadiusKm * c
 
 	return distance
 }
@@ -1,28 +1,79 @@
 package location
 
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
 type LocationBC interface {
-	CreateLocation(req CreateLocationRequest) (*Location, error)
-	GetAllLocations() ([]Location, error)
-	FindNearestLocation(lat, lng float64) (*Location, float64, error)
-	DeleteLocationByName(name string) error
+	CreateLocation(ctx context.Context, req CreateLocationRequest) (*Location, error)
+	GetAllLocations(ctx context.Context) ([]Location, error)
+	GetLocation(ctx context.Context, name string) (*Location, error)
+	GetLocationByUUID(ctx context.Context, id uuid.UUID) (*Location, error)
+	ListLocations(ctx context.Context, query ListQuery) (*LocationPage, error)
+	FindNearestLocation(ctx context.Context, lat, lng float64) (*Location, float64, error)
+	FindKNearest(ctx context.Context, lat, lng float64, k int) ([]NearestMatch, error)
+	FindWithinRadius(ctx context.Context, lat, lng, radiusKm float64) ([]NearestMatch, error)
+	FindInBoundingBox(ctx context.Context, box BoundingBox) ([]Location, error)
+	FindAlongRoute(ctx context.Context, req AlongRouteRequest) ([]RouteMatch, error)
+	UpdateLocation(ctx context.Context, name string, req UpdateLocationRequest) (*Location, error)
+	UpdateLocationByUUID(ctx context.Context, id uuid.UUID, req UpdateLocationRequest) (*Location, error)
+	DeleteLocationByName(ctx context.Context, name string) error
+	DeleteLocationByUUID(ctx context.Context, id uuid.UUID) error
 }
 
-// Service handles location-related business logic
+// Service handles location-related business logic and keeps the spatial index in sync
 type LocationService struct {
 	repo       LocationStore
 	Calculator *DistanceCalculator
+	events     events.Publisher
+	options    Options
+
+	// indexMu guards loading the index; a failed load is retried by the next call
+	indexMu     sync.Mutex
+	indexLoaded bool
+	index       *SpatialIndex
+
+	// quota limits the number of stored locations; createMu keeps concurrent creations within it
+	quota    Quota
+	createMu sync.Mutex
 }
 
-// NewLocationService creates a new location service
-func NewLocationService(repo LocationStore, calculator *DistanceCalculator) LocationBC {
+// NewLocationService creates a new location service that reports changes to publisher
+func NewLocationService(repo LocationStore, calculator *DistanceCalculator, publisher events.Publisher) LocationBC {
+	if publisher == nil {
+		publisher = events.Nop{}
+	}
 	return &LocationService{
 		repo:       repo,
 		Calculator: calculator,
+		events:     publisher,
+		options:    DefaultOptions(),
+		index:      NewSpatialIndex(),
 	}
 }
 
 // CreateLocation handles the business logic for creating a location
-func (s *LocationService) CreateLocation(req CreateLocationRequest) (*Location, error) {
+func (s *LocationService) CreateLocation(ctx context.Context, req CreateLocationRequest) (*Location, error) {
+	if s.quota.MaxLocations > 0 {
+		s.createMu.Lock()
+		defer s.createMu.Unlock()
+
+		count, err := s.repo.Count(nil)
+		if err != nil {
+			return nil, err
+		}
+		if count >= int64(s.quota.MaxLocations) {
+			return nil, &QuotaExceededError{Limit: s.quota.MaxLocations}
+		}
+	}
+
 	// Check if name already exists
 	exists, err := s.repo.NameExists(req.Name)
 	if err != nil {
@@ -33,58 +84,309 @@ func (s *LocationService) CreateLocation(req CreateLocationRequest) (*Location,
 	}
 
 	location := &Location{
-		Name:      req.Name,
-		Latitude:  req.Latitude,
-		Longitude: req.Longitude,
+		UUID:         uuid.New(),
+		Name:         req.Name,
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		Category:     req.Category,
+		RadiusMeters: req.RadiusMeters,
 	}
 
-	if err := s.repo.Create(location); err != nil {
+	if err := s.repo.Create(ctx, location); err != nil {
 		return nil, err
 	}
 
+	s.indexed(func(idx *SpatialIndex) { idx.Insert(*location) })
+	s.events.Publish(events.ForTenant(tenant.OrDefault(location.Tenant), events.LocationCreated, location))
 	return location, nil
 }
 
 // GetAllLocations returns all locations
-func (s *LocationService) GetAllLocations() ([]Location, error) {
+func (s *LocationService) GetAllLocations(ctx context.Context) ([]Location, error) {
 	return s.repo.GetAll()
 }
 
-// FindNearestLocation finds the nearest location to given coordinates
-func (s *LocationService) FindNearestLocation(lat, lng float64) (*Location, float64, error) {
-	locations, err := s.repo.GetAll()
+// GetLocation returns the location called name
+func (s *LocationService) GetLocation(ctx context.Context, name string) (*Location, error) {
+	return s.repo.GetByName(name)
+}
+
+// GetLocationByUUID returns the location with the given public UUID
+func (s *LocationService) GetLocationByUUID(ctx context.Context, id uuid.UUID) (*Location, error) {
+	return s.repo.GetByUUID(id)
+}
+
+// ListLocations returns the page of locations selected by query
+func (s *LocationService) ListLocations(ctx context.Context, query ListQuery) (*LocationPage, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	// Read one location more than asked for to learn whether another page follows
+	limit := query.Limit
+	query.Limit++
+	locations, err := s.repo.List(query)
 	if err != nil {
+		return nil, err
+	}
+
+	page := &LocationPage{Locations: locations}
+	if len(locations) > limit {
+		page.Locations = locations[:limit]
+		page.NextCursor = EncodeCursor(CursorAfter(query, page.Locations[limit-1]))
+	}
+
+	if query.WithTotal {
+		total, err := s.repo.Count(query.Within)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+// FindNearestLocation finds the nearest location to given coordinates
+func (s *LocationService) FindNearestLocation(ctx context.Context, lat, lng float64) (*Location, float64, error) {
+	if err := s.loadIndex(); err != nil {
 		return nil, 0, err
 	}
 
-	if len(locations) == 0 {
+	matches := s.index.Nearest(s.Calculator, lat, lng, 1)
+	if len(matches) == 0 {
 		return nil, 0, &NoLocationsError{}
 	}
 
-	// Find the nearest location
-	var nearest *Location
-	var minDistance float64
+	return &matches[0].Location, matches[0].DistanceKm, nil
+}
+
+// FindKNearest returns the k locations closest to the given coordinates, nearest first
+func (s *LocationService) FindKNearest(ctx context.Context, lat, lng float64, k int) ([]NearestMatch, error) {
+	if k < 1 || k > MaxNearest {
+		return nil, &ValidationError{Field: "k", Message: "must be between 1 and 50"}
+	}
+
+	if err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+
+	matches := s.index.Nearest(s.Calculator, lat, lng, k)
+	if len(matches) == 0 {
+		return nil, &NoLocationsError{}
+	}
+	return matches, nil
+}
+
+// FindWithinRadius returns every location within radiusKm of the given coordinates, nearest first
+func (s *LocationService) FindWithinRadius(ctx context.Context, lat, lng, radiusKm float64) ([]NearestMatch, error) {
+	if radiusKm <= 0 || radiusKm > MaxRadiusKm {
+		return nil, &ValidationError{Field: "radius_km", Message: "must be greater than 0 and at most 500"}
+	}
+
+	if err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+
+	return s.index.Within(s.Calculator, lat, lng, radiusKm), nil
+}
+
+// FindInBoundingBox returns every location inside the box
+func (s *LocationService) FindInBoundingBox(ctx context.Context, box BoundingBox) ([]Location, error) {
+	if err := box.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.GetInBoundingBox(box)
+}
+
+// FindAlongRoute finds the locations within a corridor around a route, ordered by their
+// position along it. The detour assumes leaving the route at its closest point and coming back.
+func (s *LocationService) FindAlongRoute(ctx context.Context, req AlongRouteRequest) ([]RouteMatch, error) {
+	path, err := routePath(req, s.options.MaxRoutePoints)
+	if err != nil {
+		return nil, err
+	}
+
+	corridor := req.CorridorKm
+	if corridor == 0 {
+		corridor = DefaultCorridorKm
+	}
+	if corridor > MaxCorridorKm {
+		return nil, &ValidationError{Field: "corridor_km", Message: "must not exceed 50"}
+	}
+
+	locations, err := s.repo.GetInBoundingBox(routeBounds(path, corridor))
+	if err != nil {
+		return nil, err
+	}
+
+	// Cumulative distance at the start of every segment
+	offsets := make([]float64, len(path))
+	for i := 1; i < len(path); i++ {
+		offsets[i] = offsets[i-1] + s.Calculator.HaversineDistance(path[i-1].Latitude, path[i-1].Longitude, path[i].Latitude, path[i].Longitude)
+	}
 
-	for i, location := range locations {
-		distance := s.Calculator.HaversineDistance(lat, lng, location.Latitude, location.Longitude)
-		if i == 0 || distance < minDistance {
-			minDistance = distance
-			nearest = &locations[i]
+	matches := make([]RouteMatch, 0)
+	for _, location := range locations {
+		best := -1.0
+		var along float64
+		for i := 1; i < len(path); i++ {
+			distance, segmentAlong := s.Calculator.PointToSegmentDistance(
+				location.Latitude, location.Longitude,
+				path[i-1].Latitude, path[i-1].Longitude,
+				path[i].Latitude, path[i].Longitude)
+			if best < 0 || distance < best {
+				best = distance
+				along = offsets[i-1] + segmentAlong
+			}
+		}
+
+		if best <= corridor {
+			matches = append(matches, RouteMatch{
+				Location:            location,
+				DistanceFromRouteKm: best,
+				AlongRouteKm:        along,
+				DetourKm:            2 * best,
+			})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].AlongRouteKm < matches[j].AlongRouteKm
+	})
+
+	return matches, nil
+}
+
+// routePath decodes and validates the route carried by an along-route request, which may have
+// at most maxPoints points
+func routePath(req AlongRouteRequest, maxPoints int) ([]Point, error) {
+	hasLineString := len(req.LineString) > 0 && string(req.LineString) != "null"
+	if (req.Polyline == "") == !hasLineString {
+		return nil, &ValidationError{Field: "route", Message: "exactly one of polyline or line_string is required"}
+	}
+
+	var path []Point
+	var err error
+	if hasLineString {
+		path, err = ParseGeoJSONLineString(req.LineString)
+	} else {
+		path, err = DecodePolyline(req.Polyline)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path) < 2 {
+		return nil, &ValidationError{Field: "route", Message: "must contain at least two points"}
+	}
+	if len(path) > maxPoints {
+		return nil, &ValidationError{Field: "route", Message: fmt.Sprintf("must not contain more than %d points", maxPoints)}
+	}
+	for _, point := range path {
+		if err := ValidateCoordinates(point.Latitude, point.Longitude); err != nil {
+			return nil, err
 		}
 	}
 
-	return nearest, minDistance, nil
+	return path, nil
+}
+
+// UpdateLocation replaces the name and coordinates of the location called name
+func (s *LocationService) UpdateLocation(ctx context.Context, name string, req UpdateLocationRequest) (*Location, error) {
+	location, err := s.repo.GetByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.UpdateLocationByUUID(ctx, location.UUID, req)
+}
+
+// UpdateLocationByUUID replaces the name and coordinates of the location with the given public UUID
+func (s *LocationService) UpdateLocationByUUID(ctx context.Context, id uuid.UUID, req UpdateLocationRequest) (*Location, error) {
+	location, err := s.repo.GetByUUID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != location.Name {
+		exists, err := s.repo.NameExists(req.Name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, &DuplicateNameError{Name: req.Name}
+		}
+	}
+
+	location.Name = req.Name
+	location.Latitude = req.Latitude
+	location.Longitude = req.Longitude
+	location.Category = req.Category
+	location.RadiusMeters = req.RadiusMeters
+
+	if err := s.repo.Update(ctx, location); err != nil {
+		return nil, err
+	}
+
+	s.indexed(func(idx *SpatialIndex) { idx.Insert(*location) })
+	s.events.Publish(events.ForTenant(tenant.OrDefault(location.Tenant), events.LocationUpdated, location))
+	return location, nil
 }
 
 // DeleteLocationByName deletes a location by name
-func (s *LocationService) DeleteLocationByName(name string) error {
+func (s *LocationService) DeleteLocationByName(ctx context.Context, name string) error {
+	location, err := s.repo.GetByName(name)
+	if err != nil {
+		return err
+	}
+	return s.DeleteLocationByUUID(ctx, location.UUID)
+}
+
+// DeleteLocationByUUID deletes the location with the given public UUID
+func (s *LocationService) DeleteLocationByUUID(ctx context.Context, id uuid.UUID) error {
 	// Check if location exists
-	_, err := s.repo.GetByName(name)
+	location, err := s.repo.GetByUUID(id)
 	if err != nil {
 		return err
 	}
 
-	return s.repo.DeleteByName(name)
+	if err := s.repo.Delete(ctx, location); err != nil {
+		return err
+	}
+
+	s.indexed(func(idx *SpatialIndex) { idx.Remove(location.ID) })
+	s.events.Publish(events.ForTenant(tenant.OrDefault(location.Tenant), events.LocationDeleted, location))
+	return nil
+}
+
+// loadIndex fills the spatial index from the store until a load succeeds
+func (s *LocationService) loadIndex() error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.indexLoaded {
+		return nil
+	}
+	locations, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, l := range locations {
+		s.index.Insert(l)
+	}
+	s.indexLoaded = true
+	return nil
+}
+
+// indexed applies a change to the spatial index. An index that is not loaded yet is left
+// alone: the change is already stored, so loading the index will pick it up.
+func (s *LocationService) indexed(apply func(idx *SpatialIndex)) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if s.indexLoaded {
+		apply(s.index)
+	}
 }
 
 // Custom error types for better error handling
@@ -96,6 +398,15 @@ func (e *DuplicateNameError) Error() string {
 	return "Location name already exists: " + e.Name
 }
 
+// QuotaExceededError is returned when a tenant already stores as many locations as its quota allows
+type QuotaExceededError struct {
+	Limit int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("Location quota exceeded: the tenant may store at most %d locations", e.Limit)
+}
+
 type NoLocationsError struct{}
 
 func (e *NoLocationsError) Error() string {
@@ -1,8 +1,16 @@
 package location
 
 import (
+	"context"
+	"errors"
 	"math"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
 )
 
 func TestHaversineDistance(t *testing.T) {
@@ -129,3 +137,452 @@ func TestValidateCoordinates(t *testing.T) {
 		})
 	}
 }
+
+// memStore is an in-memory LocationStore used by the service tests
+type memStore struct {
+	LocationStore
+	locations []Location
+	// failGetAll fails loading every location while it is set
+	failGetAll error
+}
+
+func (m *memStore) GetAll() ([]Location, error) {
+	if m.failGetAll != nil {
+		return nil, m.failGetAll
+	}
+	return m.locations, nil
+}
+
+func (m *memStore) GetInBoundingBox(box BoundingBox) ([]Location, error) {
+	var locations []Location
+	for _, l := range m.locations {
+		if box.Contains(l.Latitude, l.Longitude) {
+			locations = append(locations, l)
+		}
+	}
+	return locations, nil
+}
+
+func TestRouteBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     []Point
+		expected BoundingBox
+	}{
+		{
+			name:     "Widened by the corridor",
+			path:     []Point{{Latitude: 0, Longitude: 0}, {Latitude: 1, Longitude: 1}},
+			expected: BoundingBox{MinLat: -0.018, MinLng: -0.018, MaxLat: 1.018, MaxLng: 1.018},
+		},
+		{
+			name:     "Great circle bulging north",
+			path:     []Point{{Latitude: 60, Longitude: -60}, {Latitude: 60, Longitude: 60}},
+			expected: BoundingBox{MinLat: 59.98, MinLng: -60.06, MaxLat: 73.92, MaxLng: 60.06},
+		},
+		{
+			name:     "Across the antimeridian",
+			path:     []Point{{Latitude: 0, Longitude: 179.5}, {Latitude: 0, Longitude: -179.5}},
+			expected: BoundingBox{MinLat: -0.018, MinLng: -180, MaxLat: 0.018, MaxLng: 180},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box := routeBounds(tt.path, 2)
+			got := []float64{box.MinLat, box.MinLng, box.MaxLat, box.MaxLng}
+			expected := []float64{tt.expected.MinLat, tt.expected.MinLng, tt.expected.MaxLat, tt.expected.MaxLng}
+			for i := range got {
+				if math.Abs(got[i]-expected[i]) > 0.01 {
+					t.Errorf("routeBounds() = %+v, expected %+v", box, tt.expected)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestPointToSegmentDistance(t *testing.T) {
+	calculator := &DistanceCalculator{}
+
+	tests := []struct {
+		name          string
+		lat, lon      float64
+		expected      float64
+		expectedAlong float64
+	}{
+		{
+			name:          "Point beside the middle of the segment",
+			lat:           0.01,
+			lon:           0.5,
+			expected:      calculator.HaversineDistance(0, 0.5, 0.01, 0.5),
+			expectedAlong: calculator.HaversineDistance(0, 0, 0, 0.5),
+		},
+		{
+			name:          "Point before the start",
+			lat:           0,
+			lon:           -0.5,
+			expected:      calculator.HaversineDistance(0, 0, 0, -0.5),
+			expectedAlong: 0,
+		},
+		{
+			name:          "Point past the end",
+			lat:           0,
+			lon:           1.5,
+			expected:      calculator.HaversineDistance(0, 1, 0, 1.5),
+			expectedAlong: calculator.HaversineDistance(0, 0, 0, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance, along := calculator.PointToSegmentDistance(tt.lat, tt.lon, 0, 0, 0, 1)
+			if math.Abs(distance-tt.expected) > 0.01 {
+				t.Errorf("PointToSegmentDistance() distance = %v, expected %v", distance, tt.expected)
+			}
+			if math.Abs(along-tt.expectedAlong) > 0.01 {
+				t.Errorf("PointToSegmentDistance() along = %v, expected %v", along, tt.expectedAlong)
+			}
+		})
+	}
+}
+
+func TestDecodePolyline(t *testing.T) {
+	points, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	if err != nil {
+		t.Fatalf("DecodePolyline() error = %v", err)
+	}
+
+	expected := []Point{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+	if len(points) != len(expected) {
+		t.Fatalf("DecodePolyline() returned %d points, expected %d", len(points), len(expected))
+	}
+	for i := range expected {
+		if math.Abs(points[i].Latitude-expected[i].Latitude) > 1e-9 || math.Abs(points[i].Longitude-expected[i].Longitude) > 1e-9 {
+			t.Errorf("point %d = %v, expected %v", i, points[i], expected[i])
+		}
+	}
+
+	if _, err := DecodePolyline("_p~iF~ps|"); err == nil {
+		t.Error("DecodePolyline() expected an error for a truncated polyline")
+	}
+}
+
+func TestFindAlongRoute(t *testing.T) {
+	service := NewLocationService(&memStore{locations: []Location{
+		{Name: "Far", Latitude: 1, Longitude: 0.5},
+		{Name: "Late", Latitude: 0.005, Longitude: 0.9},
+		{Name: "Early", Latitude: -0.005, Longitude: 0.1},
+	}}, &DistanceCalculator{}, nil)
+
+	matches, err := service.FindAlongRoute(context.Background(), AlongRouteRequest{
+		LineString: []byte(`{"type":"LineString","coordinates":[[0,0],[0.5,0],[1,0]]}`),
+	})
+	if err != nil {
+		t.Fatalf("FindAlongRoute() error = %v", err)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("FindAlongRoute() returned %d matches, expected 2", len(matches))
+	}
+	if matches[0].Location.Name != "Early" || matches[1].Location.Name != "Late" {
+		t.Errorf("FindAlongRoute() order = %v, %v", matches[0].Location.Name, matches[1].Location.Name)
+	}
+	if math.Abs(matches[0].DetourKm-2*matches[0].DistanceFromRouteKm) > 1e-9 {
+		t.Errorf("detour = %v, expected twice the distance from route", matches[0].DetourKm)
+	}
+
+	if _, err := service.FindAlongRoute(context.Background(), AlongRouteRequest{}); err == nil {
+		t.Error("FindAlongRoute() expected an error without a route")
+	}
+
+	service.(*LocationService).options.MaxRoutePoints = 2
+	_, err = service.FindAlongRoute(context.Background(), AlongRouteRequest{
+		LineString: []byte(`{"type":"LineString","coordinates":[[0,0],[0.5,0],[1,0]]}`),
+	})
+	if validationErr, ok := err.(*ValidationError); !ok || validationErr.Field != "route" {
+		t.Errorf("FindAlongRoute() error = %v, expected a route validation error for too many points", err)
+	}
+}
+
+func TestFindKNearest(t *testing.T) {
+	store := &memStore{locations: []Location{
+		{ID: 1, Name: "Far", Latitude: 0, Longitude: 1},
+		{ID: 2, Name: "Near", Latitude: 0, Longitude: 0.01},
+		{ID: 3, Name: "Middle", Latitude: 0, Longitude: 0.1},
+	}}
+	service := NewLocationService(store, &DistanceCalculator{}, nil)
+
+	matches, err := service.FindKNearest(context.Background(), 0, 0, 2)
+	if err != nil {
+		t.Fatalf("FindKNearest() error = %v", err)
+	}
+	if len(matches) != 2 || matches[0].Location.Name != "Near" || matches[1].Location.Name != "Middle" {
+		t.Errorf("FindKNearest() = %+v, expected Near then Middle", matches)
+	}
+
+	if matches, _ := service.FindKNearest(context.Background(), 0, 0, 10); len(matches) != 3 {
+		t.Errorf("FindKNearest() returned %d matches, expected all 3", len(matches))
+	}
+
+	if _, err := service.FindKNearest(context.Background(), 0, 0, 0); err == nil {
+		t.Error("FindKNearest() with k = 0 should fail")
+	}
+}
+
+// List orders by name or ID in memory, enough to exercise the paging logic of the service
+func (m *memStore) List(query ListQuery) ([]Location, error) {
+	sorted := append([]Location(nil), m.locations...)
+	less := func(a, b Location) bool {
+		if query.Sort == SortName && a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+
+	var page []Location
+	for _, l := range sorted {
+		if query.After != nil && !less(Location{ID: query.After.ID, Name: query.After.Key}, l) {
+			continue
+		}
+		if len(page) < query.Limit {
+			page = append(page, l)
+		}
+	}
+	return page, nil
+}
+
+func (m *memStore) Count(within []Grant) (int64, error) {
+	return int64(len(m.locations)), nil
+}
+
+func TestListLocations(t *testing.T) {
+	store := &memStore{locations: []Location{
+		{ID: 1, Name: "Charlie"},
+		{ID: 2, Name: "Alpha"},
+		{ID: 3, Name: "Bravo"},
+	}}
+	service := NewLocationService(store, &DistanceCalculator{}, nil)
+
+	var names []string
+	query := ListQuery{Sort: SortName, Limit: 2, WithTotal: true}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := service.ListLocations(context.Background(), query)
+		if err != nil {
+			t.Fatalf("ListLocations() error = %v", err)
+		}
+		if page.Total == nil || *page.Total != 3 {
+			t.Errorf("Total = %v, expected 3", page.Total)
+		}
+		for _, l := range page.Locations {
+			names = append(names, l.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if query.After, err = DecodeCursor(page.NextCursor); err != nil {
+			t.Fatalf("DecodeCursor() error = %v", err)
+		}
+	}
+	if strings.Join(names, ",") != "Alpha,Bravo,Charlie" {
+		t.Errorf("names = %v, expected Alpha,Bravo,Charlie", names)
+	}
+
+	invalid := []ListQuery{
+		{Sort: "price"},
+		{Sort: SortDistance},
+		{Limit: MaxPageSize + 1},
+		{Fields: []string{"secret"}},
+		{Sort: SortName, After: &Cursor{Sort: SortID, ID: 1}},
+		{Sort: SortCreatedAt, After: &Cursor{Sort: SortCreatedAt, Key: "yesterday"}},
+	}
+	for _, query := range invalid {
+		if _, err := service.ListLocations(context.Background(), query); err == nil {
+			t.Errorf("ListLocations(%+v) should fail", query)
+		}
+	}
+}
+
+func (m *memStore) Create(ctx context.Context, l *Location) error {
+	l.ID = uint(len(m.locations) + 1)
+	m.locations = append(m.locations, *l)
+	return nil
+}
+
+func (m *memStore) GetByName(name string) (*Location, error) {
+	for _, l := range m.locations {
+		if l.Name == name {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) GetByUUID(id uuid.UUID) (*Location, error) {
+	for _, l := range m.locations {
+		if l.UUID == id {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) NameExists(name string) (bool, error) {
+	_, err := m.GetByName(name)
+	return err == nil, nil
+}
+
+func (m *memStore) Update(ctx context.Context, l *Location) error {
+	for i := range m.locations {
+		if m.locations[i].ID == l.ID {
+			m.locations[i] = *l
+		}
+	}
+	return nil
+}
+
+func (m *memStore) Delete(ctx context.Context, deleted *Location) error {
+	for i, l := range m.locations {
+		if l.UUID == deleted.UUID {
+			m.locations = append(m.locations[:i], m.locations[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func TestLocationUUID(t *testing.T) {
+	store := &memStore{}
+	service := NewLocationService(store, &DistanceCalculator{}, nil)
+
+	created, err := service.CreateLocation(context.Background(), CreateLocationRequest{Name: "Depot/North", Latitude: 1, Longitude: 2})
+	if err != nil {
+		t.Fatalf("CreateLocation() error = %v", err)
+	}
+	if created.UUID == uuid.Nil {
+		t.Fatal("CreateLocation() did not assign a UUID")
+	}
+
+	// A rename keeps the UUID, and the location stays reachable through it
+	renamed, err := service.UpdateLocation(context.Background(), "Depot/North", UpdateLocationRequest{Name: "Depot/South", Latitude: 1, Longitude: 2})
+	if err != nil {
+		t.Fatalf("UpdateLocation() error = %v", err)
+	}
+	if renamed.UUID != created.UUID {
+		t.Errorf("UpdateLocation() changed the UUID from %v to %v", created.UUID, renamed.UUID)
+	}
+	found, err := service.GetLocationByUUID(context.Background(), created.UUID)
+	if err != nil || found.Name != "Depot/South" {
+		t.Fatalf("GetLocationByUUID() = %v, %v, expected Depot/South", found, err)
+	}
+
+	if _, err := service.UpdateLocationByUUID(context.Background(), uuid.New(), UpdateLocationRequest{Name: "Other"}); err != gorm.ErrRecordNotFound {
+		t.Errorf("UpdateLocationByUUID() of an unknown UUID error = %v, expected not found", err)
+	}
+
+	if err := service.DeleteLocationByName(context.Background(), "Depot/South"); err != nil {
+		t.Fatalf("DeleteLocationByName() error = %v", err)
+	}
+	if err := service.DeleteLocationByUUID(context.Background(), created.UUID); err != gorm.ErrRecordNotFound {
+		t.Errorf("DeleteLocationByUUID() after delete error = %v, expected not found", err)
+	}
+}
+
+func TestIndexLoadIsRetriedAfterAFailure(t *testing.T) {
+	store := &memStore{failGetAll: errors.New("database unavailable")}
+	service := NewLocationService(store, &DistanceCalculator{}, nil)
+	ctx := context.Background()
+
+	if _, _, err := service.FindNearestLocation(ctx, 0, 0); err == nil {
+		t.Fatal("FindNearestLocation() expected the load error")
+	}
+	if _, err := service.CreateLocation(ctx, CreateLocationRequest{Name: "Depot", Latitude: 0, Longitude: 0.01}); err != nil {
+		t.Fatalf("CreateLocation() error = %v", err)
+	}
+
+	store.failGetAll = nil
+	nearest, _, err := service.FindNearestLocation(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("FindNearestLocation() error = %v, expected the load to be retried", err)
+	}
+	if nearest.Name != "Depot" {
+		t.Errorf("FindNearestLocation() = %q, expected the location created while the index was not loaded", nearest.Name)
+	}
+}
+
+func TestSpatialIndex(t *testing.T) {
+	calculator := &DistanceCalculator{}
+	idx := NewSpatialIndex()
+	idx.Insert(Location{ID: 1, Name: "Fiji", Latitude: -17, Longitude: 179.9})
+	idx.Insert(Location{ID: 2, Name: "Samoa", Latitude: -17, Longitude: -179.9})
+	idx.Insert(Location{ID: 3, Name: "Pole", Latitude: 89.9, Longitude: 45})
+	idx.Insert(Location{ID: 4, Name: "Quito", Latitude: 0, Longitude: -78.5})
+	for i := 5; i < 500; i++ {
+		idx.Insert(Location{ID: uint(i), Latitude: 40 + float64(i%10), Longitude: float64(i % 20)})
+	}
+
+	// Circles crossing the antimeridian and the poles find locations on the other side
+	if matches := idx.Within(calculator, -17, 179.95, 50); len(matches) != 2 {
+		t.Errorf("Within() across the antimeridian = %d matches, expected 2", len(matches))
+	}
+	if matches := idx.Within(calculator, 89.9, -135, 50); len(matches) != 1 || matches[0].Location.Name != "Pole" {
+		t.Errorf("Within() across the pole = %v, expected Pole", matches)
+	}
+
+	nearest := idx.Nearest(calculator, -17, -179.5, 2)
+	if len(nearest) != 2 || nearest[0].Location.Name != "Samoa" || nearest[1].Location.Name != "Fiji" {
+		t.Errorf("Nearest() = %v, expected Samoa then Fiji", nearest)
+	}
+	// The search widens until it reaches a location thousands of kilometres away
+	if nearest := idx.Nearest(calculator, 30, -100, 1); len(nearest) != 1 || nearest[0].Location.Name != "Quito" {
+		t.Errorf("Nearest() = %v, expected Quito", nearest)
+	}
+
+	idx.Insert(Location{ID: 4, Name: "Quito", Latitude: 60, Longitude: 60})
+	idx.Remove(2)
+	if matches := idx.Within(calculator, 0, -78.5, 500); len(matches) != 0 {
+		t.Errorf("Within() after moving Quito = %v, expected none", matches)
+	}
+	if idx.Len() != 498 {
+		t.Errorf("Len() = %d, expected 498", idx.Len())
+	}
+}
+
+func TestTenantServices(t *testing.T) {
+	stores := map[string]*memStore{"acme": {}, "globex": {}}
+	services := NewTenantServices(func(id string) LocationStore { return stores[id] }, &DistanceCalculator{}, nil, Quotas{
+		Default: Quota{MaxLocations: 1},
+		Tenants: map[string]Quota{"globex": {MaxLocations: 2}},
+	}, DefaultOptions())
+	acme := tenant.WithTenant(context.Background(), "acme")
+	globex := tenant.WithTenant(context.Background(), "globex")
+
+	// Names are only unique within a tenant
+	for _, ctx := range []context.Context{acme, globex} {
+		if _, err := services.CreateLocation(ctx, CreateLocationRequest{Name: "Depot", Latitude: 1, Longitude: 1}); err != nil {
+			t.Fatalf("CreateLocation() error = %v", err)
+		}
+	}
+
+	// Each tenant's spatial index only holds its own locations
+	if _, err := services.CreateLocation(globex, CreateLocationRequest{Name: "Yard", Latitude: 1.1, Longitude: 1}); err != nil {
+		t.Fatalf("CreateLocation() error = %v", err)
+	}
+	if matches, _ := services.FindWithinRadius(acme, 1, 1, 100); len(matches) != 1 {
+		t.Errorf("FindWithinRadius() for acme = %d matches, expected 1", len(matches))
+	}
+	if matches, _ := services.FindWithinRadius(globex, 1, 1, 100); len(matches) != 2 {
+		t.Errorf("FindWithinRadius() for globex = %d matches, expected 2", len(matches))
+	}
+
+	var quota *QuotaExceededError
+	if _, err := services.CreateLocation(acme, CreateLocationRequest{Name: "Yard", Latitude: 2, Longitude: 2}); !errors.As(err, &quota) || quota.Limit != 1 {
+		t.Errorf("CreateLocation() over the default quota error = %v, expected QuotaExceededError", err)
+	}
+	if _, err := services.CreateLocation(globex, CreateLocationRequest{Name: "Dock", Latitude: 2, Longitude: 2}); !errors.As(err, &quota) || quota.Limit != 2 {
+		t.Errorf("CreateLocation() over the tenant's quota error = %v, expected QuotaExceededError", err)
+	}
+}
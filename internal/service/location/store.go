@@ -1,60 +1,276 @@
 package location
 
 import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// OutboxAggregate names locations in the outbox and the change feed
+const OutboxAggregate = "location"
+
 // LocationStore defines the interface for location data access
 type LocationStore interface {
-	Create(location *Location) error
+	Create(ctx context.Context, location *Location) error
 	GetAll() ([]Location, error)
+	List(query ListQuery) ([]Location, error)
+	Count(within []Grant) (int64, error)
+	GetInBoundingBox(box BoundingBox) ([]Location, error)
+	GetReaching(box BoundingBox, defaultRadiusMeters float64) ([]Location, error)
 	GetByName(name string) (*Location, error)
-	DeleteByName(name string) error
+	GetByNames(names []string) ([]Location, error)
+	GetByUUID(id uuid.UUID) (*Location, error)
+	Update(ctx context.Context, location *Location) error
+	Delete(ctx context.Context, location *Location) error
 	NameExists(name string) (bool, error)
 }
 
-// LocationRepo provides data access methods for locations
+// LocationRepo provides data access methods for the locations of one tenant.
+// Every query is scoped to the tenant, and new locations are created in it.
 type LocationRepo struct {
-	db *gorm.DB
+	db     *gorm.DB
+	tenant string
 }
 
-// NewLocationRepo creates a new location repository
-func NewLocationRepo(db *gorm.DB) LocationStore {
+// NewLocationRepo creates a new location repository for the locations of tenant
+func NewLocationRepo(db *gorm.DB, tenant string) LocationStore {
 	return &LocationRepo{
-		db: db,
+		db:     db,
+		tenant: tenant,
 	}
 }
 
-// Create creates a new location in the database
-func (s *LocationRepo) Create(location *Location) error {
-	return s.db.Create(location).Error
+// scoped starts a query limited to the locations of the tenant
+func (s *LocationRepo) scoped(db *gorm.DB) *gorm.DB {
+	return db.Model(&Location{}).Where("tenant = ?", s.tenant)
+}
+
+// Create creates a new location in the database, recording the change in the outbox
+// and the journal of ctx
+func (s *LocationRepo) Create(ctx context.Context, location *Location) error {
+	location.Tenant = s.tenant
+	return s.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err := tx.Create(location).Error; err != nil {
+			return err
+		}
+		if location.ChangeID, err = outbox.Append(tx, s.tenant, OutboxAggregate, location.ID, events.LocationCreated, location); err != nil {
+			return err
+		}
+		return RecordChange(ctx, tx, events.LocationCreated, nil, location)
+	})
 }
 
 // GetAll retrieves all locations from the database
 func (s *LocationRepo) GetAll() ([]Location, error) {
 	var locations []Location
-	err := s.db.Find(&locations).Error
+	err := s.scoped(s.db).Find(&locations).Error
+	return locations, err
+}
+
+// List retrieves the page of locations selected by a validated query, reading only the requested
+// fields plus those needed to continue from the last location. Pages are keyset paginated on
+// the sort column and ID so that they stay stable while locations are added.
+func (s *LocationRepo) List(query ListQuery) ([]Location, error) {
+	db := within(s.scoped(s.db), query.Within)
+
+	sortExpr := query.Sort
+	var sortArgs []interface{}
+	if query.Sort == SortDistance {
+		sortExpr = haversineSQL
+		sortArgs = []interface{}{query.Near.Latitude, query.Near.Latitude, query.Near.Longitude}
+	}
+
+	columns := []string{"*"}
+	if len(query.Fields) > 0 {
+		columns = []string{"id"}
+		if query.Sort != SortID && query.Sort != SortDistance {
+			columns = append(columns, query.Sort)
+		}
+		for _, field := range query.Fields {
+			if column := ListFields[field]; column != "id" && column != query.Sort {
+				columns = append(columns, column)
+			}
+		}
+	}
+	if query.Sort == SortDistance {
+		columns = append(columns, sortExpr+" AS distance_km")
+	}
+	db = db.Select(strings.Join(columns, ", "), sortArgs...)
+
+	direction, comparison := "ASC", ">"
+	if query.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.After != nil {
+		key, _ := query.After.SortKey()
+		if query.Sort == SortID {
+			db = db.Where("id "+comparison+" ?", query.After.ID)
+		} else {
+			args := append(append([]interface{}{}, sortArgs...), key, query.After.ID)
+			db = db.Where("("+sortExpr+", id) "+comparison+" (?, ?)", args...)
+		}
+	}
+
+	order := "id " + direction
+	if query.Sort == SortDistance {
+		order = "distance_km " + direction + ", " + order
+	} else if query.Sort != SortID {
+		order = query.Sort + " " + direction + ", " + order
+	}
+
+	var locations []Location
+	err := db.Order(order).Limit(query.Limit).Find(&locations).Error
+	return locations, err
+}
+
+// haversineSQL is the haversine great-circle distance in kilometers from the point given by its
+// three arguments (latitude, latitude, longitude)
+const haversineSQL = "(6371 * 2 * ASIN(SQRT(POWER(SIN(RADIANS(latitude - ?) / 2), 2) + " +
+	"COS(RADIANS(?)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - ?) / 2), 2))))"
+
+// Count returns the number of locations of any of the grants, or of every location without grants
+func (s *LocationRepo) Count(grants []Grant) (int64, error) {
+	var count int64
+	err := within(s.scoped(s.db), grants).Count(&count).Error
+	return count, err
+}
+
+// within limits a query to the locations of any of the grants; without grants it is left alone
+func within(db *gorm.DB, grants []Grant) *gorm.DB {
+	if len(grants) == 0 {
+		return db
+	}
+
+	conditions := make([]string, 0, len(grants))
+	var args []interface{}
+	for _, grant := range grants {
+		parts := []string{"TRUE"}
+		if len(grant.Categories) > 0 {
+			parts = append(parts, "category IN ?")
+			args = append(args, grant.Categories)
+		}
+		if box := grant.BBox; box != nil {
+			parts = append(parts, "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?")
+			args = append(args, box.MinLat, box.MaxLat, box.MinLng, box.MaxLng)
+		}
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+	return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// GetInBoundingBox retrieves every location inside the box, edges included
+func (s *LocationRepo) GetInBoundingBox(box BoundingBox) ([]Location, error) {
+	var locations []Location
+	err := s.scoped(s.db).Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", box.MinLat, box.MaxLat, box.MinLng, box.MaxLng).
+		Order("id").Find(&locations).Error
+	return locations, err
+}
+
+// metersPerDegree is a little under the length of a degree of latitude, so reach in degrees is never underestimated
+const metersPerDegree = 111000
+
+// GetReaching retrieves every location whose radius, or defaultRadiusMeters when it has none, may reach
+// into the box. A few locations just out of reach may be returned too, but none in reach is missed.
+func (s *LocationRepo) GetReaching(box BoundingBox, defaultRadiusMeters float64) ([]Location, error) {
+	// reach is the radius in degrees of latitude; spread is the same distance in degrees of longitude
+	// at the latitude furthest from the equator the location reaches, and grows without bound at the poles
+	reach := "((CASE WHEN radius_meters > 0 THEN radius_meters ELSE @radius END) / @perDegree)"
+	spread := "(" + reach + " / GREATEST(COS(RADIANS(LEAST(ABS(latitude) + " + reach + ", 90))), 0.01))"
+	// Locations across the antimeridian from the box are compared as if it did not wrap
+	between := " BETWEEN @minLng - " + spread + " AND @maxLng + " + spread
+	condition := "latitude BETWEEN @minLat - " + reach + " AND @maxLat + " + reach +
+		" AND (longitude" + between + " OR longitude - 360" + between + " OR longitude + 360" + between + ")"
+
+	var locations []Location
+	err := s.scoped(s.db).Where(condition, map[string]interface{}{
+		"radius":    defaultRadiusMeters,
+		"perDegree": metersPerDegree,
+		"minLat":    box.MinLat,
+		"maxLat":    box.MaxLat,
+		"minLng":    box.MinLng,
+		"maxLng":    box.MaxLng,
+	}).Order("id").Find(&locations).Error
 	return locations, err
 }
 
 // GetByName retrieves a location by name
 func (s *LocationRepo) GetByName(name string) (*Location, error) {
 	var location Location
-	err := s.db.Where("name = ?", name).First(&location).Error
+	err := s.scoped(s.db).Where("name = ?", name).First(&location).Error
 	if err != nil {
 		return nil, err
 	}
 	return &location, nil
 }
 
-// DeleteByName deletes a location by name
-func (s *LocationRepo) DeleteByName(name string) error {
-	return s.db.Where("name = ?", name).Delete(&Location{}).Error
+// GetByNames retrieves every location whose name is in names
+func (s *LocationRepo) GetByNames(names []string) ([]Location, error) {
+	var locations []Location
+	err := s.scoped(s.db).Where("name IN ?", names).Find(&locations).Error
+	return locations, err
+}
+
+// GetByUUID retrieves a location by its public UUID
+func (s *LocationRepo) GetByUUID(id uuid.UUID) (*Location, error) {
+	var location Location
+	err := s.scoped(s.db).Where("uuid = ?", id).First(&location).Error
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// Update saves every field of an existing location, recording the change in the outbox
+// and the journal of ctx. The stored location is locked while it changes, so the journal
+// sees the state it replaces.
+func (s *LocationRepo) Update(ctx context.Context, location *Location) error {
+	return s.db.Transaction(func(tx *gorm.DB) (err error) {
+		var before Location
+		if err := s.scoped(tx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", location.ID).First(&before).Error; err != nil {
+			return err
+		}
+		location.Tenant = s.tenant
+		if err := tx.Save(location).Error; err != nil {
+			return err
+		}
+		if location.ChangeID, err = outbox.Append(tx, s.tenant, OutboxAggregate, location.ID, events.LocationUpdated, location); err != nil {
+			return err
+		}
+		return RecordChange(ctx, tx, events.LocationUpdated, &before, location)
+	})
+}
+
+// Delete deletes the location with the public UUID of location, recording the change in the
+// outbox and the journal of ctx. location is refreshed with the state that was deleted.
+func (s *LocationRepo) Delete(ctx context.Context, location *Location) error {
+	return s.db.Transaction(func(tx *gorm.DB) (err error) {
+		var deleted Location
+		if err := s.scoped(tx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", location.UUID).First(&deleted).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&deleted).Error; err != nil {
+			return err
+		}
+		if deleted.ChangeID, err = outbox.Append(tx, s.tenant, OutboxAggregate, deleted.ID, events.LocationDeleted, deleted); err != nil {
+			return err
+		}
+		if err := RecordChange(ctx, tx, events.LocationDeleted, &deleted, nil); err != nil {
+			return err
+		}
+		*location = deleted
+		return nil
+	})
 }
 
 // NameExists checks if a location with the given name exists
 func (s *LocationRepo) NameExists(name string) (bool, error) {
 	var count int64
-	err := s.db.Model(&Location{}).Where("name = ?", name).Count(&count).Error
+	err := s.scoped(s.db).Where("name = ?", name).Count(&count).Error
 	return count > 0, err
 }
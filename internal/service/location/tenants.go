@@ -0,0 +1,158 @@
+package location
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// StoreFactory returns the store holding the locations of a tenant
+type StoreFactory func(tenant string) LocationStore
+
+// Quota limits what a tenant may store. Zero values are unlimited.
+type Quota struct {
+	MaxLocations int
+}
+
+// Options configures the searches of a LocationService
+type Options struct {
+	// MaxRoutePoints is the number of points a route search accepts; longer routes are rejected
+	MaxRoutePoints int
+}
+
+// DefaultOptions returns the options used when nothing is configured
+func DefaultOptions() Options {
+	return Options{
+		MaxRoutePoints: DefaultMaxRoutePoints,
+	}
+}
+
+// Quotas holds the quota of every tenant, falling back to Default for tenants without their own
+type Quotas struct {
+	Default Quota
+	Tenants map[string]Quota
+}
+
+// For returns the quota of a tenant
+func (q Quotas) For(id string) Quota {
+	if quota, ok := q.Tenants[id]; ok {
+		return quota
+	}
+	return q.Default
+}
+
+// TenantServices serves every tenant from its own LocationService, each with its own
+// store scope, spatial index and quota. Requests are dispatched by the tenant in their
+// context, and a tenant's service is created on its first request.
+type TenantServices struct {
+	stores     StoreFactory
+	calculator *DistanceCalculator
+	events     events.Publisher
+	quotas     Quotas
+	options    Options
+
+	mu       sync.Mutex
+	services map[string]*LocationService
+}
+
+// NewTenantServices creates a location service that isolates the locations of each tenant
+func NewTenantServices(stores StoreFactory, calculator *DistanceCalculator, publisher events.Publisher, quotas Quotas, options Options) *TenantServices {
+	return &TenantServices{
+		stores:     stores,
+		calculator: calculator,
+		events:     publisher,
+		quotas:     quotas,
+		options:    options,
+		services:   make(map[string]*LocationService),
+	}
+}
+
+// For returns the service of the tenant ctx acts for
+func (t *TenantServices) For(ctx context.Context) LocationBC {
+	id := tenant.FromContext(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	service, ok := t.services[id]
+	if !ok {
+		service = NewLocationService(t.stores(id), t.calculator, t.events).(*LocationService)
+		service.quota = t.quotas.For(id)
+		service.options = t.options
+		t.services[id] = service
+	}
+	return service
+}
+
+// CreateLocation creates a location for the tenant ctx acts for
+func (t *TenantServices) CreateLocation(ctx context.Context, req CreateLocationRequest) (*Location, error) {
+	return t.For(ctx).CreateLocation(ctx, req)
+}
+
+// GetAllLocations returns all locations of the tenant
+func (t *TenantServices) GetAllLocations(ctx context.Context) ([]Location, error) {
+	return t.For(ctx).GetAllLocations(ctx)
+}
+
+// GetLocation returns the tenant's location called name
+func (t *TenantServices) GetLocation(ctx context.Context, name string) (*Location, error) {
+	return t.For(ctx).GetLocation(ctx, name)
+}
+
+// GetLocationByUUID returns the tenant's location with the given public UUID
+func (t *TenantServices) GetLocationByUUID(ctx context.Context, id uuid.UUID) (*Location, error) {
+	return t.For(ctx).GetLocationByUUID(ctx, id)
+}
+
+// ListLocations returns the page of the tenant's locations selected by query
+func (t *TenantServices) ListLocations(ctx context.Context, query ListQuery) (*LocationPage, error) {
+	return t.For(ctx).ListLocations(ctx, query)
+}
+
+// FindNearestLocation finds the tenant's location nearest to the given coordinates
+func (t *TenantServices) FindNearestLocation(ctx context.Context, lat, lng float64) (*Location, float64, error) {
+	return t.For(ctx).FindNearestLocation(ctx, lat, lng)
+}
+
+// FindKNearest returns the k locations of the tenant closest to the given coordinates
+func (t *TenantServices) FindKNearest(ctx context.Context, lat, lng float64, k int) ([]NearestMatch, error) {
+	return t.For(ctx).FindKNearest(ctx, lat, lng, k)
+}
+
+// FindWithinRadius returns the tenant's locations within radiusKm of the given coordinates
+func (t *TenantServices) FindWithinRadius(ctx context.Context, lat, lng, radiusKm float64) ([]NearestMatch, error) {
+	return t.For(ctx).FindWithinRadius(ctx, lat, lng, radiusKm)
+}
+
+// FindInBoundingBox returns the tenant's locations inside the box
+func (t *TenantServices) FindInBoundingBox(ctx context.Context, box BoundingBox) ([]Location, error) {
+	return t.For(ctx).FindInBoundingBox(ctx, box)
+}
+
+// FindAlongRoute finds the tenant's locations within a corridor around a route
+func (t *TenantServices) FindAlongRoute(ctx context.Context, req AlongRouteRequest) ([]RouteMatch, error) {
+	return t.For(ctx).FindAlongRoute(ctx, req)
+}
+
+// UpdateLocation replaces the tenant's location called name
+func (t *TenantServices) UpdateLocation(ctx context.Context, name string, req UpdateLocationRequest) (*Location, error) {
+	return t.For(ctx).UpdateLocation(ctx, name, req)
+}
+
+// UpdateLocationByUUID replaces the tenant's location with the given public UUID
+func (t *TenantServices) UpdateLocationByUUID(ctx context.Context, id uuid.UUID, req UpdateLocationRequest) (*Location, error) {
+	return t.For(ctx).UpdateLocationByUUID(ctx, id, req)
+}
+
+// DeleteLocationByName deletes the tenant's location called name
+func (t *TenantServices) DeleteLocationByName(ctx context.Context, name string) error {
+	return t.For(ctx).DeleteLocationByName(ctx, name)
+}
+
+// DeleteLocationByUUID deletes the tenant's location with the given public UUID
+func (t *TenantServices) DeleteLocationByUUID(ctx context.Context, id uuid.UUID) error {
+	return t.For(ctx).DeleteLocationByUUID(ctx, id)
+}
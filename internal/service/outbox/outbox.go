@@ -0,0 +1,173 @@
+package outbox
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Prefixes versioning the opaque cursor formats. v1 cursors hold an ID, v2 cursors a Position.
+const (
+	cursorPrefix   = "v1:"
+	positionPrefix = "v2:"
+)
+
+// Entry is a change recorded in the same transaction as the write that caused it.
+// The change feed is ordered by TxID, then ID: IDs are drawn when entries are written
+// but become visible when their transaction commits, possibly after higher IDs, so
+// the feed only serves entries of transactions older than every one still running.
+type Entry struct {
+	ID uint64 `json:"-" gorm:"primaryKey"`
+	// TxID is the ID of the transaction that wrote the entry, filled in by the database
+	TxID        uint64     `json:"-" gorm:"column:tx_id;->;-:migration"`
+	Tenant      string     `json:"tenant" gorm:"not null;default:default;index"`
+	Aggregate   string     `json:"aggregate" gorm:"not null"`
+	AggregateID uint       `json:"aggregate_id" gorm:"not null"`
+	EventType   string     `json:"type" gorm:"not null"`
+	Payload     string     `json:"-" gorm:"type:jsonb;not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `json:"-" gorm:"index"`
+}
+
+// TableName keeps the table name independent of the package name
+func (Entry) TableName() string {
+	return "outbox_entries"
+}
+
+// Change is an outbox entry as exposed by the change feed
+type Change struct {
+	Cursor      string          `json:"cursor"`
+	Tenant      string          `json:"tenant"`
+	Aggregate   string          `json:"aggregate"`
+	AggregateID uint            `json:"aggregate_id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ChangePage is one response of the change feed
+type ChangePage struct {
+	Changes    []Change `json:"changes"`
+	NextCursor string   `json:"next_cursor"`
+}
+
+// FeedSQL adds the transaction ID ordering the change feed, which AutoMigrate cannot express
+var FeedSQL = []string{
+	`ALTER TABLE outbox_entries ADD COLUMN IF NOT EXISTS tx_id bigint NOT NULL DEFAULT (pg_current_xact_id()::text::bigint)`,
+	`CREATE INDEX IF NOT EXISTS idx_outbox_entries_feed ON outbox_entries (tenant, tx_id, id)`,
+	`CREATE INDEX IF NOT EXISTS idx_outbox_entries_created_at ON outbox_entries (created_at)`,
+}
+
+// Position is the place of an entry in the change feed
+type Position struct {
+	TxID uint64
+	ID   uint64
+}
+
+// Legacy reports whether the position came from a v1 cursor, which only holds an ID
+func (p Position) Legacy() bool {
+	return p.TxID == 0 && p.ID > 0
+}
+
+// position returns the place of the entry in the change feed
+func (e Entry) position() Position {
+	return Position{TxID: e.TxID, ID: e.ID}
+}
+
+// Append writes an outbox entry of tenant using tx, which should be the transaction of the change itself,
+// and returns the ID of the entry
+func Append(tx *gorm.DB, tenant, aggregate string, aggregateID uint, eventType string, payload interface{}) (uint64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	entry := &Entry{
+		Tenant:      tenant,
+		Aggregate:   aggregate,
+		AggregateID: aggregateID,
+		EventType:   eventType,
+		Payload:     string(data),
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return 0, err
+	}
+	return entry.ID, nil
+}
+
+// EncodePosition returns the opaque change feed cursor pointing just after position
+func EncodePosition(position Position) string {
+	raw := positionPrefix + strconv.FormatUint(position.TxID, 10) + ":" + strconv.FormatUint(position.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodePosition parses a change feed cursor. An empty cursor starts from the beginning;
+// v1 cursors, issued before the feed was ordered by transaction, are still accepted.
+func DecodePosition(cursor string) (Position, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), positionPrefix) {
+		id, err := DecodeCursor(cursor)
+		return Position{ID: id}, err
+	}
+
+	txID, id, ok := strings.Cut(strings.TrimPrefix(string(raw), positionPrefix), ":")
+	position := Position{}
+	if ok {
+		position.TxID, err = strconv.ParseUint(txID, 10, 64)
+		if err == nil {
+			position.ID, err = strconv.ParseUint(id, 10, 64)
+		}
+	}
+	if !ok || err != nil {
+		return Position{}, &InvalidCursorError{Cursor: cursor}
+	}
+	return position, nil
+}
+
+// EncodeCursor returns the opaque cursor pointing just after the entry with the given ID
+func EncodeCursor(id uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatUint(id, 10)))
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor. An empty cursor starts from the beginning.
+func DecodeCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) {
+		return 0, &InvalidCursorError{Cursor: cursor}
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(string(raw), cursorPrefix), 10, 64)
+	if err != nil {
+		return 0, &InvalidCursorError{Cursor: cursor}
+	}
+	return id, nil
+}
+
+func toChange(entry Entry) Change {
+	return Change{
+		Cursor:      EncodePosition(entry.position()),
+		Tenant:      entry.Tenant,
+		Aggregate:   entry.Aggregate,
+		AggregateID: entry.AggregateID,
+		Type:        entry.EventType,
+		Payload:     json.RawMessage(entry.Payload),
+		CreatedAt:   entry.CreatedAt,
+	}
+}
+
+// InvalidCursorError is returned for cursors that were not produced by the change feed
+type InvalidCursorError struct {
+	Cursor string
+}
+
+func (e *InvalidCursorError) Error() string {
+	return "Invalid cursor: " + e.Cursor
+}
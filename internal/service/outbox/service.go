@@ -0,0 +1,261 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// Change feed limits
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+	MaxWait         = 60 * time.Second
+)
+
+// purgeInterval is how often entries older than the retention are deleted
+const purgeInterval = 10 * time.Minute
+
+// pollInterval bounds how long a long-poll waits between store checks, so changes written
+// by other instances are picked up even though they never signal this one
+const pollInterval = time.Second
+
+// Publisher hands outbox changes to an external system. Changes may be handed over more than
+// once if marking them published fails, so implementations should be idempotent per cursor.
+type Publisher interface {
+	Publish(ctx context.Context, changes []Change) error
+}
+
+type OutboxBC interface {
+	GetChanges(ctx context.Context, since string, limit int, wait time.Duration) (*ChangePage, error)
+}
+
+// OutboxService serves the change feed, relays outbox entries to a Publisher and
+// deletes the entries older than the retention
+type OutboxService struct {
+	repo      OutboxStore
+	publisher Publisher
+	interval  time.Duration
+	retention time.Duration
+
+	mu      sync.Mutex
+	changed chan struct{}
+
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	closeOnce sync.Once
+}
+
+// NewOutboxService creates a new outbox service. When publisher is nil the relay does nothing.
+// Entries are kept for retention, and until they are published; zero keeps them forever.
+func NewOutboxService(repo OutboxStore, publisher Publisher, interval, retention time.Duration) *OutboxService {
+	return &OutboxService{
+		repo:      repo,
+		publisher: publisher,
+		interval:  interval,
+		retention: retention,
+		changed:   make(chan struct{}),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// GetChanges returns the changes of the tenant of ctx after the since cursor. When there are
+// none it waits up to wait for new ones to be committed before returning an empty page.
+func (s *OutboxService) GetChanges(ctx context.Context, since string, limit int, wait time.Duration) (*ChangePage, error) {
+	after, err := DecodePosition(since)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		// Grab the signal channel before querying so a commit in between is not missed
+		changed := s.changedSignal()
+
+		entries, err := s.repo.After(tenant.FromContext(ctx), after, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := time.Until(deadline)
+		if len(entries) > 0 || remaining <= 0 {
+			return newPage(entries, after), nil
+		}
+
+		timer := time.NewTimer(minDuration(remaining, pollInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return newPage(nil, after), nil
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Publish wakes every long-poll waiting on the change feed. The entry itself was already
+// written by the repository, so the event content is not needed.
+func (s *OutboxService) Publish(events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Start runs the relay and the purge in the background until Stop is called
+func (s *OutboxService) Start() {
+	if s.publisher == nil && s.retention <= 0 {
+		return
+	}
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Stop signals the relay to finish its current batch, waits for it to exit and
+// closes the publisher when it holds resources, as the file sink does
+func (s *OutboxService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.startOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.done
+
+	if closer, ok := s.publisher.(io.Closer); ok {
+		s.closeOnce.Do(func() {
+			if err := closer.Close(); err != nil {
+				log.WithError(err).Error("Failed to close the outbox publisher")
+			}
+		})
+	}
+}
+
+func (s *OutboxService) run() {
+	defer close(s.done)
+
+	var relay, purge <-chan time.Time
+	if s.publisher != nil {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		relay = ticker.C
+	}
+	if s.retention > 0 {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		purge = ticker.C
+		s.purge()
+	}
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-purge:
+			s.purge()
+			continue
+		case <-relay:
+		}
+
+		for s.relay() == DefaultPageSize {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// relay hands one batch of unpublished entries to the publisher and returns its size
+func (s *OutboxService) relay() int {
+	entries, err := s.repo.Unpublished(DefaultPageSize)
+	if err != nil {
+		log.WithError(err).Error("Failed to load unpublished outbox entries")
+		return 0
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+
+	changes := make([]Change, 0, len(entries))
+	ids := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		changes = append(changes, toChange(entry))
+		ids = append(ids, entry.ID)
+	}
+
+	if err := s.publisher.Publish(context.Background(), changes); err != nil {
+		log.WithError(err).Error("Failed to publish outbox entries")
+		return 0
+	}
+
+	if err := s.repo.MarkPublished(ids, time.Now().UTC()); err != nil {
+		log.WithError(err).Error("Failed to mark outbox entries published")
+		return 0
+	}
+
+	return len(entries)
+}
+
+// purge deletes the entries older than the retention. While a publisher is configured,
+// entries it has not been handed yet are kept.
+func (s *OutboxService) purge() {
+	deleted, err := s.repo.Purge(time.Now().Add(-s.retention), s.publisher != nil)
+	if err != nil {
+		log.WithError(err).Error("Failed to purge outbox entries")
+		return
+	}
+	if deleted > 0 {
+		log.WithField("deleted", deleted).Info("Purged outbox entries past their retention")
+	}
+}
+
+func (s *OutboxService) changedSignal() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.changed
+}
+
+func newPage(entries []Entry, after Position) *ChangePage {
+	page := &ChangePage{
+		Changes:    make([]Change, 0, len(entries)),
+		NextCursor: EncodePosition(after),
+	}
+	for _, entry := range entries {
+		page.Changes = append(page.Changes, toChange(entry))
+	}
+	if len(entries) > 0 {
+		page.NextCursor = EncodePosition(entries[len(entries)-1].position())
+	}
+	return page
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,320 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// memStore is an in-memory OutboxStore used by the service tests. Entries are
+// written by transactions numbered from 1, and those of transactions listed in
+// running are not settled yet.
+type memStore struct {
+	mu      sync.Mutex
+	entries []Entry
+	running map[uint64]bool
+}
+
+func (m *memStore) add(eventType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addIn(uint64(len(m.entries)+1), eventType)
+}
+
+// addIn adds an entry written by transaction txID
+func (m *memStore) addIn(txID uint64, eventType string) {
+	m.entries = append(m.entries, Entry{
+		ID:          uint64(len(m.entries) + 1),
+		TxID:        txID,
+		Tenant:      tenant.Default,
+		Aggregate:   "location",
+		AggregateID: 1,
+		EventType:   eventType,
+		Payload:     `{"name":"Depot"}`,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// settled reports whether every transaction up to the entry's has finished
+func (m *memStore) settled(e Entry) bool {
+	for txID := range m.running {
+		if txID <= e.TxID {
+			return false
+		}
+	}
+	return true
+}
+
+// feed returns the settled entries selected by keep, in feed order
+func (m *memStore) feed(keep func(Entry) bool, limit int) []Entry {
+	var found []Entry
+	for _, e := range m.entries {
+		if m.settled(e) && keep(e) {
+			found = append(found, e)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].TxID < found[j].TxID || found[i].TxID == found[j].TxID && found[i].ID < found[j].ID
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+func (m *memStore) After(tenant string, after Position, limit int) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.feed(func(e Entry) bool {
+		return e.Tenant == tenant && (e.TxID > after.TxID || e.TxID == after.TxID && e.ID > after.ID)
+	}, limit), nil
+}
+
+func (m *memStore) Unpublished(limit int) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.feed(func(e Entry) bool { return e.PublishedAt == nil }, limit), nil
+}
+
+func (m *memStore) MarkPublished(ids []uint64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		for i := range m.entries {
+			if m.entries[i].ID == id {
+				m.entries[i].PublishedAt = &at
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memStore) Purge(before time.Time, publishedOnly bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []Entry
+	for _, e := range m.entries {
+		if e.CreatedAt.Before(before) && (!publishedOnly || e.PublishedAt != nil) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	deleted := int64(len(m.entries) - len(kept))
+	m.entries = kept
+	return deleted, nil
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	id, err := DecodeCursor(EncodeCursor(42))
+	if err != nil || id != 42 {
+		t.Errorf("DecodeCursor(EncodeCursor(42)) = %v, %v", id, err)
+	}
+
+	if id, err := DecodeCursor(""); err != nil || id != 0 {
+		t.Errorf("DecodeCursor(\"\") = %v, %v", id, err)
+	}
+
+	for _, invalid := range []string{"not-base64!", "MTIz", EncodeCursor(1) + "x"} {
+		if _, err := DecodeCursor(invalid); err == nil {
+			t.Errorf("DecodeCursor(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestPositionCursor(t *testing.T) {
+	position, err := DecodePosition(EncodePosition(Position{TxID: 7, ID: 42}))
+	if err != nil || position != (Position{TxID: 7, ID: 42}) {
+		t.Errorf("DecodePosition(EncodePosition()) = %+v, %v", position, err)
+	}
+
+	if position, err := DecodePosition(EncodeCursor(42)); err != nil || !position.Legacy() || position.ID != 42 {
+		t.Errorf("DecodePosition(v1 cursor) = %+v, %v, expected a legacy position", position, err)
+	}
+
+	for _, invalid := range []string{"not-base64!", EncodePosition(Position{ID: 1}) + "x"} {
+		if _, err := DecodePosition(invalid); err == nil {
+			t.Errorf("DecodePosition(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestGetChangesWaitsForEarlierTransactions(t *testing.T) {
+	store := &memStore{running: map[uint64]bool{}}
+	service := NewOutboxService(store, nil, time.Second, 0)
+
+	// Transaction 2 draws ID 1 but is still running when transaction 3 commits ID 2
+	store.running[2] = true
+	store.addIn(2, events.LocationCreated)
+	store.addIn(3, events.LocationUpdated)
+
+	page, err := service.GetChanges(context.Background(), "", 10, 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(page.Changes) != 0 {
+		t.Fatalf("served %d changes while an earlier transaction is running, expected none", len(page.Changes))
+	}
+
+	delete(store.running, 2)
+	page, err = service.GetChanges(context.Background(), page.NextCursor, 10, 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(page.Changes) != 2 || page.Changes[0].Type != events.LocationCreated {
+		t.Errorf("changes = %+v, expected both in transaction order", page.Changes)
+	}
+}
+
+func TestGetChangesResumesFromCursor(t *testing.T) {
+	store := &memStore{}
+	service := NewOutboxService(store, nil, time.Second, 0)
+	store.add(events.LocationCreated)
+	store.add(events.LocationUpdated)
+	store.add(events.LocationDeleted)
+
+	first, err := service.GetChanges(context.Background(), "", 2, 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(first.Changes) != 2 {
+		t.Fatalf("first page has %d changes, expected 2", len(first.Changes))
+	}
+
+	second, err := service.GetChanges(context.Background(), first.NextCursor, 2, 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(second.Changes) != 1 || second.Changes[0].Type != events.LocationDeleted {
+		t.Fatalf("second page = %+v", second.Changes)
+	}
+
+	empty, err := service.GetChanges(context.Background(), second.NextCursor, 2, 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(empty.Changes) != 0 || empty.NextCursor != second.NextCursor {
+		t.Errorf("caught-up page = %+v, expected no changes and the same cursor", empty)
+	}
+
+	other, err := service.GetChanges(tenant.WithTenant(context.Background(), "acme"), "", 10, 0)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(other.Changes) != 0 {
+		t.Errorf("another tenant sees %d changes, expected none", len(other.Changes))
+	}
+}
+
+func TestGetChangesLongPollWakesOnPublish(t *testing.T) {
+	store := &memStore{}
+	service := NewOutboxService(store, nil, time.Second, 0)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		store.add(events.LocationCreated)
+		service.Publish(events.New(events.LocationCreated, nil))
+	}()
+
+	started := time.Now()
+	page, err := service.GetChanges(context.Background(), "", 10, 10*time.Second)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(page.Changes) != 1 {
+		t.Fatalf("long poll returned %d changes, expected 1", len(page.Changes))
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("long poll took %v, expected to wake on publish", elapsed)
+	}
+}
+
+func TestGetChangesLongPollHonoursContext(t *testing.T) {
+	service := NewOutboxService(&memStore{}, nil, time.Second, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	page, err := service.GetChanges(ctx, "", 10, 10*time.Second)
+	if err != nil {
+		t.Fatalf("GetChanges() error = %v", err)
+	}
+	if len(page.Changes) != 0 {
+		t.Errorf("expected an empty page, got %+v", page.Changes)
+	}
+}
+
+func TestRelayWritesNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.ndjson")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	store := &memStore{}
+	store.add(events.LocationCreated)
+	store.add(events.LocationDeleted)
+	service := NewOutboxService(store, sink, time.Second, 0)
+
+	if n := service.relay(); n != 2 {
+		t.Fatalf("relay() = %d, expected 2", n)
+	}
+	if n := service.relay(); n != 0 {
+		t.Errorf("second relay() = %d, expected published entries to be skipped", n)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open sink: %v", err)
+	}
+	defer file.Close()
+
+	var lines []Change
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var change Change
+		if err := json.Unmarshal(scanner.Bytes(), &change); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, change)
+	}
+
+	if len(lines) != 2 || lines[1].Type != events.LocationDeleted || string(lines[0].Payload) != `{"name":"Depot"}` {
+		t.Errorf("sink contents = %+v", lines)
+	}
+}
+
+func TestPurgeKeepsUnpublishedEntries(t *testing.T) {
+	store := &memStore{}
+	store.add(events.LocationCreated)
+	store.add(events.LocationUpdated)
+	store.add(events.LocationDeleted)
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "changes.ndjson"))
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	service := NewOutboxService(store, sink, time.Second, time.Hour)
+
+	past := time.Now().Add(-2 * time.Hour)
+	store.entries[0].CreatedAt, store.entries[1].CreatedAt = past, past
+	_ = store.MarkPublished([]uint64{1}, time.Now())
+
+	service.purge()
+	if len(store.entries) != 2 || store.entries[0].ID != 2 {
+		t.Errorf("entries after purge = %+v, expected the published old one deleted", store.entries)
+	}
+
+	service.Stop()
+	if _, err := sink.file.Write([]byte("x")); err == nil {
+		t.Error("Stop() left the sink file open")
+	}
+}
@@ -0,0 +1,50 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink is a Publisher that appends every change to a file as newline-delimited JSON
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+var _ Publisher = &FileSink{}
+
+// NewFileSink opens, or creates, the NDJSON file at path for appending
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Publish writes one JSON line per change and syncs the file before returning
+func (f *FileSink) Publish(ctx context.Context, changes []Change) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	encoder := json.NewEncoder(f.file)
+	for _, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := encoder.Encode(change); err != nil {
+			return err
+		}
+	}
+	return f.file.Sync()
+}
+
+// Close closes the underlying file
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxStore defines the interface for outbox data access
+type OutboxStore interface {
+	After(tenant string, after Position, limit int) ([]Entry, error)
+	Unpublished(limit int) ([]Entry, error)
+	MarkPublished(ids []uint64, at time.Time) error
+	Purge(before time.Time, publishedOnly bool) (int64, error)
+}
+
+// settled selects the entries of transactions older than every transaction still running.
+// Later entries may yet be joined by commits that sort before them, so they are held back.
+const settled = "tx_id < pg_snapshot_xmin(pg_current_snapshot())::text::bigint"
+
+// OutboxRepo provides data access methods for outbox entries
+type OutboxRepo struct {
+	db *gorm.DB
+}
+
+// NewOutboxRepo creates a new outbox repository
+func NewOutboxRepo(db *gorm.DB) OutboxStore {
+	return &OutboxRepo{
+		db: db,
+	}
+}
+
+// After retrieves the settled entries of tenant after a position, in feed order
+func (s *OutboxRepo) After(tenant string, after Position, limit int) ([]Entry, error) {
+	db := s.db.Where("tenant = ?", tenant).Where(settled)
+	if after.Legacy() {
+		db = db.Where("id > ?", after.ID)
+	} else {
+		db = db.Where("(tx_id, id) > (?, ?)", after.TxID, after.ID)
+	}
+
+	var entries []Entry
+	err := db.Order("tx_id, id").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// Unpublished retrieves settled entries not yet handed to the publisher, in feed order
+func (s *OutboxRepo) Unpublished(limit int) ([]Entry, error) {
+	var entries []Entry
+	err := s.db.Where("published_at IS NULL").Where(settled).Order("tx_id, id").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// MarkPublished records that entries were handed to the publisher
+func (s *OutboxRepo) MarkPublished(ids []uint64, at time.Time) error {
+	return s.db.Model(&Entry{}).Where("id IN ?", ids).Update("published_at", at).Error
+}
+
+// Purge deletes the entries created before a time, only those already published when publishedOnly is set
+func (s *OutboxRepo) Purge(before time.Time, publishedOnly bool) (int64, error) {
+	db := s.db.Where("created_at < ?", before)
+	if publishedOnly {
+		db = db.Where("published_at IS NOT NULL")
+	}
+	result := db.Delete(&Entry{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have filled up again are dropped
+const sweepInterval = time.Minute
+
+// Limiter keeps a token bucket per key in memory. Every instance of the server
+// limits the requests it receives on its own.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// NewLimiter creates a limiter without any buckets
+func NewLimiter() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes one request from the bucket of key, which starts full
+func (l *Limiter) Allow(key string, limit Limit) Decision {
+	capacity := limit.capacity()
+	if limit.Unlimited() {
+		return Decision{Allowed: true, Limit: int64(capacity), Remaining: int64(capacity)}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: capacity, updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	decision := Decision{Limit: int64(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = b.timeFor(1)
+	}
+	decision.Remaining = int64(math.Floor(b.tokens))
+	decision.Reset = b.timeFor(capacity)
+	return decision
+}
+
+// sweep drops the buckets that are full again, since a new bucket starts full anyway
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.limit.capacity() {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// refill adds the tokens earned since the bucket was last updated
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.limit.capacity(), b.tokens+elapsed*b.limit.Rate)
+		b.updated = now
+	}
+}
+
+// timeFor returns how long until the bucket holds tokens
+func (b *bucket) timeFor(tokens float64) time.Duration {
+	missing := tokens - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestLimiterRefillsBucket(t *testing.T) {
+	clk := &clock{now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter()
+	limiter.now = clk.Now
+	limit := Limit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		if d := limiter.Allow("a", limit); !d.Allowed || d.Remaining != int64(2-i) {
+			t.Fatalf("request %d = %+v, expected allowed with %d remaining", i+1, d, 2-i)
+		}
+	}
+
+	d := limiter.Allow("a", limit)
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != 1500*time.Millisecond {
+		t.Errorf("request beyond the burst = %+v, expected refused for 500ms", d)
+	}
+	if d := limiter.Allow("b", limit); !d.Allowed {
+		t.Error("another key shares the bucket")
+	}
+
+	clk.Advance(500 * time.Millisecond)
+	if d := limiter.Allow("a", limit); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("request after refill = %+v, expected allowed with 0 remaining", d)
+	}
+
+	clk.Advance(time.Hour)
+	if d := limiter.Allow("a", limit); d.Remaining != 2 {
+		t.Errorf("Remaining after an idle hour = %d, expected the bucket capped at its burst", d.Remaining)
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	clk := &clock{now: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter()
+	limiter.now = clk.Now
+
+	limiter.Allow("idle", Limit{Rate: 1, Burst: 5})
+	limiter.Allow("busy", Limit{Rate: 0.001, Burst: 1})
+	clk.Advance(sweepInterval)
+	limiter.Allow("new", Limit{Rate: 1, Burst: 5})
+
+	if _, ok := limiter.buckets["idle"]; ok {
+		t.Error("a full bucket was kept")
+	}
+	if _, ok := limiter.buckets["busy"]; !ok {
+		t.Error("a bucket that is still draining was dropped")
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	policy := Policy{
+		Default: Limit{Rate: 10, Burst: 20},
+		Routes:  map[string]Limit{"GET /locations/nearest": {Rate: 1, Burst: 2}},
+	}
+
+	if limit, key := policy.For("GET", "/locations/nearest"); limit.Rate != 1 || key == "" {
+		t.Errorf("For(nearest) = %+v, %q, expected its own limit and bucket", limit, key)
+	}
+	if limit, key := policy.For("POST", "/locations"); limit.Rate != 10 || key != "" {
+		t.Errorf("For(create) = %+v, %q, expected the default limit and the shared bucket", limit, key)
+	}
+	if (Limit{}).Unlimited() != true {
+		t.Error("a zero limit must be unlimited")
+	}
+}
+
+// memStore is an in-memory UsageStore
+type memStore struct {
+	mu     sync.Mutex
+	totals map[usageKey]int64
+	err    error
+}
+
+func (m *memStore) Add(client, period string, n int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, m.err
+	}
+	key := usageKey{client: client, period: period}
+	m.totals[key] += n
+	return m.totals[key], nil
+}
+
+func TestMeterEnforcesMonthlyQuota(t *testing.T) {
+	clk := &clock{now: time.Date(2026, 10, 31, 23, 0, 0, 0, time.UTC)}
+	store := &memStore{totals: map[usageKey]int64{{client: "api_key:1", period: "2026-10"}: 3}}
+	meter := NewMeter(store, Quotas{Monthly: 5, Clients: map[string]int64{"api_key:2": 0}}, time.Minute)
+	meter.now = clk.Now
+
+	for i := 0; i < 2; i++ {
+		if d, err := meter.Use("api_key:1"); err != nil || !d.Allowed || d.Remaining != int64(1-i) {
+			t.Fatalf("request %d = %+v, %v, expected allowed with %d remaining", i+1, d, err, 1-i)
+		}
+	}
+	d, _ := meter.Use("api_key:1")
+	if d.Allowed || d.RetryAfter != time.Hour {
+		t.Errorf("request beyond the quota = %+v, expected refused until the next month", d)
+	}
+	if d, _ := meter.Use("api_key:2"); !d.Allowed || d.Limit != 0 {
+		t.Errorf("request of an unlimited key = %+v, expected allowed", d)
+	}
+
+	meter.Flush()
+	if total := store.totals[usageKey{client: "api_key:1", period: "2026-10"}]; total != 5 {
+		t.Errorf("stored total = %d, expected 5; refused requests must not be counted", total)
+	}
+
+	clk.Advance(time.Hour)
+	if d, _ := meter.Use("api_key:1"); !d.Allowed || d.Remaining != 4 {
+		t.Errorf("first request of a new month = %+v, expected allowed with 4 remaining", d)
+	}
+	meter.Flush()
+	if len(meter.counters) != 1 {
+		t.Errorf("meter keeps %d counters, expected only those of the current month", len(meter.counters))
+	}
+}
+
+func TestMeterReadsOtherInstancesOnFlush(t *testing.T) {
+	store := &memStore{totals: make(map[usageKey]int64)}
+	meter := NewMeter(store, Quotas{Monthly: 10}, time.Minute)
+	key := usageKey{client: "api_key:1", period: time.Now().UTC().Format(periodLayout)}
+
+	_, _ = meter.Use("api_key:1")
+	store.totals[key] += 8 // served by another instance
+	meter.Flush()
+
+	if d, _ := meter.Use("api_key:1"); d.Remaining != 0 {
+		t.Errorf("Remaining = %d, expected the other instance's requests to count", d.Remaining)
+	}
+	if d, _ := meter.Use("api_key:1"); d.Allowed {
+		t.Error("request beyond the shared quota was allowed")
+	}
+}
+
+func TestMeterKeepsCountsThatFailToStore(t *testing.T) {
+	store := &memStore{totals: make(map[usageKey]int64)}
+	meter := NewMeter(store, Quotas{}, time.Minute)
+	_, _ = meter.Use("api_key:1")
+	_, _ = meter.Use("api_key:1")
+
+	store.err = errors.New("database is down")
+	meter.Flush()
+	if _, err := meter.Use("api_key:2"); err == nil {
+		t.Error("Use() of a new client succeeded without reading its usage")
+	}
+
+	store.err = nil
+	meter.Stop()
+	key := usageKey{client: "api_key:1", period: time.Now().UTC().Format(periodLayout)}
+	if store.totals[key] != 2 {
+		t.Errorf("stored total = %d, expected 2 after the retried flush", store.totals[key])
+	}
+}
@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// periodLayout formats the calendar month a request is counted in
+const periodLayout = "2006-01"
+
+// Quotas sets the monthly quota of every client, which Clients overrides per client. Zero is unlimited.
+type Quotas struct {
+	Monthly int64
+	Clients map[string]int64
+}
+
+// For returns the monthly quota of client
+func (q Quotas) For(client string) int64 {
+	if quota, ok := q.Clients[client]; ok {
+		return quota
+	}
+	return q.Monthly
+}
+
+// Meter counts the requests of each client per calendar month and refuses them
+// once the client's quota is used up. Counts are kept in memory and added to the
+// database in the background, so a request costs no database write; the totals
+// read back include the requests served by the other instances.
+type Meter struct {
+	repo     UsageStore
+	quotas   Quotas
+	interval time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	counters map[usageKey]*counter
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type usageKey struct {
+	client string
+	period string
+}
+
+// counter is the total stored for a client when it was last read, and the requests counted since
+type counter struct {
+	stored  int64
+	pending int64
+}
+
+// NewMeter creates a meter adding the counted requests to repo every interval
+func NewMeter(repo UsageStore, quotas Quotas, interval time.Duration) *Meter {
+	return &Meter{
+		repo:     repo,
+		quotas:   quotas,
+		interval: interval,
+		now:      time.Now,
+		counters: make(map[usageKey]*counter),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Use counts a request of client against its quota for the current month.
+// Requests refused by the quota are not counted.
+func (m *Meter) Use(client string) (Decision, error) {
+	now := m.now().UTC()
+	key := usageKey{client: client, period: now.Format(periodLayout)}
+	quota := m.quotas.For(client)
+
+	m.mu.Lock()
+	c, ok := m.counters[key]
+	m.mu.Unlock()
+	if !ok {
+		// The first request of the month reads what the other instances counted so far
+		stored, err := m.repo.Add(key.client, key.period, 0)
+		if err != nil {
+			return Decision{}, err
+		}
+		m.mu.Lock()
+		if c, ok = m.counters[key]; !ok {
+			c = &counter{stored: stored}
+			m.counters[key] = c
+		}
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset := nextPeriod(now).Sub(now)
+	used := c.stored + c.pending
+	if quota > 0 && used >= quota {
+		return Decision{Limit: quota, Reset: reset, RetryAfter: reset}, nil
+	}
+	c.pending++
+	decision := Decision{Allowed: true, Limit: quota, Reset: reset}
+	if quota > 0 {
+		decision.Remaining = quota - used - 1
+	}
+	return decision, nil
+}
+
+// Flush adds the requests counted since the last flush to the database and
+// reads back the totals. Counts that fail to be stored are kept for the next flush.
+func (m *Meter) Flush() {
+	m.mu.Lock()
+	batch := make(map[usageKey]int64)
+	for key, c := range m.counters {
+		if c.pending > 0 {
+			batch[key] = c.pending
+			c.pending = 0
+		}
+	}
+	m.mu.Unlock()
+
+	for key, n := range batch {
+		total, err := m.repo.Add(key.client, key.period, n)
+
+		m.mu.Lock()
+		if c := m.counters[key]; err != nil {
+			c.pending += n
+		} else {
+			c.stored = total
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{"client": key.client, "period": key.period}).Error("Failed to store request usage")
+		}
+	}
+
+	// Past months are only kept until their last counts are stored
+	period := m.now().UTC().Format(periodLayout)
+	m.mu.Lock()
+	for key, c := range m.counters {
+		if key.period != period && c.pending == 0 {
+			delete(m.counters, key)
+		}
+	}
+	m.mu.Unlock()
+}
+
+// Start flushes the counts in the background until Stop is called
+func (m *Meter) Start() {
+	if m.interval <= 0 {
+		return
+	}
+	m.startOnce.Do(func() {
+		go m.run()
+	})
+}
+
+// Stop ends the background flushing and stores the remaining counts
+func (m *Meter) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	m.startOnce.Do(func() {
+		close(m.done)
+	})
+	<-m.done
+	m.Flush()
+}
+
+func (m *Meter) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.Flush()
+		}
+	}
+}
+
+// nextPeriod returns the start of the month after the one t is in
+func nextPeriod(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
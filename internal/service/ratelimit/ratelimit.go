@@ -0,0 +1,98 @@
+// Package ratelimit protects the API from clients sending more requests than
+// it can serve. Short bursts are limited by token buckets kept in memory per
+// client and route; usage over a month is limited by counters kept in the database.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+)
+
+// Limit is a token bucket holding up to Burst requests, refilled at Rate requests per second.
+// A zero Rate is unlimited.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited reports whether the limit lets every request through
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// capacity is the size of the bucket; a bucket always holds at least one request
+func (l Limit) capacity() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+// Policy sets the limit of every route, which Routes overrides per route. Routes
+// are keyed by method and gin path, e.g. "GET /locations/nearest".
+type Policy struct {
+	Default Limit
+	Routes  map[string]Limit
+}
+
+// RouteKey returns the key of a route in Policy.Routes
+func RouteKey(method, path string) string {
+	return method + " " + path
+}
+
+// For returns the limit of a route and the key of its bucket. Routes without
+// a limit of their own share one bucket per client.
+func (p Policy) For(method, path string) (Limit, string) {
+	key := RouteKey(method, path)
+	if limit, ok := p.Routes[key]; ok {
+		return limit, key
+	}
+	return p.Default, ""
+}
+
+// ClientOf returns the key identifying the client of a request, and whether it is an
+// API key. Authenticated clients are known by their credentials, others by their ip.
+func ClientOf(principal *auth.Principal, ip string) (string, bool) {
+	if principal != nil {
+		return ClientKey(principal.Method, principal.ID), principal.Method == auth.MethodAPIKey
+	}
+	return "ip:" + ip, false
+}
+
+// ClientKey returns the key of an authenticated client, such as api_key:3 for the API key with ID 3
+func ClientKey(method, id string) string {
+	return method + ":" + id
+}
+
+// Decision is the outcome of counting a request against a limit
+type Decision struct {
+	Allowed bool
+	// Limit is the number of requests allowed at once, or in the period of a quota
+	Limit int64
+	// Remaining is the number of requests that would still be allowed right now
+	Remaining int64
+	// Reset is the time until the limit is fully available again
+	Reset time.Duration
+	// RetryAfter is the time until a refused request would be allowed
+	RetryAfter time.Duration
+}
+
+// LimitedError is returned for requests refused by a rate limit or a quota
+type LimitedError struct {
+	RetryAfter time.Duration
+	Reason     string
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("%s, retry in %d seconds", e.Reason, Seconds(e.RetryAfter))
+}
+
+// Seconds rounds a duration up to whole seconds, as used by the Retry-After header
+func Seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Usage counts the requests a client made in one calendar month
+type Usage struct {
+	Client string `json:"client" gorm:"primaryKey"`
+	// Period is the month in UTC, e.g. 2026-10
+	Period    string    `json:"period" gorm:"primaryKey"`
+	Requests  int64     `json:"requests" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName keeps the table name independent of the package name
+func (Usage) TableName() string {
+	return "client_usage"
+}
+
+// UsageStore defines the interface for usage data access
+type UsageStore interface {
+	// Add counts n more requests of client in period and returns its total, n included
+	Add(client, period string, n int64) (int64, error)
+}
+
+// UsageRepo provides data access methods for usage counters
+type UsageRepo struct {
+	db *gorm.DB
+}
+
+// NewUsageRepo creates a new usage repository
+func NewUsageRepo(db *gorm.DB) UsageStore {
+	return &UsageRepo{
+		db: db,
+	}
+}
+
+// Add increments the counter in one statement, so instances flushing at the same time add up
+func (s *UsageRepo) Add(client, period string, n int64) (int64, error) {
+	var total int64
+	err := s.db.Raw(`INSERT INTO client_usage (client, period, requests, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (client, period) DO UPDATE
+		SET requests = client_usage.requests + EXCLUDED.requests, updated_at = EXCLUDED.updated_at
+		RETURNING requests`, client, period, n, time.Now().UTC()).Scan(&total).Error
+	return total, err
+}
@@ -0,0 +1,176 @@
+package route
+
+// improvementEpsilon ignores floating point noise when comparing route lengths
+const improvementEpsilon = 1e-9
+
+// maxImprovementPasses bounds the local search in case of pathological inputs
+const maxImprovementPasses = 1000
+
+// maxOrOptSegment is the longest run of consecutive stops Or-opt tries to relocate
+const maxOrOptSegment = 3
+
+// optimizer searches for a short visiting order over a distance matrix.
+// Node 0 is always the start. When fixedEnd is set the last node stays last,
+// and when closed is set the route returns to the start after the last stop.
+type optimizer struct {
+	dist     [][]float64
+	closed   bool
+	fixedEnd bool
+}
+
+// solve returns a near-optimal visiting order using a nearest-neighbour seed
+// followed by 2-opt and Or-opt improvement until no move shortens the route
+func (o *optimizer) solve() []int {
+	order := o.nearestNeighbour()
+
+	for pass := 0; pass < maxImprovementPasses; pass++ {
+		improved := o.twoOpt(order)
+		if o.orOpt(order) {
+			improved = true
+		}
+		if !improved {
+			break
+		}
+	}
+
+	return order
+}
+
+// length returns the total distance travelled along order
+func (o *optimizer) length(order []int) float64 {
+	var total float64
+	for i := 0; i+1 < len(order); i++ {
+		total += o.dist[order[i]][order[i+1]]
+	}
+	if o.closed && len(order) > 1 {
+		total += o.dist[order[len(order)-1]][order[0]]
+	}
+	return total
+}
+
+// movableEnd returns the exclusive upper bound of positions that may be reordered
+func (o *optimizer) movableEnd(order []int) int {
+	if o.fixedEnd {
+		return len(order) - 1
+	}
+	return len(order)
+}
+
+// nearestNeighbour builds the seed route by always travelling to the closest unvisited stop
+func (o *optimizer) nearestNeighbour() []int {
+	n := len(o.dist)
+	last := n
+	if o.fixedEnd {
+		last = n - 1
+	}
+
+	visited := make([]bool, n)
+	order := make([]int, 0, n)
+	order = append(order, 0)
+	visited[0] = true
+
+	for len(order) < last {
+		current := order[len(order)-1]
+		next := -1
+		for candidate := 1; candidate < last; candidate++ {
+			if visited[candidate] {
+				continue
+			}
+			if next == -1 || o.dist[current][candidate] < o.dist[current][next] {
+				next = candidate
+			}
+		}
+		visited[next] = true
+		order = append(order, next)
+	}
+
+	if o.fixedEnd {
+		order = append(order, n-1)
+	}
+
+	return order
+}
+
+// twoOpt reverses sub-sequences of the route whenever doing so shortens it
+func (o *optimizer) twoOpt(order []int) bool {
+	improved := false
+	end := o.movableEnd(order)
+
+	for i := 1; i < end-1; i++ {
+		for k := i + 1; k < end; k++ {
+			prev := order[i-1]
+			next := -1
+			if k+1 < len(order) {
+				next = order[k+1]
+			} else if o.closed {
+				next = order[0]
+			}
+
+			before := o.dist[prev][order[i]]
+			after := o.dist[prev][order[k]]
+			if next >= 0 {
+				before += o.dist[order[k]][next]
+				after += o.dist[order[i]][next]
+			}
+
+			if after < before-improvementEpsilon {
+				reverse(order[i : k+1])
+				improved = true
+			}
+		}
+	}
+
+	return improved
+}
+
+// orOpt relocates short runs of stops, in either direction, to a cheaper position
+func (o *optimizer) orOpt(order []int) bool {
+	improved := false
+	end := o.movableEnd(order)
+	best := o.length(order)
+
+	for size := 1; size <= maxOrOptSegment; size++ {
+		for i := 1; i+size <= end; i++ {
+			segment := append([]int(nil), order[i:i+size]...)
+			rest := make([]int, 0, len(order)-size)
+			rest = append(rest, order[:i]...)
+			rest = append(rest, order[i+size:]...)
+
+			for j := 1; j <= end-size; j++ {
+				if j == i {
+					continue
+				}
+				for _, reversed := range []bool{false, true} {
+					candidate := insertSegment(rest, segment, j, reversed)
+					if l := o.length(candidate); l < best-improvementEpsilon {
+						copy(order, candidate)
+						best = l
+						improved = true
+					}
+				}
+			}
+		}
+	}
+
+	return improved
+}
+
+// insertSegment returns a copy of rest with segment inserted before position at
+func insertSegment(rest, segment []int, at int, reversed bool) []int {
+	result := make([]int, 0, len(rest)+len(segment))
+	result = append(result, rest[:at]...)
+	if reversed {
+		for i := len(segment) - 1; i >= 0; i-- {
+			result = append(result, segment[i])
+		}
+	} else {
+		result = append(result, segment...)
+	}
+	return append(result, rest[at:]...)
+}
+
+func reverse(order []int) {
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+}
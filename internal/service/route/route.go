@@ -0,0 +1,46 @@
+package route
+
+import "github.com/youngprinnce/geolocation-service/internal/service/location"
+
+// MaxStations is the largest number of stations accepted in a single optimisation request
+const MaxStations = 100
+
+// Stop kinds used in an optimised route
+const (
+	StopStart   = "start"
+	StopStation = "station"
+	StopEnd     = "end"
+)
+
+// OptimizeRouteRequest represents the request body for optimising a visiting order
+type OptimizeRouteRequest struct {
+	Start     *location.Point `json:"start" binding:"required"`
+	Stations  []string        `json:"stations" binding:"required,min=1,max=100,dive,required"`
+	RoundTrip bool            `json:"round_trip"`
+	End       *location.Point `json:"end"`
+}
+
+// Stop is a single point visited by an optimised route
+type Stop struct {
+	Sequence  int     `json:"sequence"`
+	Kind      string  `json:"kind"`
+	Name      string  `json:"name,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Leg is the stretch travelled between two consecutive stops
+type Leg struct {
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	DistanceKm   float64 `json:"distance_km"`
+	CumulativeKm float64 `json:"cumulative_km"`
+}
+
+// OptimizedRoute is the visiting order returned for an optimisation request
+type OptimizedRoute struct {
+	Stops           []Stop  `json:"stops"`
+	Legs            []Leg   `json:"legs"`
+	TotalDistanceKm float64 `json:"total_distance_km"`
+	RoundTrip       bool    `json:"round_trip"`
+}
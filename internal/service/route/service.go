@@ -0,0 +1,185 @@
+package route
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+type RouteBC interface {
+	OptimizeRoute(ctx context.Context, req OptimizeRouteRequest) (*OptimizedRoute, error)
+}
+
+// RouteService handles visit-order optimisation across registered stations
+type RouteService struct {
+	locations  location.StoreFactory
+	Calculator *location.DistanceCalculator
+}
+
+// NewRouteService creates a new route service visiting the stations of each tenant
+func NewRouteService(locations location.StoreFactory, calculator *location.DistanceCalculator) RouteBC {
+	return &RouteService{
+		locations:  locations,
+		Calculator: calculator,
+	}
+}
+
+// OptimizeRoute orders the requested stations so the total travelled distance is near-minimal
+func (s *RouteService) OptimizeRoute(ctx context.Context, req OptimizeRouteRequest) (*OptimizedRoute, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	stations, err := s.resolveStations(tenant.FromContext(ctx), req.Stations)
+	if err != nil {
+		return nil, err
+	}
+
+	// Node 0 is the start, followed by the stations and the optional fixed end
+	stops := make([]Stop, 0, len(stations)+2)
+	stops = append(stops, Stop{Kind: StopStart, Latitude: req.Start.Latitude, Longitude: req.Start.Longitude})
+	for _, station := range stations {
+		stops = append(stops, Stop{Kind: StopStation, Name: station.Name, Latitude: station.Latitude, Longitude: station.Longitude})
+	}
+	if req.End != nil {
+		stops = append(stops, Stop{Kind: StopEnd, Latitude: req.End.Latitude, Longitude: req.End.Longitude})
+	}
+
+	opt := &optimizer{
+		dist:     s.distanceMatrix(stops),
+		closed:   req.RoundTrip,
+		fixedEnd: req.End != nil,
+	}
+	order := opt.solve()
+	if req.RoundTrip {
+		order = append(order, 0)
+	}
+
+	route := &OptimizedRoute{
+		Stops:     make([]Stop, 0, len(order)),
+		Legs:      make([]Leg, 0, len(order)-1),
+		RoundTrip: req.RoundTrip,
+	}
+
+	for i, node := range order {
+		stop := stops[node]
+		stop.Sequence = i
+		route.Stops = append(route.Stops, stop)
+
+		if i == 0 {
+			continue
+		}
+		distance := opt.dist[order[i-1]][node]
+		route.TotalDistanceKm += distance
+		route.Legs = append(route.Legs, Leg{
+			From:         stopLabel(stops[order[i-1]]),
+			To:           stopLabel(stop),
+			DistanceKm:   distance,
+			CumulativeKm: route.TotalDistanceKm,
+		})
+	}
+
+	return route, nil
+}
+
+// resolveStations loads the requested stations of a tenant, failing if any of them is unknown
+func (s *RouteService) resolveStations(id string, names []string) ([]location.Location, error) {
+	found, err := s.locations(id).GetByNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]location.Location, len(found))
+	for _, loc := range found {
+		byName[loc.Name] = loc
+	}
+
+	stations := make([]location.Location, 0, len(names))
+	var missing []string
+	for _, name := range names {
+		loc, ok := byName[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		stations = append(stations, loc)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, &UnknownStationsError{Names: missing}
+	}
+
+	return stations, nil
+}
+
+// distanceMatrix computes the pairwise great-circle distance between all stops
+func (s *RouteService) distanceMatrix(stops []Stop) [][]float64 {
+	dist := make([][]float64, len(stops))
+	for i := range stops {
+		dist[i] = make([]float64, len(stops))
+	}
+
+	for i := range stops {
+		for j := i + 1; j < len(stops); j++ {
+			d := s.Calculator.HaversineDistance(stops[i].Latitude, stops[i].Longitude, stops[j].Latitude, stops[j].Longitude)
+			dist[i][j] = d
+			dist[j][i] = d
+		}
+	}
+
+	return dist
+}
+
+func validateRequest(req OptimizeRouteRequest) error {
+	if len(req.Stations) == 0 {
+		return &location.ValidationError{Field: "stations", Message: "at least one station is required"}
+	}
+	if len(req.Stations) > MaxStations {
+		return &location.ValidationError{Field: "stations", Message: "too many stations"}
+	}
+	if req.RoundTrip && req.End != nil {
+		return &location.ValidationError{Field: "end", Message: "cannot be combined with round_trip"}
+	}
+
+	if req.Start == nil {
+		return &location.ValidationError{Field: "start", Message: "is required"}
+	}
+	if err := location.ValidateCoordinates(req.Start.Latitude, req.Start.Longitude); err != nil {
+		return err
+	}
+	if req.End != nil {
+		if err := location.ValidateCoordinates(req.End.Latitude, req.End.Longitude); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool, len(req.Stations))
+	for _, name := range req.Stations {
+		if seen[name] {
+			return &location.ValidationError{Field: "stations", Message: "duplicate station " + name}
+		}
+		seen[name] = true
+	}
+
+	return nil
+}
+
+func stopLabel(stop Stop) string {
+	if stop.Kind == StopStation {
+		return stop.Name
+	}
+	return stop.Kind
+}
+
+// UnknownStationsError is returned when a request references stations that do not exist
+type UnknownStationsError struct {
+	Names []string
+}
+
+func (e *UnknownStationsError) Error() string {
+	return "Unknown stations: " + strings.Join(e.Names, ", ")
+}
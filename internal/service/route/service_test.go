@@ -0,0 +1,221 @@
+package route
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// fakeStore is an in-memory LocationStore used to exercise the route service
+type fakeStore struct {
+	location.LocationStore
+	locations []location.Location
+}
+
+func (f *fakeStore) GetByNames(names []string) ([]location.Location, error) {
+	var found []location.Location
+	for _, loc := range f.locations {
+		for _, name := range names {
+			if loc.Name == name {
+				found = append(found, loc)
+			}
+		}
+	}
+	return found, nil
+}
+
+func newTestService(locations ...location.Location) RouteBC {
+	store := &fakeStore{locations: locations}
+	return NewRouteService(func(string) location.LocationStore { return store }, &location.DistanceCalculator{})
+}
+
+func TestOptimizeRouteVisitsStationsAlongALine(t *testing.T) {
+	service := newTestService(
+		location.Location{Name: "C", Latitude: 0, Longitude: 3},
+		location.Location{Name: "A", Latitude: 0, Longitude: 1},
+		location.Location{Name: "D", Latitude: 0, Longitude: 4},
+		location.Location{Name: "B", Latitude: 0, Longitude: 2},
+	)
+
+	result, err := service.OptimizeRoute(context.Background(), OptimizeRouteRequest{
+		Start:    &location.Point{Latitude: 0, Longitude: 0},
+		Stations: []string{"D", "B", "A", "C"},
+	})
+	if err != nil {
+		t.Fatalf("OptimizeRoute() error = %v", err)
+	}
+
+	var names []string
+	for _, stop := range result.Stops[1:] {
+		names = append(names, stop.Name)
+	}
+	if got, want := names, []string{"A", "B", "C", "D"}; !equalStrings(got, want) {
+		t.Errorf("OptimizeRoute() order = %v, expected %v", got, want)
+	}
+
+	if len(result.Legs) != 4 {
+		t.Fatalf("OptimizeRoute() returned %d legs, expected 4", len(result.Legs))
+	}
+	if last := result.Legs[len(result.Legs)-1]; math.Abs(last.CumulativeKm-result.TotalDistanceKm) > 1e-9 {
+		t.Errorf("last leg cumulative = %v, expected total %v", last.CumulativeKm, result.TotalDistanceKm)
+	}
+}
+
+func TestOptimizeRouteRoundTripReturnsToStart(t *testing.T) {
+	service := newTestService(
+		location.Location{Name: "A", Latitude: 1, Longitude: 0},
+		location.Location{Name: "B", Latitude: 1, Longitude: 1},
+	)
+
+	result, err := service.OptimizeRoute(context.Background(), OptimizeRouteRequest{
+		Start:     &location.Point{Latitude: 0, Longitude: 0},
+		Stations:  []string{"A", "B"},
+		RoundTrip: true,
+	})
+	if err != nil {
+		t.Fatalf("OptimizeRoute() error = %v", err)
+	}
+
+	last := result.Stops[len(result.Stops)-1]
+	if last.Kind != StopStart || len(result.Stops) != 4 {
+		t.Errorf("round trip should end at the start, got stops %+v", result.Stops)
+	}
+}
+
+func TestOptimizeRouteKeepsFixedEndLast(t *testing.T) {
+	service := newTestService(
+		location.Location{Name: "A", Latitude: 0, Longitude: 1},
+		location.Location{Name: "B", Latitude: 0, Longitude: 5},
+	)
+
+	result, err := service.OptimizeRoute(context.Background(), OptimizeRouteRequest{
+		Start:    &location.Point{Latitude: 0, Longitude: 0},
+		Stations: []string{"B", "A"},
+		End:      &location.Point{Latitude: 0, Longitude: 2},
+	})
+	if err != nil {
+		t.Fatalf("OptimizeRoute() error = %v", err)
+	}
+
+	if last := result.Stops[len(result.Stops)-1]; last.Kind != StopEnd {
+		t.Errorf("last stop kind = %v, expected %v", last.Kind, StopEnd)
+	}
+}
+
+func TestOptimizeRouteErrors(t *testing.T) {
+	service := newTestService(location.Location{Name: "A", Latitude: 0, Longitude: 1})
+
+	tests := []struct {
+		name string
+		req  OptimizeRouteRequest
+		want interface{}
+	}{
+		{
+			name: "Unknown station",
+			req:  OptimizeRouteRequest{Start: &location.Point{}, Stations: []string{"A", "Missing"}},
+			want: &UnknownStationsError{},
+		},
+		{
+			name: "Missing start",
+			req:  OptimizeRouteRequest{Stations: []string{"A"}},
+			want: &location.ValidationError{},
+		},
+		{
+			name: "Duplicate station",
+			req:  OptimizeRouteRequest{Stations: []string{"A", "A"}},
+			want: &location.ValidationError{},
+		},
+		{
+			name: "Round trip with fixed end",
+			req:  OptimizeRouteRequest{Stations: []string{"A"}, RoundTrip: true, End: &location.Point{}},
+			want: &location.ValidationError{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.OptimizeRoute(context.Background(), tt.req)
+			switch tt.want.(type) {
+			case *UnknownStationsError:
+				if _, ok := err.(*UnknownStationsError); !ok {
+					t.Errorf("OptimizeRoute() error = %v, expected UnknownStationsError", err)
+				}
+			case *location.ValidationError:
+				if _, ok := err.(*location.ValidationError); !ok {
+					t.Errorf("OptimizeRoute() error = %v, expected ValidationError", err)
+				}
+			}
+		})
+	}
+}
+
+func TestOptimizerMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+
+	for trial := 0; trial < 20; trial++ {
+		n := 7
+		points := make([][2]float64, n)
+		for i := range points {
+			points[i] = [2]float64{rng.Float64() * 10, rng.Float64() * 10}
+		}
+
+		calculator := &location.DistanceCalculator{}
+		dist := make([][]float64, n)
+		for i := range dist {
+			dist[i] = make([]float64, n)
+			for j := range dist[i] {
+				dist[i][j] = calculator.HaversineDistance(points[i][0], points[i][1], points[j][0], points[j][1])
+			}
+		}
+
+		opt := &optimizer{dist: dist, closed: true}
+		got := opt.length(opt.solve())
+		best := bruteForce(opt)
+
+		// The heuristic is not exact, but on tiny instances it should be within a few percent
+		if got > best*1.05 {
+			t.Errorf("trial %d: optimizer length %v, optimum %v", trial, got, best)
+		}
+	}
+}
+
+func bruteForce(o *optimizer) float64 {
+	nodes := make([]int, len(o.dist)-1)
+	for i := range nodes {
+		nodes[i] = i + 1
+	}
+
+	best := math.Inf(1)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == len(nodes) {
+			if l := o.length(append([]int{0}, nodes...)); l < best {
+				best = l
+			}
+			return
+		}
+		for i := k; i < len(nodes); i++ {
+			nodes[k], nodes[i] = nodes[i], nodes[k]
+			permute(k + 1)
+			nodes[k], nodes[i] = nodes[i], nodes[k]
+		}
+	}
+	permute(0)
+
+	return best
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"golang.org/x/text/unicode/norm"
+)
+
+// entry is an indexed location with its normalised name
+type entry struct {
+	location   location.Location
+	normalized string
+	words      []string
+	trigrams   map[string]struct{}
+}
+
+// Index is an in-memory trigram index over location names. It is not safe for concurrent use.
+type Index struct {
+	entries  map[uint]*entry
+	postings map[string]map[uint]struct{}
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{
+		entries:  make(map[uint]*entry),
+		postings: make(map[string]map[uint]struct{}),
+	}
+}
+
+// Put adds a location or replaces the indexed version of it
+func (idx *Index) Put(l location.Location) {
+	idx.Remove(l.ID)
+
+	normalized := Normalize(l.Name)
+	e := &entry{
+		location:   l,
+		normalized: normalized,
+		words:      strings.Fields(normalized),
+		trigrams:   trigrams(normalized),
+	}
+	idx.entries[l.ID] = e
+
+	for trigram := range e.trigrams {
+		ids, ok := idx.postings[trigram]
+		if !ok {
+			ids = make(map[uint]struct{})
+			idx.postings[trigram] = ids
+		}
+		ids[l.ID] = struct{}{}
+	}
+}
+
+// Remove drops a location from the index
+func (idx *Index) Remove(id uint) {
+	e, ok := idx.entries[id]
+	if !ok {
+		return
+	}
+	delete(idx.entries, id)
+
+	for trigram := range e.trigrams {
+		delete(idx.postings[trigram], id)
+		if len(idx.postings[trigram]) == 0 {
+			delete(idx.postings, trigram)
+		}
+	}
+}
+
+// Get returns the indexed version of a location
+func (idx *Index) Get(id uint) (location.Location, bool) {
+	e, ok := idx.entries[id]
+	if !ok {
+		return location.Location{}, false
+	}
+	return e.location, true
+}
+
+// Len returns the number of indexed locations
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+// candidates returns the entries sharing at least one trigram with the query
+func (idx *Index) candidates(queryTrigrams map[string]struct{}) []*entry {
+	seen := make(map[uint]struct{})
+	var found []*entry
+	for trigram := range queryTrigrams {
+		for id := range idx.postings[trigram] {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			found = append(found, idx.entries[id])
+		}
+	}
+	return found
+}
+
+// Normalize folds case and accents and reduces everything but letters and digits to single spaces,
+// so that "Zürich-Hbf" and "zurich hbf" compare equal
+func Normalize(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Combining accent split off by the decomposition
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), " ")
+}
+
+// trigrams returns the trigrams of every word, padded like pg_trgm with two spaces in front and
+// one behind so that prefixes of a word share its leading trigrams
+func trigrams(normalized string) map[string]struct{} {
+	result := make(map[string]struct{})
+	for _, word := range strings.Fields(normalized) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			result[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+	return result
+}
+
+// similarity is the Jaccard index of two trigram sets
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for trigram := range a {
+		if _, ok := b[trigram]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,300 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// Result limits
+const (
+	DefaultLimit   = 10
+	MaxLimit       = 50
+	MaxQueryLength = 100
+)
+
+// Scoring
+const (
+	// minScore is the lowest score a match is returned with
+	minScore = 0.3
+	// proximityBoost is added to the score of a location at the query point and halves at 10 km
+	proximityBoost = 0.25
+	proximityScale = 10.0
+)
+
+// Query is a name search
+type Query struct {
+	Text string
+	// Near boosts locations close to this point when set
+	Near *location.Point
+	// Limit defaults to DefaultLimit
+	Limit int
+	// Visible, when set, leaves out the locations it rejects
+	Visible func(l *location.Location) bool
+}
+
+// Result is a location matching a search
+type Result struct {
+	Location   location.Location `json:"location"`
+	Score      float64           `json:"score"`
+	DistanceKm *float64          `json:"distance_km,omitempty"`
+}
+
+type SearchBC interface {
+	Search(ctx context.Context, query Query) ([]Result, error)
+}
+
+// SearchService answers name searches from an in-memory index per tenant. Each index is loaded
+// from the tenant's location store on first use and kept in sync by receiving location events.
+type SearchService struct {
+	stores     location.StoreFactory
+	Calculator *location.DistanceCalculator
+
+	mu      sync.Mutex
+	tenants map[string]*tenantIndex
+}
+
+// tenantIndex is the name index over the locations of one tenant
+type tenantIndex struct {
+	// loadMu serialises loads; a failed load is retried by the next search
+	loadMu sync.Mutex
+
+	mu     sync.RWMutex
+	index  *Index
+	loaded bool
+	// removed holds the locations deleted while the index was loading, so the load does not
+	// bring them back from an older snapshot
+	removed map[uint]struct{}
+}
+
+// NewSearchService creates a new search service over the locations of each tenant
+func NewSearchService(stores location.StoreFactory, calculator *location.DistanceCalculator) *SearchService {
+	return &SearchService{
+		stores:     stores,
+		Calculator: calculator,
+		tenants:    make(map[string]*tenantIndex),
+	}
+}
+
+// Publish applies a location change to the index of its tenant
+func (s *SearchService) Publish(event events.Event) {
+	loc, ok := event.Data.(*location.Location)
+	if !ok {
+		return
+	}
+
+	t := s.indexOf(tenant.OrDefault(loc.Tenant))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch event.Type {
+	case events.LocationCreated, events.LocationUpdated:
+		t.index.Put(*loc)
+	case events.LocationDeleted:
+		t.index.Remove(loc.ID)
+		if !t.loaded {
+			t.removed[loc.ID] = struct{}{}
+		}
+	}
+}
+
+// Search returns the locations of the tenant ctx acts for whose names best match the query, best first
+func (s *SearchService) Search(ctx context.Context, query Query) ([]Result, error) {
+	normalized := Normalize(query.Text)
+	if normalized == "" {
+		return nil, &location.ValidationError{Field: "q", Message: "is required"}
+	}
+	if len([]rune(query.Text)) > MaxQueryLength {
+		return nil, &location.ValidationError{Field: "q", Message: "must be at most 100 characters"}
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultLimit
+	}
+	if query.Limit < 0 || query.Limit > MaxLimit {
+		return nil, &location.ValidationError{Field: "limit", Message: "must be between 1 and 50"}
+	}
+	if query.Near != nil {
+		if err := location.ValidateCoordinates(query.Near.Latitude, query.Near.Longitude); err != nil {
+			return nil, err
+		}
+	}
+
+	id := tenant.FromContext(ctx)
+	t := s.indexOf(id)
+	if err := t.load(s.stores(id)); err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(normalized)
+	queryTrigrams := trigrams(normalized)
+
+	t.mu.RLock()
+	results := make([]Result, 0)
+	for _, e := range t.index.candidates(queryTrigrams) {
+		if query.Visible != nil && !query.Visible(&e.location) {
+			continue
+		}
+		score := match(e, normalized, words, queryTrigrams)
+		if score < minScore {
+			continue
+		}
+
+		result := Result{Location: e.location, Score: score}
+		if query.Near != nil {
+			distance := s.Calculator.HaversineDistance(query.Near.Latitude, query.Near.Longitude, e.location.Latitude, e.location.Longitude)
+			result.DistanceKm = &distance
+			result.Score += proximityBoost / (1 + distance/proximityScale)
+		}
+		results = append(results, result)
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if len(results[i].Location.Name) != len(results[j].Location.Name) {
+			return len(results[i].Location.Name) < len(results[j].Location.Name)
+		}
+		return results[i].Location.ID < results[j].Location.ID
+	})
+
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+// indexOf returns the index of a tenant, creating an empty one on first use
+func (s *SearchService) indexOf(id string) *tenantIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tenants[id]
+	if !ok {
+		t = &tenantIndex{index: NewIndex(), removed: make(map[uint]struct{})}
+		s.tenants[id] = t
+	}
+	return t
+}
+
+// load fills the index from the store until a load succeeds. Changes received while loading
+// are kept: a stored location only replaces an indexed one that is older.
+func (t *tenantIndex) load(store location.LocationStore) error {
+	if t.isLoaded() {
+		return nil
+	}
+
+	t.loadMu.Lock()
+	defer t.loadMu.Unlock()
+	if t.isLoaded() {
+		return nil
+	}
+
+	locations, err := store.GetAll()
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, l := range locations {
+		if _, ok := t.removed[l.ID]; ok {
+			continue
+		}
+		if indexed, ok := t.index.Get(l.ID); ok && !indexed.UpdatedAt.Before(l.UpdatedAt) {
+			continue
+		}
+		t.index.Put(l)
+	}
+	t.loaded = true
+	t.removed = nil
+	return nil
+}
+
+// isLoaded reports whether the index has been filled from the store
+func (t *tenantIndex) isLoaded() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.loaded
+}
+
+// match scores how well an indexed name matches the query, from 0 to 1. Exact and prefix matches
+// rank first for autocomplete, followed by names within a few typos of the query.
+func match(e *entry, normalized string, words []string, queryTrigrams map[string]struct{}) float64 {
+	switch {
+	case e.normalized == normalized:
+		return 1
+	case strings.HasPrefix(e.normalized, normalized):
+		return 0.9
+	case prefixesWords(words, e.words):
+		return 0.8
+	}
+
+	return max(similarity(queryTrigrams, e.trigrams), 0.7*fuzzy(words, e.words))
+}
+
+// prefixesWords reports whether every query word starts one of the name's words
+func prefixesWords(query, name []string) bool {
+	for _, q := range query {
+		found := false
+		for _, n := range name {
+			if strings.HasPrefix(n, q) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// fuzzy returns the average similarity of each query word to its closest name word, or 0 when a
+// query word is further from every name word than its allowed number of typos. The last query
+// word is also compared with prefixes of the name words as it may still be being typed.
+func fuzzy(query, name []string) float64 {
+	total := 0.0
+	for i, q := range query {
+		length := len([]rune(q))
+		allowed := allowedEdits(length)
+		best := -1
+		for _, n := range name {
+			distance := levenshtein(q, n)
+			if i == len(query)-1 {
+				if runes := []rune(n); len(runes) > length {
+					distance = min(distance, levenshtein(q, string(runes[:length])))
+				}
+			}
+			if distance <= allowed && (best < 0 || distance < best) {
+				best = distance
+			}
+		}
+		if best < 0 {
+			return 0
+		}
+		total += 1 - float64(best)/float64(length)
+	}
+	return total / float64(len(query))
+}
+
+// allowedEdits is the number of typos tolerated in a word of the given length
+func allowedEdits(length int) int {
+	switch {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
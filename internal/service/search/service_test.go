@@ -0,0 +1,287 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// memStore is an in-memory LocationStore; only GetAll is used by the search service
+type memStore struct {
+	location.LocationStore
+	locations []location.Location
+	loads     int
+	// fail fails every load while it is set
+	fail error
+}
+
+func (m *memStore) GetAll() ([]location.Location, error) {
+	m.loads++
+	if m.fail != nil {
+		return nil, m.fail
+	}
+	return m.locations, nil
+}
+
+// only serves the same store to every tenant
+func only(store location.LocationStore) location.StoreFactory {
+	return func(string) location.LocationStore { return store }
+}
+
+func newService(names ...string) (*SearchService, *memStore) {
+	store := &memStore{}
+	for i, name := range names {
+		store.locations = append(store.locations, location.Location{ID: uint(i + 1), Name: name, Latitude: float64(i), Longitude: 0})
+	}
+	return NewSearchService(only(store), &location.DistanceCalculator{}), store
+}
+
+func names(results []Result) []string {
+	found := make([]string, len(results))
+	for i, r := range results {
+		found[i] = r.Location.Name
+	}
+	return found
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"Zürich-Hbf":         "zurich hbf",
+		"  CAFÉ  de   Flore": "cafe de flore",
+		"São Paulo!":         "sao paulo",
+		"Øresund":            "øresund",
+		"---":                "",
+	}
+	for input, want := range cases {
+		if got := Normalize(input); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"kitten", "sitting", 3},
+		{"berlin", "berlin", 0},
+		{"", "abc", 3},
+		{"zürich", "zurich", 1},
+	}
+	for _, c := range cases {
+		if got := levenshtein(c.a, c.b); got != c.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestSearchRanksExactThenPrefix(t *testing.T) {
+	service, _ := newService("Berlin Hauptbahnhof", "Berlin", "Bern", "Oberlin Park")
+
+	results, err := service.Search(context.Background(), Query{Text: "berlin"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	got := names(results)
+	if len(got) < 2 || got[0] != "Berlin" || got[1] != "Berlin Hauptbahnhof" {
+		t.Fatalf("expected the exact match then the prefix match first, got %v", got)
+	}
+}
+
+func TestSearchAutocompletesWords(t *testing.T) {
+	service, _ := newService("Gare du Nord", "Gare de Lyon", "Nordbahnhof")
+
+	results, err := service.Search(context.Background(), Query{Text: "nord ga"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if got := names(results); len(got) == 0 || got[0] != "Gare du Nord" {
+		t.Fatalf("expected every word to prefix Gare du Nord, got %v", got)
+	}
+}
+
+func TestSearchIgnoresAccentsAndCase(t *testing.T) {
+	service, _ := newService("Zürich HB", "Genève Cornavin")
+
+	results, err := service.Search(context.Background(), Query{Text: "GENEVE"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if got := names(results); len(got) != 1 || got[0] != "Genève Cornavin" {
+		t.Fatalf("expected Genève Cornavin, got %v", got)
+	}
+}
+
+func TestSearchToleratesTypos(t *testing.T) {
+	service, _ := newService("Amsterdam Centraal", "Rotterdam Centraal", "Utrecht")
+
+	results, err := service.Search(context.Background(), Query{Text: "amstredam"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if got := names(results); len(got) == 0 || got[0] != "Amsterdam Centraal" {
+		t.Fatalf("expected Amsterdam Centraal for a transposition, got %v", got)
+	}
+
+	results, err = service.Search(context.Background(), Query{Text: "xyz"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 0 {
+		t.Fatalf("expected no match for an unrelated query, got %v", names(results))
+	}
+}
+
+func TestSearchBoostsNearbyLocations(t *testing.T) {
+	store := &memStore{locations: []location.Location{
+		{ID: 1, Name: "Central Station", Latitude: 52.37, Longitude: 4.90},
+		{ID: 2, Name: "Central Station", Latitude: 51.92, Longitude: 4.47},
+	}}
+	service := NewSearchService(only(store), &location.DistanceCalculator{})
+
+	results, err := service.Search(context.Background(), Query{Text: "central", Near: &location.Point{Latitude: 51.92, Longitude: 4.47}})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 || results[0].Location.ID != 2 {
+		t.Fatalf("expected the nearby station first, got %+v", results)
+	}
+	if results[0].DistanceKm == nil || *results[0].DistanceKm > 0.001 {
+		t.Fatalf("expected a zero distance for the nearby station, got %v", results[0].DistanceKm)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Fatalf("expected the nearby station to score higher: %v <= %v", results[0].Score, results[1].Score)
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	service, _ := newService("Park 1", "Park 2", "Park 3")
+
+	results, err := service.Search(context.Background(), Query{Text: "park", Limit: 2})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+}
+
+func TestSearchValidation(t *testing.T) {
+	service, _ := newService("Park")
+
+	invalid := []Query{
+		{Text: "  "},
+		{Text: "park", Limit: 51},
+		{Text: "park", Limit: -1},
+		{Text: "park", Near: &location.Point{Latitude: 91}},
+		{Text: strings.Repeat("a", MaxQueryLength+1)},
+	}
+	for _, query := range invalid {
+		if _, err := service.Search(context.Background(), query); err == nil {
+			t.Errorf("expected %+v to be rejected", query)
+		} else if _, ok := err.(*location.ValidationError); !ok {
+			t.Errorf("expected a validation error for %+v, got %T", query, err)
+		}
+	}
+}
+
+func TestSearchFollowsLocationEvents(t *testing.T) {
+	service, store := newService("Harbour")
+
+	if _, err := service.Search(context.Background(), Query{Text: "harbour"}); err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	service.Publish(events.New(events.LocationCreated, &location.Location{ID: 2, Name: "Lighthouse"}))
+	service.Publish(events.New(events.LocationUpdated, &location.Location{ID: 1, Name: "Marina"}))
+
+	results, _ := service.Search(context.Background(), Query{Text: "lighthouse"})
+	if got := names(results); len(got) != 1 || got[0] != "Lighthouse" {
+		t.Fatalf("expected the created location to be found, got %v", got)
+	}
+	results, _ = service.Search(context.Background(), Query{Text: "harbour"})
+	if len(results) != 0 {
+		t.Fatalf("expected the old name to be gone after the update, got %v", names(results))
+	}
+
+	service.Publish(events.New(events.LocationDeleted, &location.Location{ID: 2, Name: "Lighthouse"}))
+	results, _ = service.Search(context.Background(), Query{Text: "lighthouse"})
+	if len(results) != 0 {
+		t.Fatalf("expected the deleted location to be gone, got %v", names(results))
+	}
+
+	if store.loads != 1 {
+		t.Fatalf("expected the store to be read once, got %d", store.loads)
+	}
+}
+
+func TestLoadKeepsChangesReceivedBeforeIt(t *testing.T) {
+	now := time.Now()
+	store := &memStore{locations: []location.Location{
+		{ID: 1, Name: "Old Name", UpdatedAt: now},
+		{ID: 2, Name: "Removed", UpdatedAt: now},
+	}}
+	service := NewSearchService(only(store), &location.DistanceCalculator{})
+
+	service.Publish(events.New(events.LocationUpdated, &location.Location{ID: 1, Name: "New Name", UpdatedAt: now.Add(time.Second)}))
+	service.Publish(events.New(events.LocationDeleted, &location.Location{ID: 2, Name: "Removed"}))
+
+	results, err := service.Search(context.Background(), Query{Text: "name"})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if got := names(results); len(got) != 1 || got[0] != "New Name" {
+		t.Fatalf("expected the newer event to win over the snapshot, got %v", got)
+	}
+
+	results, _ = service.Search(context.Background(), Query{Text: "removed"})
+	if len(results) != 0 {
+		t.Fatalf("expected the location deleted before loading to stay gone, got %v", names(results))
+	}
+}
+
+func TestLoadIsRetriedAfterAFailure(t *testing.T) {
+	service, store := newService("Harbour")
+	store.fail = errors.New("database unavailable")
+
+	if _, err := service.Search(context.Background(), Query{Text: "harbour"}); err == nil {
+		t.Fatal("expected the load error")
+	}
+
+	store.fail = nil
+	results, err := service.Search(context.Background(), Query{Text: "harbour"})
+	if err != nil {
+		t.Fatalf("Search: %v, expected the load to be retried", err)
+	}
+	if len(results) != 1 || store.loads != 2 {
+		t.Fatalf("expected the location after %d loads, got %v", store.loads, names(results))
+	}
+}
+
+func TestSearchKeepsTenantsApart(t *testing.T) {
+	stores := map[string]*memStore{
+		tenant.Default: {locations: []location.Location{{ID: 1, Name: "Harbour"}}},
+		"acme":         {locations: []location.Location{{ID: 2, Name: "Harbour Gate", Tenant: "acme"}}},
+	}
+	service := NewSearchService(func(id string) location.LocationStore { return stores[id] }, &location.DistanceCalculator{})
+	acme := tenant.WithTenant(context.Background(), "acme")
+
+	service.Publish(events.New(events.LocationCreated, &location.Location{ID: 3, Name: "Harbour Lights", Tenant: "acme"}))
+
+	results, _ := service.Search(context.Background(), Query{Text: "harbour"})
+	if got := names(results); len(got) != 1 || got[0] != "Harbour" {
+		t.Fatalf("expected only the default tenant's location, got %v", got)
+	}
+	results, _ = service.Search(acme, Query{Text: "harbour"})
+	if got := names(results); len(got) != 2 {
+		t.Fatalf("expected both of acme's locations, got %v", got)
+	}
+}
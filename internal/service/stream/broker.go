@@ -0,0 +1,188 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// Message is a location change as delivered to stream subscribers. IDs are those of the
+// outbox entries recording the changes, so an ID means the same change on every instance
+// and across restarts. They are not necessarily delivered in increasing order.
+type Message struct {
+	ID         uint64            `json:"-"`
+	Type       string            `json:"type"`
+	Location   location.Location `json:"location"`
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+// Filter narrows a subscription to the locations of a tenant, in a bounding box and/or categories.
+// Zero values match everything.
+type Filter struct {
+	Tenant     string
+	BBox       *location.BoundingBox
+	Categories []string
+	// Visible, when set, leaves out the locations it rejects
+	Visible func(l *location.Location) bool
+}
+
+// Matches reports whether the message passes the filter
+func (f Filter) Matches(msg Message) bool {
+	if f.Tenant != "" && f.Tenant != tenant.OrDefault(msg.Location.Tenant) {
+		return false
+	}
+	if f.Visible != nil && !f.Visible(&msg.Location) {
+		return false
+	}
+	if f.BBox != nil && !f.BBox.Contains(msg.Location.Latitude, msg.Location.Longitude) {
+		return false
+	}
+	if len(f.Categories) == 0 {
+		return true
+	}
+	for _, category := range f.Categories {
+		if strings.EqualFold(category, msg.Location.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the messages matching its filter. C is closed when the subscription
+// is cancelled or when the subscriber falls so far behind that its buffer overflows.
+type Subscription struct {
+	C <-chan Message
+
+	ch       chan Message
+	filter   Filter
+	overflow bool
+}
+
+// Overflowed reports whether the subscription was dropped because its buffer was full
+func (s *Subscription) Overflowed() bool {
+	return s.overflow
+}
+
+// Broker fans location change events out to stream subscribers and keeps a bounded
+// history so that reconnecting clients can resume from the last message they saw
+type Broker struct {
+	mu          sync.Mutex
+	history     []Message
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBroker creates a broker keeping historySize past messages and buffering up to
+// bufferSize messages per subscriber
+func NewBroker(historySize, bufferSize int) *Broker {
+	return &Broker{
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish records location change events and forwards them to matching subscribers.
+// Other events are ignored.
+func (b *Broker) Publish(event events.Event) {
+	loc, ok := event.Data.(*location.Location)
+	if !ok {
+		return
+	}
+	switch event.Type {
+	case events.LocationCreated, events.LocationUpdated, events.LocationDeleted:
+	default:
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg := Message{
+		ID:         loc.ChangeID,
+		Type:       event.Type,
+		Location:   *loc,
+		OccurredAt: event.OccurredAt,
+	}
+
+	b.history = append(b.history, msg)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(msg) {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			// A subscriber that cannot keep up is dropped rather than stalling everyone else;
+			// it can reconnect with Last-Event-ID and resume from the history
+			sub.overflow = true
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe registers a new subscriber. When lastEventID is non-zero the messages published after
+// it are replayed from the history; complete is false if it is no longer or was never in the
+// history, as when it was evicted or published by another instance.
+func (b *Broker) Subscribe(filter Filter, lastEventID uint64) (sub *Subscription, replay []Message, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Message, b.bufferSize)
+	sub = &Subscription{C: ch, ch: ch, filter: filter}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+
+	// IDs are not published in order, so the replay starts after the position of the last one seen
+	for i := len(b.history) - 1; i >= 0; i-- {
+		if b.history[i].ID != lastEventID {
+			continue
+		}
+		for _, msg := range b.history[i+1:] {
+			if filter.Matches(msg) {
+				replay = append(replay, msg)
+			}
+		}
+		return sub, replay, true
+	}
+	return sub, nil, false
+}
+
+// Unsubscribe cancels a subscription and closes its channel
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// LastID returns the ID of the most recent message, or 0 if none was published yet
+func (b *Broker) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.history) == 0 {
+		return 0
+	}
+	return b.history[len(b.history)-1].ID
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
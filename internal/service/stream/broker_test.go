@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+)
+
+// publish publishes the change recorded by the outbox entry id
+func publish(b *Broker, id uint64, eventType, name, category string, lat, lng float64) {
+	b.Publish(events.New(eventType, &location.Location{Name: name, Category: category, Latitude: lat, Longitude: lng, ChangeID: id}))
+}
+
+func TestFilterMatches(t *testing.T) {
+	msg := Message{Location: location.Location{Latitude: 10, Longitude: 20, Category: "Fuel"}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "Empty filter", filter: Filter{}, want: true},
+		{name: "Inside bbox", filter: Filter{BBox: &location.BoundingBox{MinLat: 0, MinLng: 0, MaxLat: 20, MaxLng: 30}}, want: true},
+		{name: "Outside bbox", filter: Filter{BBox: &location.BoundingBox{MinLat: 11, MinLng: 0, MaxLat: 20, MaxLng: 30}}, want: false},
+		{name: "Category case-insensitive", filter: Filter{Categories: []string{"ev", "fuel"}}, want: true},
+		{name: "Other category", filter: Filter{Categories: []string{"ev"}}, want: false},
+		{name: "Default tenant", filter: Filter{Tenant: "default"}, want: true},
+		{name: "Other tenant", filter: Filter{Tenant: "acme"}, want: false},
+		{name: "Hidden location", filter: Filter{Visible: func(l *location.Location) bool { return l.Category != "Fuel" }}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(msg); got != tt.want {
+				t.Errorf("Matches() = %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeReceivesMatchingEvents(t *testing.T) {
+	broker := NewBroker(10, 10)
+	sub, _, _ := broker.Subscribe(Filter{Categories: []string{"fuel"}}, 0)
+
+	publish(broker, 1, events.LocationCreated, "A", "ev", 0, 0)
+	publish(broker, 2, events.LocationCreated, "B", "fuel", 0, 0)
+	broker.Publish(events.New(events.ZoneEnter, nil))
+
+	msg := <-sub.C
+	if msg.Location.Name != "B" || msg.ID != 2 {
+		t.Errorf("received %+v, expected B with ID 2", msg)
+	}
+	select {
+	case extra := <-sub.C:
+		t.Errorf("unexpected message %+v", extra)
+	default:
+	}
+
+	broker.Unsubscribe(sub)
+	if _, ok := <-sub.C; ok {
+		t.Error("channel should be closed after Unsubscribe")
+	}
+}
+
+func TestSubscribeResumesFromLastEventID(t *testing.T) {
+	broker := NewBroker(3, 10)
+	// Entries 3 and 4 were written concurrently and committed out of order
+	for i, id := range []uint64{1, 2, 4, 3, 5} {
+		publish(broker, id, events.LocationUpdated, string(rune('A'+i)), "", 0, 0)
+	}
+
+	_, replay, complete := broker.Subscribe(Filter{}, 4)
+	if !complete {
+		t.Error("resume from an ID still in history should be complete")
+	}
+	if len(replay) != 2 || replay[0].Location.Name != "D" || replay[1].Location.Name != "E" {
+		t.Errorf("replay = %+v, expected D and E", replay)
+	}
+	if broker.LastID() != 5 {
+		t.Errorf("LastID() = %d, expected 5", broker.LastID())
+	}
+
+	if _, _, complete := broker.Subscribe(Filter{}, 0); !complete {
+		t.Error("a fresh subscription should be complete")
+	}
+	if _, _, complete := broker.Subscribe(Filter{}, 1); complete {
+		t.Error("resume from an evicted ID should be incomplete")
+	}
+	if _, _, complete := broker.Subscribe(Filter{}, 99); complete {
+		t.Error("resume from an ID of another instance should be incomplete")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	broker := NewBroker(10, 1)
+	slow, _, _ := broker.Subscribe(Filter{}, 0)
+
+	publish(broker, 1, events.LocationCreated, "A", "", 0, 0)
+	publish(broker, 2, events.LocationCreated, "B", "", 0, 0)
+
+	<-slow.C
+	if _, ok := <-slow.C; ok {
+		t.Fatal("slow subscriber should have been closed")
+	}
+	if !slow.Overflowed() {
+		t.Error("Overflowed() = false, expected true")
+	}
+}
@@ -0,0 +1,338 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// Options configures how positions are turned into zone events
+type Options struct {
+	// StationRadiusMeters is used for stations that do not set their own radius
+	StationRadiusMeters float64
+	// Debounce is how long a device must stay on the other side of a zone boundary before enter/exit fires
+	Debounce time.Duration
+	// Dwell is how long a device must stay inside a zone before a dwell event fires
+	Dwell time.Duration
+}
+
+// DefaultOptions returns the options used when nothing is configured
+func DefaultOptions() Options {
+	return Options{
+		StationRadiusMeters: 200,
+		Debounce:            30 * time.Second,
+		Dwell:               5 * time.Minute,
+	}
+}
+
+type TrackingBC interface {
+	IngestPositions(ctx context.Context, deviceID string, positions []PositionRequest) (*IngestResult, error)
+	GetEvents(ctx context.Context, query EventQuery) ([]Event, error)
+}
+
+// publishedTypes maps tracking event types to the types published on the event bus
+var publishedTypes = map[string]string{
+	EventEnter: events.ZoneEnter,
+	EventExit:  events.ZoneExit,
+	EventDwell: events.ZoneDwell,
+}
+
+// TrackingService evaluates device positions against station radii and geofences
+type TrackingService struct {
+	repo       TrackingStore
+	locations  location.StoreFactory
+	geofences  geofence.GeofenceBC
+	Calculator *location.DistanceCalculator
+	options    Options
+	events     events.Publisher
+	now        func() time.Time
+
+	// locks serialises ingestion per tenant and device so zone states are never updated concurrently.
+	// A lock is dropped once no ingestion holds or waits for it.
+	mu    sync.Mutex
+	locks map[string]*deviceLock
+}
+
+// deviceLock is the lock of one device and the number of ingestions holding or waiting for it
+type deviceLock struct {
+	sync.Mutex
+	users int
+}
+
+// NewTrackingService creates a new tracking service that reports zone events to publisher
+func NewTrackingService(repo TrackingStore, locations location.StoreFactory, geofences geofence.GeofenceBC, calculator *location.DistanceCalculator, options Options, publisher events.Publisher) TrackingBC {
+	if publisher == nil {
+		publisher = events.Nop{}
+	}
+	return &TrackingService{
+		repo:       repo,
+		locations:  locations,
+		geofences:  geofences,
+		Calculator: calculator,
+		options:    options,
+		events:     publisher,
+		now:        time.Now,
+		locks:      make(map[string]*deviceLock),
+	}
+}
+
+// IngestPositions records a batch of positions for a device and returns the zone events they caused.
+// Positions are processed in time order; positions older than the latest stored one are ignored.
+// Devices, their zones and stations belong to the tenant ctx acts for.
+func (s *TrackingService) IngestPositions(ctx context.Context, deviceID string, positions []PositionRequest) (*IngestResult, error) {
+	if deviceID == "" {
+		return nil, &location.ValidationError{Field: "device_id", Message: "is required"}
+	}
+	if len(positions) == 0 {
+		return nil, &location.ValidationError{Field: "positions", Message: "at least one position is required"}
+	}
+	if len(positions) > MaxBatchSize {
+		return nil, &location.ValidationError{Field: "positions", Message: "too many positions in one batch"}
+	}
+	latestAllowed := s.now().Add(MaxClockSkew)
+	for _, p := range positions {
+		if err := location.ValidateCoordinates(p.Latitude, p.Longitude); err != nil {
+			return nil, err
+		}
+		if p.RecordedAt != nil && p.RecordedAt.After(latestAllowed) {
+			return nil, &location.ValidationError{Field: "recorded_at", Message: "must not be more than 2 minutes in the future"}
+		}
+	}
+
+	id := tenant.FromContext(ctx)
+	unlock := s.lock(id + "/" + deviceID)
+	defer unlock()
+
+	samples := s.normalise(positions)
+
+	latest, err := s.repo.GetPosition(id, deviceID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	stored, err := s.repo.GetZoneStates(id, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	states := make(map[zoneKey]*ZoneState, len(stored))
+	for i := range stored {
+		states[zoneKey{stored[i].ZoneType, stored[i].ZoneID}] = &stored[i]
+	}
+
+	stations, err := s.locations(id).GetReaching(bounds(samples), s.options.StationRadiusMeters)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IngestResult{Events: make([]Event, 0)}
+	for _, sample := range samples {
+		if latest != nil && sample.RecordedAt.Before(latest.RecordedAt) {
+			result.Ignored++
+			continue
+		}
+
+		observed, err := s.zonesAt(ctx, sample.Latitude, sample.Longitude, stations)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, name := range observed {
+			if _, ok := states[key]; !ok {
+				states[key] = &ZoneState{Tenant: id, DeviceID: deviceID, ZoneType: key.zoneType, ZoneID: key.zoneID, ZoneName: name}
+			}
+		}
+
+		for _, key := range sortedKeys(states) {
+			state := states[key]
+			_, inside := observed[key]
+			for _, eventType := range s.advance(state, inside, sample.RecordedAt) {
+				result.Events = append(result.Events, Event{
+					Tenant:     id,
+					DeviceID:   deviceID,
+					Type:       eventType,
+					ZoneType:   state.ZoneType,
+					ZoneID:     state.ZoneID,
+					ZoneName:   state.ZoneName,
+					Latitude:   sample.Latitude,
+					Longitude:  sample.Longitude,
+					OccurredAt: sample.RecordedAt,
+				})
+			}
+		}
+
+		latest = &DevicePosition{
+			Tenant:     id,
+			DeviceID:   deviceID,
+			Latitude:   sample.Latitude,
+			Longitude:  sample.Longitude,
+			RecordedAt: sample.RecordedAt,
+		}
+		result.Accepted++
+	}
+
+	if result.Accepted == 0 {
+		return result, nil
+	}
+
+	updated := make([]ZoneState, 0, len(states))
+	for _, state := range states {
+		updated = append(updated, *state)
+	}
+
+	if err := s.repo.Record(latest, updated, result.Events); err != nil {
+		return nil, err
+	}
+
+	for _, event := range result.Events {
+		s.events.Publish(events.ForTenant(id, publishedTypes[event.Type], event))
+	}
+
+	result.Position = latest
+	return result, nil
+}
+
+// GetEvents returns the events of the tenant ctx acts for matching the query
+func (s *TrackingService) GetEvents(ctx context.Context, query EventQuery) ([]Event, error) {
+	return s.repo.QueryEvents(tenant.FromContext(ctx), query)
+}
+
+// lock locks the device with the given key and returns the function unlocking it
+func (s *TrackingService) lock(key string) func() {
+	s.mu.Lock()
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = &deviceLock{}
+		s.locks[key] = lock
+	}
+	lock.users++
+	s.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// bounds returns the smallest bounding box around the samples
+func bounds(samples []DevicePosition) location.BoundingBox {
+	box := location.BoundingBox{MinLat: samples[0].Latitude, MinLng: samples[0].Longitude, MaxLat: samples[0].Latitude, MaxLng: samples[0].Longitude}
+	for _, sample := range samples[1:] {
+		box.MinLat = min(box.MinLat, sample.Latitude)
+		box.MinLng = min(box.MinLng, sample.Longitude)
+		box.MaxLat = max(box.MaxLat, sample.Latitude)
+		box.MaxLng = max(box.MaxLng, sample.Longitude)
+	}
+	return box
+}
+
+// normalise stamps positions without a timestamp with the current time and sorts them chronologically
+func (s *TrackingService) normalise(positions []PositionRequest) []DevicePosition {
+	now := s.now().UTC()
+	samples := make([]DevicePosition, 0, len(positions))
+	for _, p := range positions {
+		recordedAt := now
+		if p.RecordedAt != nil {
+			recordedAt = p.RecordedAt.UTC()
+		}
+		samples = append(samples, DevicePosition{Latitude: p.Latitude, Longitude: p.Longitude, RecordedAt: recordedAt})
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].RecordedAt.Before(samples[j].RecordedAt)
+	})
+
+	return samples
+}
+
+// zonesAt returns the name of every station radius and geofence of the tenant ctx acts for covering the point
+func (s *TrackingService) zonesAt(ctx context.Context, lat, lng float64, stations []location.Location) (map[zoneKey]string, error) {
+	zones := make(map[zoneKey]string)
+
+	for _, station := range stations {
+		radius := station.RadiusMeters
+		if radius <= 0 {
+			radius = s.options.StationRadiusMeters
+		}
+		if s.Calculator.HaversineDistance(lat, lng, station.Latitude, station.Longitude)*1000 <= radius {
+			zones[zoneKey{ZoneLocation, station.ID}] = station.Name
+		}
+	}
+
+	if s.geofences != nil {
+		containing, err := s.geofences.FindContaining(ctx, lat, lng)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range containing {
+			zones[zoneKey{ZoneGeofence, g.ID}] = g.Name
+		}
+	}
+
+	return zones, nil
+}
+
+// advance moves a zone state forward to a new observation and returns the events it fires.
+// A change of side only becomes an enter or exit once it has persisted for the debounce window,
+// so a device jittering across a boundary does not flap.
+func (s *TrackingService) advance(state *ZoneState, inside bool, at time.Time) []string {
+	var fired []string
+
+	if inside == state.Inside {
+		state.PendingSince = nil
+	} else {
+		if state.PendingSince == nil {
+			since := at
+			state.PendingSince = &since
+		}
+		if at.Sub(*state.PendingSince) >= s.options.Debounce {
+			since := *state.PendingSince
+			state.Inside = inside
+			state.PendingSince = nil
+			state.DwellEmitted = false
+			if inside {
+				state.EnteredAt = &since
+				fired = append(fired, EventEnter)
+			} else {
+				state.EnteredAt = nil
+				fired = append(fired, EventExit)
+			}
+		}
+	}
+
+	if state.Inside && !state.DwellEmitted && state.EnteredAt != nil && at.Sub(*state.EnteredAt) >= s.options.Dwell {
+		state.DwellEmitted = true
+		fired = append(fired, EventDwell)
+	}
+
+	return fired
+}
+
+// sortedKeys orders zones so events fired by the same position are stored deterministically
+func sortedKeys(states map[zoneKey]*ZoneState) []zoneKey {
+	keys := make([]zoneKey, 0, len(states))
+	for key := range states {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].zoneType != keys[j].zoneType {
+			return keys[i].zoneType < keys[j].zoneType
+		}
+		return keys[i].zoneID < keys[j].zoneID
+	})
+	return keys
+}
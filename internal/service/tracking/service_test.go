@@ -0,0 +1,247 @@
+package tracking
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory TrackingStore used by the service tests
+type memStore struct {
+	positions map[string]DevicePosition
+	states    map[string][]ZoneState
+	events    []Event
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		positions: make(map[string]DevicePosition),
+		states:    make(map[string][]ZoneState),
+	}
+}
+
+func (m *memStore) GetPosition(tenant, deviceID string) (*DevicePosition, error) {
+	p, ok := m.positions[tenant+"/"+deviceID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &p, nil
+}
+
+func (m *memStore) GetZoneStates(tenant, deviceID string) ([]ZoneState, error) {
+	return append([]ZoneState(nil), m.states[tenant+"/"+deviceID]...), nil
+}
+
+func (m *memStore) Record(position *DevicePosition, states []ZoneState, events []Event) error {
+	m.positions[position.Tenant+"/"+position.DeviceID] = *position
+	var kept []ZoneState
+	for _, state := range states {
+		if state.Inside || state.PendingSince != nil {
+			kept = append(kept, state)
+		}
+	}
+	m.states[position.Tenant+"/"+position.DeviceID] = kept
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memStore) QueryEvents(tenant string, query EventQuery) ([]Event, error) {
+	var matching []Event
+	for _, event := range m.events {
+		if event.Tenant == tenant {
+			matching = append(matching, event)
+		}
+	}
+	return matching, nil
+}
+
+// stationStore serves a fixed set of stations
+type stationStore struct {
+	location.LocationStore
+	stations []location.Location
+}
+
+func (s *stationStore) GetReaching(box location.BoundingBox, defaultRadiusMeters float64) ([]location.Location, error) {
+	return s.stations, nil
+}
+
+// noGeofences is a GeofenceBC without any geofences
+type noGeofences struct {
+	geofence.GeofenceBC
+}
+
+func (noGeofences) FindContaining(ctx context.Context, lat, lng float64) ([]geofence.Geofence, error) {
+	return nil, nil
+}
+
+var start = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(seconds int, lat, lng float64) PositionRequest {
+	t := start.Add(time.Duration(seconds) * time.Second)
+	return PositionRequest{Latitude: lat, Longitude: lng, RecordedAt: &t}
+}
+
+func newTestService(store *memStore) TrackingBC {
+	stations := &stationStore{stations: []location.Location{
+		{ID: 1, Name: "Depot", Latitude: 0, Longitude: 0},
+	}}
+	return NewTrackingService(store, func(string) location.LocationStore { return stations }, noGeofences{}, &location.DistanceCalculator{}, Options{
+		StationRadiusMeters: 100,
+		Debounce:            30 * time.Second,
+		Dwell:               2 * time.Minute,
+	}, nil)
+}
+
+func eventTypes(events []Event) []string {
+	types := make([]string, 0, len(events))
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestIngestPositionsEmitsDebouncedEnterDwellAndExit(t *testing.T) {
+	store := newMemStore()
+	service := newTestService(store)
+
+	outside, inside := 0.01, 0.0
+
+	result, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{
+		at(0, outside, 0),
+		at(10, inside, 0),
+		at(20, inside, 0),
+		at(40, inside, 0),
+		at(200, inside, 0),
+		at(210, outside, 0),
+		at(250, outside, 0),
+	})
+	if err != nil {
+		t.Fatalf("IngestPositions() error = %v", err)
+	}
+
+	types := eventTypes(result.Events)
+	expected := []string{EventEnter, EventDwell, EventExit}
+	if len(types) != len(expected) {
+		t.Fatalf("events = %v, expected %v", types, expected)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("events = %v, expected %v", types, expected)
+			break
+		}
+	}
+
+	if got := result.Events[0].OccurredAt; !got.Equal(start.Add(40 * time.Second)) {
+		t.Errorf("enter occurred at %v, expected confirmation time", got)
+	}
+	if result.Accepted != 7 {
+		t.Errorf("accepted = %d, expected 7", result.Accepted)
+	}
+}
+
+func TestIngestPositionsIgnoresBoundaryJitter(t *testing.T) {
+	store := newMemStore()
+	service := newTestService(store)
+
+	result, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{
+		at(0, 0.01, 0),
+		at(10, 0, 0),
+		at(20, 0.01, 0),
+		at(30, 0, 0),
+		at(40, 0.01, 0),
+	})
+	if err != nil {
+		t.Fatalf("IngestPositions() error = %v", err)
+	}
+
+	if len(result.Events) != 0 {
+		t.Errorf("events = %v, expected none while jittering", eventTypes(result.Events))
+	}
+}
+
+func TestIngestPositionsAcrossRequestsAndOutOfOrder(t *testing.T) {
+	store := newMemStore()
+	service := newTestService(store)
+
+	if _, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{at(0, 0, 0)}); err != nil {
+		t.Fatalf("IngestPositions() error = %v", err)
+	}
+
+	result, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{at(-10, 0, 0), at(60, 0, 0)})
+	if err != nil {
+		t.Fatalf("IngestPositions() error = %v", err)
+	}
+
+	if result.Ignored != 1 || result.Accepted != 1 {
+		t.Errorf("accepted = %d ignored = %d, expected 1 and 1", result.Accepted, result.Ignored)
+	}
+	if types := eventTypes(result.Events); len(types) != 1 || types[0] != EventEnter {
+		t.Errorf("events = %v, expected a single enter", types)
+	}
+	if p := store.positions[tenant.Default+"/truck-1"]; !p.RecordedAt.Equal(start.Add(60 * time.Second)) {
+		t.Errorf("latest position recorded at %v", p.RecordedAt)
+	}
+}
+
+func TestIngestPositionsKeepsTenantsApart(t *testing.T) {
+	store := newMemStore()
+	service := newTestService(store)
+	acme := tenant.WithTenant(context.Background(), "acme")
+
+	if _, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{at(0, 0, 0), at(60, 0, 0)}); err != nil {
+		t.Fatalf("IngestPositions() error = %v", err)
+	}
+	result, err := service.IngestPositions(acme, "truck-1", []PositionRequest{at(30, 0, 0)})
+	if err != nil {
+		t.Fatalf("IngestPositions() error = %v", err)
+	}
+
+	if result.Ignored != 0 || result.Position.Tenant != "acme" {
+		t.Errorf("ignored = %d tenant = %q, expected the same device ID of another tenant to be a new device", result.Ignored, result.Position.Tenant)
+	}
+	if events, _ := service.GetEvents(acme, EventQuery{}); len(events) != 0 {
+		t.Errorf("GetEvents() in acme = %v, expected none of the default tenant's events", eventTypes(events))
+	}
+	if events, _ := service.GetEvents(context.Background(), EventQuery{}); len(events) != 1 {
+		t.Errorf("GetEvents() = %v, expected the default tenant's enter", eventTypes(events))
+	}
+}
+
+func TestIngestPositionsValidation(t *testing.T) {
+	service := newTestService(newMemStore())
+
+	if _, err := service.IngestPositions(context.Background(), "truck-1", nil); err == nil {
+		t.Error("expected an error for an empty batch")
+	}
+	if _, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{{Latitude: 91}}); err == nil {
+		t.Error("expected an error for an invalid latitude")
+	}
+
+	ahead := time.Now().Add(MaxClockSkew + time.Minute)
+	if _, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{{RecordedAt: &ahead}}); err == nil {
+		t.Error("expected an error for a position recorded too far in the future")
+	}
+	skewed := time.Now().Add(MaxClockSkew / 2)
+	if _, err := service.IngestPositions(context.Background(), "truck-1", []PositionRequest{{RecordedAt: &skewed}}); err != nil {
+		t.Errorf("IngestPositions() of a slightly skewed clock error = %v", err)
+	}
+}
+
+func TestIngestPositionsReleasesDeviceLocks(t *testing.T) {
+	service := newTestService(newMemStore())
+
+	for _, device := range []string{"truck-1", "truck-2"} {
+		if _, err := service.IngestPositions(context.Background(), device, []PositionRequest{at(0, 0, 0)}); err != nil {
+			t.Fatalf("IngestPositions() error = %v", err)
+		}
+	}
+
+	if locks := len(service.(*TrackingService).locks); locks != 0 {
+		t.Errorf("locks = %d, expected the locks of idle devices to be dropped", locks)
+	}
+}
@@ -0,0 +1,132 @@
+package tracking
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultEventLimit is the number of events returned when a query does not set a limit
+const DefaultEventLimit = 100
+
+// TenantKeySQL adds the tenant to the primary keys of tables created before devices
+// were scoped to tenants, which AutoMigrate does not change
+var TenantKeySQL = []string{
+	rekeySQL("device_positions", "tenant, device_id"),
+	rekeySQL("zone_states", "tenant, device_id, zone_type, zone_id"),
+}
+
+// rekeySQL replaces the primary key of table with columns unless it already includes the tenant
+func rekeySQL(table, columns string) string {
+	return `DO $$
+BEGIN
+	IF NOT EXISTS (
+		SELECT 1 FROM information_schema.table_constraints c
+		JOIN information_schema.key_column_usage k ON k.constraint_name = c.constraint_name AND k.table_name = c.table_name
+		WHERE c.table_name = '` + table + `' AND c.constraint_type = 'PRIMARY KEY' AND k.column_name = 'tenant'
+	) THEN
+		ALTER TABLE ` + table + ` DROP CONSTRAINT IF EXISTS ` + table + `_pkey, ADD PRIMARY KEY (` + columns + `);
+	END IF;
+END $$`
+}
+
+// TrackingStore defines the interface for device tracking data access
+type TrackingStore interface {
+	GetPosition(tenant, deviceID string) (*DevicePosition, error)
+	GetZoneStates(tenant, deviceID string) ([]ZoneState, error)
+	Record(position *DevicePosition, states []ZoneState, events []Event) error
+	QueryEvents(tenant string, query EventQuery) ([]Event, error)
+}
+
+// TrackingRepo provides data access methods for device positions and events
+type TrackingRepo struct {
+	db *gorm.DB
+}
+
+// NewTrackingRepo creates a new tracking repository
+func NewTrackingRepo(db *gorm.DB) TrackingStore {
+	return &TrackingRepo{
+		db: db,
+	}
+}
+
+// GetPosition retrieves the latest position of a device of the tenant
+func (s *TrackingRepo) GetPosition(tenant, deviceID string) (*DevicePosition, error) {
+	var position DevicePosition
+	err := s.db.Where("tenant = ? AND device_id = ?", tenant, deviceID).First(&position).Error
+	if err != nil {
+		return nil, err
+	}
+	return &position, nil
+}
+
+// GetZoneStates retrieves every zone a device of the tenant is inside of or transitioning into
+func (s *TrackingRepo) GetZoneStates(tenant, deviceID string) ([]ZoneState, error) {
+	var states []ZoneState
+	err := s.db.Where("tenant = ? AND device_id = ?", tenant, deviceID).Find(&states).Error
+	return states, err
+}
+
+// Record stores the latest position, the new zone states and any events in a single transaction.
+// States that are outside and have no pending transition are removed rather than stored.
+func (s *TrackingRepo) Record(position *DevicePosition, states []ZoneState, events []Event) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(position).Error; err != nil {
+			return err
+		}
+
+		for i := range states {
+			state := &states[i]
+			if !state.Inside && state.PendingSince == nil {
+				err := tx.Where("tenant = ? AND device_id = ? AND zone_type = ? AND zone_id = ?", state.Tenant, state.DeviceID, state.ZoneType, state.ZoneID).
+					Delete(&ZoneState{}).Error
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(state).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(events) > 0 {
+			if err := tx.Create(&events).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// QueryEvents retrieves the events of the tenant matching the query, oldest first
+func (s *TrackingRepo) QueryEvents(tenant string, query EventQuery) ([]Event, error) {
+	db := s.db.Model(&Event{}).Where("tenant = ?", tenant)
+	if query.DeviceID != "" {
+		db = db.Where("device_id = ?", query.DeviceID)
+	}
+	if query.Type != "" {
+		db = db.Where("type = ?", query.Type)
+	}
+	if query.ZoneType != "" {
+		db = db.Where("zone_type = ?", query.ZoneType)
+	}
+	if query.ZoneID != 0 {
+		db = db.Where("zone_id = ?", query.ZoneID)
+	}
+	if query.Since != nil {
+		db = db.Where("occurred_at >= ?", *query.Since)
+	}
+	if query.Until != nil {
+		db = db.Where("occurred_at < ?", *query.Until)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultEventLimit
+	}
+
+	var events []Event
+	err := db.Order("occurred_at, id").Limit(limit).Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,94 @@
+package tracking
+
+import "time"
+
+// Event types emitted when a device moves relative to a zone
+const (
+	EventEnter = "enter"
+	EventExit  = "exit"
+	EventDwell = "dwell"
+)
+
+// Zone types a device can be inside of
+const (
+	ZoneLocation = "location"
+	ZoneGeofence = "geofence"
+)
+
+// MaxBatchSize is the largest number of positions accepted in one request
+const MaxBatchSize = 1000
+
+// MaxClockSkew is how far ahead of the server clock a position may be recorded. Positions further
+// in the future would make every position recorded until then look out of order.
+const MaxClockSkew = 2 * time.Minute
+
+// DevicePosition is the latest known position of a device. Device IDs are unique per tenant.
+type DevicePosition struct {
+	Tenant     string    `json:"tenant" gorm:"primaryKey;not null;default:default"`
+	DeviceID   string    `json:"device_id" gorm:"primaryKey"`
+	Latitude   float64   `json:"latitude" gorm:"not null"`
+	Longitude  float64   `json:"longitude" gorm:"not null"`
+	RecordedAt time.Time `json:"recorded_at" gorm:"not null"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ZoneState tracks whether a device is inside a zone, including a pending
+// transition that has not yet outlasted the debounce window
+type ZoneState struct {
+	Tenant       string `gorm:"primaryKey;not null;default:default"`
+	DeviceID     string `gorm:"primaryKey"`
+	ZoneType     string `gorm:"primaryKey"`
+	ZoneID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	ZoneName     string `gorm:"not null"`
+	Inside       bool   `gorm:"not null"`
+	EnteredAt    *time.Time
+	PendingSince *time.Time
+	DwellEmitted bool `gorm:"not null"`
+}
+
+// Event records a device entering, leaving or dwelling in a zone
+type Event struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Tenant     string    `json:"tenant" gorm:"index;not null;default:default"`
+	DeviceID   string    `json:"device_id" gorm:"index;not null"`
+	Type       string    `json:"type" gorm:"index;not null"`
+	ZoneType   string    `json:"zone_type" gorm:"not null"`
+	ZoneID     uint      `json:"zone_id" gorm:"not null"`
+	ZoneName   string    `json:"zone_name" gorm:"not null"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	OccurredAt time.Time `json:"occurred_at" gorm:"index;not null"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PositionRequest represents a single position report from a device
+type PositionRequest struct {
+	Latitude   float64    `json:"latitude" binding:"min=-90,max=90"`
+	Longitude  float64    `json:"longitude" binding:"min=-180,max=180"`
+	RecordedAt *time.Time `json:"recorded_at"`
+}
+
+// IngestResult summarises what happened to a batch of positions
+type IngestResult struct {
+	Accepted int             `json:"accepted"`
+	Ignored  int             `json:"ignored"`
+	Position *DevicePosition `json:"position,omitempty"`
+	Events   []Event         `json:"events"`
+}
+
+// EventQuery filters the events returned by GET /events
+type EventQuery struct {
+	DeviceID string
+	Type     string
+	ZoneType string
+	ZoneID   uint
+	Since    *time.Time
+	Until    *time.Time
+	Limit    int
+}
+
+// zoneKey identifies a zone independently of the device
+type zoneKey struct {
+	zoneType string
+	zoneID   uint
+}
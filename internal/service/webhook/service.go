@@ -0,0 +1,561 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+)
+
+// maxErrorLength caps the error text kept in the delivery log
+const maxErrorLength = 500
+
+// Options configures delivery retries and the background workers
+type Options struct {
+	// MaxAttempts is the number of attempts before a delivery is dead-lettered
+	MaxAttempts int
+	// InitialBackoff is the wait after the first failed attempt, doubled after every further failure
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts
+	MaxBackoff time.Duration
+	// Timeout bounds a single HTTP attempt
+	Timeout time.Duration
+	// PollInterval is how often the worker looks for due deliveries when it is not woken up
+	PollInterval time.Duration
+	// BatchSize is the number of due deliveries processed per poll
+	BatchSize int
+	// Workers is the number of subscriptions delivered to at once. The deliveries of one
+	// subscription are sent in order by a single worker, so a slow receiver only holds up its own.
+	Workers int
+	// AllowPrivateNetworks lets subscriptions deliver to private, loopback and link-local addresses
+	AllowPrivateNetworks bool
+}
+
+// DefaultOptions returns the options used when nothing is configured
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:    8,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Hour,
+		Timeout:        10 * time.Second,
+		PollInterval:   time.Second,
+		BatchSize:      50,
+		Workers:        8,
+	}
+}
+
+type WebhookBC interface {
+	CreateSubscription(ctx context.Context, req CreateSubscriptionRequest) (*Subscription, error)
+	GetSubscriptions(ctx context.Context) ([]Subscription, error)
+	GetSubscription(ctx context.Context, id uint) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, id uint) error
+	GetDeliveries(ctx context.Context, query DeliveryQuery) ([]Delivery, error)
+	RetryDelivery(ctx context.Context, id uint) (*Delivery, error)
+}
+
+// WebhookService manages subscriptions, queues a delivery per matching subscription for every
+// published event and runs the workers that send them
+type WebhookService struct {
+	repo     WebhookStore
+	client   *http.Client
+	resolver *net.Resolver
+	options  Options
+	now      func() time.Time
+
+	mu      sync.Mutex
+	busy    map[uint]bool
+	workers sync.WaitGroup
+
+	wake      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewWebhookService creates a new webhook service. Call Start to begin sending deliveries.
+func NewWebhookService(repo WebhookStore, options Options) *WebhookService {
+	return &WebhookService{
+		repo:     repo,
+		client:   newClient(options),
+		resolver: net.DefaultResolver,
+		options:  options,
+		now:      time.Now,
+		busy:     make(map[uint]bool),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// CreateSubscription registers a new webhook subscription for the tenant ctx acts for
+func (s *WebhookService) CreateSubscription(ctx context.Context, req CreateSubscriptionRequest) (*Subscription, error) {
+	if err := s.checkURL(ctx, req.URL); err != nil {
+		return nil, err
+	}
+	for _, eventType := range req.EventTypes {
+		if !knownEventType(eventType) {
+			return nil, &location.ValidationError{Field: "event_types", Message: "unknown event type " + eventType}
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	subscription := &Subscription{
+		Tenant:     tenant.FromContext(ctx),
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+		Active:     true,
+	}
+
+	if err := s.repo.CreateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	// The secret is only ever returned on creation
+	return subscription, nil
+}
+
+// GetSubscriptions returns all subscriptions of the tenant ctx acts for without their secrets
+func (s *WebhookService) GetSubscriptions(ctx context.Context) ([]Subscription, error) {
+	subscriptions, err := s.repo.GetSubscriptions(tenant.FromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns a single subscription without its secret
+func (s *WebhookService) GetSubscription(ctx context.Context, id uint) (*Subscription, error) {
+	subscription, err := s.repo.GetSubscription(tenant.FromContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+// DeleteSubscription removes a subscription together with its delivery log
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id uint) error {
+	owner := tenant.FromContext(ctx)
+	// Check if subscription exists
+	if _, err := s.repo.GetSubscription(owner, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteSubscription(owner, id)
+}
+
+// GetDeliveries returns the delivery log of a subscription
+func (s *WebhookService) GetDeliveries(ctx context.Context, query DeliveryQuery) ([]Delivery, error) {
+	owner := tenant.FromContext(ctx)
+	if _, err := s.repo.GetSubscription(owner, query.SubscriptionID); err != nil {
+		return nil, err
+	}
+	return s.repo.QueryDeliveries(owner, query)
+}
+
+// RetryDelivery puts a dead-lettered delivery back in the queue with a fresh set of attempts
+func (s *WebhookService) RetryDelivery(ctx context.Context, id uint) (*Delivery, error) {
+	delivery, err := s.repo.GetDelivery(tenant.FromContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != StatusDead {
+		return nil, &NotDeadError{ID: id, Status: delivery.Status}
+	}
+
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = s.now().UTC()
+	if err := s.repo.UpdateDelivery(delivery); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+	return delivery, nil
+}
+
+// Publish queues a delivery of the event for every active subscription of its tenant interested in it
+func (s *WebhookService) Publish(event events.Event) {
+	owner := tenant.OrDefault(event.Tenant)
+	subscriptions, err := s.repo.GetSubscriptions(owner)
+	if err != nil {
+		log.WithError(err).Error("Failed to load webhook subscriptions")
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.WithError(err).WithField("event_type", event.Type).Error("Failed to encode webhook payload")
+		return
+	}
+
+	now := s.now().UTC()
+	var deliveries []Delivery
+	for _, subscription := range subscriptions {
+		if !subscription.Active || !subscription.Matches(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			Tenant:         owner,
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := s.repo.CreateDeliveries(deliveries); err != nil {
+		log.WithError(err).WithField("event_type", event.Type).Error("Failed to queue webhook deliveries")
+		return
+	}
+
+	s.notify()
+}
+
+// Start runs the delivery workers in the background until Stop is called
+func (s *WebhookService) Start() {
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Stop signals the workers to finish the delivery they are sending and waits for them to exit
+func (s *WebhookService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.startOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.done
+}
+
+func (s *WebhookService) run() {
+	defer close(s.done)
+	defer s.workers.Wait()
+
+	ticker := time.NewTicker(s.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+
+		// Keep draining while full batches come back so a backlog is not throttled by the ticker
+		for s.deliverDue() == s.options.BatchSize {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue hands the due deliveries of every subscription without a running worker to a new
+// worker, while fewer than Options.Workers are running, and returns how many it handed out
+func (s *WebhookService) deliverDue() int {
+	s.mu.Lock()
+	free := s.options.Workers - len(s.busy)
+	skip := make([]uint, 0, len(s.busy))
+	for id := range s.busy {
+		skip = append(skip, id)
+	}
+	s.mu.Unlock()
+
+	if free <= 0 {
+		return 0
+	}
+
+	due, err := s.repo.DueDeliveries(s.now().UTC(), s.options.BatchSize, skip)
+	if err != nil {
+		log.WithError(err).Error("Failed to load due webhook deliveries")
+		return 0
+	}
+
+	// Group the deliveries by subscription, keeping the order they became due in
+	var order []uint
+	queues := make(map[uint][]Delivery)
+	handed := 0
+	for _, delivery := range due {
+		id := delivery.SubscriptionID
+		if _, ok := queues[id]; !ok {
+			if len(order) == free {
+				continue
+			}
+			order = append(order, id)
+		}
+		queues[id] = append(queues[id], delivery)
+		handed++
+	}
+
+	s.mu.Lock()
+	for _, id := range order {
+		s.busy[id] = true
+	}
+	s.mu.Unlock()
+
+	for _, id := range order {
+		s.workers.Add(1)
+		go s.deliverQueue(id, queues[id])
+	}
+
+	return handed
+}
+
+// deliverQueue attempts the due deliveries of one subscription in order
+func (s *WebhookService) deliverQueue(id uint, queue []Delivery) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+		s.workers.Done()
+		// Deliveries of the subscription may have become due in the meantime
+		s.notify()
+	}()
+
+	subscription, err := s.repo.GetSubscription(queue[0].Tenant, id)
+	if err != nil {
+		log.WithError(err).WithField("subscription_id", id).Error("Failed to load webhook subscription")
+		return
+	}
+
+	for i := range queue {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		delivery := &queue[i]
+		s.attempt(subscription, delivery)
+		if err := s.repo.UpdateDelivery(delivery); err != nil {
+			log.WithError(err).WithField("delivery_id", delivery.ID).Error("Failed to update webhook delivery")
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome on it
+func (s *WebhookService) attempt(subscription *Subscription, delivery *Delivery) {
+	delivery.Attempts++
+	status, err := s.send(subscription, delivery)
+	delivery.ResponseStatus = status
+
+	now := s.now().UTC()
+	if err == nil {
+		delivery.Status = StatusSucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxErrorLength {
+		delivery.LastError = delivery.LastError[:maxErrorLength]
+	}
+
+	if delivery.Attempts >= s.options.MaxAttempts {
+		delivery.Status = StatusDead
+		log.WithFields(log.Fields{
+			"delivery_id":     delivery.ID,
+			"subscription_id": delivery.SubscriptionID,
+			"attempts":        delivery.Attempts,
+		}).Warn("Webhook delivery dead-lettered")
+		return
+	}
+
+	delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts))
+}
+
+// send POSTs the signed payload and returns the response status
+func (s *WebhookService) send(subscription *Subscription, delivery *Delivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := s.now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the next attempt after the given number of failures
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	wait := s.options.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= s.options.MaxBackoff {
+			return s.options.MaxBackoff
+		}
+	}
+	return wait
+}
+
+// Sign returns the signature header value for a payload: the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription secret, prefixed with "sha256=".
+// Receivers should recompute it from the X-Webhook-Timestamp header and the raw body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for the payload
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// checkURL rejects URLs that are not http or https, or whose host resolves to an address
+// deliveries must not be sent to
+func (s *WebhookService) checkURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return &location.ValidationError{Field: "url", Message: "must be an http or https URL"}
+	}
+	if s.options.AllowPrivateNetworks {
+		return nil
+	}
+
+	addrs, err := s.resolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return &location.ValidationError{Field: "url", Message: "host could not be resolved"}
+	}
+	for _, addr := range addrs {
+		if blocked(addr.IP) {
+			return &location.ValidationError{Field: "url", Message: "must not resolve to a private, loopback or link-local address"}
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. Unless private networks are allowed it
+// refuses to connect to blocked addresses, which also covers redirects and hosts that resolve
+// differently than they did when the subscription was created. Proxies are never used, as the
+// address they connect to cannot be checked.
+func newClient(options Options) *http.Client {
+	dialer := &net.Dialer{Timeout: options.Timeout}
+	if !options.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blocked(ip) {
+				return fmt.Errorf("connecting to %s is not allowed", host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: options.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// blocked reports whether ip is an address deliveries must not be sent to
+func blocked(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// knownEventType reports whether subscriptions may ask for events of the given type
+func knownEventType(eventType string) bool {
+	if eventType == "*" {
+		return true
+	}
+	for _, t := range events.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// NotDeadError is returned when retrying a delivery that has not been dead-lettered
+type NotDeadError struct {
+	ID     uint
+	Status string
+}
+
+func (e *NotDeadError) Error() string {
+	return fmt.Sprintf("Delivery %d is %s, only dead deliveries can be retried", e.ID, e.Status)
+}
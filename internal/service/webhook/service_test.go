@@ -0,0 +1,404 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/tenant"
+	"gorm.io/gorm"
+)
+
+// memStore is an in-memory WebhookStore used by the service tests
+type memStore struct {
+	mu            sync.Mutex
+	subscriptions []Subscription
+	deliveries    []Delivery
+}
+
+func (m *memStore) CreateSubscription(s *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.ID = uint(len(m.subscriptions) + 1)
+	m.subscriptions = append(m.subscriptions, *s)
+	return nil
+}
+
+func (m *memStore) GetSubscriptions(tenant string) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subscriptions []Subscription
+	for _, s := range m.subscriptions {
+		if s.Tenant == tenant {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (m *memStore) GetSubscription(tenant string, id uint) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.subscriptions {
+		if s.ID == id && s.Tenant == tenant {
+			return &s, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memStore) DeleteSubscription(tenant string, id uint) error {
+	return nil
+}
+
+func (m *memStore) CreateDeliveries(deliveries []Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range deliveries {
+		d.ID = uint(len(m.deliveries) + 1)
+		m.deliveries = append(m.deliveries, d)
+	}
+	return nil
+}
+
+func (m *memStore) GetDelivery(tenant string, id uint) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if int(id) > len(m.deliveries) || m.deliveries[id-1].Tenant != tenant {
+		return nil, gorm.ErrRecordNotFound
+	}
+	d := m.deliveries[id-1]
+	return &d, nil
+}
+
+func (m *memStore) DueDeliveries(now time.Time, limit int, skip []uint) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	skipped := make(map[uint]bool)
+	for _, id := range skip {
+		skipped[id] = true
+	}
+	var due []Delivery
+	for _, d := range m.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) && !skipped[d.SubscriptionID] {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (m *memStore) UpdateDelivery(d *Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[d.ID-1] = *d
+	return nil
+}
+
+func (m *memStore) QueryDeliveries(tenant string, query DeliveryQuery) ([]Delivery, error) {
+	return m.deliveries, nil
+}
+
+// receiver is a local webhook endpoint that records requests and answers with a scripted status
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, _ := io.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestService(t *testing.T, statuses ...int) (*WebhookService, *memStore, *receiver, *time.Time) {
+	t.Helper()
+
+	rcv := &receiver{statuses: statuses}
+	server := httptest.NewServer(rcv)
+	t.Cleanup(server.Close)
+
+	store := &memStore{}
+	options := DefaultOptions()
+	options.MaxAttempts = 3
+	// The receiver listens on the loopback address
+	options.AllowPrivateNetworks = true
+	service := NewWebhookService(store, options)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	if _, err := service.CreateSubscription(context.Background(), CreateSubscriptionRequest{
+		URL:        server.URL,
+		EventTypes: []string{events.LocationCreated},
+		Secret:     "s3cret",
+	}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	return service, store, rcv, &now
+}
+
+// deliver hands out the due deliveries and waits until they were attempted
+func deliver(service *WebhookService) int {
+	n := service.deliverDue()
+	service.workers.Wait()
+	return n
+}
+
+func TestPublishDeliversSignedPayload(t *testing.T) {
+	service, store, rcv, _ := newTestService(t)
+
+	service.Publish(events.New(events.LocationCreated, map[string]string{"name": "Depot"}))
+	service.Publish(events.New(events.LocationDeleted, map[string]string{"name": "Depot"}))
+
+	if n := deliver(service); n != 1 {
+		t.Fatalf("deliverDue() attempted %d deliveries, expected only the subscribed event", n)
+	}
+
+	req := rcv.requests[0]
+	if got := req.Header.Get(HeaderEvent); got != events.LocationCreated {
+		t.Errorf("%s = %q", HeaderEvent, got)
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header: %v", err)
+	}
+	if !Verify("s3cret", timestamp, rcv.bodies[0], req.Header.Get(HeaderSignature)) {
+		t.Error("signature did not verify against the received body")
+	}
+	if Verify("wrong", timestamp, rcv.bodies[0], req.Header.Get(HeaderSignature)) {
+		t.Error("signature verified with the wrong secret")
+	}
+
+	if status := store.deliveries[0].Status; status != StatusSucceeded {
+		t.Errorf("delivery status = %v, expected %v", status, StatusSucceeded)
+	}
+}
+
+func TestPublishOnlyReachesSubscriptionsOfTheEventTenant(t *testing.T) {
+	service, store, rcv, _ := newTestService(t)
+
+	service.Publish(events.ForTenant("acme", events.LocationCreated, nil))
+	if n := deliver(service); n != 0 || len(rcv.requests) != 0 {
+		t.Errorf("deliverDue() attempted %d deliveries, expected none for another tenant's event", n)
+	}
+
+	service.Publish(events.New(events.LocationCreated, nil))
+	if n := deliver(service); n != 1 {
+		t.Fatalf("deliverDue() attempted %d deliveries, expected 1", n)
+	}
+	if owner := store.deliveries[0].Tenant; owner != tenant.Default {
+		t.Errorf("delivery tenant = %q, expected %q", owner, tenant.Default)
+	}
+
+	acme := tenant.WithTenant(context.Background(), "acme")
+	if _, err := service.RetryDelivery(acme, store.deliveries[0].ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("RetryDelivery() of another tenant's delivery error = %v, expected not found", err)
+	}
+	if subscriptions, _ := service.GetSubscriptions(acme); len(subscriptions) != 0 {
+		t.Errorf("GetSubscriptions() in acme = %d subscriptions, expected none", len(subscriptions))
+	}
+}
+
+func TestFailedDeliveriesBackOffAndDeadLetter(t *testing.T) {
+	service, store, rcv, now := newTestService(t, 500, 503, 500)
+
+	service.Publish(events.New(events.LocationCreated, nil))
+
+	deliver(service)
+	delivery := store.deliveries[0]
+	if delivery.Status != StatusPending || delivery.Attempts != 1 {
+		t.Fatalf("after one failure: status = %v attempts = %d", delivery.Status, delivery.Attempts)
+	}
+	if wait := delivery.NextAttemptAt.Sub(*now); wait != service.options.InitialBackoff {
+		t.Errorf("first backoff = %v, expected %v", wait, service.options.InitialBackoff)
+	}
+
+	// Not due yet, nothing should be sent
+	if n := deliver(service); n != 0 {
+		t.Errorf("deliverDue() attempted %d deliveries before the backoff elapsed", n)
+	}
+
+	*now = now.Add(time.Hour)
+	deliver(service)
+	if wait := store.deliveries[0].NextAttemptAt.Sub(*now); wait != 2*service.options.InitialBackoff {
+		t.Errorf("second backoff = %v, expected %v", wait, 2*service.options.InitialBackoff)
+	}
+
+	*now = now.Add(time.Hour)
+	deliver(service)
+	delivery = store.deliveries[0]
+	if delivery.Status != StatusDead || delivery.ResponseStatus != 500 {
+		t.Fatalf("after max attempts: status = %v response = %d", delivery.Status, delivery.ResponseStatus)
+	}
+	if len(rcv.requests) != 3 {
+		t.Errorf("receiver got %d requests, expected 3", len(rcv.requests))
+	}
+
+	retried, err := service.RetryDelivery(context.Background(), delivery.ID)
+	if err != nil {
+		t.Fatalf("RetryDelivery() error = %v", err)
+	}
+	if retried.Status != StatusPending || retried.Attempts != 0 {
+		t.Errorf("retried delivery status = %v attempts = %d", retried.Status, retried.Attempts)
+	}
+
+	deliver(service)
+	if status := store.deliveries[0].Status; status != StatusSucceeded {
+		t.Errorf("redelivery status = %v, expected %v", status, StatusSucceeded)
+	}
+
+	if _, err := service.RetryDelivery(context.Background(), delivery.ID); err == nil {
+		t.Error("RetryDelivery() expected an error for a delivery that is not dead")
+	}
+}
+
+func TestWorkerStartStop(t *testing.T) {
+	service, store, _, _ := newTestService(t)
+	service.now = time.Now
+
+	service.Start()
+	service.Publish(events.New(events.LocationCreated, nil))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if d, _ := store.GetDelivery(tenant.Default, 1); d != nil && d.Status == StatusSucceeded {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	service.Stop()
+
+	if d, _ := store.GetDelivery(tenant.Default, 1); d == nil || d.Status != StatusSucceeded {
+		t.Errorf("worker did not deliver the event: %+v", d)
+	}
+}
+
+func TestCreateSubscriptionValidation(t *testing.T) {
+	service := NewWebhookService(&memStore{}, DefaultOptions())
+
+	tests := []struct {
+		name       string
+		url        string
+		eventTypes []string
+		field      string
+	}{
+		{name: "Public address", url: "https://93.184.216.34/hooks", eventTypes: []string{events.ZoneEnter, "*"}},
+		{name: "Unknown event type", url: "https://93.184.216.34/hooks", eventTypes: []string{"zone.entered"}, field: "event_types"},
+		{name: "Other scheme", url: "ftp://93.184.216.34/hooks", eventTypes: []string{"*"}, field: "url"},
+		{name: "Loopback", url: "http://127.0.0.1:8080/hooks", eventTypes: []string{"*"}, field: "url"},
+		{name: "IPv6 loopback", url: "http://[::1]/hooks", eventTypes: []string{"*"}, field: "url"},
+		{name: "Private", url: "http://10.1.2.3/hooks", eventTypes: []string{"*"}, field: "url"},
+		{name: "Link-local", url: "http://169.254.169.254/latest/meta-data", eventTypes: []string{"*"}, field: "url"},
+		{name: "Unspecified", url: "http://0.0.0.0/hooks", eventTypes: []string{"*"}, field: "url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateSubscription(context.Background(), CreateSubscriptionRequest{URL: tt.url, EventTypes: tt.eventTypes})
+			if tt.field == "" {
+				if err != nil {
+					t.Errorf("CreateSubscription() error = %v, expected none", err)
+				}
+				return
+			}
+			validationErr, ok := err.(*location.ValidationError)
+			if !ok || validationErr.Field != tt.field {
+				t.Errorf("CreateSubscription() error = %v, expected a validation error on %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestDeliveryToBlockedAddressFails(t *testing.T) {
+	rcv := &receiver{}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	// The subscription was accepted while its host resolved to a public address
+	store := &memStore{subscriptions: []Subscription{{
+		ID: 1, Tenant: tenant.Default, URL: server.URL, EventTypes: []string{"*"}, Secret: "s3cret", Active: true,
+	}}}
+	service := NewWebhookService(store, DefaultOptions())
+
+	service.Publish(events.New(events.LocationCreated, nil))
+	deliver(service)
+
+	if len(rcv.requests) != 0 {
+		t.Errorf("receiver got %d requests, expected none", len(rcv.requests))
+	}
+	if delivery := store.deliveries[0]; delivery.Status != StatusPending || !strings.Contains(delivery.LastError, "not allowed") {
+		t.Errorf("delivery status = %v last error = %q, expected a refused connection", delivery.Status, delivery.LastError)
+	}
+}
+
+func TestSlowReceiverDoesNotHoldUpOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+
+	service, store, rcv, _ := newTestService(t)
+	defer func() {
+		close(release)
+		service.workers.Wait()
+	}()
+	if _, err := service.CreateSubscription(context.Background(), CreateSubscriptionRequest{
+		URL:        slow.URL,
+		EventTypes: []string{events.LocationCreated},
+	}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	// The slow subscription was created last, but gets its delivery queued first
+	store.subscriptions[0], store.subscriptions[1] = store.subscriptions[1], store.subscriptions[0]
+	service.Publish(events.New(events.LocationCreated, nil))
+	service.Publish(events.New(events.LocationCreated, nil))
+
+	if n := service.deliverDue(); n != 4 {
+		t.Fatalf("deliverDue() handed out %d deliveries, expected 4", n)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		rcv.mu.Lock()
+		received := len(rcv.requests)
+		rcv.mu.Unlock()
+		if received == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rcv.mu.Lock()
+	received := len(rcv.requests)
+	rcv.mu.Unlock()
+	if received != 2 {
+		t.Errorf("receiver got %d requests while the slow one was busy, expected 2", received)
+	}
+	if n := service.deliverDue(); n != 0 {
+		t.Errorf("deliverDue() handed out %d deliveries of subscriptions that are being delivered to", n)
+	}
+}
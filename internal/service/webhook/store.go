@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultDeliveryLimit is the number of deliveries returned when a query does not set a limit
+const DefaultDeliveryLimit = 100
+
+// WebhookStore defines the interface for webhook data access
+type WebhookStore interface {
+	CreateSubscription(subscription *Subscription) error
+	GetSubscriptions(tenant string) ([]Subscription, error)
+	GetSubscription(tenant string, id uint) (*Subscription, error)
+	DeleteSubscription(tenant string, id uint) error
+	CreateDeliveries(deliveries []Delivery) error
+	GetDelivery(tenant string, id uint) (*Delivery, error)
+	DueDeliveries(now time.Time, limit int, skip []uint) ([]Delivery, error)
+	UpdateDelivery(delivery *Delivery) error
+	QueryDeliveries(tenant string, query DeliveryQuery) ([]Delivery, error)
+}
+
+// WebhookRepo provides data access methods for webhook subscriptions and deliveries
+type WebhookRepo struct {
+	db *gorm.DB
+}
+
+// NewWebhookRepo creates a new webhook repository
+func NewWebhookRepo(db *gorm.DB) WebhookStore {
+	return &WebhookRepo{
+		db: db,
+	}
+}
+
+// CreateSubscription creates a new subscription in the database
+func (s *WebhookRepo) CreateSubscription(subscription *Subscription) error {
+	return s.db.Create(subscription).Error
+}
+
+// GetSubscriptions retrieves all subscriptions of the tenant from the database
+func (s *WebhookRepo) GetSubscriptions(tenant string) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := s.db.Where("tenant = ?", tenant).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// GetSubscription retrieves a subscription of the tenant by ID
+func (s *WebhookRepo) GetSubscription(tenant string, id uint) (*Subscription, error) {
+	var subscription Subscription
+	err := s.db.Where("tenant = ?", tenant).First(&subscription, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// DeleteSubscription deletes a subscription of the tenant and its delivery log
+func (s *WebhookRepo) DeleteSubscription(tenant string, id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tenant = ? AND subscription_id = ?", tenant, id).Delete(&Delivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("tenant = ?", tenant).Delete(&Subscription{}, id).Error
+	})
+}
+
+// CreateDeliveries queues deliveries in the database
+func (s *WebhookRepo) CreateDeliveries(deliveries []Delivery) error {
+	return s.db.Create(&deliveries).Error
+}
+
+// GetDelivery retrieves a delivery of the tenant by ID
+func (s *WebhookRepo) GetDelivery(tenant string, id uint) (*Delivery, error) {
+	var delivery Delivery
+	err := s.db.Where("tenant = ?", tenant).First(&delivery, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// DueDeliveries retrieves pending deliveries of every tenant whose next attempt is due, oldest first,
+// leaving out those of the skipped subscriptions
+func (s *WebhookRepo) DueDeliveries(now time.Time, limit int, skip []uint) ([]Delivery, error) {
+	db := s.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now)
+	if len(skip) > 0 {
+		db = db.Where("subscription_id NOT IN ?", skip)
+	}
+
+	var deliveries []Delivery
+	err := db.Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt
+func (s *WebhookRepo) UpdateDelivery(delivery *Delivery) error {
+	return s.db.Save(delivery).Error
+}
+
+// QueryDeliveries retrieves the delivery log of a subscription of the tenant, newest first
+func (s *WebhookRepo) QueryDeliveries(tenant string, query DeliveryQuery) ([]Delivery, error) {
+	db := s.db.Where("tenant = ? AND subscription_id = ?", tenant, query.SubscriptionID)
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+
+	var deliveries []Delivery
+	err := db.Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
@@ -0,0 +1,75 @@
+package webhook
+
+import "time"
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Subscription registers a URL to receive the events of the given types that happen in its tenant
+type Subscription struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Tenant     string    `json:"tenant" gorm:"index;not null;default:default"`
+	URL        string    `json:"url" gorm:"not null"`
+	EventTypes []string  `json:"event_types" gorm:"type:jsonb;serializer:json;not null"`
+	Secret     string    `json:"secret,omitempty" gorm:"not null"`
+	Active     bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Matches reports whether the subscription wants events of the given type.
+// The type "*" subscribes to every event.
+func (s *Subscription) Matches(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event queued for, or already sent to, one subscription.
+// Deliveries that exhaust their attempts are kept with StatusDead as a dead letter.
+type Delivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	Tenant         string     `json:"tenant" gorm:"index;not null;default:default"`
+	SubscriptionID uint       `json:"subscription_id" gorm:"index;not null"`
+	EventID        string     `json:"event_id" gorm:"not null"`
+	EventType      string     `json:"event_type" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"index;not null"`
+	Attempts       int        `json:"attempts" gorm:"not null"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index;not null"`
+	LastError      string     `json:"last_error,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CreateSubscriptionRequest represents the request body for creating a subscription.
+// A random secret is generated when none is supplied.
+type CreateSubscriptionRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1,dive,required"`
+	Secret     string   `json:"secret"`
+}
+
+// DeliveryQuery filters the deliveries returned for a subscription
+type DeliveryQuery struct {
+	SubscriptionID uint
+	Status         string
+	Limit          int
+}
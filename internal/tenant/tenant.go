@@ -0,0 +1,70 @@
+// Package tenant identifies the customer a request acts for. Every customer
+// has its own set of locations; the HTTP layer resolves the tenant of a request
+// and stores it in the context, where services and stores read it.
+package tenant
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/youngprinnce/geolocation-service/internal/auth"
+)
+
+// Default is the tenant of requests that name none, and of the locations stored before tenants existed
+const Default = "default"
+
+// Header lets credentials that are not bound to a tenant choose one
+const Header = "X-Tenant-ID"
+
+// pattern restricts tenant IDs to short slugs
+var pattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Valid reports whether id is a well-formed tenant ID: lower case letters,
+// digits, dashes and underscores, starting with a letter or digit
+func Valid(id string) bool {
+	return pattern.MatchString(id)
+}
+
+// Resolve returns the tenant a caller acts for, given the tenant it requested, if any.
+// Credentials bound to a tenant always act for it. The requested tenant is honoured
+// for unbound admin credentials, and for every caller while authentication is disabled,
+// when principal is nil; everybody else acts for the default tenant.
+func Resolve(principal *auth.Principal, requested string) (string, error) {
+	switch {
+	case principal != nil && principal.Tenant != "":
+		if !Valid(principal.Tenant) {
+			return "", &auth.ForbiddenError{Reason: "The credentials are bound to an invalid tenant"}
+		}
+		if requested != "" && requested != principal.Tenant {
+			return "", &auth.ForbiddenError{Reason: "The credentials are bound to another tenant"}
+		}
+		return principal.Tenant, nil
+	case requested == "":
+		return Default, nil
+	case principal == nil || principal.Allows(auth.ScopeAdmin):
+		return requested, nil
+	default:
+		return "", &auth.ForbiddenError{Scope: auth.ScopeAdmin, Reason: "Only admin credentials that are not bound to a tenant may choose one"}
+	}
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx acting for the tenant
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant ctx acts for, Default when none was resolved
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return OrDefault(id)
+}
+
+// OrDefault returns id, or Default when id is empty
+func OrDefault(id string) string {
+	if id == "" {
+		return Default
+	}
+	return id
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ChangeOptions selects a page of the change feed
+type ChangeOptions struct {
+	// Since is the NextCursor of the previous page; empty starts from the beginning
+	Since string
+	// Limit is at most 1000
+	Limit int
+	// Wait long-polls for up to a minute when no changes are pending
+	Wait time.Duration
+}
+
+// GetChanges returns the changes after a cursor
+func (c *Client) GetChanges(ctx context.Context, options ChangeOptions) (*ChangePage, error) {
+	query := url.Values{}
+	if options.Since != "" {
+		query.Set("since", options.Since)
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Wait > 0 {
+		query.Set("wait", strconv.Itoa(int(options.Wait/time.Second)))
+	}
+
+	var page ChangePage
+	if _, err := c.do(ctx, http.MethodGet, "/changes", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
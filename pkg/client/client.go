@@ -0,0 +1,263 @@
+// Package client is a Go client for the geolocation service HTTP API.
+//
+// Every method takes a context, which bounds the call including its retries.
+// Requests the server rejects return an *Error carrying the problem details
+// it answered with. The streaming endpoints (server-sent events, WebSockets
+// and GraphQL) are not wrapped.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retry defaults
+const (
+	DefaultMaxRetries     = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+)
+
+// APIKeyHeader carries the API key of a client
+const APIKeyHeader = "X-API-Key"
+
+// TenantHeader chooses the tenant a request acts for, for credentials not bound to one
+const TenantHeader = "X-Tenant-ID"
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// Client calls the API of one server. It is safe for concurrent use.
+type Client struct {
+	baseURL        *url.URL
+	httpClient     *http.Client
+	userAgent      string
+	apiKey         string
+	token          string
+	tenant         string
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with httpClient instead of http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithAPIKey authenticates every request with an API key
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithBearerToken authenticates every request with a bearer token, such as a JWT issued by single sign-on
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithTenant acts for a tenant on every request. The server only honours it
+// for admin credentials that are not bound to a tenant.
+func WithTenant(tenant string) Option {
+	return func(c *Client) {
+		c.tenant = tenant
+	}
+}
+
+// WithRetries retries a failed request up to maxRetries times, waiting
+// initialBackoff before the first retry and doubling the wait up to maxBackoff.
+// A Retry-After header sent by the server takes precedence. Use 0 retries to disable retrying.
+func WithRetries(maxRetries int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.initialBackoff = initialBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// New creates a client for the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	parsed.RawPath = strings.TrimSuffix(parsed.RawPath, "/")
+
+	c := &Client{
+		baseURL:        parsed,
+		httpClient:     http.DefaultClient,
+		userAgent:      "geolocation-service-go-client",
+		maxRetries:     DefaultMaxRetries,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// Health reports whether the server is up
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/", nil, nil, nil)
+	return err
+}
+
+// do sends a request, retrying it when the server is overloaded or failing,
+// and decodes a successful JSON response into out unless out is nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	// path holds escaped segments; keep them escaped so names may contain slashes
+	target := *c.baseURL
+	target.RawPath = c.baseURL.EscapedPath() + path
+	if unescaped, err := url.PathUnescape(target.RawPath); err == nil {
+		target.Path = unescaped
+	}
+	target.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, target.String(), payload)
+		if err == nil && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out != nil {
+				if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+					return resp, fmt.Errorf("failed to decode response: %w", err)
+				}
+			}
+			return resp, nil
+		}
+
+		if err == nil {
+			err = readError(resp)
+		}
+		if attempt >= c.maxRetries || !retryable(method, resp, err) {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt, resp)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if c.apiKey != "" {
+		req.Header.Set(APIKeyHeader, c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.tenant != "" {
+		req.Header.Set(TenantHeader, c.tenant)
+	}
+	return c.httpClient.Do(req)
+}
+
+// retryable reports whether a failed request may be sent again. A 429 or 503
+// means the server did not act on the request, so any method is retried;
+// other server errors and transport failures are only retried for methods
+// that are safe to repeat.
+func retryable(method string, resp *http.Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	if resp == nil {
+		return idempotent
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusServiceUnavailable:
+		return true
+	case resp.StatusCode >= 500:
+		return idempotent
+	default:
+		return false
+	}
+}
+
+// backoff returns how long to wait before retry number attempt+1, with jitter
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	wait := c.initialBackoff << attempt
+	if wait > c.maxBackoff || wait <= 0 {
+		wait = c.maxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	// Full jitter on the upper half keeps retrying clients from synchronising
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// escape encodes a path segment, slashes included
+func escape(segment string) string {
+	return url.PathEscape(segment)
+}
+
+// id formats a numeric path segment
+func id(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
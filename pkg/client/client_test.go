@@ -0,0 +1,597 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/youngprinnce/geolocation-service/cmd/server"
+	"github.com/youngprinnce/geolocation-service/config"
+	"github.com/youngprinnce/geolocation-service/internal/events"
+	apihttp "github.com/youngprinnce/geolocation-service/internal/http"
+	"github.com/youngprinnce/geolocation-service/internal/service/geofence"
+	"github.com/youngprinnce/geolocation-service/internal/service/location"
+	"github.com/youngprinnce/geolocation-service/internal/service/outbox"
+	"github.com/youngprinnce/geolocation-service/internal/service/route"
+	"github.com/youngprinnce/geolocation-service/internal/service/search"
+	"github.com/youngprinnce/geolocation-service/internal/service/tracking"
+	"github.com/youngprinnce/geolocation-service/internal/service/webhook"
+	"github.com/youngprinnce/geolocation-service/pkg/client"
+	"gorm.io/gorm"
+)
+
+// locationStore is an in-memory LocationStore listing in ID order only
+type locationStore struct {
+	location.LocationStore
+	mu        sync.Mutex
+	locations []location.Location
+	nextID    uint
+}
+
+func (m *locationStore) Create(ctx context.Context, l *location.Location) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	l.ID = m.nextID
+	l.CreatedAt, l.UpdatedAt = time.Now(), time.Now()
+	m.locations = append(m.locations, *l)
+	return nil
+}
+
+func (m *locationStore) GetAll() ([]location.Location, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]location.Location(nil), m.locations...), nil
+}
+
+func (m *locationStore) GetInBoundingBox(box location.BoundingBox) ([]location.Location, error) {
+	all, _ := m.GetAll()
+	var found []location.Location
+	for _, l := range all {
+		if box.Contains(l.Latitude, l.Longitude) {
+			found = append(found, l)
+		}
+	}
+	return found, nil
+}
+
+func (m *locationStore) List(query location.ListQuery) ([]location.Location, error) {
+	all, _ := m.GetAll()
+	var afterID uint
+	if query.After != nil {
+		afterID = query.After.ID
+	}
+
+	var page []location.Location
+	for _, l := range all {
+		if l.ID > afterID && len(page) < query.Limit {
+			page = append(page, l)
+		}
+	}
+	return page, nil
+}
+
+func (m *locationStore) Count(within []location.Grant) (int64, error) {
+	all, _ := m.GetAll()
+	return int64(len(all)), nil
+}
+
+func (m *locationStore) find(match func(location.Location) bool) (*location.Location, error) {
+	all, _ := m.GetAll()
+	for _, l := range all {
+		if match(l) {
+			return &l, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *locationStore) GetByName(name string) (*location.Location, error) {
+	return m.find(func(l location.Location) bool { return l.Name == name })
+}
+
+func (m *locationStore) GetByUUID(id uuid.UUID) (*location.Location, error) {
+	return m.find(func(l location.Location) bool { return l.UUID == id })
+}
+
+func (m *locationStore) GetByNames(names []string) ([]location.Location, error) {
+	var found []location.Location
+	for _, name := range names {
+		if l, err := m.GetByName(name); err == nil {
+			found = append(found, *l)
+		}
+	}
+	return found, nil
+}
+
+func (m *locationStore) NameExists(name string) (bool, error) {
+	_, err := m.GetByName(name)
+	return err == nil, nil
+}
+
+func (m *locationStore) Update(ctx context.Context, updated *location.Location) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, l := range m.locations {
+		if l.ID == updated.ID {
+			updated.UpdatedAt = time.Now()
+			m.locations[i] = *updated
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *locationStore) Delete(ctx context.Context, deleted *location.Location) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, l := range m.locations {
+		if l.UUID == deleted.UUID {
+			m.locations = append(m.locations[:i], m.locations[i+1:]...)
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// geofenceStore is an in-memory GeofenceStore
+type geofenceStore struct {
+	mu        sync.Mutex
+	geofences map[uint]geofence.Geofence
+	nextID    uint
+}
+
+func (m *geofenceStore) Create(g *geofence.Geofence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	g.ID = m.nextID
+	m.geofences[g.ID] = *g
+	return nil
+}
+
+func (m *geofenceStore) GetAll(tenant string) ([]geofence.Geofence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []geofence.Geofence
+	for _, g := range m.geofences {
+		if g.Tenant == tenant {
+			all = append(all, g)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all, nil
+}
+
+func (m *geofenceStore) GetByID(tenant string, id uint) (*geofence.Geofence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.geofences[id]
+	if !ok || g.Tenant != tenant {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &g, nil
+}
+
+func (m *geofenceStore) Update(g *geofence.Geofence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.geofences[g.ID] = *g
+	return nil
+}
+
+func (m *geofenceStore) DeleteByID(tenant string, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if g, ok := m.geofences[id]; !ok || g.Tenant != tenant {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.geofences, id)
+	return nil
+}
+
+func (m *geofenceStore) NameExists(tenant, name string, excludeID uint) (bool, error) {
+	all, _ := m.GetAll(tenant)
+	for _, g := range all {
+		if g.Name == name && g.ID != excludeID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeTracking records the event query it was asked for
+type fakeTracking struct {
+	query tracking.EventQuery
+}
+
+func (f *fakeTracking) IngestPositions(ctx context.Context, deviceID string, positions []tracking.PositionRequest) (*tracking.IngestResult, error) {
+	last := positions[len(positions)-1]
+	return &tracking.IngestResult{
+		Accepted: len(positions),
+		Position: &tracking.DevicePosition{DeviceID: deviceID, Latitude: last.Latitude, Longitude: last.Longitude},
+		Events:   []tracking.Event{},
+	}, nil
+}
+
+func (f *fakeTracking) GetEvents(ctx context.Context, query tracking.EventQuery) ([]tracking.Event, error) {
+	f.query = query
+	return []tracking.Event{{ID: 1, DeviceID: query.DeviceID, Type: tracking.EventEnter}}, nil
+}
+
+// fakeWebhooks keeps subscriptions in memory and has one dead delivery
+type fakeWebhooks struct {
+	subscriptions map[uint]webhook.Subscription
+}
+
+func (f *fakeWebhooks) CreateSubscription(ctx context.Context, req webhook.CreateSubscriptionRequest) (*webhook.Subscription, error) {
+	s := webhook.Subscription{ID: uint(len(f.subscriptions) + 1), URL: req.URL, EventTypes: req.EventTypes, Secret: "generated", Active: true}
+	f.subscriptions[s.ID] = s
+	return &s, nil
+}
+
+func (f *fakeWebhooks) GetSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	var all []webhook.Subscription
+	for _, s := range f.subscriptions {
+		all = append(all, s)
+	}
+	return all, nil
+}
+
+func (f *fakeWebhooks) GetSubscription(ctx context.Context, id uint) (*webhook.Subscription, error) {
+	s, ok := f.subscriptions[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &s, nil
+}
+
+func (f *fakeWebhooks) DeleteSubscription(ctx context.Context, id uint) error {
+	if _, err := f.GetSubscription(ctx, id); err != nil {
+		return err
+	}
+	delete(f.subscriptions, id)
+	return nil
+}
+
+func (f *fakeWebhooks) GetDeliveries(ctx context.Context, query webhook.DeliveryQuery) ([]webhook.Delivery, error) {
+	return []webhook.Delivery{{ID: 7, SubscriptionID: query.SubscriptionID, Status: query.Status}}, nil
+}
+
+func (f *fakeWebhooks) RetryDelivery(ctx context.Context, id uint) (*webhook.Delivery, error) {
+	if id != 7 {
+		return nil, &webhook.NotDeadError{ID: id, Status: webhook.StatusSucceeded}
+	}
+	return &webhook.Delivery{ID: id, Status: webhook.StatusPending}, nil
+}
+
+// fakeChanges serves a single change
+type fakeChanges struct{}
+
+func (fakeChanges) GetChanges(_ context.Context, since string, _ int, _ time.Duration) (*outbox.ChangePage, error) {
+	if since != "" {
+		return &outbox.ChangePage{Changes: []outbox.Change{}, NextCursor: since}, nil
+	}
+	return &outbox.ChangePage{
+		Changes:    []outbox.Change{{Cursor: "c1", Aggregate: "location", AggregateID: 1, Type: events.LocationCreated, Payload: []byte(`{"name":"A"}`)}},
+		NextCursor: "c1",
+	}, nil
+}
+
+// newServer serves the real router from in-memory services
+func newServer(t *testing.T) (*client.Client, *fakeTracking) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	calculator := &location.DistanceCalculator{}
+	locations := &locationStore{}
+	stores := func(string) location.LocationStore { return locations }
+	searchService := search.NewSearchService(stores, calculator)
+	bus := events.NewBus()
+	bus.Subscribe(searchService)
+	locationService := location.NewLocationService(locations, calculator, bus)
+	trackingService := &fakeTracking{}
+
+	router := server.NewRouter(&config.Config{}, server.Controllers{
+		Location: apihttp.NewLocationController(locationService),
+		Search:   apihttp.NewSearchController(searchService),
+		Route:    apihttp.NewRouteController(route.NewRouteService(stores, calculator)),
+		Geofence: apihttp.NewGeofenceController(geofence.NewGeofenceService(&geofenceStore{geofences: map[uint]geofence.Geofence{}}, calculator)),
+		Tracking: apihttp.NewTrackingController(trackingService),
+		Webhook:  apihttp.NewWebhookController(&fakeWebhooks{subscriptions: map[uint]webhook.Subscription{}}),
+		Change:   apihttp.NewChangeController(fakeChanges{}),
+	})
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+
+	c, err := client.New(ts.URL + "/")
+	require.NoError(t, err)
+	return c, trackingService
+}
+
+func TestLocations(t *testing.T) {
+	c, _ := newServer(t)
+	ctx := context.Background()
+
+	require.NoError(t, c.Health(ctx))
+
+	depot, err := c.CreateLocation(ctx, client.LocationRequest{Name: "Main Depot", Latitude: 52.52, Longitude: 13.405, Category: "depot"})
+	require.NoError(t, err)
+	assert.Equal(t, "Main Depot", depot.Name)
+	assert.NotEmpty(t, depot.UUID)
+	for _, name := range []string{"North Yard", "South Yard"} {
+		_, err := c.CreateLocation(ctx, client.LocationRequest{Name: name, Latitude: 52.6, Longitude: 13.4})
+		require.NoError(t, err)
+	}
+
+	found, err := c.GetLocation(ctx, depot.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, depot.ID, found.ID)
+
+	page, err := c.ListLocations(ctx, client.ListOptions{Limit: 2, WithTotal: true})
+	require.NoError(t, err)
+	assert.Len(t, page.Locations, 2)
+	assert.NotEmpty(t, page.NextCursor)
+	require.NotNil(t, page.Total)
+	assert.Equal(t, int64(3), *page.Total)
+
+	next, err := c.ListLocations(ctx, client.ListOptions{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Len(t, next.Locations, 1)
+	assert.Empty(t, next.NextCursor)
+	assert.Nil(t, next.Total)
+
+	all, err := c.AllLocations(ctx, client.ListOptions{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	nearest, err := c.NearestLocation(ctx, 52.52, 13.41)
+	require.NoError(t, err)
+	assert.Equal(t, "Main Depot", nearest.Location.Name)
+
+	results, err := c.SearchLocations(ctx, client.SearchOptions{Query: "yar", Limit: 5})
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	updated, err := c.UpdateLocation(ctx, depot.UUID, client.LocationRequest{Name: "Central Depot", Latitude: 52.5, Longitude: 13.4})
+	require.NoError(t, err)
+	assert.Equal(t, "Central Depot", updated.Name)
+	assert.Equal(t, depot.UUID, updated.UUID)
+
+	_, err = c.UpdateLocationByName(ctx, "North Yard", client.LocationRequest{Name: "North Yard", Latitude: 52.7, Longitude: 13.4})
+	require.NoError(t, err)
+
+	require.NoError(t, c.DeleteLocation(ctx, depot.UUID))
+	_, err = c.GetLocation(ctx, depot.UUID)
+	assert.True(t, client.IsNotFound(err))
+
+	require.NoError(t, c.DeleteLocationByName(ctx, "South Yard"))
+	assert.True(t, client.IsNotFound(c.DeleteLocationByName(ctx, "South Yard")))
+}
+
+func TestErrors(t *testing.T) {
+	c, _ := newServer(t)
+	ctx := context.Background()
+
+	_, err := c.CreateLocation(ctx, client.LocationRequest{Name: "A", Latitude: 1, Longitude: 1})
+	require.NoError(t, err)
+
+	_, err = c.CreateLocation(ctx, client.LocationRequest{Name: "A", Latitude: 1, Longitude: 1})
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.True(t, client.IsConflict(err))
+	assert.Equal(t, client.CodeDuplicateName, apiErr.Code)
+	assert.Equal(t, http.StatusConflict, apiErr.Status)
+	assert.NotEmpty(t, apiErr.RequestID)
+	assert.Contains(t, err.Error(), "duplicate_name")
+
+	_, err = c.CreateLocation(ctx, client.LocationRequest{Name: "B", Latitude: 95, Longitude: 1})
+	require.True(t, errors.As(err, &apiErr))
+	assert.True(t, client.IsValidation(err))
+	assert.Equal(t, client.CodeValidationFailed, apiErr.Code)
+	assert.Equal(t, []client.FieldError{{Field: "latitude", Message: "must be at most 90"}}, apiErr.Errors)
+
+	_, err = c.GetLocation(ctx, "not-a-uuid")
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, client.CodeBadRequest, apiErr.Code)
+
+	_, err = c.GetLocation(ctx, uuid.NewString())
+	assert.True(t, client.IsNotFound(err))
+}
+
+func TestGeofences(t *testing.T) {
+	c, _ := newServer(t)
+	ctx := context.Background()
+
+	circle, err := c.CreateGeofence(ctx, client.GeofenceRequest{Name: "Yard", Kind: client.GeofenceCircle, Latitude: 10, Longitude: 10, RadiusMeters: 500})
+	require.NoError(t, err)
+
+	containing, err := c.ContainingGeofences(ctx, 10.001, 10)
+	require.NoError(t, err)
+	require.Len(t, containing, 1)
+	assert.Equal(t, circle.ID, containing[0].ID)
+
+	updated, err := c.UpdateGeofence(ctx, circle.ID, client.GeofenceRequest{
+		Name: "Yard", Kind: client.GeofencePolygon,
+		Polygon: []client.Point{{Latitude: 0, Longitude: 0}, {Latitude: 0, Longitude: 1}, {Latitude: 1, Longitude: 1}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, client.GeofencePolygon, updated.Kind)
+	assert.Len(t, updated.Polygon, 3)
+
+	got, err := c.GetGeofence(ctx, circle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, client.GeofencePolygon, got.Kind)
+
+	list, err := c.ListGeofences(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	require.NoError(t, c.DeleteGeofence(ctx, circle.ID))
+	_, err = c.GetGeofence(ctx, circle.ID)
+	assert.True(t, client.IsNotFound(err))
+}
+
+func TestRoutes(t *testing.T) {
+	c, _ := newServer(t)
+	ctx := context.Background()
+
+	for i, name := range []string{"A", "B", "C"} {
+		_, err := c.CreateLocation(ctx, client.LocationRequest{Name: name, Latitude: 0.001, Longitude: 0.1 * float64(i+1)})
+		require.NoError(t, err)
+	}
+
+	matches, err := c.FindAlongRoute(ctx, client.AlongRouteRequest{
+		LineString: []byte(`{"type":"LineString","coordinates":[[0,0],[0.5,0]]}`),
+		CorridorKm: 1,
+	})
+	require.NoError(t, err)
+	require.Len(t, matches, 3)
+	assert.Equal(t, "A", matches[0].Location.Name)
+
+	optimized, err := c.OptimizeRoute(ctx, client.OptimizeRouteRequest{Start: &client.Point{}, Stations: []string{"C", "A", "B"}})
+	require.NoError(t, err)
+	assert.Len(t, optimized.Legs, 3)
+	assert.Greater(t, optimized.TotalDistanceKm, 0.0)
+
+	_, err = c.OptimizeRoute(ctx, client.OptimizeRouteRequest{Start: &client.Point{}, Stations: []string{"Nowhere"}})
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, client.CodeUnknownStations, apiErr.Code)
+}
+
+func TestTrackingWebhooksAndChanges(t *testing.T) {
+	c, trackingService := newServer(t)
+	ctx := context.Background()
+
+	result, err := c.ReportPositions(ctx, "truck 7", client.Position{Latitude: 1, Longitude: 2}, client.Position{Latitude: 3, Longitude: 4})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Accepted)
+	assert.Equal(t, "truck 7", result.Position.DeviceID)
+	assert.Equal(t, 3.0, result.Position.Latitude)
+
+	since := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	events, err := c.ListEvents(ctx, client.EventOptions{DeviceID: "truck 7", ZoneID: 3, Since: since, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "truck 7", trackingService.query.DeviceID)
+	assert.Equal(t, uint(3), trackingService.query.ZoneID)
+	assert.True(t, since.Equal(*trackingService.query.Since))
+	assert.Equal(t, 10, trackingService.query.Limit)
+
+	subscription, err := c.CreateWebhook(ctx, client.SubscriptionRequest{URL: "https://example.com/hook", EventTypes: []string{"location.created"}})
+	require.NoError(t, err)
+	assert.Equal(t, "generated", subscription.Secret)
+
+	_, err = c.CreateWebhook(ctx, client.SubscriptionRequest{URL: "not a url"})
+	assert.True(t, client.IsValidation(err))
+
+	subscriptions, err := c.ListWebhooks(ctx)
+	require.NoError(t, err)
+	assert.Len(t, subscriptions, 1)
+
+	got, err := c.GetWebhook(ctx, subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, subscription.URL, got.URL)
+
+	deliveries, err := c.ListDeliveries(ctx, subscription.ID, client.DeliveryOptions{Status: client.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, client.DeliveryDead, deliveries[0].Status)
+
+	retried, err := c.RetryDelivery(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, client.DeliveryPending, retried.Status)
+	_, err = c.RetryDelivery(ctx, 8)
+	assert.True(t, client.IsConflict(err))
+
+	require.NoError(t, c.DeleteWebhook(ctx, subscription.ID))
+	assert.True(t, client.IsNotFound(c.DeleteWebhook(ctx, subscription.ID)))
+
+	page, err := c.GetChanges(ctx, client.ChangeOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Changes, 1)
+	assert.JSONEq(t, `{"name":"A"}`, string(page.Changes[0].Payload))
+
+	page, err = c.GetChanges(ctx, client.ChangeOptions{Since: page.NextCursor, Wait: time.Second})
+	require.NoError(t, err)
+	assert.Empty(t, page.Changes)
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	failures := int32(2)
+	status := int32(http.StatusServiceUnavailable)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= atomic.LoadInt32(&failures) {
+			code := int(atomic.LoadInt32(&status))
+			if code == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(code)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	c, err := client.New(ts.URL, client.WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = c.ListGeofences(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "two failures then a success")
+
+	// A 429 is retried even for POST, since the server did not act on it
+	atomic.StoreInt32(&status, http.StatusTooManyRequests)
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.FindAlongRoute(ctx, client.AlongRouteRequest{Polyline: "_p~iF~ps|U"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// Other server errors are not retried for POST, which may have taken effect
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	atomic.StoreInt32(&calls, 0)
+	_, err = c.FindAlongRoute(ctx, client.AlongRouteRequest{Polyline: "_p~iF~ps|U"})
+	var apiErr *client.Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusInternalServerError, apiErr.Status)
+	assert.Equal(t, "Internal Server Error", apiErr.Title)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Retries give up after the configured number
+	atomic.StoreInt32(&status, http.StatusBadGateway)
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&failures, 10)
+	_, err = c.ListGeofences(ctx)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadGateway, apiErr.Status)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// A cancelled context stops waiting for the next attempt
+	slow, err := client.New(ts.URL, client.WithRetries(3, time.Hour, time.Hour))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = slow.ListGeofences(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestNew(t *testing.T) {
+	_, err := client.New("localhost:8080")
+	assert.Error(t, err)
+	_, err = client.New("ftp://example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Problem codes returned by the server; switch on these rather than on titles or details
+const (
+	CodeValidationFailed = "validation_failed"
+	CodeInvalidBody      = "invalid_body"
+	CodeBadRequest       = "bad_request"
+	CodeInvalidCursor    = "invalid_cursor"
+	CodeNotFound         = "not_found"
+	CodeNoLocations      = "no_locations"
+	CodeUnknownStations  = "unknown_stations"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeDuplicateName    = "duplicate_name"
+	CodeDeliveryNotDead  = "delivery_not_dead"
+	CodeInternal         = "internal_error"
+)
+
+// Error is a request the server answered with an error status. When the
+// server sent RFC 7807 problem details they are decoded into the fields;
+// otherwise only Status and Title are set.
+type Error struct {
+	Status    int          `json:"status"`
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors"`
+}
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s", e.Status, e.Title)
+	if e.Code != "" {
+		fmt.Fprintf(&b, " (%s)", e.Code)
+	}
+	if e.Detail != "" {
+		b.WriteString(": " + e.Detail)
+	}
+	for i, field := range e.Errors {
+		if i == 0 {
+			b.WriteString(":")
+		} else {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, " %s %s", field.Field, field.Message)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " [request %s]", e.RequestID)
+	}
+	return b.String()
+}
+
+// IsNotFound reports whether err is a 404 from the server
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a 409 from the server, such as a duplicate name
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsValidation reports whether err is a 400 from the server
+func IsValidation(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsRateLimited reports whether err is a 429 from the server
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// readError consumes an error response and decodes it into an *Error
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	apiErr := &Error{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.Contains(contentType, "json") && json.Unmarshal(body, apiErr) == nil {
+		// Keep the transport status should the body disagree with it
+		apiErr.Status = resp.StatusCode
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return apiErr
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateGeofence creates a geofence
+func (c *Client) CreateGeofence(ctx context.Context, req GeofenceRequest) (*Geofence, error) {
+	var created Geofence
+	if _, err := c.do(ctx, http.MethodPost, "/geofences", nil, req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListGeofences returns every geofence
+func (c *Client) ListGeofences(ctx context.Context) ([]Geofence, error) {
+	var geofences []Geofence
+	if _, err := c.do(ctx, http.MethodGet, "/geofences", nil, nil, &geofences); err != nil {
+		return nil, err
+	}
+	return geofences, nil
+}
+
+// GetGeofence returns the geofence with an ID
+func (c *Client) GetGeofence(ctx context.Context, geofenceID uint) (*Geofence, error) {
+	var found Geofence
+	if _, err := c.do(ctx, http.MethodGet, "/geofences/"+id(geofenceID), nil, nil, &found); err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// UpdateGeofence replaces the geofence with an ID
+func (c *Client) UpdateGeofence(ctx context.Context, geofenceID uint, req GeofenceRequest) (*Geofence, error) {
+	var updated Geofence
+	if _, err := c.do(ctx, http.MethodPut, "/geofences/"+id(geofenceID), nil, req, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteGeofence deletes the geofence with an ID
+func (c *Client) DeleteGeofence(ctx context.Context, geofenceID uint) error {
+	_, err := c.do(ctx, http.MethodDelete, "/geofences/"+id(geofenceID), nil, nil, nil)
+	return err
+}
+
+// ContainingGeofences returns the geofences covering a point
+func (c *Client) ContainingGeofences(ctx context.Context, lat, lng float64) ([]Geofence, error) {
+	query := url.Values{}
+	setPoint(query, Point{Latitude: lat, Longitude: lng})
+
+	var geofences []Geofence
+	if _, err := c.do(ctx, http.MethodGet, "/geofences/contains", query, nil, &geofences); err != nil {
+		return nil, err
+	}
+	return geofences, nil
+}
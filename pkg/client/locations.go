@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ListOptions selects a page of GET /locations. The zero value lists the first page in ID order.
+type ListOptions struct {
+	// Limit is the page size; the server defaults to 100 and allows at most 1000
+	Limit int
+	// Cursor continues from a previous page's NextCursor
+	Cursor string
+	// Sort is one of id, name, created_at, updated_at or distance, prefixed with - for descending order
+	Sort string
+	// Near is required when sorting by distance
+	Near *Point
+	// Fields restricts the fields returned; the others are left zero
+	Fields []string
+	// WithTotal asks for the total number of locations
+	WithTotal bool
+}
+
+// LocationPage is a page of locations
+type LocationPage struct {
+	Locations []Location
+	// NextCursor is empty on the last page
+	NextCursor string
+	// Total is set when the page was requested WithTotal
+	Total *int64
+}
+
+// nextLink extracts the cursor from a Link header pointing at the next page
+var nextLink = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="next"`)
+
+// CreateLocation registers a location
+func (c *Client) CreateLocation(ctx context.Context, req LocationRequest) (*Location, error) {
+	var created Location
+	if _, err := c.do(ctx, http.MethodPost, "/locations", nil, req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListLocations returns one page of locations
+func (c *Client) ListLocations(ctx context.Context, options ListOptions) (*LocationPage, error) {
+	query := url.Values{}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+	if options.Cursor != "" {
+		query.Set("cursor", options.Cursor)
+	}
+	if options.Sort != "" {
+		query.Set("sort", options.Sort)
+	}
+	if options.Near != nil {
+		setPoint(query, *options.Near)
+	}
+	if len(options.Fields) > 0 {
+		query.Set("fields", strings.Join(options.Fields, ","))
+	}
+	if options.WithTotal {
+		query.Set("total", "true")
+	}
+
+	page := &LocationPage{}
+	resp, err := c.do(ctx, http.MethodGet, "/locations", query, nil, &page.Locations)
+	if err != nil {
+		return nil, err
+	}
+
+	if match := nextLink.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		if next, err := url.Parse(match[1]); err == nil {
+			page.NextCursor = next.Query().Get("cursor")
+		}
+	}
+	if total, err := strconv.ParseInt(resp.Header.Get("X-Total-Count"), 10, 64); err == nil {
+		page.Total = &total
+	}
+	return page, nil
+}
+
+// AllLocations follows the cursor through every page of the listing
+func (c *Client) AllLocations(ctx context.Context, options ListOptions) ([]Location, error) {
+	options.WithTotal = false
+
+	var all []Location
+	for {
+		page, err := c.ListLocations(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page.Locations...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		options.Cursor = page.NextCursor
+	}
+}
+
+// GetLocation returns the location with a UUID
+func (c *Client) GetLocation(ctx context.Context, uuid string) (*Location, error) {
+	var found Location
+	if _, err := c.do(ctx, http.MethodGet, "/locations/id/"+escape(uuid), nil, nil, &found); err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// UpdateLocation replaces the location with a UUID
+func (c *Client) UpdateLocation(ctx context.Context, uuid string, req LocationRequest) (*Location, error) {
+	var updated Location
+	if _, err := c.do(ctx, http.MethodPut, "/locations/id/"+escape(uuid), nil, req, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteLocation deletes the location with a UUID
+func (c *Client) DeleteLocation(ctx context.Context, uuid string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/locations/id/"+escape(uuid), nil, nil, nil)
+	return err
+}
+
+// UpdateLocationByName replaces the location with a name
+func (c *Client) UpdateLocationByName(ctx context.Context, name string, req LocationRequest) (*Location, error) {
+	var updated Location
+	if _, err := c.do(ctx, http.MethodPut, "/locations/"+escape(name), nil, req, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteLocationByName deletes the location with a name
+func (c *Client) DeleteLocationByName(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/locations/"+escape(name), nil, nil, nil)
+	return err
+}
+
+// NearestLocation returns the location closest to a point
+func (c *Client) NearestLocation(ctx context.Context, lat, lng float64) (*NearestMatch, error) {
+	query := url.Values{}
+	setPoint(query, Point{Latitude: lat, Longitude: lng})
+
+	var nearest NearestMatch
+	if _, err := c.do(ctx, http.MethodGet, "/locations/nearest", query, nil, &nearest); err != nil {
+		return nil, err
+	}
+	return &nearest, nil
+}
+
+// SearchOptions describes a name search
+type SearchOptions struct {
+	// Query is the text to search for; the last word may be a prefix
+	Query string
+	// Near ranks locations close to a point higher
+	Near *Point
+	// Limit is the number of results; the server defaults to 10 and allows at most 50
+	Limit int
+}
+
+// SearchLocations finds locations by name, tolerating typos, best matches first
+func (c *Client) SearchLocations(ctx context.Context, options SearchOptions) ([]SearchResult, error) {
+	query := url.Values{"q": {options.Query}}
+	if options.Near != nil {
+		setPoint(query, *options.Near)
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+
+	var results []SearchResult
+	if _, err := c.do(ctx, http.MethodGet, "/locations/search", query, nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// FindAlongRoute returns the locations within a corridor around a route, in route order
+func (c *Client) FindAlongRoute(ctx context.Context, req AlongRouteRequest) ([]RouteMatch, error) {
+	var matches []RouteMatch
+	if _, err := c.do(ctx, http.MethodPost, "/locations/along-route", nil, req, &matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func setPoint(query url.Values, point Point) {
+	query.Set("lat", strconv.FormatFloat(point.Latitude, 'f', -1, 64))
+	query.Set("lng", strconv.FormatFloat(point.Longitude, 'f', -1, 64))
+}
@@ -0,0 +1,15 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// OptimizeRoute orders stations into a short route
+func (c *Client) OptimizeRoute(ctx context.Context, req OptimizeRouteRequest) (*OptimizedRoute, error) {
+	var optimized OptimizedRoute
+	if _, err := c.do(ctx, http.MethodPost, "/routes/optimize", nil, req, &optimized); err != nil {
+		return nil, err
+	}
+	return &optimized, nil
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ReportPositions sends positions of a device in one batch
+func (c *Client) ReportPositions(ctx context.Context, deviceID string, positions ...Position) (*IngestResult, error) {
+	if positions == nil {
+		positions = []Position{}
+	}
+
+	var result IngestResult
+	if _, err := c.do(ctx, http.MethodPost, "/devices/"+escape(deviceID)+"/positions", nil, positions, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EventOptions filters zone events; zero fields do not filter
+type EventOptions struct {
+	DeviceID string
+	Type     string
+	ZoneType string
+	ZoneID   uint
+	Since    time.Time
+	Until    time.Time
+	// Limit is at most 1000
+	Limit int
+}
+
+// ListEvents returns zone events, oldest first
+func (c *Client) ListEvents(ctx context.Context, options EventOptions) ([]ZoneEvent, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{"device_id": options.DeviceID, "type": options.Type, "zone_type": options.ZoneType} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if options.ZoneID > 0 {
+		query.Set("zone_id", id(options.ZoneID))
+	}
+	if !options.Since.IsZero() {
+		query.Set("since", options.Since.Format(time.RFC3339))
+	}
+	if !options.Until.IsZero() {
+		query.Set("until", options.Until.Format(time.RFC3339))
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+
+	var events []ZoneEvent
+	if _, err := c.do(ctx, http.MethodGet, "/events", query, nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Location is a registered station
+type Location struct {
+	ID           uint      `json:"id"`
+	UUID         string    `json:"uuid"`
+	Tenant       string    `json:"tenant"`
+	Name         string    `json:"name"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
+	Category     string    `json:"category,omitempty"`
+	RadiusMeters float64   `json:"radius_m,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	DistanceKm   float64   `json:"distance_km,omitempty"`
+}
+
+// LocationRequest is the body of location creates and updates
+type LocationRequest struct {
+	Name         string  `json:"name"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Category     string  `json:"category,omitempty"`
+	RadiusMeters float64 `json:"radius_m,omitempty"`
+}
+
+// Point is a bare pair of coordinates
+type Point struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// NearestMatch is a location and its distance from the queried point
+type NearestMatch struct {
+	Location   Location `json:"location"`
+	DistanceKm float64  `json:"distance_km"`
+}
+
+// SearchResult is a location matching a name search
+type SearchResult struct {
+	Location   Location `json:"location"`
+	Score      float64  `json:"score"`
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+// AlongRouteRequest describes a route to find locations along.
+// Exactly one of Polyline (Google encoded, precision 5) or LineString (GeoJSON) must be set.
+type AlongRouteRequest struct {
+	Polyline   string          `json:"polyline,omitempty"`
+	LineString json.RawMessage `json:"line_string,omitempty"`
+	CorridorKm float64         `json:"corridor_km,omitempty"`
+}
+
+// RouteMatch is a location found within the corridor around a route
+type RouteMatch struct {
+	Location            Location `json:"location"`
+	DistanceFromRouteKm float64  `json:"distance_from_route_km"`
+	AlongRouteKm        float64  `json:"along_route_km"`
+	DetourKm            float64  `json:"detour_km"`
+}
+
+// Geofence shapes
+const (
+	GeofenceCircle  = "circle"
+	GeofencePolygon = "polygon"
+)
+
+// Geofence is a named circle or polygon
+type Geofence struct {
+	ID           uint      `json:"id"`
+	Tenant       string    `json:"tenant"`
+	Name         string    `json:"name"`
+	Kind         string    `json:"kind"`
+	Latitude     float64   `json:"latitude,omitempty"`
+	Longitude    float64   `json:"longitude,omitempty"`
+	RadiusMeters float64   `json:"radius_m,omitempty"`
+	Polygon      []Point   `json:"polygon,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// GeofenceRequest is the body of geofence creates and updates.
+// Circles use Latitude, Longitude and RadiusMeters; polygons use Polygon.
+type GeofenceRequest struct {
+	Name         string  `json:"name"`
+	Kind         string  `json:"kind"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	RadiusMeters float64 `json:"radius_m"`
+	Polygon      []Point `json:"polygon,omitempty"`
+}
+
+// Position is a device position report; RecordedAt defaults to the time it is received
+type Position struct {
+	Latitude   float64    `json:"latitude"`
+	Longitude  float64    `json:"longitude"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+}
+
+// DevicePosition is the latest known position of a device
+type DevicePosition struct {
+	Tenant     string    `json:"tenant"`
+	DeviceID   string    `json:"device_id"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	RecordedAt time.Time `json:"recorded_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ZoneEvent is a device entering, leaving or dwelling in a station radius or geofence
+type ZoneEvent struct {
+	ID         uint      `json:"id"`
+	Tenant     string    `json:"tenant"`
+	DeviceID   string    `json:"device_id"`
+	Type       string    `json:"type"`
+	ZoneType   string    `json:"zone_type"`
+	ZoneID     uint      `json:"zone_id"`
+	ZoneName   string    `json:"zone_name"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	OccurredAt time.Time `json:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IngestResult reports what became of reported positions
+type IngestResult struct {
+	Accepted int             `json:"accepted"`
+	Ignored  int             `json:"ignored"`
+	Position *DevicePosition `json:"position,omitempty"`
+	Events   []ZoneEvent     `json:"events"`
+}
+
+// Subscription is a webhook subscription
+type Subscription struct {
+	ID         uint      `json:"id"`
+	Tenant     string    `json:"tenant"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SubscriptionRequest is the body of a webhook subscription; the server generates Secret when it is empty
+type SubscriptionRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryDead      = "dead"
+)
+
+// Delivery is one attempt sequence to deliver an event to a subscription
+type Delivery struct {
+	ID             uint       `json:"id"`
+	Tenant         string     `json:"tenant"`
+	SubscriptionID uint       `json:"subscription_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      string     `json:"last_error,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Change is one entry of the change feed
+type Change struct {
+	Cursor      string          `json:"cursor"`
+	Aggregate   string          `json:"aggregate"`
+	AggregateID uint            `json:"aggregate_id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ChangePage is a page of the change feed; pass NextCursor as Since to read on
+type ChangePage struct {
+	Changes    []Change `json:"changes"`
+	NextCursor string   `json:"next_cursor"`
+}
+
+// OptimizeRouteRequest selects the stations to visit and where the route starts and ends
+type OptimizeRouteRequest struct {
+	Start     *Point   `json:"start"`
+	Stations  []string `json:"stations"`
+	RoundTrip bool     `json:"round_trip,omitempty"`
+	End       *Point   `json:"end,omitempty"`
+}
+
+// Stop is a point visited by an optimized route
+type Stop struct {
+	Sequence  int     `json:"sequence"`
+	Kind      string  `json:"kind"`
+	Name      string  `json:"name,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Leg is the stretch between two consecutive stops
+type Leg struct {
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	DistanceKm   float64 `json:"distance_km"`
+	CumulativeKm float64 `json:"cumulative_km"`
+}
+
+// OptimizedRoute is the visiting order found for a route request
+type OptimizedRoute struct {
+	Stops           []Stop  `json:"stops"`
+	Legs            []Leg   `json:"legs"`
+	TotalDistanceKm float64 `json:"total_distance_km"`
+	RoundTrip       bool    `json:"round_trip"`
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateWebhook subscribes a URL to event types
+func (c *Client) CreateWebhook(ctx context.Context, req SubscriptionRequest) (*Subscription, error) {
+	var created Subscription
+	if _, err := c.do(ctx, http.MethodPost, "/webhooks", nil, req, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListWebhooks returns every webhook subscription
+func (c *Client) ListWebhooks(ctx context.Context) ([]Subscription, error) {
+	var subscriptions []Subscription
+	if _, err := c.do(ctx, http.MethodGet, "/webhooks", nil, nil, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// GetWebhook returns the webhook subscription with an ID
+func (c *Client) GetWebhook(ctx context.Context, subscriptionID uint) (*Subscription, error) {
+	var found Subscription
+	if _, err := c.do(ctx, http.MethodGet, "/webhooks/"+id(subscriptionID), nil, nil, &found); err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// DeleteWebhook deletes the webhook subscription with an ID
+func (c *Client) DeleteWebhook(ctx context.Context, subscriptionID uint) error {
+	_, err := c.do(ctx, http.MethodDelete, "/webhooks/"+id(subscriptionID), nil, nil, nil)
+	return err
+}
+
+// DeliveryOptions filters the deliveries of a subscription
+type DeliveryOptions struct {
+	// Status is one of DeliveryPending, DeliverySucceeded or DeliveryDead
+	Status string
+	// Limit is at most 1000
+	Limit int
+}
+
+// ListDeliveries returns the deliveries of a webhook subscription, newest first
+func (c *Client) ListDeliveries(ctx context.Context, subscriptionID uint, options DeliveryOptions) ([]Delivery, error) {
+	query := url.Values{}
+	if options.Status != "" {
+		query.Set("status", options.Status)
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+
+	var deliveries []Delivery
+	if _, err := c.do(ctx, http.MethodGet, "/webhooks/"+id(subscriptionID)+"/deliveries", query, nil, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// RetryDelivery queues a dead delivery again
+func (c *Client) RetryDelivery(ctx context.Context, deliveryID uint) (*Delivery, error) {
+	var delivery Delivery
+	if _, err := c.do(ctx, http.MethodPost, "/webhooks/deliveries/"+id(deliveryID)+"/retry", nil, nil, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}